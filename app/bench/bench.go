@@ -0,0 +1,327 @@
+package bench
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/paulmach/orb"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/stats"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+// The name of point-in-polygon queries.
+const QUERY_PIP string = "pip"
+
+// The name of intersects queries.
+const QUERY_INTERSECTS string = "intersects"
+
+// The name of read (by ID) queries.
+const QUERY_READ string = "read"
+
+// query is a struct describing a single query to perform.
+type query struct {
+	kind  string
+	point orb.Point
+	id    string
+}
+
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create application flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flagset, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	if opts.Verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		slog.Debug("Verbose logging enabled")
+	}
+
+	if opts.SpatialDatabaseURI == "" {
+		return fmt.Errorf("Missing -spatial-database-uri flag")
+	}
+
+	if opts.PIPWeight < 0 || opts.IntersectsWeight < 0 || opts.ReadWeight < 0 {
+		return fmt.Errorf("Query weights must not be negative")
+	}
+
+	if opts.PIPWeight+opts.IntersectsWeight+opts.ReadWeight == 0 {
+		return fmt.Errorf("At least one query weight must be greater than zero")
+	}
+
+	if opts.IntersectsWeight > 0 && opts.IntersectsSize <= 0 {
+		return fmt.Errorf("Intersects size must be greater than zero")
+	}
+
+	b, err := sqlite.ParseBoundingBox(opts.BoundingBox)
+
+	if err != nil {
+		return fmt.Errorf("Failed to parse bounding box, %w", err)
+	}
+
+	seed := opts.Seed
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	rnd := rand.New(rand.NewPCG(uint64(seed), 0))
+
+	db, err := database.NewSpatialDatabase(ctx, opts.SpatialDatabaseURI)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create spatial database, %w", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	// Warm up caches and collect the IDs used for read queries
+
+	ids := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for i := 0; i < opts.Warmup; i++ {
+
+		pt := randomPoint(rnd, b)
+
+		rsp, err := db.PointInPolygon(ctx, &pt)
+
+		if err != nil {
+			return fmt.Errorf("Failed to perform warmup query for %v, %w", pt, err)
+		}
+
+		for _, r := range rsp.Results() {
+
+			if !seen[r.Id()] {
+				seen[r.Id()] = true
+				ids = append(ids, r.Id())
+			}
+		}
+	}
+
+	read_weight := opts.ReadWeight
+
+	if read_weight > 0 && len(ids) == 0 {
+		slog.Warn("Warmup queries returned no records, skipping read queries")
+		read_weight = 0
+	}
+
+	total_weight := opts.PIPWeight + opts.IntersectsWeight + read_weight
+
+	if total_weight == 0 {
+		return fmt.Errorf("No queries to perform")
+	}
+
+	// Derive all the queries up front so the same seed always produces the same queries
+
+	queries := make([]*query, opts.Queries)
+
+	for idx := range queries {
+
+		q := &query{
+			point: randomPoint(rnd, b),
+		}
+
+		n := rnd.IntN(total_weight)
+
+		switch {
+		case n < opts.PIPWeight:
+			q.kind = QUERY_PIP
+		case n < opts.PIPWeight+opts.IntersectsWeight:
+			q.kind = QUERY_INTERSECTS
+		default:
+			q.kind = QUERY_READ
+			q.id = ids[rnd.IntN(len(ids))]
+		}
+
+		queries[idx] = q
+	}
+
+	latencies := map[string]*stats.Latencies{
+		QUERY_PIP:        stats.NewLatencies(),
+		QUERY_INTERSECTS: stats.NewLatencies(),
+		QUERY_READ:       stats.NewLatencies(),
+	}
+
+	all := stats.NewLatencies()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var first_err error
+	mu := new(sync.Mutex)
+
+	setError := func(err error) {
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if first_err == nil {
+			first_err = err
+			cancel()
+		}
+	}
+
+	workers := max(opts.Workers, 1)
+
+	query_ch := make(chan *query, workers)
+
+	wg := new(sync.WaitGroup)
+
+	t1 := time.Now()
+
+	for i := 0; i < workers; i++ {
+
+		wg.Go(func() {
+
+			for q := range query_ch {
+
+				if ctx.Err() != nil {
+					continue
+				}
+
+				d, err := performQuery(ctx, db, q, opts.IntersectsSize)
+
+				if err != nil {
+					setError(fmt.Errorf("Failed to perform %s query, %w", q.kind, err))
+					continue
+				}
+
+				latencies[q.kind].Add(d)
+				all.Add(d)
+			}
+		})
+	}
+
+	for _, q := range queries {
+
+		select {
+		case <-ctx.Done():
+		case query_ch <- q:
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	close(query_ch)
+	wg.Wait()
+
+	if first_err != nil {
+		return first_err
+	}
+
+	slog.Debug("Performed queries", "count", all.Count(), "seed", seed, "time", time.Since(t1))
+
+	wr := opts.Writer
+
+	if wr == nil {
+		wr = os.Stdout
+	}
+
+	for _, label := range []string{QUERY_PIP, QUERY_INTERSECTS, QUERY_READ} {
+
+		if latencies[label].Count() == 0 {
+			continue
+		}
+
+		err := latencies[label].Summary().Write(wr, label)
+
+		if err != nil {
+			return fmt.Errorf("Failed to write %s summary, %w", label, err)
+		}
+	}
+
+	err = all.Summary().Write(wr, "all")
+
+	if err != nil {
+		return fmt.Errorf("Failed to write summary, %w", err)
+	}
+
+	return nil
+}
+
+// performQuery performs 'q' against 'db' and returns the time it took to complete.
+func performQuery(ctx context.Context, db database.SpatialDatabase, q *query, intersects_size float64) (time.Duration, error) {
+
+	t1 := time.Now()
+
+	switch q.kind {
+	case QUERY_PIP:
+
+		_, err := db.PointInPolygon(ctx, &q.point)
+
+		if err != nil {
+			return 0, err
+		}
+
+	case QUERY_INTERSECTS:
+
+		b := orb.Bound{
+			Min: orb.Point{q.point.X() - intersects_size/2, q.point.Y() - intersects_size/2},
+			Max: orb.Point{q.point.X() + intersects_size/2, q.point.Y() + intersects_size/2},
+		}
+
+		_, err := db.Intersects(ctx, b.ToPolygon())
+
+		if err != nil {
+			return 0, err
+		}
+
+	case QUERY_READ:
+
+		r, err := db.Read(ctx, q.id)
+
+		if err != nil {
+			return 0, err
+		}
+
+		defer r.Close()
+
+		_, err = io.Copy(io.Discard, r)
+
+		if err != nil {
+			return 0, err
+		}
+
+	default:
+		return 0, fmt.Errorf("Unsupported query type '%s'", q.kind)
+	}
+
+	return time.Since(t1), nil
+}
+
+// randomPoint returns a random coordinate inside 'b'.
+func randomPoint(rnd *rand.Rand, b *orb.Bound) orb.Point {
+
+	x := b.Min.X() + rnd.Float64()*(b.Max.X()-b.Min.X())
+	y := b.Min.Y() + rnd.Float64()*(b.Max.Y()-b.Min.Y())
+
+	return orb.Point{x, y}
+}
@@ -0,0 +1,79 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/generator"
+)
+
+func TestBench(t *testing.T) {
+
+	ctx := context.Background()
+
+	uri := fmt.Sprintf("sqlite://%s?dsn=%s", sqlite.DEFAULT_ENGINE, filepath.Join(t.TempDir(), "bench.db"))
+
+	db, err := sqlite.NewSQLiteSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	g, err := generator.NewGenerator(&generator.Options{Seed: 1, Children: 2, Placetypes: []string{"country", "region"}})
+
+	if err != nil {
+		t.Fatalf("Failed to create generator, %v", err)
+	}
+
+	_, err = generator.IndexDatabase(ctx, db, g)
+
+	if err != nil {
+		t.Fatalf("Failed to index features, %v", err)
+	}
+
+	db.Disconnect(ctx)
+
+	var buf bytes.Buffer
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: uri,
+		Queries:            50,
+		Warmup:             20,
+		Workers:            2,
+		BoundingBox:        "-180,-80,180,80",
+		Seed:               1,
+		PIPWeight:          1,
+		IntersectsWeight:   1,
+		ReadWeight:         1,
+		IntersectsSize:     1.0,
+		Writer:             &buf,
+	}
+
+	err = RunWithOptions(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to run benchmark, %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 summaries, got %d\n%s", len(lines), buf.String())
+	}
+
+	for idx, label := range []string{QUERY_PIP, QUERY_INTERSECTS, QUERY_READ, "all"} {
+
+		if !strings.HasPrefix(lines[idx], label+"\t") || !strings.Contains(lines[idx], "p99=") {
+			t.Fatalf("Unexpected summary for %s: %s", label, lines[idx])
+		}
+	}
+
+	if !strings.Contains(lines[3], "count=50\t") {
+		t.Fatalf("Expected 50 queries, got %s", lines[3])
+	}
+}
@@ -0,0 +1,60 @@
+package bench
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+var spatial_database_uri string
+
+var queries int
+var warmup int
+var workers int
+
+var bbox string
+var seed int64
+
+var pip_weight int
+var intersects_weight int
+var read_weight int
+var intersects_size float64
+
+var verbose bool
+
+func DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("bench")
+
+	available_databases := database.Schemes()
+	desc_databases := fmt.Sprintf("A valid whosonfirst/go-whosonfirst-spatial/data.SpatialDatabase URI. options are: %s", available_databases)
+
+	fs.StringVar(&spatial_database_uri, "spatial-database-uri", "", desc_databases)
+
+	fs.IntVar(&queries, "queries", 1000, "The number of (timed) queries to perform.")
+	fs.IntVar(&warmup, "warmup", 100, "The number of (untimed) point-in-polygon queries to perform before timing starts. The IDs of the records they return are used for read queries.")
+	fs.IntVar(&workers, "workers", 1, "The number of queries to perform concurrently.")
+
+	fs.StringVar(&bbox, "bbox", "-180,-90,180,90", "A comma-separated bounding box (minx,miny,maxx,maxy) from which random query coordinates are chosen.")
+	fs.Int64Var(&seed, "seed", 0, "The seed used to choose random queries and coordinates. If 0 the current time is used.")
+
+	fs.IntVar(&pip_weight, "pip-weight", 80, "The relative weight of point-in-polygon queries in the query mix.")
+	fs.IntVar(&intersects_weight, "intersects-weight", 15, "The relative weight of intersects queries in the query mix.")
+	fs.IntVar(&read_weight, "read-weight", 5, "The relative weight of read (by ID) queries in the query mix.")
+	fs.Float64Var(&intersects_size, "intersects-size", 0.01, "The width, in decimal degrees, of the square, centered on a random coordinate, used for intersects queries.")
+
+	fs.BoolVar(&verbose, "verbose", false, "Enable verbose (debug) logging.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Perform a random mix of point-in-polygon, intersects and read queries against a spatial database and report latency percentiles for each type of query.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Valid options are:\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs, nil
+}
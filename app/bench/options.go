@@ -0,0 +1,53 @@
+package bench
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+type RunOptions struct {
+	SpatialDatabaseURI string  `json:"spatial_database_uri"`
+	Queries            int     `json:"queries"`
+	Warmup             int     `json:"warmup"`
+	Workers            int     `json:"workers"`
+	BoundingBox        string  `json:"bbox"`
+	Seed               int64   `json:"seed"`
+	PIPWeight          int     `json:"pip_weight"`
+	IntersectsWeight   int     `json:"intersects_weight"`
+	ReadWeight         int     `json:"read_weight"`
+	IntersectsSize     float64 `json:"intersects_size"`
+	// Where latency summaries are written. Default is STDOUT.
+	Writer  io.Writer `json:"-"`
+	Verbose bool      `json:"verbose"`
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	flagset.Parse(fs)
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WHOSONFIRST")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set flags from environment variables, %w", err)
+	}
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: spatial_database_uri,
+		Queries:            queries,
+		Warmup:             warmup,
+		Workers:            workers,
+		BoundingBox:        bbox,
+		Seed:               seed,
+		PIPWeight:          pip_weight,
+		IntersectsWeight:   intersects_weight,
+		ReadWeight:         read_weight,
+		IntersectsSize:     intersects_size,
+		Verbose:            verbose,
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,106 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create application flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flagset, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	if opts.Verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		slog.Debug("Verbose logging enabled")
+	}
+
+	if opts.SpatialDatabaseURI == "" {
+		return fmt.Errorf("Missing -spatial-database-uri flag")
+	}
+
+	db, err := database.NewSpatialDatabase(ctx, opts.SpatialDatabaseURI)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create spatial database, %w", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db, ok := db.(*sqlite.SQLiteSpatialDatabase)
+
+	if !ok {
+		return fmt.Errorf("Spatial database URI must be a single sqlite:// database")
+	}
+
+	problems, err := sqlite_db.Validate(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to validate database, %w", err)
+	}
+
+	slog.Debug("Validated database", "problems", len(problems))
+
+	if opts.Repair && len(problems) > 0 {
+
+		unrepaired, err := sqlite_db.Repair(ctx, problems)
+
+		if err != nil {
+			return fmt.Errorf("Failed to repair database, %w", err)
+		}
+
+		slog.Info("Repaired database", "problems", len(problems), "repaired", len(problems)-len(unrepaired))
+
+		// Validate the database again since repairs (specifically indexing records again) may
+		// have fixed other problems or revealed new ones.
+
+		problems, err = sqlite_db.Validate(ctx)
+
+		if err != nil {
+			return fmt.Errorf("Failed to validate database after repair, %w", err)
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+
+	for _, p := range problems {
+
+		err := enc.Encode(p)
+
+		if err != nil {
+			return fmt.Errorf("Failed to encode problem, %w", err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Database has %d problem(s)", len(problems))
+	}
+
+	return nil
+}
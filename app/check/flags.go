@@ -0,0 +1,33 @@
+package check
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+var spatial_database_uri string
+var repair bool
+var verbose bool
+
+func DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("check")
+
+	fs.StringVar(&spatial_database_uri, "spatial-database-uri", "", "A valid sqlite:// spatial database URI.")
+	fs.BoolVar(&repair, "repair", false, "Attempt to repair any problems that are found.")
+	fs.BoolVar(&verbose, "verbose", false, "Enable verbose (debug) logging.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Check a SQLite spatial database for inconsistencies between its rtree, spr and geojson tables and optionally repair them.\n")
+		fmt.Fprintf(os.Stderr, "Problems are written to STDOUT as line-delimited JSON. If any problems remain the tool exits with a non-zero status.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Valid options are:\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs, nil
+}
@@ -0,0 +1,438 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+)
+
+// The name of point-in-polygon queries in a report.
+const QUERY_PIP string = "pip"
+
+// The name of intersects queries in a report.
+const QUERY_INTERSECTS string = "intersects"
+
+// report is a struct describing the differences between the results of the queries for each sample in two databases.
+type report struct {
+	// The number of sample coordinates queried.
+	Samples int `json:"samples"`
+	// The number of sample queries whose results differ.
+	Changed int `json:"changed"`
+	// The number of records added, removed and changed by placetype.
+	Placetypes map[string]*placetypeSummary `json:"placetypes"`
+	// The differences for each sample query.
+	Diffs []*sampleDiff `json:"diffs"`
+}
+
+// placetypeSummary is a struct containing the number of records added, removed and changed for a placetype.
+type placetypeSummary struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+}
+
+// sampleDiff is a struct describing the differences between the results of a single query in two databases.
+type sampleDiff struct {
+	// The position of the sample in the set of samples.
+	Index     int     `json:"index"`
+	Query     string  `json:"query"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Records returned by the new database but not the old database.
+	Added []*resultDiff `json:"added"`
+	// Records returned by the old database but not the new database.
+	Removed []*resultDiff `json:"removed"`
+	// Records returned by both databases whose name, placetype or last modified time differ.
+	Changed []*resultDiff `json:"changed"`
+}
+
+// resultDiff is a struct describing a record in a `sampleDiff`.
+type resultDiff struct {
+	Id           string `json:"id"`
+	Name         string `json:"name"`
+	Placetype    string `json:"placetype"`
+	LastModified int64  `json:"lastmodified"`
+	// The last modified time of the record in the old database. Only assigned for changed records.
+	PreviousLastModified int64 `json:"previous_lastmodified,omitempty"`
+}
+
+// sample is a struct containing a sample coordinate and its position in the set of samples.
+type sample struct {
+	index int
+	point orb.Point
+}
+
+// query is a function which performs a spatial query for a sample coordinate.
+type query func(context.Context, database.SpatialDatabase, orb.Point, spatial.Filter) (spr.StandardPlacesResults, error)
+
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create application flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flagset, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	if opts.Verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		slog.Debug("Verbose logging enabled")
+	}
+
+	if opts.OldDatabaseURI == "" {
+		return fmt.Errorf("Missing -old-database-uri flag")
+	}
+
+	if opts.NewDatabaseURI == "" {
+		return fmt.Errorf("Missing -new-database-uri flag")
+	}
+
+	samples_iter, err := samples(opts)
+
+	if err != nil {
+		return err
+	}
+
+	spr_filter, err := filter.NewSPRFilterFromQuery(opts.Filters)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create SPR filter, %w", err)
+	}
+
+	old_db, err := database.NewSpatialDatabase(ctx, opts.OldDatabaseURI)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create old spatial database, %w", err)
+	}
+
+	defer old_db.Disconnect(ctx)
+
+	new_db, err := database.NewSpatialDatabase(ctx, opts.NewDatabaseURI)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new spatial database, %w", err)
+	}
+
+	defer new_db.Disconnect(ctx)
+
+	queries := map[string]query{
+		QUERY_PIP: pointInPolygon,
+	}
+
+	if opts.Intersects {
+
+		if opts.IntersectsSize <= 0 {
+			return fmt.Errorf("Intersects size must be greater than zero")
+		}
+
+		queries[QUERY_INTERSECTS] = intersectsQuery(opts.IntersectsSize)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := max(opts.Workers, 1)
+
+	var first_err error
+	mu := new(sync.Mutex)
+
+	setError := func(err error) {
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if first_err == nil {
+			first_err = err
+			cancel()
+		}
+	}
+
+	rpt := &report{
+		Placetypes: make(map[string]*placetypeSummary),
+		Diffs:      make([]*sampleDiff, 0),
+	}
+
+	addDiff := func(d *sampleDiff) {
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		changed := len(d.Added) > 0 || len(d.Removed) > 0 || len(d.Changed) > 0
+
+		if changed {
+			rpt.Changed += 1
+		}
+
+		for _, r := range d.Added {
+			placetypeCounts(rpt, r.Placetype).Added += 1
+		}
+
+		for _, r := range d.Removed {
+			placetypeCounts(rpt, r.Placetype).Removed += 1
+		}
+
+		for _, r := range d.Changed {
+			placetypeCounts(rpt, r.Placetype).Changed += 1
+		}
+
+		if changed || opts.IncludeUnchanged {
+			rpt.Diffs = append(rpt.Diffs, d)
+		}
+	}
+
+	t1 := time.Now()
+
+	sample_ch := make(chan *sample, workers)
+
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < workers; i++ {
+
+		wg.Go(func() {
+
+			for s := range sample_ch {
+
+				if ctx.Err() != nil {
+					continue
+				}
+
+				for name, q := range queries {
+
+					d, err := diffSample(ctx, old_db, new_db, q, s, spr_filter)
+
+					if err != nil {
+						setError(fmt.Errorf("Failed to perform %s query for %v, %w", name, s.point, err))
+						break
+					}
+
+					d.Query = name
+					addDiff(d)
+				}
+			}
+		})
+	}
+
+	idx := 0
+
+	for pt, err := range samples_iter {
+
+		if err != nil {
+			setError(fmt.Errorf("Failed to derive samples, %w", err))
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+		case sample_ch <- &sample{index: idx, point: pt}:
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		idx += 1
+	}
+
+	close(sample_ch)
+	wg.Wait()
+
+	if first_err != nil {
+		return first_err
+	}
+
+	rpt.Samples = idx
+
+	slices.SortFunc(rpt.Diffs, func(a *sampleDiff, b *sampleDiff) int {
+
+		if a.Index != b.Index {
+			return a.Index - b.Index
+		}
+
+		if a.Query < b.Query {
+			return -1
+		}
+
+		if a.Query > b.Query {
+			return 1
+		}
+
+		return 0
+	})
+
+	slog.Debug("Compared samples", "count", rpt.Samples, "changed", rpt.Changed, "time", time.Since(t1))
+
+	wr := opts.Writer
+
+	if wr == nil {
+		wr = os.Stdout
+	}
+
+	enc := json.NewEncoder(wr)
+	enc.SetIndent("", "  ")
+
+	err = enc.Encode(rpt)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode report, %w", err)
+	}
+
+	return nil
+}
+
+// diffSample performs 'q' for 's' against 'old_db' and 'new_db' and returns the differences between their results.
+func diffSample(ctx context.Context, old_db database.SpatialDatabase, new_db database.SpatialDatabase, q query, s *sample, f spatial.Filter) (*sampleDiff, error) {
+
+	old_rsp, err := q(ctx, old_db, s.point, f)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query old database, %w", err)
+	}
+
+	new_rsp, err := q(ctx, new_db, s.point, f)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query new database, %w", err)
+	}
+
+	old_results := resultsById(old_rsp)
+	new_results := resultsById(new_rsp)
+
+	d := &sampleDiff{
+		Index:     s.index,
+		Latitude:  s.point.Y(),
+		Longitude: s.point.X(),
+		Added:     make([]*resultDiff, 0),
+		Removed:   make([]*resultDiff, 0),
+		Changed:   make([]*resultDiff, 0),
+	}
+
+	for _, id := range sortedKeys(new_results) {
+
+		new_s := new_results[id]
+		old_s, exists := old_results[id]
+
+		if !exists {
+			d.Added = append(d.Added, newResultDiff(new_s))
+			continue
+		}
+
+		if old_s.LastModified() != new_s.LastModified() || old_s.Name() != new_s.Name() || old_s.Placetype() != new_s.Placetype() {
+			r := newResultDiff(new_s)
+			r.PreviousLastModified = old_s.LastModified()
+			d.Changed = append(d.Changed, r)
+		}
+	}
+
+	for _, id := range sortedKeys(old_results) {
+
+		_, exists := new_results[id]
+
+		if !exists {
+			d.Removed = append(d.Removed, newResultDiff(old_results[id]))
+		}
+	}
+
+	return d, nil
+}
+
+// pointInPolygon performs a point-in-polygon query for 'pt' against 'db'.
+func pointInPolygon(ctx context.Context, db database.SpatialDatabase, pt orb.Point, f spatial.Filter) (spr.StandardPlacesResults, error) {
+	return db.PointInPolygon(ctx, &pt, f)
+}
+
+// intersectsQuery returns a `query` function which performs an intersects query against a square, 'size' degrees
+// wide, centered on each sample coordinate.
+func intersectsQuery(size float64) query {
+
+	return func(ctx context.Context, db database.SpatialDatabase, pt orb.Point, f spatial.Filter) (spr.StandardPlacesResults, error) {
+
+		b := orb.Bound{
+			Min: orb.Point{pt.X() - size/2, pt.Y() - size/2},
+			Max: orb.Point{pt.X() + size/2, pt.Y() + size/2},
+		}
+
+		return db.Intersects(ctx, b.ToPolygon(), f)
+	}
+}
+
+// resultsById returns the results in 'rsp' keyed by their ID. If there are multiple results for an ID (for example
+// alternate geometries) only the first is included.
+func resultsById(rsp spr.StandardPlacesResults) map[string]spr.StandardPlacesResult {
+
+	results := make(map[string]spr.StandardPlacesResult)
+
+	for _, s := range rsp.Results() {
+
+		_, exists := results[s.Id()]
+
+		if !exists {
+			results[s.Id()] = s
+		}
+	}
+
+	return results
+}
+
+// sortedKeys returns the keys of 'm' in sorted order.
+func sortedKeys(m map[string]spr.StandardPlacesResult) []string {
+
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+	return keys
+}
+
+// newResultDiff returns a `resultDiff` instance for 's'.
+func newResultDiff(s spr.StandardPlacesResult) *resultDiff {
+
+	return &resultDiff{
+		Id:           s.Id(),
+		Name:         s.Name(),
+		Placetype:    s.Placetype(),
+		LastModified: s.LastModified(),
+	}
+}
+
+// placetypeCounts returns the `placetypeSummary` instance for 'pt' in 'rpt', creating it if necessary.
+func placetypeCounts(rpt *report, pt string) *placetypeSummary {
+
+	counts, exists := rpt.Placetypes[pt]
+
+	if !exists {
+		counts = &placetypeSummary{}
+		rpt.Placetypes[pt] = counts
+	}
+
+	return counts
+}
@@ -0,0 +1,129 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/sjson"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/internal/testdatabase"
+)
+
+// A neighbourhood inside the locality of Quebec (101737491).
+const diff_neighbourhood string = `{"type":"Feature","id":1,"properties":{"wof:id":1,"wof:name":"Test","wof:placetype":"neighbourhood","wof:parent_id":101737491,"wof:hierarchy":[],"wof:country":"CA","wof:repo":"whosonfirst-data-admin-ca","wof:lastmodified":1,"geom:latitude":46.8525,"geom:longitude":-71.3305},"bbox":[-71.34,46.84,-71.32,46.86],"geometry":{"type":"Polygon","coordinates":[[[-71.34,46.84],[-71.32,46.84],[-71.32,46.86],[-71.34,46.86],[-71.34,46.84]]]}}`
+
+func TestDiff(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	old_path := filepath.Join(root, "old.db")
+	new_path := filepath.Join(root, "new.db")
+	csv_path := filepath.Join(root, "samples.csv")
+
+	body, err := os.ReadFile("../../fixtures/101737491.geojson")
+
+	if err != nil {
+		t.Fatalf("Failed to read fixture, %v", err)
+	}
+
+	updated_body, err := sjson.SetBytes(body, "properties.wof:lastmodified", 1)
+
+	if err != nil {
+		t.Fatalf("Failed to update last modified time, %v", err)
+	}
+
+	testdatabase.Create(t, old_path, body)
+	testdatabase.Create(t, new_path, updated_body, []byte(diff_neighbourhood))
+
+	err = os.WriteFile(csv_path, []byte("name,latitude,longitude\nquebec,46.852675,-71.330873\nnowhere,40.0,-40.0\n"), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write samples, %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	opts := &RunOptions{
+		OldDatabaseURI: fmt.Sprintf("sqlite://%s?dsn=%s", sqlite.DEFAULT_ENGINE, old_path),
+		NewDatabaseURI: fmt.Sprintf("sqlite://%s?dsn=%s", sqlite.DEFAULT_ENGINE, new_path),
+		SampleMode:     SAMPLE_CSV,
+		CSVPath:        csv_path,
+		Intersects:     true,
+		IntersectsSize: 0.001,
+		Workers:        2,
+		Writer:         &buf,
+	}
+
+	err = RunWithOptions(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to diff databases, %v", err)
+	}
+
+	var rpt report
+
+	err = json.Unmarshal(buf.Bytes(), &rpt)
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal report, %v", err)
+	}
+
+	if rpt.Samples != 2 {
+		t.Fatalf("Expected 2 samples, got %d", rpt.Samples)
+	}
+
+	// One pip and one intersects query for the first sample
+
+	if rpt.Changed != 2 || len(rpt.Diffs) != 2 {
+		t.Fatalf("Expected 2 changed queries, got %d (%d diffs)", rpt.Changed, len(rpt.Diffs))
+	}
+
+	for _, d := range rpt.Diffs {
+
+		if d.Index != 0 {
+			t.Fatalf("Unexpected sample index %d", d.Index)
+		}
+
+		if len(d.Added) != 1 || d.Added[0].Id != "1" {
+			t.Fatalf("Expected neighbourhood to be added for %s query", d.Query)
+		}
+
+		if len(d.Changed) != 1 || d.Changed[0].Id != "101737491" {
+			t.Fatalf("Expected locality to be changed for %s query", d.Query)
+		}
+
+		if len(d.Removed) != 0 {
+			t.Fatalf("Expected no removed records for %s query", d.Query)
+		}
+	}
+
+	if rpt.Placetypes["neighbourhood"].Added != 2 || rpt.Placetypes["locality"].Changed != 2 {
+		t.Fatalf("Unexpected placetype counts")
+	}
+}
+
+func TestGridSamples(t *testing.T) {
+
+	b, err := sqlite.ParseBoundingBox("0,0,1,0.5")
+
+	if err != nil {
+		t.Fatalf("Failed to parse bounding box, %v", err)
+	}
+
+	count := 0
+
+	for range gridSamples(b, 0.25) {
+		count += 1
+	}
+
+	if count != 15 {
+		t.Fatalf("Expected 15 grid samples, got %d", count)
+	}
+}
@@ -0,0 +1,87 @@
+package diff
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/multi"
+)
+
+var old_database_uri string
+var new_database_uri string
+
+var sample_mode string
+var csv_path string
+var bbox string
+var grid_step float64
+var random_count int
+var random_seed int64
+
+var intersects bool
+var intersects_size float64
+
+var workers int
+var include_unchanged bool
+
+var placetypes multi.MultiString
+var geometries string
+var alt_geoms multi.MultiString
+var inception string
+var cessation string
+
+var is_current multi.MultiString
+var is_ceased multi.MultiString
+var is_deprecated multi.MultiString
+var is_superseded multi.MultiString
+var is_superseding multi.MultiString
+
+var verbose bool
+
+func DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("diff")
+
+	fs.StringVar(&old_database_uri, "old-database-uri", "", "A valid whosonfirst/go-whosonfirst-spatial URI (for example 'sqlite://sqlite3?dsn=/usr/local/data/ca-20251001.db') for the current database.")
+	fs.StringVar(&new_database_uri, "new-database-uri", "", "A valid whosonfirst/go-whosonfirst-spatial URI (for example 'sqlite://sqlite3?dsn=/usr/local/data/ca-20251002.db') for the database being compared to the current database.")
+
+	fs.StringVar(&sample_mode, "sample-mode", SAMPLE_GRID, "How sample coordinates are derived. Valid options are: csv (read from the file defined by -csv), grid (a regular grid over -bbox spaced -grid-step degrees apart), random (-random-count points inside -bbox).")
+	fs.StringVar(&csv_path, "csv", "", "The path to a CSV file containing sample coordinates. The file must have a header row with 'latitude' and 'longitude' (or 'lat' and 'lon') columns. If '-' then data will be read from STDIN.")
+	fs.StringVar(&bbox, "bbox", "", "A comma-separated bounding box (minx,miny,maxx,maxy) used to derive grid or random sample coordinates.")
+	fs.Float64Var(&grid_step, "grid-step", 0.1, "The distance, in decimal degrees, between grid sample coordinates.")
+	fs.IntVar(&random_count, "random-count", 1000, "The number of random sample coordinates to derive.")
+	fs.Int64Var(&random_seed, "random-seed", 0, "The seed used to derive random sample coordinates. If 0 the current time is used.")
+
+	fs.BoolVar(&intersects, "intersects", false, "Also compare the results of intersects queries for a square, -intersects-size degrees wide, centered on each sample coordinate.")
+	fs.Float64Var(&intersects_size, "intersects-size", 0.01, "The width, in decimal degrees, of the square used for intersects queries.")
+
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "The number of sample coordinates to query in parallel.")
+	fs.BoolVar(&include_unchanged, "include-unchanged", false, "Include samples whose results are the same in both databases in the report.")
+
+	fs.Var(&placetypes, "placetype", "One or more place types to filter results by.")
+	fs.StringVar(&geometries, "geometries", "all", "Valid options are: all, alt, default.")
+	fs.Var(&alt_geoms, "alternate-geometry", "One or more alternate geometry labels (wof:alt_label) values to filter results by.")
+	fs.StringVar(&inception, "inception", "", "A valid EDTF date string.")
+	fs.StringVar(&cessation, "cessation", "", "A valid EDTF date string.")
+
+	fs.Var(&is_current, "is-current", "One or more existential flags (-1, 0, 1) to filter results by.")
+	fs.Var(&is_ceased, "is-ceased", "One or more existential flags (-1, 0, 1) to filter results by.")
+	fs.Var(&is_deprecated, "is-deprecated", "One or more existential flags (-1, 0, 1) to filter results by.")
+	fs.Var(&is_superseded, "is-superseded", "One or more existential flags (-1, 0, 1) to filter results by.")
+	fs.Var(&is_superseding, "is-superseding", "One or more existential flags (-1, 0, 1) to filter results by.")
+
+	fs.BoolVar(&verbose, "verbose", false, "Enable verbose (debug) logging.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Compare the results of point-in-polygon (and optionally intersects) queries for a set of sample coordinates between two spatial databases.\n")
+		fmt.Fprintf(os.Stderr, "A report of the records added, removed and changed for each sample, and summary counts by placetype, is written to STDOUT as JSON.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Valid options are:\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs, nil
+}
@@ -0,0 +1,81 @@
+package diff
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+type RunOptions struct {
+	OldDatabaseURI string  `json:"old_database_uri"`
+	NewDatabaseURI string  `json:"new_database_uri"`
+	SampleMode     string  `json:"sample_mode"`
+	CSVPath        string  `json:"csv,omitempty"`
+	BoundingBox    string  `json:"bbox,omitempty"`
+	GridStep       float64 `json:"grid_step"`
+	RandomCount    int     `json:"random_count"`
+	RandomSeed     int64   `json:"random_seed"`
+	Intersects     bool    `json:"intersects"`
+	IntersectsSize float64 `json:"intersects_size"`
+	Workers        int     `json:"workers"`
+	// Include samples whose results are the same in both databases in the report.
+	IncludeUnchanged bool `json:"include_unchanged"`
+	// SPR filter criteria, as defined by `whosonfirst/go-whosonfirst-spatial/filter.NewSPRFilterFromQuery`.
+	Filters url.Values `json:"filters,omitempty"`
+	// Where the report is written. Default is STDOUT.
+	Writer  io.Writer `json:"-"`
+	Verbose bool      `json:"verbose"`
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	flagset.Parse(fs)
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WHOSONFIRST")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set flags from environment variables, %w", err)
+	}
+
+	filters := url.Values{
+		"placetype":          placetypes,
+		"geometries":         []string{geometries},
+		"alternate_geometry": alt_geoms,
+		"is_current":         is_current,
+		"is_ceased":          is_ceased,
+		"is_deprecated":      is_deprecated,
+		"is_superseded":      is_superseded,
+		"is_superseding":     is_superseding,
+	}
+
+	if inception != "" {
+		filters.Set("inception_date", inception)
+	}
+
+	if cessation != "" {
+		filters.Set("cessation_date", cessation)
+	}
+
+	opts := &RunOptions{
+		OldDatabaseURI:   old_database_uri,
+		NewDatabaseURI:   new_database_uri,
+		SampleMode:       sample_mode,
+		CSVPath:          csv_path,
+		BoundingBox:      bbox,
+		GridStep:         grid_step,
+		RandomCount:      random_count,
+		RandomSeed:       random_seed,
+		Intersects:       intersects,
+		IntersectsSize:   intersects_size,
+		Workers:          workers,
+		IncludeUnchanged: include_unchanged,
+		Filters:          filters,
+		Verbose:          verbose,
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,198 @@
+package diff
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+)
+
+// Read sample coordinates from a CSV file.
+const SAMPLE_CSV string = "csv"
+
+// Derive sample coordinates from a regular grid over a bounding box.
+const SAMPLE_GRID string = "grid"
+
+// Derive sample coordinates at random from inside a bounding box.
+const SAMPLE_RANDOM string = "random"
+
+// samples returns an iterator of the sample coordinates defined by 'opts'.
+func samples(opts *RunOptions) (iter.Seq2[orb.Point, error], error) {
+
+	switch opts.SampleMode {
+	case SAMPLE_CSV:
+
+		if opts.CSVPath == "" {
+			return nil, fmt.Errorf("Missing -csv flag")
+		}
+
+		return csvSamples(opts.CSVPath), nil
+
+	case SAMPLE_GRID, SAMPLE_RANDOM:
+
+		if opts.BoundingBox == "" {
+			return nil, fmt.Errorf("Missing -bbox flag")
+		}
+
+		b, err := sqlite.ParseBoundingBox(opts.BoundingBox)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse bounding box, %w", err)
+		}
+
+		if opts.SampleMode == SAMPLE_RANDOM {
+			return randomSamples(b, opts.RandomCount, opts.RandomSeed), nil
+		}
+
+		if opts.GridStep <= 0 {
+			return nil, fmt.Errorf("Grid step must be greater than zero")
+		}
+
+		return gridSamples(b, opts.GridStep), nil
+
+	default:
+		return nil, fmt.Errorf("Invalid or unsupported sample mode '%s'", opts.SampleMode)
+	}
+}
+
+// csvSamples returns an iterator of the coordinates in the CSV file 'path'.
+func csvSamples(path string) iter.Seq2[orb.Point, error] {
+
+	return func(yield func(orb.Point, error) bool) {
+
+		var r io.Reader
+
+		if path == "-" {
+			r = os.Stdin
+		} else {
+
+			fh, err := os.Open(path)
+
+			if err != nil {
+				yield(orb.Point{}, fmt.Errorf("Failed to open %s, %w", path, err))
+				return
+			}
+
+			defer fh.Close()
+			r = fh
+		}
+
+		csv_r := csv.NewReader(r)
+
+		header, err := csv_r.Read()
+
+		if err != nil {
+			yield(orb.Point{}, fmt.Errorf("Failed to read CSV header, %w", err))
+			return
+		}
+
+		lat_idx := -1
+		lon_idx := -1
+
+		for idx, col := range header {
+
+			switch strings.ToLower(strings.TrimSpace(col)) {
+			case "latitude", "lat":
+				lat_idx = idx
+			case "longitude", "lon", "lng":
+				lon_idx = idx
+			}
+		}
+
+		if lat_idx == -1 || lon_idx == -1 {
+			yield(orb.Point{}, fmt.Errorf("CSV header is missing latitude or longitude column"))
+			return
+		}
+
+		for {
+
+			row, err := csv_r.Read()
+
+			if err == io.EOF {
+				return
+			}
+
+			if err != nil {
+				yield(orb.Point{}, fmt.Errorf("Failed to read CSV row, %w", err))
+				return
+			}
+
+			lat, err := strconv.ParseFloat(strings.TrimSpace(row[lat_idx]), 64)
+
+			if err != nil {
+				yield(orb.Point{}, fmt.Errorf("Invalid latitude '%s', %w", row[lat_idx], err))
+				return
+			}
+
+			lon, err := strconv.ParseFloat(strings.TrimSpace(row[lon_idx]), 64)
+
+			if err != nil {
+				yield(orb.Point{}, fmt.Errorf("Invalid longitude '%s', %w", row[lon_idx], err))
+				return
+			}
+
+			if !yield(orb.Point{lon, lat}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// gridSamples returns an iterator of coordinates spaced 'step' degrees apart inside 'b'.
+func gridSamples(b *orb.Bound, step float64) iter.Seq2[orb.Point, error] {
+
+	return func(yield func(orb.Point, error) bool) {
+
+		cols := int(math.Floor((b.Max.X()-b.Min.X())/step)) + 1
+		rows := int(math.Floor((b.Max.Y()-b.Min.Y())/step)) + 1
+
+		for y := 0; y < rows; y++ {
+
+			for x := 0; x < cols; x++ {
+
+				pt := orb.Point{
+					b.Min.X() + float64(x)*step,
+					b.Min.Y() + float64(y)*step,
+				}
+
+				if !yield(pt, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// randomSamples returns an iterator of 'count' random coordinates inside 'b' derived using 'seed'.
+func randomSamples(b *orb.Bound, count int, seed int64) iter.Seq2[orb.Point, error] {
+
+	return func(yield func(orb.Point, error) bool) {
+
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+
+		rnd := rand.New(rand.NewPCG(uint64(seed), uint64(seed)))
+
+		for i := 0; i < count; i++ {
+
+			pt := orb.Point{
+				b.Min.X() + rnd.Float64()*(b.Max.X()-b.Min.X()),
+				b.Min.Y() + rnd.Float64()*(b.Max.Y()-b.Min.Y()),
+			}
+
+			if !yield(pt, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-iterate/v3"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	_ "github.com/whosonfirst/go-writer-featurecollection/v3"
+	"github.com/whosonfirst/go-writer/v3"
+)
+
+// Export records as a single GeoJSON FeatureCollection.
+const FORMAT_FEATURECOLLECTION string = "featurecollection"
+
+// Export records as line-delimited GeoJSON.
+const FORMAT_GEOJSONL string = "geojsonl"
+
+// Export records to their Who's On First relative paths (for example "101/737/491/101737491.geojson").
+const FORMAT_DIRECTORY string = "directory"
+
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create application flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flagset, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	if opts.Verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		slog.Debug("Verbose logging enabled")
+	}
+
+	if opts.SpatialDatabaseURI == "" {
+		return fmt.Errorf("Missing -spatial-database-uri flag")
+	}
+
+	iterator_uri := iteratorURI(opts)
+
+	it, err := iterate.NewIterator(ctx, iterator_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create iterator, %w", err)
+	}
+
+	defer it.Close()
+
+	writer_uri := opts.WriterURI
+
+	switch opts.Format {
+	case FORMAT_FEATURECOLLECTION:
+
+		q := url.Values{}
+		q.Set("writer", writer_uri)
+
+		writer_uri = fmt.Sprintf("featurecollection://?%s", q.Encode())
+
+	case FORMAT_GEOJSONL, FORMAT_DIRECTORY:
+		// pass
+	default:
+		return fmt.Errorf("Invalid or unsupported format '%s'", opts.Format)
+	}
+
+	wr, err := writer.NewWriter(ctx, writer_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create writer, %w", err)
+	}
+
+	t1 := time.Now()
+	count := 0
+
+	for rec, err := range it.Iterate(ctx, opts.SpatialDatabaseURI) {
+
+		if err != nil {
+			return fmt.Errorf("Failed to iterate records, %w", err)
+		}
+
+		err = writeRecord(ctx, wr, opts.Format, rec)
+		rec.Body.Close()
+
+		if err != nil {
+			return fmt.Errorf("Failed to write %s, %w", rec.Path, err)
+		}
+
+		count += 1
+	}
+
+	err = wr.Close(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to close writer, %w", err)
+	}
+
+	slog.Debug("Exported records", "count", count, "time", time.Since(t1))
+	return nil
+}
+
+// writeRecord writes 'rec' to 'wr' in the format defined by 'format'.
+func writeRecord(ctx context.Context, wr writer.Writer, format string, rec *iterate.Record) error {
+
+	switch format {
+	case FORMAT_GEOJSONL:
+
+		body, err := io.ReadAll(rec.Body)
+
+		if err != nil {
+			return fmt.Errorf("Failed to read body, %w", err)
+		}
+
+		var buf bytes.Buffer
+
+		err = json.Compact(&buf, body)
+
+		if err != nil {
+			return fmt.Errorf("Failed to compact body, %w", err)
+		}
+
+		buf.WriteString("\n")
+
+		_, err = wr.Write(ctx, rec.Path, bytes.NewReader(buf.Bytes()))
+		return err
+
+	default:
+
+		_, err := wr.Write(ctx, rec.Path, rec.Body)
+		return err
+	}
+}
+
+// iteratorURI returns a `sqlitespatial://` iterator URI for the filters defined in 'opts'.
+func iteratorURI(opts *RunOptions) string {
+
+	q := url.Values{}
+	q.Set("_with_stats", "false")
+	q.Set("include-alt-files", strconv.FormatBool(opts.IncludeAltFiles))
+
+	if opts.BoundingBox != "" {
+		q.Set("bbox", opts.BoundingBox)
+	}
+
+	for _, pt := range opts.Placetypes {
+		q.Add("placetype", pt)
+	}
+
+	for col, values := range opts.Existential {
+
+		for _, v := range values {
+			q.Add(col, v)
+		}
+	}
+
+	return fmt.Sprintf("%s://?%s", sqlite.ITERATOR_SCHEME, q.Encode())
+}
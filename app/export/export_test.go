@@ -0,0 +1,191 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/internal/testdatabase"
+	"github.com/whosonfirst/go-writer/v3"
+)
+
+func TestExportDirectory(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	db_path := createExportDatabase(t, root)
+	data_root := filepath.Join(root, "data")
+
+	err := os.Mkdir(data_root, 0755)
+
+	if err != nil {
+		t.Fatalf("Failed to create data directory, %v", err)
+	}
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: db_path,
+		Format:             FORMAT_DIRECTORY,
+		WriterURI:          fmt.Sprintf("fs://%s", data_root),
+		Placetypes:         []string{"wing"},
+	}
+
+	err = RunWithOptions(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to export database, %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(data_root, "136/052/154/5/1360521545.geojson"))
+
+	if err != nil {
+		t.Fatalf("Expected 1360521545 to be exported, %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(data_root, "101/737/491/101737491.geojson"))
+
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected 101737491 to be excluded by placetype filter")
+	}
+}
+
+func TestExportFeatureCollection(t *testing.T) {
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: createExportDatabase(t, t.TempDir()),
+		Format:             FORMAT_FEATURECOLLECTION,
+	}
+
+	body := runExport(t, opts)
+
+	_, err := geojson.UnmarshalFeatureCollection(body)
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal feature collection, %v\n%s", err, body)
+	}
+
+	ids := make([]string, 0)
+
+	for _, rsp := range gjson.GetBytes(body, "features.#.properties.wof:id").Array() {
+		ids = append(ids, rsp.String())
+	}
+
+	slices.Sort(ids)
+
+	if !slices.Equal(ids, []string{"101737491", "1360521545"}) {
+		t.Fatalf("Unexpected features in feature collection, %v", ids)
+	}
+}
+
+func TestExportGeoJSONL(t *testing.T) {
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: createExportDatabase(t, t.TempDir()),
+		Format:             FORMAT_GEOJSONL,
+	}
+
+	body := runExport(t, opts)
+
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d\n%s", len(lines), body)
+	}
+
+	for idx, ln := range lines {
+
+		f, err := geojson.UnmarshalFeature([]byte(ln))
+
+		if err != nil {
+			t.Fatalf("Failed to unmarshal line %d, %v", idx, err)
+		}
+
+		if f.Properties["wof:id"] == nil {
+			t.Fatalf("Line %d is missing wof:id property", idx)
+		}
+	}
+}
+
+func TestExportBoundingBox(t *testing.T) {
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: createExportDatabase(t, t.TempDir()),
+		Format:             FORMAT_GEOJSONL,
+		BoundingBox:        "-122.5,37.5,-122.3,37.7",
+	}
+
+	body := runExport(t, opts)
+
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line, got %d\n%s", len(lines), body)
+	}
+
+	id := gjson.Get(lines[0], "properties.wof:id").String()
+
+	if id != "1360521545" {
+		t.Fatalf("Expected 1360521545 to be exported, got %s", id)
+	}
+
+	opts.BoundingBox = "0,0,1,1"
+
+	body = runExport(t, opts)
+
+	if len(body) != 0 {
+		t.Fatalf("Expected no records outside bounding box, got %s", body)
+	}
+}
+
+// createExportDatabase creates a new SQLite spatial database, in 'root', containing the fixtures used by the tests
+// in this package and returns its path.
+func createExportDatabase(t *testing.T, root string) string {
+
+	db_path := filepath.Join(root, "export.db")
+
+	bodies := make([][]byte, 0)
+
+	for _, path := range []string{"../../fixtures/101737491.geojson", "../../fixtures/1360521545.geojson"} {
+
+		body, err := os.ReadFile(path)
+
+		if err != nil {
+			t.Fatalf("Failed to read %s, %v", path, err)
+		}
+
+		bodies = append(bodies, body)
+	}
+
+	testdatabase.Create(t, db_path, bodies...)
+	return db_path
+}
+
+// runExport runs the export tool with 'opts', writing records to an in-memory buffer, and returns the output.
+func runExport(t *testing.T, opts *RunOptions) []byte {
+
+	var buf bytes.Buffer
+
+	ctx, err := writer.SetIOWriterWithContext(context.Background(), &buf)
+
+	if err != nil {
+		t.Fatalf("Failed to assign IO writer, %v", err)
+	}
+
+	opts.WriterURI = "io://"
+
+	err = RunWithOptions(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to export database, %v", err)
+	}
+
+	return buf.Bytes()
+}
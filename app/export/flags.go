@@ -0,0 +1,55 @@
+package export
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/multi"
+)
+
+var spatial_database_uri string
+var format string
+var writer_uri string
+
+var bbox string
+var placetypes multi.MultiString
+var is_current multi.MultiString
+var is_ceased multi.MultiString
+var is_deprecated multi.MultiString
+var is_superseded multi.MultiString
+var is_superseding multi.MultiString
+var include_alt_files bool
+
+var verbose bool
+
+func DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("export")
+
+	fs.StringVar(&spatial_database_uri, "spatial-database-uri", "", "A valid SQLite spatial database URI (for example 'sqlite://sqlite3?dsn=/usr/local/data/ca.db') or the path to a SQLite spatial database.")
+	fs.StringVar(&format, "format", FORMAT_GEOJSONL, "The format to export records in. Valid options are: featurecollection, geojsonl, directory.")
+	fs.StringVar(&writer_uri, "writer-uri", "stdout://", "A valid whosonfirst/go-writer URI. If -format is 'directory' records will be written to their Who's On First relative path (for example 'fs:///usr/local/data/export/data').")
+
+	fs.StringVar(&bbox, "bbox", "", "An optional comma-separated bounding box (minx,miny,maxx,maxy) that exported records must intersect.")
+	fs.Var(&placetypes, "placetype", "Zero or more placetypes that exported records must match.")
+	fs.Var(&is_current, "is-current", "Zero or more existential flags (-1, 0, 1) that exported records must match.")
+	fs.Var(&is_ceased, "is-ceased", "Zero or more existential flags (-1, 0, 1) that exported records must match.")
+	fs.Var(&is_deprecated, "is-deprecated", "Zero or more existential flags (-1, 0, 1) that exported records must match.")
+	fs.Var(&is_superseded, "is-superseded", "Zero or more existential flags (-1, 0, 1) that exported records must match.")
+	fs.Var(&is_superseding, "is-superseding", "Zero or more existential flags (-1, 0, 1) that exported records must match.")
+	fs.BoolVar(&include_alt_files, "include-alt-files", false, "Include alternate geometries.")
+
+	fs.BoolVar(&verbose, "verbose", false, "Enable verbose (debug) logging.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Export the records in a SQLite spatial database as a GeoJSON FeatureCollection, line-delimited GeoJSON or a Who's On First style directory tree.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Valid options are:\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs, nil
+}
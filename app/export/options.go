@@ -0,0 +1,52 @@
+package export
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+type RunOptions struct {
+	SpatialDatabaseURI string              `json:"spatial_database_uri"`
+	Format             string              `json:"format"`
+	WriterURI          string              `json:"writer_uri"`
+	BoundingBox        string              `json:"bbox,omitempty"`
+	Placetypes         []string            `json:"placetypes,omitempty"`
+	Existential        map[string][]string `json:"existential,omitempty"`
+	IncludeAltFiles    bool                `json:"include_alt_files"`
+	Verbose            bool                `json:"verbose"`
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	flagset.Parse(fs)
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WHOSONFIRST")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set flags from environment variables, %w", err)
+	}
+
+	existential := map[string][]string{
+		"is_current":     is_current,
+		"is_ceased":      is_ceased,
+		"is_deprecated":  is_deprecated,
+		"is_superseded":  is_superseded,
+		"is_superseding": is_superseding,
+	}
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: spatial_database_uri,
+		Format:             format,
+		WriterURI:          writer_uri,
+		BoundingBox:        bbox,
+		Placetypes:         placetypes,
+		Existential:        existential,
+		IncludeAltFiles:    include_alt_files,
+		Verbose:            verbose,
+	}
+
+	return opts, nil
+}
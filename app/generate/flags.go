@@ -0,0 +1,68 @@
+package generate
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/multi"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/generator"
+)
+
+var spatial_database_uri string
+
+var seed int64
+var start_id int64
+var bbox string
+var placetypes multi.MultiString
+var children int
+var vertices int
+var interior_rings int
+var alt_labels multi.MultiString
+var antimeridian int
+
+var ceased_ratio float64
+var deprecated_ratio float64
+var superseded_ratio float64
+
+var country string
+var repo string
+
+var verbose bool
+
+func DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("generate")
+
+	fs.StringVar(&spatial_database_uri, "spatial-database-uri", "", "A valid whosonfirst/go-whosonfirst-spatial URI (for example 'sqlite://sqlite3?dsn=/usr/local/data/synthetic.db') to write synthetic features to.")
+
+	fs.Int64Var(&seed, "seed", 0, "The seed used to generate features. The same flags (and seed) always produce the same features.")
+	fs.Int64Var(&start_id, "start-id", 1, "The ID assigned to the first feature. Subsequent features are assigned sequential IDs.")
+	fs.StringVar(&bbox, "bbox", "-180,-80,180,80", "A comma-separated bounding box (minx,miny,maxx,maxy) that top-level features are distributed across.")
+	fs.Var(&placetypes, "placetype", "One or more placetypes, from the top down, defining the hierarchy of generated features. Default is country, region, locality, neighbourhood.")
+	fs.IntVar(&children, "children", 4, "The number of features to create for the top-level placetype and for each parent feature.")
+	fs.IntVar(&vertices, "vertices", 16, "The number of vertices in the exterior ring of each polygon.")
+	fs.IntVar(&interior_rings, "interior-rings", 0, fmt.Sprintf("The number of interior rings (holes) in each polygon, up to %d. Requires at least 8 vertices.", generator.MAX_INTERIOR_RINGS))
+	fs.Var(&alt_labels, "alt-label", "Zero or more labels for which an alternate geometry is created for each feature.")
+	fs.IntVar(&antimeridian, "antimeridian", 0, "The number of additional top-level features crossing the antimeridian.")
+
+	fs.Float64Var(&ceased_ratio, "ceased-ratio", 0.0, "The probability (0.0 - 1.0) that a feature is ceased.")
+	fs.Float64Var(&deprecated_ratio, "deprecated-ratio", 0.0, "The probability (0.0 - 1.0) that a feature is deprecated.")
+	fs.Float64Var(&superseded_ratio, "superseded-ratio", 0.0, "The probability (0.0 - 1.0) that a feature is superseded.")
+
+	fs.StringVar(&country, "country", generator.DEFAULT_COUNTRY, "The value of the wof:country property of generated features.")
+	fs.StringVar(&repo, "repo", generator.DEFAULT_REPO, "The value of the wof:repo property of generated features.")
+
+	fs.BoolVar(&verbose, "verbose", false, "Enable verbose (debug) logging.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Generate synthetic Who's On First features, with a nested placetype hierarchy, and write them to a spatial database.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Valid options are:\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs, nil
+}
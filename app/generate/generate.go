@@ -0,0 +1,127 @@
+package generate
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/generator"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create application flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flagset, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	if opts.Verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		slog.Debug("Verbose logging enabled")
+	}
+
+	if opts.SpatialDatabaseURI == "" {
+		return fmt.Errorf("Missing -spatial-database-uri flag")
+	}
+
+	gen_opts := &generator.Options{
+		Seed:            opts.Seed,
+		StartId:         opts.StartId,
+		Placetypes:      opts.Placetypes,
+		Children:        opts.Children,
+		Vertices:        opts.Vertices,
+		InteriorRings:   opts.InteriorRings,
+		AltLabels:       opts.AltLabels,
+		Antimeridian:    opts.Antimeridian,
+		CeasedRatio:     opts.CeasedRatio,
+		DeprecatedRatio: opts.DeprecatedRatio,
+		SupersededRatio: opts.SupersededRatio,
+		Country:         opts.Country,
+		Repo:            opts.Repo,
+	}
+
+	if opts.BoundingBox != "" {
+
+		b, err := sqlite.ParseBoundingBox(opts.BoundingBox)
+
+		if err != nil {
+			return fmt.Errorf("Failed to parse bounding box, %w", err)
+		}
+
+		gen_opts.Bounds = *b
+	}
+
+	g, err := generator.NewGenerator(gen_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create generator, %w", err)
+	}
+
+	db_uri, err := databaseURI(opts)
+
+	if err != nil {
+		return err
+	}
+
+	db, err := database.NewSpatialDatabase(ctx, db_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create spatial database, %w", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	slog.Debug("Generate features", "count", g.Count(), "alt labels", len(opts.AltLabels))
+
+	t1 := time.Now()
+
+	count, err := generator.IndexDatabase(ctx, db, g)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write features to database, %w", err)
+	}
+
+	slog.Info("Generated features", "count", count, "time", time.Since(t1))
+	return nil
+}
+
+// databaseURI returns the spatial database URI defined in 'opts' with the "index-alt-files" parameter assigned if
+// alternate geometries are being generated.
+func databaseURI(opts *RunOptions) (string, error) {
+
+	u, err := url.Parse(opts.SpatialDatabaseURI)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse spatial database URI, %w", err)
+	}
+
+	if len(opts.AltLabels) > 0 {
+		q := u.Query()
+		q.Set("index-alt-files", "true")
+		u.RawQuery = q.Encode()
+	}
+
+	return u.String(), nil
+}
@@ -0,0 +1,60 @@
+package generate
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+type RunOptions struct {
+	SpatialDatabaseURI string   `json:"spatial_database_uri"`
+	Seed               int64    `json:"seed"`
+	StartId            int64    `json:"start_id"`
+	BoundingBox        string   `json:"bbox"`
+	Placetypes         []string `json:"placetypes,omitempty"`
+	Children           int      `json:"children"`
+	Vertices           int      `json:"vertices"`
+	InteriorRings      int      `json:"interior_rings"`
+	AltLabels          []string `json:"alt_labels,omitempty"`
+	Antimeridian       int      `json:"antimeridian"`
+	CeasedRatio        float64  `json:"ceased_ratio"`
+	DeprecatedRatio    float64  `json:"deprecated_ratio"`
+	SupersededRatio    float64  `json:"superseded_ratio"`
+	Country            string   `json:"country"`
+	Repo               string   `json:"repo"`
+	Verbose            bool     `json:"verbose"`
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	flagset.Parse(fs)
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WHOSONFIRST")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set flags from environment variables, %w", err)
+	}
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: spatial_database_uri,
+		Seed:               seed,
+		StartId:            start_id,
+		BoundingBox:        bbox,
+		Placetypes:         placetypes,
+		Children:           children,
+		Vertices:           vertices,
+		InteriorRings:      interior_rings,
+		AltLabels:          alt_labels,
+		Antimeridian:       antimeridian,
+		CeasedRatio:        ceased_ratio,
+		DeprecatedRatio:    deprecated_ratio,
+		SupersededRatio:    superseded_ratio,
+		Country:            country,
+		Repo:               repo,
+		Verbose:            verbose,
+	}
+
+	return opts, nil
+}
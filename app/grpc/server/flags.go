@@ -0,0 +1,44 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+
+	grpc_server "github.com/whosonfirst/go-whosonfirst-spatial-grpc/app/server"
+)
+
+// Enable a HTTP metrics endpoint reporting SQLite spatial database metrics in the Prometheus text format.
+var enable_metrics bool
+
+// The port to listen for metrics requests on
+var metrics_port int
+
+// The URL for the metrics handler
+var path_metrics string
+
+// A valid URI for exporting OpenTelemetry traces.
+var tracing_uri string
+
+// Enable a gRPC service reporting the records added, updated or removed since a given time.
+var enable_changes bool
+
+// DefaultFlagSet returns the default `whosonfirst/go-whosonfirst-spatial-grpc/app/server` flag set with additional
+// flags specific to SQLite spatial databases.
+func DefaultFlagSet() (*flag.FlagSet, error) {
+
+	fs, err := grpc_server.DefaultFlagSet()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive default gRPC server flag set, %w", err)
+	}
+
+	fs.BoolVar(&enable_metrics, "enable-metrics", false, "Enable a HTTP metrics endpoint reporting SQLite spatial database metrics in the Prometheus text format.")
+	fs.IntVar(&metrics_port, "metrics-port", 8083, "The port to listen for metrics requests on")
+	fs.StringVar(&path_metrics, "path-metrics", "/metrics", "The URL for the metrics handler")
+
+	fs.BoolVar(&enable_changes, "enable-changes", false, "Enable a gRPC service (Changes) reporting the records added, updated or removed since a given time.")
+
+	fs.StringVar(&tracing_uri, "tracing-uri", "", "A valid URI for exporting OpenTelemetry traces. Valid options are: stdout://, stderr://, file:///path/to/file. If empty tracing is disabled.")
+
+	return fs, nil
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	grpc_server "github.com/whosonfirst/go-whosonfirst-spatial-grpc/app/server"
+)
+
+// RunOptions extends the `whosonfirst/go-whosonfirst-spatial-grpc/app/server.RunOptions` struct with options
+// specific to SQLite spatial databases.
+type RunOptions struct {
+	*grpc_server.RunOptions
+	// Enable a HTTP metrics endpoint reporting SQLite spatial database metrics in the Prometheus text format.
+	EnableMetrics bool `json:"enable_metrics"`
+	// The port to listen for metrics requests on
+	MetricsPort int `json:"metrics_port"`
+	// The URL for the metrics handler
+	PathMetrics string `json:"path_metrics"`
+	// A valid URI for exporting OpenTelemetry traces. If empty tracing is disabled.
+	TracingURI string `json:"tracing_uri"`
+	// Enable a gRPC service reporting the records added, updated or removed since a given time.
+	EnableChanges bool `json:"enable_changes"`
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	grpc_opts, err := grpc_server.RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive gRPC server options from flag set, %w", err)
+	}
+
+	opts := &RunOptions{
+		RunOptions:    grpc_opts,
+		EnableMetrics: enable_metrics,
+		MetricsPort:   metrics_port,
+		PathMetrics:   path_metrics,
+		TracingURI:    tracing_uri,
+		EnableChanges: enable_changes,
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	grpc_server "github.com/whosonfirst/go-whosonfirst-spatial-grpc/server"
+	"github.com/whosonfirst/go-whosonfirst-spatial-grpc/spatial"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/grpc/changes"
+	sqlite_server "github.com/whosonfirst/go-whosonfirst-spatial-sqlite/grpc/server"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/tracing"
+	app "github.com/whosonfirst/go-whosonfirst-spatial/application"
+	"google.golang.org/grpc"
+)
+
+// Run starts a new gRPC server for performing spatial queries against a SQLite spatial database using the default flag set.
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet()
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive default flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flagset, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+// RunWithOptions starts a new gRPC server for performing spatial queries against a SQLite spatial database
+// configured by 'opts'. With the exception of the services specific to SQLite spatial databases (like metrics) this
+// mirrors the `whosonfirst/go-whosonfirst-spatial-grpc/app/server.RunWithOptions` method. Like the HTTP server it can
+// not wrap that method because it creates its gRPC server without options (for tracing) and without a way to register
+// additional services (for changes) so only the spatial server itself is reused.
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	grpc_opts := make([]grpc.ServerOption, 0)
+
+	if opts.TracingURI != "" {
+
+		_, shutdown, err := tracing.NewTracerProvider(ctx, opts.TracingURI, "grpc-server")
+
+		if err != nil {
+			return fmt.Errorf("Failed to create tracer provider, %w", err)
+		}
+
+		defer shutdown(ctx)
+
+		grpc_opts = append(grpc_opts,
+			grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor()),
+			grpc.ChainStreamInterceptor(tracing.StreamServerInterceptor()),
+		)
+	}
+
+	spatial_opts := &app.SpatialApplicationOptions{
+		SpatialDatabaseURI:     opts.SpatialDatabaseURI,
+		PropertiesReaderURI:    opts.PropertiesReaderURI,
+		EnableCustomPlacetypes: opts.EnableCustomPlacetypes,
+		CustomPlacetypes:       opts.CustomPlacetypes,
+	}
+
+	spatial_app, err := app.NewSpatialApplication(ctx, spatial_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new spatial application, %w", err)
+	}
+
+	// If the spatial database is also the properties reader then read properties from its properties
+	// table rather than reading (and parsing) the entire GeoJSON body of each result.
+
+	if opts.PropertiesReaderURI == "{spatial-database-uri}" {
+
+		sqlite_db, ok := spatial_app.SpatialDatabase.(*sqlite.SQLiteSpatialDatabase)
+
+		if ok {
+			spatial_app.PropertiesReader = sqlite_db.PropertiesReader()
+		}
+	}
+
+	go func() {
+
+		err := spatial_app.IndexDatabaseWithIterators(ctx, opts.IteratorSources)
+
+		if err != nil {
+			slog.Error("Failed to index database", "error", err)
+		}
+	}()
+
+	if opts.EnableMetrics {
+
+		mux := http.NewServeMux()
+		mux.Handle(opts.PathMetrics, sqlite.MetricsHandler())
+
+		metrics_addr := fmt.Sprintf("%s:%d", opts.Host, opts.MetricsPort)
+
+		go func() {
+
+			slog.Info("Listening for metrics requests", "address", metrics_addr, "path", opts.PathMetrics)
+
+			err := http.ListenAndServe(metrics_addr, mux)
+
+			if err != nil {
+				slog.Error("Failed to serve metrics", "error", err)
+			}
+		}()
+	}
+
+	spatial_server, err := grpc_server.NewSpatialServer(spatial_app)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create spatial server, %v", err)
+	}
+
+	grpc_server := grpc.NewServer(grpc_opts...)
+
+	spatial.RegisterSpatialServer(grpc_server, spatial_server)
+
+	if opts.EnableChanges {
+
+		changes_db, ok := spatial_app.SpatialDatabase.(sqlite.ChangesDatabase)
+
+		if !ok {
+			return fmt.Errorf("Spatial database does not support reporting changes")
+		}
+
+		changes_server, err := sqlite_server.NewChangesServer(changes_db)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create changes server, %w", err)
+		}
+
+		changes.RegisterChangesServer(grpc_server, changes_server)
+	}
+
+	addr := fmt.Sprintf("%s:%d", opts.Host, opts.Port)
+	slog.Info("Listening for requests", "address", addr)
+
+	lis, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+
+	grpc_server.Serve(lis)
+	return nil
+}
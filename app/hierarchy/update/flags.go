@@ -0,0 +1,44 @@
+package update
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sfomuseum/go-flags/multi"
+	spatial_update "github.com/whosonfirst/go-whosonfirst-spatial/app/hierarchy/update"
+)
+
+var in_place bool
+var placetypes multi.MultiString
+var since int64
+var batch_size int
+var dry_run bool
+
+// DefaultFlagSet returns the flags defined by the whosonfirst/go-whosonfirst-spatial/app/hierarchy/update package
+// along with flags for updating the hierarchies of the records in a SQLite spatial database in place.
+func DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs, err := spatial_update.DefaultFlagSet(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fs.BoolVar(&in_place, "in-place", false, "Update the hierarchies of the records in the (SQLite) spatial database itself, writing the results back to the database. The -target-iterator-uri, -source-iterator-uri, -exporter-uri and -writer-uri flags are ignored.")
+	fs.Var(&placetypes, "placetype", "Zero or more placetypes that records must match to be updated. Only used when -in-place is true.")
+	fs.Int64Var(&since, "since", 0, "Only update records whose last modified time is after this Unix timestamp. Only used when -in-place is true.")
+	fs.IntVar(&batch_size, "batch-size", 1000, "The number of updated records to write in each transaction. Only used when -in-place is true.")
+	fs.BoolVar(&dry_run, "dry-run", false, "Report the changes that would be made, as JSON, without modifying the database. Only used when -in-place is true.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Perform point-in-polygon (PIP), and related update, operations on a set of Who's on First records.\n")
+		fmt.Fprintf(os.Stderr, "If the -in-place flag is true the records in the spatial database are updated and a report of the changes is written to STDOUT as JSON.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options] uri(N) uri(N)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Valid options are:\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs, nil
+}
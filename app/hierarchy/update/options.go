@@ -0,0 +1,39 @@
+package update
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	spatial_update "github.com/whosonfirst/go-whosonfirst-spatial/app/hierarchy/update"
+)
+
+type RunOptions struct {
+	*spatial_update.RunOptions
+	InPlace    bool     `json:"in_place"`
+	Placetypes []string `json:"placetypes"`
+	Since      int64    `json:"since"`
+	BatchSize  int      `json:"batch_size"`
+	DryRun     bool     `json:"dry_run"`
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	// This calls flagset.Parse(fs)
+	update_opts, err := spatial_update.RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive run options, %w", err)
+	}
+
+	opts := &RunOptions{
+		RunOptions: update_opts,
+		InPlace:    in_place,
+		Placetypes: placetypes,
+		Since:      since,
+		BatchSize:  batch_size,
+		DryRun:     dry_run,
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,128 @@
+// Package update wraps the whosonfirst/go-whosonfirst-spatial/app/hierarchy/update application so that SQLite spatial
+// databases resolve hierarchies using a single point-in-polygon query per coordinate and adds an "in place" mode which
+// updates the hierarchies of the records in a SQLite spatial database itself.
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	spatial_update "github.com/whosonfirst/go-whosonfirst-spatial/app/hierarchy/update"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create application flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive run options, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+// RunWithOptions runs the update-hierarchies application. If 'opts' does not define a spatial database and its spatial
+// database URI is a single sqlite:// database it is wrapped in a `sqlite.PointInPolygonHierarchyDatabase` instance.
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	if opts.InPlace {
+		return runInPlace(ctx, opts)
+	}
+
+	if opts.SpatialDatabase == nil {
+
+		db, err := database.NewSpatialDatabase(ctx, opts.SpatialDatabaseURI)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create spatial database for '%s', %w", opts.SpatialDatabaseURI, err)
+		}
+
+		defer db.Disconnect(ctx)
+
+		sqlite_db, ok := db.(*sqlite.SQLiteSpatialDatabase)
+
+		if ok {
+			opts.SpatialDatabase = sqlite.NewPointInPolygonHierarchyDatabase(sqlite_db)
+		} else {
+			opts.SpatialDatabase = db
+		}
+	}
+
+	return spatial_update.RunWithOptions(ctx, opts.RunOptions)
+}
+
+// runInPlace updates the hierarchies of the records in the spatial database defined by 'opts' and writes a report of
+// the changes to STDOUT.
+func runInPlace(ctx context.Context, opts *RunOptions) error {
+
+	if opts.Verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		slog.Debug("Verbose logging enabled")
+	}
+
+	var db database.SpatialDatabase
+
+	if opts.SpatialDatabase != nil {
+		db = opts.SpatialDatabase
+	} else {
+
+		_db, err := database.NewSpatialDatabase(ctx, opts.SpatialDatabaseURI)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create spatial database for '%s', %w", opts.SpatialDatabaseURI, err)
+		}
+
+		defer _db.Disconnect(ctx)
+		db = _db
+	}
+
+	sqlite_db, ok := db.(*sqlite.SQLiteSpatialDatabase)
+
+	if !ok {
+		return fmt.Errorf("Spatial database URI must be a single sqlite:// database when -in-place is true")
+	}
+
+	update_opts := &sqlite.UpdateHierarchiesOptions{
+		Placetypes:      opts.Placetypes,
+		Since:           opts.Since,
+		BatchSize:       opts.BatchSize,
+		DryRun:          opts.DryRun,
+		SPRFilterInputs: opts.SPRFilterInputs,
+		SPRResultsFunc:  opts.SPRResultsFunc,
+		PIPUpdateFunc:   opts.PIPUpdateFunc,
+	}
+
+	summary, err := sqlite_db.UpdateHierarchies(ctx, update_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to update hierarchies, %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	err = enc.Encode(summary)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode summary, %w", err)
+	}
+
+	return nil
+}
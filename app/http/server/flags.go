@@ -0,0 +1,40 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+
+	www_server "github.com/whosonfirst/go-whosonfirst-spatial-www/app/server"
+)
+
+// Enable a metrics endpoint reporting SQLite spatial database metrics in the Prometheus text format.
+var enable_metrics bool
+
+// The URL for the metrics handler
+var path_metrics string
+
+// A valid URI for exporting OpenTelemetry traces.
+var tracing_uri string
+
+// Enable an API endpoint reporting the records added, updated or removed since a given time.
+var enable_changes bool
+
+// DefaultFlagSet returns the default `whosonfirst/go-whosonfirst-spatial-www/app/server` flag set with additional
+// flags specific to SQLite spatial databases.
+func DefaultFlagSet() (*flag.FlagSet, error) {
+
+	fs, err := www_server.DefaultFlagSet()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive default www server flag set, %w", err)
+	}
+
+	fs.BoolVar(&enable_metrics, "enable-metrics", false, "Enable a metrics endpoint reporting SQLite spatial database metrics in the Prometheus text format.")
+	fs.StringVar(&path_metrics, "path-metrics", "/metrics", "The URL for the metrics handler")
+
+	fs.BoolVar(&enable_changes, "enable-changes", false, "Enable an API endpoint (/{PATH_API}/changes?since={UNIX_TIMESTAMP}) reporting the records added, updated or removed since a given time, as line-delimited JSON.")
+
+	fs.StringVar(&tracing_uri, "tracing-uri", "", "A valid URI for exporting OpenTelemetry traces. Valid options are: stdout://, stderr://, file:///path/to/file. If empty tracing is disabled.")
+
+	return fs, nil
+}
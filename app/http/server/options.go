@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	www_server "github.com/whosonfirst/go-whosonfirst-spatial-www/app/server"
+)
+
+// RunOptions extends the `whosonfirst/go-whosonfirst-spatial-www/app/server.RunOptions` struct with options
+// specific to SQLite spatial databases.
+type RunOptions struct {
+	*www_server.RunOptions
+	// Enable a metrics endpoint reporting SQLite spatial database metrics in the Prometheus text format.
+	EnableMetrics bool
+	// The URL for the metrics handler
+	PathMetrics string
+	// A valid URI for exporting OpenTelemetry traces. If empty tracing is disabled.
+	TracingURI string
+	// Enable an API endpoint reporting the records added, updated or removed since a given time.
+	EnableChanges bool
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	www_opts, err := www_server.RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive www server options from flag set, %w", err)
+	}
+
+	opts := &RunOptions{
+		RunOptions:    www_opts,
+		EnableMetrics: enable_metrics,
+		PathMetrics:   path_metrics,
+		TracingURI:    tracing_uri,
+		EnableChanges: enable_changes,
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	gohttp "net/http"
+	"path/filepath"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/aaronland/go-http-maps/v2"
+	"github.com/aaronland/go-http/v3/auth"
+	"github.com/aaronland/go-http/v3/handlers"
+	"github.com/aaronland/go-http/v3/server"
+	"github.com/rs/cors"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	sqlite_api "github.com/whosonfirst/go-whosonfirst-spatial-sqlite/http/api"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/tracing"
+	"github.com/whosonfirst/go-whosonfirst-spatial-www/http"
+	"github.com/whosonfirst/go-whosonfirst-spatial-www/http/api"
+	"github.com/whosonfirst/go-whosonfirst-spatial-www/static/www"
+	app "github.com/whosonfirst/go-whosonfirst-spatial/application"
+)
+
+// Run starts a new HTTP server for performing spatial queries against a SQLite spatial database using the default flag set.
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet()
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive default flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flag set, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+// RunWithOptions starts a new HTTP server for performing spatial queries against a SQLite spatial database
+// configured by 'opts'. With the exception of the handlers specific to SQLite spatial databases (like metrics) this
+// mirrors the `whosonfirst/go-whosonfirst-spatial-www/app/server.RunWithOptions` method. It can not wrap that method
+// because it creates its handlers, and its spatial database, without a way to add to them so only the handlers
+// themselves are reused.
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	logger := slog.Default()
+
+	if opts.TracingURI != "" {
+
+		_, shutdown, err := tracing.NewTracerProvider(ctx, opts.TracingURI, "http-server")
+
+		if err != nil {
+			return fmt.Errorf("Failed to create tracer provider, %w", err)
+		}
+
+		defer shutdown(ctx)
+	}
+
+	spatial_opts := &app.SpatialApplicationOptions{
+		SpatialDatabaseURI:     opts.SpatialDatabaseURI,
+		PropertiesReaderURI:    opts.PropertiesReaderURI,
+		EnableCustomPlacetypes: opts.EnableCustomPlacetypes,
+		CustomPlacetypes:       opts.CustomPlacetypes,
+	}
+
+	spatial_app, err := app.NewSpatialApplication(ctx, spatial_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new spatial application, %w", err)
+	}
+
+	// If the spatial database is also the properties reader then read properties from its properties
+	// table rather than reading (and parsing) the entire GeoJSON body of each result.
+
+	if opts.PropertiesReaderURI == "{spatial-database-uri}" {
+
+		sqlite_db, ok := spatial_app.SpatialDatabase.(*sqlite.SQLiteSpatialDatabase)
+
+		if ok {
+			spatial_app.PropertiesReader = sqlite_db.PropertiesReader()
+		}
+	}
+
+	go func() {
+
+		err := spatial_app.IndexDatabaseWithIterators(ctx, opts.IteratorSources)
+
+		if err != nil {
+			slog.Error("Failed to index database with iterator", "error", err)
+		}
+	}()
+
+	handler, err := newHandler(ctx, opts, spatial_app)
+
+	if err != nil {
+		return err
+	}
+
+	s, err := server.NewServer(ctx, opts.ServerURI)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new server for '%s', %v", opts.ServerURI, err)
+	}
+
+	logger.Info("Listening for requests", "address", s.Address())
+
+	err = s.ListenAndServe(ctx, handler)
+
+	if err != nil {
+		return fmt.Errorf("Failed to start server, %v", err)
+	}
+
+	return nil
+}
+
+// newHandler returns a `http.Handler` instance for the handlers enabled by 'opts' querying 'spatial_app'.
+func newHandler(ctx context.Context, opts *RunOptions, spatial_app *app.SpatialApplication) (gohttp.Handler, error) {
+
+	authenticator, err := auth.NewAuthenticator(ctx, opts.AuthenticatorURI)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create authenticator, %w", err)
+	}
+
+	var cors_wrapper *cors.Cors
+
+	if opts.EnableCORS {
+		cors_wrapper = cors.New(cors.Options{
+			AllowedOrigins:   opts.CORSOrigins,
+			AllowCredentials: opts.CORSAllowCredentials,
+		})
+	}
+
+	wrapHandler := func(h gohttp.Handler) gohttp.Handler {
+
+		if opts.EnableCORS {
+			h = cors_wrapper.Handler(h)
+		}
+
+		if opts.EnableGzip {
+			h = gziphandler.GzipHandler(h)
+		}
+
+		return h
+	}
+
+	mux := gohttp.NewServeMux()
+
+	ping_handler, err := handlers.PingPongHandler()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ping handler because %s", err)
+	}
+
+	mux.Handle(opts.PathPing, ping_handler)
+
+	if opts.EnableMetrics {
+		mux.Handle(opts.PathMetrics, sqlite.MetricsHandler())
+	}
+
+	// data (geojson) handlers
+	// SpatialDatabase implements reader.Reader
+
+	data_handler, err := api.NewDataHandler(spatial_app.SpatialDatabase)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create data handler, %v", err)
+	}
+
+	data_handler = http.CheckIndexingHandler(spatial_app, data_handler)
+
+	mux.Handle("/data/", wrapHandler(authenticator.WrapHandler(data_handler)))
+
+	// point-in-polygon handlers
+
+	api_pip_opts := &api.PointInPolygonHandlerOptions{
+		EnableGeoJSON: opts.EnableGeoJSON,
+		LogTimings:    opts.LogTimings,
+	}
+
+	api_pip_handler, err := api.PointInPolygonHandler(spatial_app, api_pip_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create point-in-polygon handler because %s", err)
+	}
+
+	path_api_pip := filepath.Join(opts.PathAPI, "point-in-polygon")
+	mux.Handle(path_api_pip, wrapHandler(authenticator.WrapHandler(api_pip_handler)))
+
+	// point-in-polygon (maptile) handlers
+
+	api_piptile_opts := &api.PointInPolygonTileHandlerOptions{}
+
+	api_piptile_handler, err := api.PointInPolygonTileHandler(spatial_app, api_piptile_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create point-in-polygon maptile handler because %s", err)
+	}
+
+	path_api_piptile := filepath.Join(opts.PathAPI, "point-in-polygon-with-tile")
+	mux.Handle(path_api_piptile, wrapHandler(api_piptile_handler))
+
+	// intersects
+
+	api_intersects_opts := &api.IntersectsHandlerOptions{
+		EnableGeoJSON: opts.EnableGeoJSON,
+		LogTimings:    opts.LogTimings,
+	}
+
+	api_intersects_handler, err := api.IntersectsHandler(spatial_app, api_intersects_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create intersects handler because %s", err)
+	}
+
+	path_api_intersects := filepath.Join(opts.PathAPI, "intersects")
+	mux.Handle(path_api_intersects, wrapHandler(authenticator.WrapHandler(api_intersects_handler)))
+
+	// changes
+
+	if opts.EnableChanges {
+
+		changes_db, ok := spatial_app.SpatialDatabase.(sqlite.ChangesDatabase)
+
+		if !ok {
+			return nil, fmt.Errorf("Spatial database does not support reporting changes")
+		}
+
+		api_changes_handler, err := sqlite_api.ChangesHandler(changes_db)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create changes handler, %w", err)
+		}
+
+		path_api_changes := filepath.Join(opts.PathAPI, "changes")
+		mux.Handle(path_api_changes, wrapHandler(authenticator.WrapHandler(api_changes_handler)))
+	}
+
+	// www handlers
+
+	if opts.EnableWWW {
+
+		// placetypes handler
+
+		placetypes_handler, err := api.NewPlacetypesHandler()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create placetypes handler, %v", err)
+		}
+
+		path_api_placetypes := filepath.Join(opts.PathAPI, "placetypes")
+		mux.Handle(path_api_placetypes, wrapHandler(authenticator.WrapHandler(placetypes_handler)))
+
+		maps_opts := &maps.AssignMapConfigHandlerOptions{
+			MapProvider:       opts.MapProvider,
+			MapTileURI:        opts.MapTileURI,
+			InitialView:       opts.InitialView,
+			LeafletStyle:      opts.LeafletStyle,
+			LeafletPointStyle: opts.LeafletPointStyle,
+			ProtomapsTheme:    opts.ProtomapsTheme,
+		}
+
+		err = maps.AssignMapConfigHandler(maps_opts, mux, "/map.json")
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign map config handler, %w", err)
+		}
+
+		www_fs := gohttp.FS(www.FS)
+		www_handler := gohttp.FileServer(www_fs)
+
+		mux.Handle("/", www_handler)
+	}
+
+	var handler gohttp.Handler = mux
+
+	if opts.TracingURI != "" {
+		handler = tracing.HTTPHandler(handler)
+	}
+
+	return handler, nil
+}
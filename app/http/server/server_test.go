@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	gohttp "net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	www_server "github.com/whosonfirst/go-whosonfirst-spatial-www/app/server"
+	app "github.com/whosonfirst/go-whosonfirst-spatial/application"
+)
+
+func TestNewHandler(t *testing.T) {
+
+	ctx := context.Background()
+
+	spatial_opts := &app.SpatialApplicationOptions{
+		SpatialDatabaseURI: "sqlite://" + sqlite.DEFAULT_ENGINE + "?dsn=:memory:",
+	}
+
+	spatial_app, err := app.NewSpatialApplication(ctx, spatial_opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create spatial application, %v", err)
+	}
+
+	defer spatial_app.SpatialDatabase.Disconnect(ctx)
+
+	opts := &RunOptions{
+		RunOptions: &www_server.RunOptions{
+			AuthenticatorURI: "null://",
+			PathAPI:          "/api",
+			PathPing:         "/ping",
+		},
+		EnableMetrics: true,
+		PathMetrics:   "/metrics",
+		EnableChanges: true,
+	}
+
+	handler, err := newHandler(ctx, opts, spatial_app)
+
+	if err != nil {
+		t.Fatalf("Failed to create handler, %v", err)
+	}
+
+	tests := map[string]int{
+		"/ping":                gohttp.StatusNoContent,
+		"/metrics":             gohttp.StatusOK,
+		"/api/changes?since=0": gohttp.StatusOK,
+		"/api/placetypes":      gohttp.StatusNotFound,
+	}
+
+	for path, expected := range tests {
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(gohttp.MethodGet, path, nil)
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != expected {
+			t.Fatalf("Expected %s to return %d, got %d", path, expected, rec.Code)
+		}
+	}
+}
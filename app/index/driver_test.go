@@ -0,0 +1,10 @@
+//go:build !modernc || mattn
+
+package index
+
+// Packages built without the mattn or modernc tags do not register a SQLite driver so tests use the
+// mattn/go-sqlite3 driver for the default engine.
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
@@ -0,0 +1,56 @@
+package index
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+var spatial_database_uri string
+var iterator_uri string
+var index_alt_files bool
+
+var workers int
+var batch_size int
+
+var progress bool
+var progress_interval time.Duration
+
+var analyze bool
+var vacuum bool
+
+var verbose bool
+
+func DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("index")
+
+	fs.StringVar(&spatial_database_uri, "spatial-database-uri", "", "A valid sqlite:// spatial database URI (for example 'sqlite://sqlite3?dsn=/usr/local/data/ca.db').")
+	fs.StringVar(&iterator_uri, "iterator-uri", "repo://", "A valid whosonfirst/go-whosonfirst-iterate/v3 URI.")
+	fs.BoolVar(&index_alt_files, "index-alt-files", false, "Index alternate geometries.")
+
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "The number of records to parse simultaneously.")
+	fs.IntVar(&batch_size, "batch-size", 1000, "The number of records to index in each transaction.")
+
+	fs.BoolVar(&progress, "progress", false, "Periodically log the number of records indexed.")
+	fs.DurationVar(&progress_interval, "progress-interval", 10*time.Second, "How often to log the number of records indexed if -progress is true.")
+
+	fs.BoolVar(&analyze, "analyze", true, "Run ANALYZE on the database after all records have been indexed.")
+	fs.BoolVar(&vacuum, "vacuum", false, "Run VACUUM on the database after all records have been indexed.")
+
+	fs.BoolVar(&verbose, "verbose", false, "Enable verbose (debug) logging.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Index one or more whosonfirst/go-whosonfirst-iterate/v3 sources in a SQLite spatial database, creating the rtree, spr and geojson tables this package queries.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options] uri(N) uri(N)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Valid options are:\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs, nil
+}
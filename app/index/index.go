@@ -0,0 +1,308 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-feature/alt"
+	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v3"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+// indexRecord is a struct containing the body of a record to be indexed and the path it was read from.
+type indexRecord struct {
+	path string
+	body []byte
+}
+
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create application flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flagset, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	if opts.Verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		slog.Debug("Verbose logging enabled")
+	}
+
+	if opts.SpatialDatabaseURI == "" {
+		return fmt.Errorf("Missing -spatial-database-uri flag")
+	}
+
+	if len(opts.Sources) == 0 {
+		return fmt.Errorf("No sources to index")
+	}
+
+	database_uri, err := databaseURI(opts)
+
+	if err != nil {
+		return err
+	}
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create spatial database, %w", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db, ok := db.(*sqlite.SQLiteSpatialDatabase)
+
+	if !ok {
+		return fmt.Errorf("Spatial database URI must be a single sqlite:// database")
+	}
+
+	it, err := iterate.NewIterator(ctx, opts.IteratorURI)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create iterator, %w", err)
+	}
+
+	defer it.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := max(opts.Workers, 1)
+	batch_size := max(opts.BatchSize, 1)
+
+	var first_err error
+	err_mu := new(sync.Mutex)
+
+	setError := func(err error) {
+
+		err_mu.Lock()
+		defer err_mu.Unlock()
+
+		if first_err == nil {
+			first_err = err
+			cancel()
+		}
+	}
+
+	t1 := time.Now()
+
+	var count int64
+
+	if opts.Progress {
+
+		ticker := time.NewTicker(opts.ProgressInterval)
+		defer ticker.Stop()
+
+		go func() {
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					n := atomic.LoadInt64(&count)
+					slog.Info("Indexing records", "count", n, "per second", float64(n)/time.Since(t1).Seconds())
+				}
+			}
+		}()
+	}
+
+	raw_ch := make(chan *indexRecord, workers)
+	parsed_ch := make(chan *indexRecord, batch_size)
+
+	// Records are parsed (and validated) in parallel but written, in batches, by a single goroutine
+	// since SQLite only allows one writer at a time.
+
+	parse_wg := new(sync.WaitGroup)
+
+	for i := 0; i < workers; i++ {
+
+		parse_wg.Go(func() {
+
+			for rec := range raw_ch {
+
+				if ctx.Err() != nil {
+					continue
+				}
+
+				ok, err := parseRecord(rec.body, opts.IndexAltFiles)
+
+				if err != nil {
+					setError(fmt.Errorf("Failed to parse %s, %w", rec.path, err))
+					continue
+				}
+
+				if !ok {
+					continue
+				}
+
+				parsed_ch <- rec
+			}
+		})
+	}
+
+	write_wg := new(sync.WaitGroup)
+
+	write_wg.Go(func() {
+
+		batch := make([][]byte, 0, batch_size)
+
+		flush := func() {
+
+			if len(batch) == 0 || ctx.Err() != nil {
+				return
+			}
+
+			err := sqlite_db.IndexFeatures(ctx, batch)
+
+			if err != nil {
+				setError(fmt.Errorf("Failed to index records, %w", err))
+				return
+			}
+
+			atomic.AddInt64(&count, int64(len(batch)))
+			batch = make([][]byte, 0, batch_size)
+		}
+
+		for rec := range parsed_ch {
+
+			batch = append(batch, rec.body)
+
+			if len(batch) >= batch_size {
+				flush()
+			}
+		}
+
+		flush()
+	})
+
+	for rec, err := range it.Iterate(ctx, opts.Sources...) {
+
+		if err != nil {
+			setError(fmt.Errorf("Failed to iterate records, %w", err))
+			break
+		}
+
+		body, err := io.ReadAll(rec.Body)
+		rec.Body.Close()
+
+		if err != nil {
+			setError(fmt.Errorf("Failed to read %s, %w", rec.Path, err))
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+		case raw_ch <- &indexRecord{path: rec.Path, body: body}:
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	close(raw_ch)
+	parse_wg.Wait()
+
+	close(parsed_ch)
+	write_wg.Wait()
+
+	if first_err != nil {
+		return first_err
+	}
+
+	slog.Info("Indexed records", "count", count, "time", time.Since(t1))
+
+	if opts.Analyze {
+
+		t2 := time.Now()
+
+		err := sqlite_db.Analyze(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		slog.Debug("Analyzed database", "time", time.Since(t2))
+	}
+
+	if opts.Vacuum {
+
+		t2 := time.Now()
+
+		err := sqlite_db.Vacuum(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		slog.Debug("Vacuumed database", "time", time.Since(t2))
+	}
+
+	return nil
+}
+
+// parseRecord ensures that 'body' is a valid Who's On First GeoJSON Feature. It returns false if 'body' is an
+// alternate geometry and 'index_alt_files' is false.
+func parseRecord(body []byte, index_alt_files bool) (bool, error) {
+
+	if !json.Valid(body) {
+		return false, fmt.Errorf("Invalid JSON")
+	}
+
+	if alt.IsAlt(body) && !index_alt_files {
+		return false, nil
+	}
+
+	_, err := properties.Id(body)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to derive ID, %w", err)
+	}
+
+	return true, nil
+}
+
+// databaseURI returns the spatial database URI defined in 'opts' with the "index-alt-files" parameter assigned.
+func databaseURI(opts *RunOptions) (string, error) {
+
+	u, err := url.Parse(opts.SpatialDatabaseURI)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse spatial database URI, %w", err)
+	}
+
+	if opts.IndexAltFiles {
+		q := u.Query()
+		q.Set("index-alt-files", "true")
+		u.RawQuery = q.Encode()
+	}
+
+	return u.String(), nil
+}
@@ -0,0 +1,114 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+)
+
+func TestIndex(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	db_path := filepath.Join(root, "index.db")
+	data_root := filepath.Join(root, "data")
+
+	err := os.Mkdir(data_root, 0755)
+
+	if err != nil {
+		t.Fatalf("Failed to create data directory, %v", err)
+	}
+
+	for _, id := range []int64{101737491, 1360521545} {
+
+		fname := fmt.Sprintf("%d.geojson", id)
+
+		body, err := os.ReadFile(filepath.Join("../../fixtures", fname))
+
+		if err != nil {
+			t.Fatalf("Failed to read fixture for %d, %v", id, err)
+		}
+
+		err = os.WriteFile(filepath.Join(data_root, fname), body, 0644)
+
+		if err != nil {
+			t.Fatalf("Failed to write fixture for %d, %v", id, err)
+		}
+	}
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: fmt.Sprintf("sqlite://%s?dsn=%s", sqlite.DEFAULT_ENGINE, db_path),
+		IteratorURI:        "directory://",
+		Sources:            []string{data_root},
+		Workers:            2,
+		BatchSize:          1,
+		Analyze:            true,
+		Vacuum:             true,
+	}
+
+	// Index the fixtures twice to ensure that records indexed again don't create duplicate rtree rows.
+
+	var rtree_count int
+
+	for i := 0; i < 2; i++ {
+
+		err := RunWithOptions(ctx, opts)
+
+		if err != nil {
+			t.Fatalf("Failed to index fixtures, %v", err)
+		}
+
+		conn, err := sql.Open(sqlite.DEFAULT_ENGINE, db_path)
+
+		if err != nil {
+			t.Fatalf("Failed to open database, %v", err)
+		}
+
+		var count int
+
+		err = conn.QueryRow("SELECT COUNT(id) FROM rtree").Scan(&count)
+		conn.Close()
+
+		if err != nil {
+			t.Fatalf("Failed to count rtree rows, %v", err)
+		}
+
+		if i > 0 && count != rtree_count {
+			t.Fatalf("Expected %d rtree rows after indexing again but got %d", rtree_count, count)
+		}
+
+		rtree_count = count
+	}
+
+	db, err := sqlite.NewSQLiteSpatialDatabase(ctx, opts.SpatialDatabaseURI)
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	c, err := geo.NewCoordinate(-71.330873, 46.852675)
+
+	if err != nil {
+		t.Fatalf("Failed to create new coordinate, %v", err)
+	}
+
+	rsp, err := db.PointInPolygon(ctx, c)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query, %v", err)
+	}
+
+	if len(rsp.Results()) != 1 {
+		t.Fatalf("Expected 1 result but got %d", len(rsp.Results()))
+	}
+}
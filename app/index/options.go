@@ -0,0 +1,51 @@
+package index
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+type RunOptions struct {
+	SpatialDatabaseURI string        `json:"spatial_database_uri"`
+	IteratorURI        string        `json:"iterator_uri"`
+	Sources            []string      `json:"sources"`
+	IndexAltFiles      bool          `json:"index_alt_files"`
+	Workers            int           `json:"workers"`
+	BatchSize          int           `json:"batch_size"`
+	Progress           bool          `json:"progress"`
+	ProgressInterval   time.Duration `json:"progress_interval"`
+	Analyze            bool          `json:"analyze"`
+	Vacuum             bool          `json:"vacuum"`
+	Verbose            bool          `json:"verbose"`
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	flagset.Parse(fs)
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WHOSONFIRST")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set flags from environment variables, %w", err)
+	}
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: spatial_database_uri,
+		IteratorURI:        iterator_uri,
+		Sources:            fs.Args(),
+		IndexAltFiles:      index_alt_files,
+		Workers:            workers,
+		BatchSize:          batch_size,
+		Progress:           progress,
+		ProgressInterval:   progress_interval,
+		Analyze:            analyze,
+		Vacuum:             vacuum,
+		Verbose:            verbose,
+	}
+
+	return opts, nil
+}
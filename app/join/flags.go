@@ -0,0 +1,75 @@
+package join
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/multi"
+)
+
+var left_database_uri string
+var left_placetypes multi.MultiString
+
+var right_database_uri string
+
+var predicate string
+var format string
+var workers int
+var include_unmatched bool
+
+var placetypes multi.MultiString
+var geometries string
+var alt_geoms multi.MultiString
+var inception string
+var cessation string
+
+var is_current multi.MultiString
+var is_ceased multi.MultiString
+var is_deprecated multi.MultiString
+var is_superseded multi.MultiString
+var is_superseding multi.MultiString
+
+var verbose bool
+
+func DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("join")
+
+	fs.StringVar(&left_database_uri, "left-database-uri", "", "A valid SQLite spatial database URI (for example 'sqlite://sqlite3?dsn=/usr/local/data/venue-us-ca.db') or the path to a SQLite spatial database. These are the records to join.")
+	fs.Var(&left_placetypes, "left-placetype", "Zero or more placetypes that records in the left database must match.")
+
+	fs.StringVar(&right_database_uri, "right-database-uri", "", "A valid whosonfirst/go-whosonfirst-spatial URI (for example 'sqlite://sqlite3?dsn=/usr/local/data/admin-us.db'). These are the records that left records are joined to.")
+
+	fs.StringVar(&predicate, "predicate", PREDICATE_PIP, "The spatial predicate used to join records. Valid options are: pip (the right records containing the centroid of the left record), intersects (the right records intersecting the geometry of the left record), max-overlap (the right record whose area of intersection with the geometry of the left record is largest).")
+	fs.StringVar(&format, "format", FORMAT_CSV, "The format to write joined records in. Valid options are: csv, ndjson.")
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "The number of left records to join in parallel.")
+	fs.BoolVar(&include_unmatched, "include-unmatched", false, "Include left records which are not joined to any right records.")
+
+	fs.Var(&placetypes, "placetype", "One or more place types to filter right records by.")
+	fs.StringVar(&geometries, "geometries", "all", "Valid options are: all, alt, default.")
+	fs.Var(&alt_geoms, "alternate-geometry", "One or more alternate geometry labels (wof:alt_label) values to filter right records by.")
+	fs.StringVar(&inception, "inception", "", "A valid EDTF date string.")
+	fs.StringVar(&cessation, "cessation", "", "A valid EDTF date string.")
+
+	fs.Var(&is_current, "is-current", "One or more existential flags (-1, 0, 1) to filter right records by.")
+	fs.Var(&is_ceased, "is-ceased", "One or more existential flags (-1, 0, 1) to filter right records by.")
+	fs.Var(&is_deprecated, "is-deprecated", "One or more existential flags (-1, 0, 1) to filter right records by.")
+	fs.Var(&is_superseded, "is-superseded", "One or more existential flags (-1, 0, 1) to filter right records by.")
+	fs.Var(&is_superseding, "is-superseding", "One or more existential flags (-1, 0, 1) to filter right records by.")
+
+	fs.BoolVar(&verbose, "verbose", false, "Enable verbose (debug) logging.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Join the records in a SQLite spatial database (left) to the records in another spatial database (right) using a spatial predicate.\n")
+		fmt.Fprintf(os.Stderr, "Pairs of left and right IDs are written to STDOUT as CSV or line-delimited JSON.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Valid options are:\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs, nil
+}
@@ -0,0 +1,554 @@
+package join
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+	sf_geom "github.com/peterstace/simplefeatures/geom"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v3"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+)
+
+// Join left records to the right records which contain their centroid.
+const PREDICATE_PIP string = "pip"
+
+// Join left records to the right records which intersect their geometry.
+const PREDICATE_INTERSECTS string = "intersects"
+
+// Join left records to the right record whose area of intersection with their geometry is largest.
+const PREDICATE_MAX_OVERLAP string = "max-overlap"
+
+// Write joined records as CSV with "left_id" and "right_id" columns.
+const FORMAT_CSV string = "csv"
+
+// Write joined records as line-delimited JSON.
+const FORMAT_NDJSON string = "ndjson"
+
+// joinRecord is a struct containing the body of a left record to be joined and the path it was read from.
+type joinRecord struct {
+	path string
+	body []byte
+}
+
+// joinResult is a struct containing the right records joined to a left record.
+type joinResult struct {
+	LeftId   int64   `json:"left_id"`
+	RightIds []int64 `json:"right_ids"`
+	// The fraction of the left record's area covered by the right record. Only assigned by the max-overlap predicate.
+	Overlap float64 `json:"overlap,omitempty"`
+}
+
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create application flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flagset, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	if opts.Verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		slog.Debug("Verbose logging enabled")
+	}
+
+	if opts.LeftDatabaseURI == "" {
+		return fmt.Errorf("Missing -left-database-uri flag")
+	}
+
+	if opts.RightDatabaseURI == "" {
+		return fmt.Errorf("Missing -right-database-uri flag")
+	}
+
+	switch opts.Predicate {
+	case PREDICATE_PIP, PREDICATE_INTERSECTS, PREDICATE_MAX_OVERLAP:
+		// pass
+	default:
+		return fmt.Errorf("Invalid or unsupported predicate '%s'", opts.Predicate)
+	}
+
+	switch opts.Format {
+	case FORMAT_CSV, FORMAT_NDJSON:
+		// pass
+	default:
+		return fmt.Errorf("Invalid or unsupported format '%s'", opts.Format)
+	}
+
+	spr_filter, err := filter.NewSPRFilterFromQuery(opts.Filters)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create SPR filter, %w", err)
+	}
+
+	right_db, err := database.NewSpatialDatabase(ctx, opts.RightDatabaseURI)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create right spatial database, %w", err)
+	}
+
+	defer right_db.Disconnect(ctx)
+
+	it, err := iterate.NewIterator(ctx, iteratorURI(opts))
+
+	if err != nil {
+		return fmt.Errorf("Failed to create iterator, %w", err)
+	}
+
+	defer it.Close()
+
+	wr := opts.Writer
+
+	if wr == nil {
+		wr = os.Stdout
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := max(opts.Workers, 1)
+
+	var first_err error
+	err_mu := new(sync.Mutex)
+
+	setError := func(err error) {
+
+		err_mu.Lock()
+		defer err_mu.Unlock()
+
+		if first_err == nil {
+			first_err = err
+			cancel()
+		}
+	}
+
+	t1 := time.Now()
+
+	var count int64
+
+	record_ch := make(chan *joinRecord, workers)
+	result_ch := make(chan *joinResult, workers)
+
+	// Records are joined in parallel but written by a single goroutine
+
+	join_wg := new(sync.WaitGroup)
+
+	for i := 0; i < workers; i++ {
+
+		join_wg.Go(func() {
+
+			for rec := range record_ch {
+
+				if ctx.Err() != nil {
+					continue
+				}
+
+				rsp, err := joinFeature(ctx, right_db, opts.Predicate, rec.body, spr_filter)
+
+				if err != nil {
+					setError(fmt.Errorf("Failed to join %s, %w", rec.path, err))
+					continue
+				}
+
+				atomic.AddInt64(&count, 1)
+
+				if len(rsp.RightIds) == 0 && !opts.IncludeUnmatched {
+					continue
+				}
+
+				result_ch <- rsp
+			}
+		})
+	}
+
+	write_wg := new(sync.WaitGroup)
+
+	write_wg.Go(func() {
+
+		write, flush := newResultWriter(wr, opts.Format)
+
+		for rsp := range result_ch {
+
+			if ctx.Err() != nil {
+				continue
+			}
+
+			err := write(rsp)
+
+			if err != nil {
+				setError(fmt.Errorf("Failed to write result for %d, %w", rsp.LeftId, err))
+			}
+		}
+
+		err := flush()
+
+		if err != nil {
+			setError(fmt.Errorf("Failed to flush results, %w", err))
+		}
+	})
+
+	for rec, err := range it.Iterate(ctx, opts.LeftDatabaseURI) {
+
+		if err != nil {
+			setError(fmt.Errorf("Failed to iterate records, %w", err))
+			break
+		}
+
+		body, err := io.ReadAll(rec.Body)
+		rec.Body.Close()
+
+		if err != nil {
+			setError(fmt.Errorf("Failed to read %s, %w", rec.Path, err))
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+		case record_ch <- &joinRecord{path: rec.Path, body: body}:
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	close(record_ch)
+	join_wg.Wait()
+
+	close(result_ch)
+	write_wg.Wait()
+
+	if first_err != nil {
+		return first_err
+	}
+
+	slog.Debug("Joined records", "count", count, "time", time.Since(t1))
+	return nil
+}
+
+// joinFeature returns the right records in 'db' joined to the left record 'body' using 'predicate'.
+func joinFeature(ctx context.Context, db database.SpatialDatabase, predicate string, body []byte, f spatial.Filter) (*joinResult, error) {
+
+	left_id, err := properties.Id(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive ID, %w", err)
+	}
+
+	rsp := &joinResult{
+		LeftId:   left_id,
+		RightIds: make([]int64, 0),
+	}
+
+	var possible spr.StandardPlacesResults
+
+	switch predicate {
+	case PREDICATE_INTERSECTS, PREDICATE_MAX_OVERLAP:
+
+		geom, err := leftGeometry(body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if predicate == PREDICATE_MAX_OVERLAP && planar.Area(geom) > 0 {
+			return maxOverlap(ctx, db, rsp, geom, f)
+		}
+
+		// Records without an area (points) are joined to the right records which contain them
+
+		possible, err = db.Intersects(ctx, geom, f)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to perform intersects query, %w", err)
+		}
+
+	default:
+
+		pt, err := leftCentroid(body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		possible, err = db.PointInPolygon(ctx, pt, f)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to perform point in polygon query, %w", err)
+		}
+	}
+
+	seen := make(map[int64]bool)
+
+	for _, s := range possible.Results() {
+
+		right_id, err := strconv.ParseInt(s.Id(), 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse right ID '%s', %w", s.Id(), err)
+		}
+
+		if seen[right_id] {
+			continue
+		}
+
+		seen[right_id] = true
+		rsp.RightIds = append(rsp.RightIds, right_id)
+	}
+
+	return rsp, nil
+}
+
+// maxOverlap assigns the right record in 'db' whose area of intersection with 'geom' is largest to 'rsp'.
+func maxOverlap(ctx context.Context, db database.SpatialDatabase, rsp *joinResult, geom orb.Geometry, f spatial.Filter) (*joinResult, error) {
+
+	possible, err := db.Intersects(ctx, geom, f)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to perform intersects query, %w", err)
+	}
+
+	left_geom, err := toSimpleFeatures(geom)
+
+	if err != nil {
+		return nil, err
+	}
+
+	left_area := left_geom.Area()
+
+	var best_id int64
+	var best_area float64
+
+	for _, s := range possible.Results() {
+
+		right_id, err := strconv.ParseInt(s.Id(), 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse right ID '%s', %w", s.Id(), err)
+		}
+
+		right_geom, err := readGeometry(ctx, db, s.Path())
+
+		if err != nil {
+			return nil, err
+		}
+
+		overlap, err := sf_geom.Intersection(left_geom, right_geom)
+
+		if err != nil {
+			slog.Warn("Failed to derive intersection, skipping", "left", rsp.LeftId, "right", right_id, "error", err)
+			continue
+		}
+
+		area := overlap.Area()
+
+		if area > best_area {
+			best_id = right_id
+			best_area = area
+		}
+	}
+
+	if best_area > 0 {
+		rsp.RightIds = append(rsp.RightIds, best_id)
+		rsp.Overlap = best_area / left_area
+	}
+
+	return rsp, nil
+}
+
+// newResultWriter returns functions for writing joined records to 'wr' in 'format' and flushing any buffered output.
+func newResultWriter(wr io.Writer, format string) (func(*joinResult) error, func() error) {
+
+	switch format {
+	case FORMAT_NDJSON:
+
+		enc := json.NewEncoder(wr)
+
+		write := func(rsp *joinResult) error {
+			return enc.Encode(rsp)
+		}
+
+		flush := func() error {
+			return nil
+		}
+
+		return write, flush
+
+	default:
+
+		csv_wr := csv.NewWriter(wr)
+		header := false
+
+		write := func(rsp *joinResult) error {
+
+			if !header {
+
+				err := csv_wr.Write([]string{"left_id", "right_id"})
+
+				if err != nil {
+					return err
+				}
+
+				header = true
+			}
+
+			left_id := strconv.FormatInt(rsp.LeftId, 10)
+
+			if len(rsp.RightIds) == 0 {
+				return csv_wr.Write([]string{left_id, ""})
+			}
+
+			for _, right_id := range rsp.RightIds {
+
+				err := csv_wr.Write([]string{left_id, strconv.FormatInt(right_id, 10)})
+
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		flush := func() error {
+			csv_wr.Flush()
+			return csv_wr.Error()
+		}
+
+		return write, flush
+	}
+}
+
+// leftCentroid returns the centroid of 'body', derived from its properties or, failing that, its geometry.
+func leftCentroid(body []byte) (*orb.Point, error) {
+
+	pt, _, err := properties.Centroid(body)
+
+	if err == nil {
+		return pt, nil
+	}
+
+	geom, err := leftGeometry(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c, _ := planar.CentroidArea(geom)
+	return &c, nil
+}
+
+// leftGeometry returns the geometry of 'body'.
+func leftGeometry(body []byte) (orb.Geometry, error) {
+
+	geom_rsp := gjson.GetBytes(body, "geometry")
+
+	if !geom_rsp.Exists() {
+		return nil, fmt.Errorf("Missing geometry")
+	}
+
+	geom, err := geojson.UnmarshalGeometry([]byte(geom_rsp.Raw))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal geometry, %w", err)
+	}
+
+	return geom.Geometry(), nil
+}
+
+// readGeometry reads the record 'path' from 'db' and returns its geometry.
+func readGeometry(ctx context.Context, db database.SpatialDatabase, path string) (sf_geom.Geometry, error) {
+
+	r, err := db.Read(ctx, path)
+
+	if err != nil {
+		return sf_geom.Geometry{}, fmt.Errorf("Failed to read %s, %w", path, err)
+	}
+
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+
+	if err != nil {
+		return sf_geom.Geometry{}, fmt.Errorf("Failed to read body for %s, %w", path, err)
+	}
+
+	geom_rsp := gjson.GetBytes(body, "geometry")
+
+	if !geom_rsp.Exists() {
+		return sf_geom.Geometry{}, fmt.Errorf("Record %s is missing geometry", path)
+	}
+
+	geom, err := sf_geom.UnmarshalGeoJSON([]byte(geom_rsp.Raw), sf_geom.NoValidate{})
+
+	if err != nil {
+		return sf_geom.Geometry{}, fmt.Errorf("Failed to unmarshal geometry for %s, %w", path, err)
+	}
+
+	return geom, nil
+}
+
+// toSimpleFeatures converts 'geom' in to a `peterstace/simplefeatures/geom.Geometry` instance.
+func toSimpleFeatures(geom orb.Geometry) (sf_geom.Geometry, error) {
+
+	enc, err := geojson.NewGeometry(geom).MarshalJSON()
+
+	if err != nil {
+		return sf_geom.Geometry{}, fmt.Errorf("Failed to marshal geometry, %w", err)
+	}
+
+	sf, err := sf_geom.UnmarshalGeoJSON(enc, sf_geom.NoValidate{})
+
+	if err != nil {
+		return sf_geom.Geometry{}, fmt.Errorf("Failed to unmarshal geometry, %w", err)
+	}
+
+	return sf, nil
+}
+
+// iteratorURI returns a `sqlitespatial://` iterator URI for the left records defined in 'opts'.
+func iteratorURI(opts *RunOptions) string {
+
+	q := url.Values{}
+	q.Set("_with_stats", "false")
+
+	for _, pt := range opts.LeftPlacetypes {
+		q.Add("placetype", pt)
+	}
+
+	return fmt.Sprintf("%s://?%s", sqlite.ITERATOR_SCHEME, q.Encode())
+}
@@ -0,0 +1,119 @@
+package join
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/internal/testdatabase"
+)
+
+// A venue, as a point, inside the locality of Quebec (101737491).
+const join_venue_point string = `{"type":"Feature","id":1,"properties":{"wof:id":1,"wof:name":"Point","wof:placetype":"venue","wof:parent_id":-1,"wof:hierarchy":[],"wof:country":"CA","wof:repo":"whosonfirst-data-venue-ca","wof:lastmodified":1,"geom:latitude":46.852675,"geom:longitude":-71.330873},"bbox":[-71.330873,46.852675,-71.330873,46.852675],"geometry":{"type":"Point","coordinates":[-71.330873,46.852675]}}`
+
+// A venue, as a small polygon, inside the locality of Quebec (101737491).
+const join_venue_polygon string = `{"type":"Feature","id":2,"properties":{"wof:id":2,"wof:name":"Polygon","wof:placetype":"venue","wof:parent_id":-1,"wof:hierarchy":[],"wof:country":"CA","wof:repo":"whosonfirst-data-venue-ca","wof:lastmodified":1,"geom:latitude":46.8525,"geom:longitude":-71.3305},"bbox":[-71.331,46.8524,-71.33,46.8526],"geometry":{"type":"Polygon","coordinates":[[[-71.331,46.8524],[-71.33,46.8524],[-71.33,46.8526],[-71.331,46.8526],[-71.331,46.8524]]]}}`
+
+// A venue, as a point, in the middle of the Atlantic Ocean.
+const join_venue_unmatched string = `{"type":"Feature","id":3,"properties":{"wof:id":3,"wof:name":"Nowhere","wof:placetype":"venue","wof:parent_id":-1,"wof:hierarchy":[],"wof:country":"XY","wof:repo":"whosonfirst-data-venue-xy","wof:lastmodified":1,"geom:latitude":40.0,"geom:longitude":-40.0},"bbox":[-40.0,40.0,-40.0,40.0],"geometry":{"type":"Point","coordinates":[-40.0,40.0]}}`
+
+func TestJoin(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	left_path := filepath.Join(root, "left.db")
+	right_path := filepath.Join(root, "right.db")
+
+	testdatabase.Create(t, left_path, []byte(join_venue_point), []byte(join_venue_polygon), []byte(join_venue_unmatched))
+
+	body, err := os.ReadFile("../../fixtures/101737491.geojson")
+
+	if err != nil {
+		t.Fatalf("Failed to read fixture, %v", err)
+	}
+
+	testdatabase.Create(t, right_path, body)
+
+	tests := map[string]string{
+		PREDICATE_PIP:         "left_id,right_id\n1,101737491\n2,101737491\n",
+		PREDICATE_INTERSECTS:  "left_id,right_id\n1,101737491\n2,101737491\n",
+		PREDICATE_MAX_OVERLAP: "left_id,right_id\n1,101737491\n2,101737491\n",
+	}
+
+	for predicate, expected := range tests {
+
+		var buf bytes.Buffer
+
+		opts := &RunOptions{
+			LeftDatabaseURI:  left_path,
+			RightDatabaseURI: fmt.Sprintf("sqlite://%s?dsn=%s", sqlite.DEFAULT_ENGINE, right_path),
+			Predicate:        predicate,
+			Format:           FORMAT_CSV,
+			Workers:          1,
+			Writer:           &buf,
+		}
+
+		err := RunWithOptions(ctx, opts)
+
+		if err != nil {
+			t.Fatalf("Failed to join records using %s, %v", predicate, err)
+		}
+
+		if buf.String() != expected {
+			t.Fatalf("Unexpected output for %s: %s", predicate, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+
+	opts := &RunOptions{
+		LeftDatabaseURI:  left_path,
+		RightDatabaseURI: fmt.Sprintf("sqlite://%s?dsn=%s", sqlite.DEFAULT_ENGINE, right_path),
+		Predicate:        PREDICATE_MAX_OVERLAP,
+		Format:           FORMAT_NDJSON,
+		Workers:          4,
+		IncludeUnmatched: true,
+		Writer:           &buf,
+	}
+
+	err = RunWithOptions(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to join records, %v", err)
+	}
+
+	results := make(map[int64]*joinResult)
+
+	for _, ln := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+
+		var rsp joinResult
+
+		err := json.Unmarshal([]byte(ln), &rsp)
+
+		if err != nil {
+			t.Fatalf("Failed to unmarshal '%s', %v", ln, err)
+		}
+
+		results[rsp.LeftId] = &rsp
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	if len(results[3].RightIds) != 0 {
+		t.Fatalf("Expected 3 to be unmatched, got %v", results[3].RightIds)
+	}
+
+	if results[2].Overlap < 0.99 {
+		t.Fatalf("Expected 2 to be covered by 101737491, got %f", results[2].Overlap)
+	}
+}
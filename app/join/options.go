@@ -0,0 +1,70 @@
+package join
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+type RunOptions struct {
+	LeftDatabaseURI  string   `json:"left_database_uri"`
+	LeftPlacetypes   []string `json:"left_placetypes,omitempty"`
+	RightDatabaseURI string   `json:"right_database_uri"`
+	Predicate        string   `json:"predicate"`
+	Format           string   `json:"format"`
+	Workers          int      `json:"workers"`
+	IncludeUnmatched bool     `json:"include_unmatched"`
+	// SPR filter criteria for right records, as defined by `whosonfirst/go-whosonfirst-spatial/filter.NewSPRFilterFromQuery`.
+	Filters url.Values `json:"filters,omitempty"`
+	// Where joined records are written. Default is STDOUT.
+	Writer  io.Writer `json:"-"`
+	Verbose bool      `json:"verbose"`
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	flagset.Parse(fs)
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WHOSONFIRST")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set flags from environment variables, %w", err)
+	}
+
+	filters := url.Values{
+		"placetype":          placetypes,
+		"geometries":         []string{geometries},
+		"alternate_geometry": alt_geoms,
+		"is_current":         is_current,
+		"is_ceased":          is_ceased,
+		"is_deprecated":      is_deprecated,
+		"is_superseded":      is_superseded,
+		"is_superseding":     is_superseding,
+	}
+
+	if inception != "" {
+		filters.Set("inception_date", inception)
+	}
+
+	if cessation != "" {
+		filters.Set("cessation_date", cessation)
+	}
+
+	opts := &RunOptions{
+		LeftDatabaseURI:  left_database_uri,
+		LeftPlacetypes:   left_placetypes,
+		RightDatabaseURI: right_database_uri,
+		Predicate:        predicate,
+		Format:           format,
+		Workers:          workers,
+		IncludeUnmatched: include_unmatched,
+		Filters:          filters,
+		Verbose:          verbose,
+	}
+
+	return opts, nil
+}
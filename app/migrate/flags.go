@@ -0,0 +1,35 @@
+package migrate
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+var spatial_database_uri string
+var geometry_encoding string
+var batch_size int
+var verbose bool
+
+func DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("migrate")
+
+	fs.StringVar(&spatial_database_uri, "spatial-database-uri", "", "A valid sqlite:// spatial database URI.")
+	fs.StringVar(&geometry_encoding, "geometry-encoding", "wkt", "The encoding to convert rtree geometries to. Valid options are: wkt, wkb.")
+	fs.IntVar(&batch_size, "batch-size", 1000, "The number of rtree rows to convert in each transaction.")
+	fs.BoolVar(&verbose, "verbose", false, "Enable verbose (debug) logging.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Upgrade a SQLite spatial database to the current schema version in place.\n")
+		fmt.Fprintf(os.Stderr, "The database's updated schema metadata is written to STDOUT as JSON.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Valid options are:\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs, nil
+}
@@ -0,0 +1,87 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create application flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flagset, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	if opts.Verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		slog.Debug("Verbose logging enabled")
+	}
+
+	if opts.SpatialDatabaseURI == "" {
+		return fmt.Errorf("Missing -spatial-database-uri flag")
+	}
+
+	db, err := database.NewSpatialDatabase(ctx, opts.SpatialDatabaseURI)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create spatial database, %w", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db, ok := db.(*sqlite.SQLiteSpatialDatabase)
+
+	if !ok {
+		return fmt.Errorf("Spatial database URI must be a single sqlite:// database")
+	}
+
+	migrate_opts := &sqlite.MigrateOptions{
+		GeometryEncoding: opts.GeometryEncoding,
+		BatchSize:        opts.BatchSize,
+	}
+
+	err = sqlite_db.Migrate(ctx, migrate_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to migrate database, %w", err)
+	}
+
+	m, err := sqlite_db.SchemaMetadata(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive schema metadata, %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	err = enc.Encode(m)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode schema metadata, %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package migrate
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+type RunOptions struct {
+	SpatialDatabaseURI string `json:"spatial_database_uri"`
+	GeometryEncoding   string `json:"geometry_encoding"`
+	BatchSize          int    `json:"batch_size"`
+	Verbose            bool   `json:"verbose"`
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	flagset.Parse(fs)
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WHOSONFIRST")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set flags from environment variables, %w", err)
+	}
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: spatial_database_uri,
+		GeometryEncoding:   geometry_encoding,
+		BatchSize:          batch_size,
+		Verbose:            verbose,
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,38 @@
+package replay
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+var spatial_database_uri string
+var iterations int
+var workers int
+var verbose bool
+
+func DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("replay")
+
+	available_databases := database.Schemes()
+	desc_databases := fmt.Sprintf("A valid whosonfirst/go-whosonfirst-spatial/data.SpatialDatabase URI. options are: %s", available_databases)
+
+	fs.StringVar(&spatial_database_uri, "spatial-database-uri", "", desc_databases)
+	fs.IntVar(&iterations, "iterations", 1, "The number of times to replay each captured query.")
+	fs.IntVar(&workers, "workers", 1, "The number of queries to replay concurrently.")
+	fs.BoolVar(&verbose, "verbose", false, "Enable verbose (debug) logging.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Re-run the queries captured in one or more slow query logs against a spatial database and report latency percentiles.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options] slow-query-log(N) slow-query-log(N)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Valid options are:\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs, nil
+}
@@ -0,0 +1,38 @@
+package replay
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+type RunOptions struct {
+	SpatialDatabaseURI string   `json:"spatial_database_uri"`
+	Sources            []string `json:"sources"`
+	Iterations         int      `json:"iterations"`
+	Workers            int      `json:"workers"`
+	Verbose            bool     `json:"verbose"`
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	flagset.Parse(fs)
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WHOSONFIRST")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set flags from environment variables, %w", err)
+	}
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: spatial_database_uri,
+		Sources:            fs.Args(),
+		Iterations:         iterations,
+		Workers:            workers,
+		Verbose:            verbose,
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,234 @@
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/paulmach/orb"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/stats"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create application flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flagset, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	if opts.Verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		slog.Debug("Verbose logging enabled")
+	}
+
+	if opts.SpatialDatabaseURI == "" {
+		return fmt.Errorf("Missing -spatial-database-uri flag")
+	}
+
+	queries := make([]*sqlite.SlowQuery, 0)
+
+	for _, path := range opts.Sources {
+
+		q, err := readSlowQueries(path)
+
+		if err != nil {
+			return fmt.Errorf("Failed to read slow queries from %s, %w", path, err)
+		}
+
+		queries = append(queries, q...)
+	}
+
+	if len(queries) == 0 {
+		return fmt.Errorf("No queries to replay")
+	}
+
+	db, err := database.NewSpatialDatabase(ctx, opts.SpatialDatabaseURI)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create spatial database, %w", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	workers := max(opts.Workers, 1)
+	iterations := max(opts.Iterations, 1)
+
+	recorded := map[string]*stats.Latencies{
+		"pip":        stats.NewLatencies(),
+		"intersects": stats.NewLatencies(),
+	}
+
+	replayed := map[string]*stats.Latencies{
+		"pip":        stats.NewLatencies(),
+		"intersects": stats.NewLatencies(),
+	}
+
+	for _, q := range queries {
+
+		l, ok := recorded[q.Query]
+
+		if ok {
+			l.Add(q.Timings.Total)
+		}
+	}
+
+	throttle := make(chan bool, workers)
+
+	wg := new(sync.WaitGroup)
+	mu := new(sync.Mutex)
+
+	errors := 0
+
+	for i := 0; i < iterations; i++ {
+
+		for _, q := range queries {
+
+			throttle <- true
+
+			wg.Go(func() {
+
+				defer func() {
+					<-throttle
+				}()
+
+				d, err := replayQuery(ctx, db, q)
+
+				if err != nil {
+					slog.Error("Failed to replay query", "query", q.Query, "time", q.Time, "error", err)
+					mu.Lock()
+					errors += 1
+					mu.Unlock()
+					return
+				}
+
+				replayed[q.Query].Add(d)
+			})
+		}
+	}
+
+	wg.Wait()
+
+	for _, label := range []string{"pip", "intersects"} {
+
+		if recorded[label].Count() == 0 {
+			continue
+		}
+
+		recorded[label].Summary().Write(os.Stdout, fmt.Sprintf("%s (recorded)", label))
+		replayed[label].Summary().Write(os.Stdout, fmt.Sprintf("%s (replayed)", label))
+	}
+
+	if errors > 0 {
+		return fmt.Errorf("%d queries failed to replay", errors)
+	}
+
+	return nil
+}
+
+// replayQuery re-runs 'q' against 'db' and returns the time it took to complete.
+func replayQuery(ctx context.Context, db database.SpatialDatabase, q *sqlite.SlowQuery) (time.Duration, error) {
+
+	if q.Geometry == nil {
+		return 0, fmt.Errorf("Query is missing geometry")
+	}
+
+	filters, err := q.SPRFilters()
+
+	if err != nil {
+		return 0, fmt.Errorf("Failed to derive filters, %w", err)
+	}
+
+	geom := q.Geometry.Geometry()
+
+	t1 := time.Now()
+
+	switch q.Query {
+	case "pip":
+
+		pt, ok := geom.(orb.Point)
+
+		if !ok {
+			return 0, fmt.Errorf("Invalid geometry for point-in-polygon query, %s", geom.GeoJSONType())
+		}
+
+		_, err = db.PointInPolygon(ctx, &pt, filters...)
+
+	case "intersects":
+		_, err = db.Intersects(ctx, geom, filters...)
+	default:
+		return 0, fmt.Errorf("Unsupported query type '%s'", q.Query)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Since(t1), nil
+}
+
+// readSlowQueries returns the list of `sqlite.SlowQuery` records read from the line-delimited JSON file 'path'.
+func readSlowQueries(path string) ([]*sqlite.SlowQuery, error) {
+
+	fh, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer fh.Close()
+
+	queries := make([]*sqlite.SlowQuery, 0)
+
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	lineno := 0
+
+	for scanner.Scan() {
+
+		lineno += 1
+
+		var q *sqlite.SlowQuery
+
+		err := json.Unmarshal(scanner.Bytes(), &q)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal line %d, %w", lineno, err)
+		}
+
+		queries = append(queries, q)
+	}
+
+	err = scanner.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return queries, nil
+}
@@ -0,0 +1,33 @@
+package sql
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+var spatial_database_uri string
+var format string
+var verbose bool
+
+func DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("sql")
+
+	fs.StringVar(&spatial_database_uri, "spatial-database-uri", "", "A valid whosonfirst/go-whosonfirst-spatial-sqlite URI (for example 'sqlite://sqlite3?dsn=/usr/local/data/ca.db'). The database engine is replaced by one which provides the wof_contains and wof_intersects functions.")
+	fs.StringVar(&format, "format", FORMAT_CSV, "The format to write results in. Valid options are: csv, ndjson.")
+	fs.BoolVar(&verbose, "verbose", false, "Enable verbose (debug) logging.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Run ad-hoc SQL statements, which may use the wof_contains(geometry, x, y) and wof_intersects(geometry, wkt) functions, against a spatial database.\n")
+		fmt.Fprintf(os.Stderr, "If no statements are passed as arguments they are read from STDIN, one per line.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options] statement(N) statement(N)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Valid options are:\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs, nil
+}
@@ -0,0 +1,41 @@
+package sql
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+type RunOptions struct {
+	SpatialDatabaseURI string   `json:"spatial_database_uri"`
+	Statements         []string `json:"statements"`
+	Format             string   `json:"format"`
+	// Where statements are read from if Statements is empty. Default is STDIN.
+	Reader io.Reader `json:"-"`
+	// Where results are written. Default is STDOUT.
+	Writer  io.Writer `json:"-"`
+	Verbose bool      `json:"verbose"`
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	flagset.Parse(fs)
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WHOSONFIRST")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set flags from environment variables, %w", err)
+	}
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: spatial_database_uri,
+		Statements:         fs.Args(),
+		Format:             format,
+		Verbose:            verbose,
+	}
+
+	return opts, nil
+}
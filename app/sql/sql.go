@@ -0,0 +1,263 @@
+package sql
+
+import (
+	"bufio"
+	"context"
+	db_sql "database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+
+	database_sql "github.com/sfomuseum/go-database/sql"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+)
+
+// The name of the CSV output format.
+const FORMAT_CSV string = "csv"
+
+// The name of the newline-delimited JSON output format.
+const FORMAT_NDJSON string = "ndjson"
+
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create application flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flagset, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	if opts.Verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		slog.Debug("Verbose logging enabled")
+	}
+
+	if opts.SpatialDatabaseURI == "" {
+		return fmt.Errorf("Missing -spatial-database-uri flag")
+	}
+
+	switch opts.Format {
+	case FORMAT_CSV, FORMAT_NDJSON:
+		// pass
+	default:
+		return fmt.Errorf("Invalid or unsupported format '%s'", opts.Format)
+	}
+
+	statements := opts.Statements
+
+	if len(statements) == 0 {
+
+		rd := opts.Reader
+
+		if rd == nil {
+			rd = os.Stdin
+		}
+
+		s, err := readStatements(rd)
+
+		if err != nil {
+			return fmt.Errorf("Failed to read statements, %w", err)
+		}
+
+		statements = s
+	}
+
+	u, err := url.Parse(opts.SpatialDatabaseURI)
+
+	if err != nil {
+		return fmt.Errorf("Failed to parse spatial database URI, %w", err)
+	}
+
+	// Swap in the database engine which provides the wof_contains and wof_intersects functions
+	u.Host = sqlite.SQL_FUNCTIONS_ENGINE
+
+	db, err := database_sql.OpenWithURI(ctx, u.String())
+
+	if err != nil {
+		return fmt.Errorf("Failed to open database (this tool must be built with the 'mattn' or 'modernc' tag), %w", err)
+	}
+
+	defer db.Close()
+
+	wr := opts.Writer
+
+	if wr == nil {
+		wr = os.Stdout
+	}
+
+	for _, q := range statements {
+
+		slog.Debug("Run statement", "statement", q)
+
+		err := runStatement(ctx, db, q, opts.Format, wr)
+
+		if err != nil {
+			return fmt.Errorf("Failed to run statement '%s', %w", q, err)
+		}
+	}
+
+	return nil
+}
+
+// runStatement runs 'q' against 'db' and writes any rows it returns to 'wr' encoded as 'format'.
+func runStatement(ctx context.Context, db *db_sql.DB, q string, format string, wr io.Writer) error {
+
+	rows, err := db.QueryContext(ctx, q)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive columns, %w", err)
+	}
+
+	if len(cols) == 0 {
+		return rows.Err()
+	}
+
+	var csv_wr *csv.Writer
+	var json_enc *json.Encoder
+
+	switch format {
+	case FORMAT_CSV:
+
+		csv_wr = csv.NewWriter(wr)
+
+		err := csv_wr.Write(cols)
+
+		if err != nil {
+			return fmt.Errorf("Failed to write header, %w", err)
+		}
+
+	default:
+		json_enc = json.NewEncoder(wr)
+	}
+
+	values := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+
+	for idx := range values {
+		ptrs[idx] = &values[idx]
+	}
+
+	for rows.Next() {
+
+		err := rows.Scan(ptrs...)
+
+		if err != nil {
+			return fmt.Errorf("Failed to scan row, %w", err)
+		}
+
+		switch format {
+		case FORMAT_CSV:
+
+			out := make([]string, len(cols))
+
+			for idx, v := range values {
+
+				switch v := v.(type) {
+				case nil:
+					out[idx] = ""
+				case []byte:
+					out[idx] = string(v)
+				default:
+					out[idx] = fmt.Sprintf("%v", v)
+				}
+			}
+
+			err = csv_wr.Write(out)
+
+		default:
+
+			out := make(map[string]any)
+
+			for idx, v := range values {
+
+				if b, ok := v.([]byte); ok {
+					v = string(b)
+				}
+
+				out[cols[idx]] = v
+			}
+
+			err = json_enc.Encode(out)
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to write row, %w", err)
+		}
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return fmt.Errorf("Failed to iterate rows, %w", err)
+	}
+
+	if csv_wr != nil {
+
+		csv_wr.Flush()
+
+		err := csv_wr.Error()
+
+		if err != nil {
+			return fmt.Errorf("Failed to flush results, %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readStatements reads SQL statements, one per line, from 'rd'. Blank lines and lines starting with "--" are ignored.
+func readStatements(rd io.Reader) ([]string, error) {
+
+	statements := make([]string, 0)
+
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+
+		q := strings.TrimSpace(scanner.Text())
+
+		if q == "" || strings.HasPrefix(q, "--") {
+			continue
+		}
+
+		statements = append(statements, q)
+	}
+
+	err := scanner.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return statements, nil
+}
@@ -0,0 +1,83 @@
+//go:build mattn || modernc
+
+package sql
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/generator"
+)
+
+func TestSQL(t *testing.T) {
+
+	ctx := context.Background()
+
+	uri := fmt.Sprintf("sqlite://%s?dsn=%s", sqlite.DEFAULT_ENGINE, filepath.Join(t.TempDir(), "sql.db"))
+
+	db, err := sqlite.NewSQLiteSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	g, err := generator.NewGenerator(&generator.Options{Seed: 1, Children: 2, Placetypes: []string{"country"}})
+
+	if err != nil {
+		t.Fatalf("Failed to create generator, %v", err)
+	}
+
+	_, err = generator.IndexDatabase(ctx, db, g)
+
+	if err != nil {
+		t.Fatalf("Failed to index features, %v", err)
+	}
+
+	db.Disconnect(ctx)
+
+	tests := []struct {
+		format     string
+		statements []string
+		input      string
+		expected   string
+	}{
+		{
+			format:     FORMAT_CSV,
+			statements: []string{"SELECT wof_id, wof_contains(geometry, (min_x + max_x) / 2, (min_y + max_y) / 2) AS contains FROM rtree ORDER BY wof_id"},
+			expected:   "wof_id,contains\n1,1\n2,1\n",
+		},
+		{
+			format:   FORMAT_NDJSON,
+			input:    "-- features in the south-west quadrant\n\nSELECT count(*) AS count FROM rtree WHERE wof_intersects(geometry, 'POLYGON((-180 -90, 0 -90, 0 0, -180 0, -180 -90))')\n",
+			expected: "{\"count\":1}\n",
+		},
+	}
+
+	for _, test := range tests {
+
+		var buf bytes.Buffer
+
+		opts := &RunOptions{
+			SpatialDatabaseURI: uri,
+			Statements:         test.statements,
+			Format:             test.format,
+			Reader:             strings.NewReader(test.input),
+			Writer:             &buf,
+		}
+
+		err := RunWithOptions(ctx, opts)
+
+		if err != nil {
+			t.Fatalf("Failed to run statements, %v", err)
+		}
+
+		if buf.String() != test.expected {
+			t.Fatalf("Unexpected output for %s: '%s'", test.format, buf.String())
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package sync
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+var spatial_database_uri string
+var iterator_uri string
+var index_alt_files bool
+var batch_size int
+var verbose bool
+
+func DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("sync")
+
+	fs.StringVar(&spatial_database_uri, "spatial-database-uri", "", "A valid sqlite:// spatial database URI (for example 'sqlite://sqlite3?dsn=/usr/local/data/ca.db').")
+	fs.StringVar(&iterator_uri, "iterator-uri", "repo://", "A valid whosonfirst/go-whosonfirst-iterate/v3 URI.")
+	fs.BoolVar(&index_alt_files, "index-alt-files", false, "Synchronize alternate geometries.")
+	fs.IntVar(&batch_size, "batch-size", 1000, "The number of added or updated records to index in each transaction.")
+	fs.BoolVar(&verbose, "verbose", false, "Enable verbose (debug) logging.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Synchronize a SQLite spatial database with one or more whosonfirst/go-whosonfirst-iterate/v3 sources, indexing records which have been added or updated and removing records which have been deleted.\n")
+		fmt.Fprintf(os.Stderr, "A summary of the changes made is written to STDOUT as JSON.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options] uri(N) uri(N)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Valid options are:\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs, nil
+}
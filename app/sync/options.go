@@ -0,0 +1,40 @@
+package sync
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+type RunOptions struct {
+	SpatialDatabaseURI string   `json:"spatial_database_uri"`
+	IteratorURI        string   `json:"iterator_uri"`
+	Sources            []string `json:"sources"`
+	IndexAltFiles      bool     `json:"index_alt_files"`
+	BatchSize          int      `json:"batch_size"`
+	Verbose            bool     `json:"verbose"`
+}
+
+func RunOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunOptions, error) {
+
+	flagset.Parse(fs)
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WHOSONFIRST")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set flags from environment variables, %w", err)
+	}
+
+	opts := &RunOptions{
+		SpatialDatabaseURI: spatial_database_uri,
+		IteratorURI:        iterator_uri,
+		Sources:            fs.Args(),
+		IndexAltFiles:      index_alt_files,
+		BatchSize:          batch_size,
+		Verbose:            verbose,
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,125 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-iterate/v3"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+func Run(ctx context.Context) error {
+
+	fs, err := DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create application flag set, %w", err)
+	}
+
+	return RunWithFlagSet(ctx, fs)
+}
+
+func RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	opts, err := RunOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive options from flagset, %w", err)
+	}
+
+	return RunWithOptions(ctx, opts)
+}
+
+func RunWithOptions(ctx context.Context, opts *RunOptions) error {
+
+	if opts.Verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		slog.Debug("Verbose logging enabled")
+	}
+
+	if opts.SpatialDatabaseURI == "" {
+		return fmt.Errorf("Missing -spatial-database-uri flag")
+	}
+
+	if len(opts.Sources) == 0 {
+		return fmt.Errorf("No sources to synchronize")
+	}
+
+	database_uri, err := databaseURI(opts)
+
+	if err != nil {
+		return err
+	}
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create spatial database, %w", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db, ok := db.(*sqlite.SQLiteSpatialDatabase)
+
+	if !ok {
+		return fmt.Errorf("Spatial database URI must be a single sqlite:// database")
+	}
+
+	it, err := iterate.NewIterator(ctx, opts.IteratorURI)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create iterator, %w", err)
+	}
+
+	defer it.Close()
+
+	sync_opts := &sqlite.SyncOptions{
+		Iterator:  it,
+		Sources:   opts.Sources,
+		BatchSize: opts.BatchSize,
+	}
+
+	t1 := time.Now()
+
+	summary, err := sqlite_db.Sync(ctx, sync_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to synchronize database, %w", err)
+	}
+
+	slog.Debug("Synchronized database", "time", time.Since(t1))
+
+	enc := json.NewEncoder(os.Stdout)
+	err = enc.Encode(summary)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode summary, %w", err)
+	}
+
+	return nil
+}
+
+// databaseURI returns the spatial database URI defined in 'opts' with the "index-alt-files" parameter assigned.
+func databaseURI(opts *RunOptions) (string, error) {
+
+	u, err := url.Parse(opts.SpatialDatabaseURI)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse spatial database URI, %w", err)
+	}
+
+	if opts.IndexAltFiles {
+		q := u.Query()
+		q.Set("index-alt-files", "true")
+		u.RawQuery = q.Encode()
+	}
+
+	return u.String(), nil
+}
@@ -0,0 +1,43 @@
+package sqlite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+)
+
+// ParseBoundingBox parses a comma-separated string (minx,miny,maxx,maxy) in to an `orb.Bound` instance.
+func ParseBoundingBox(str_bbox string) (*orb.Bound, error) {
+
+	parts := strings.Split(str_bbox, ",")
+
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("Bounding box must contain 4 values")
+	}
+
+	coords := make([]float64, 4)
+
+	for idx, str_v := range parts {
+
+		v, err := strconv.ParseFloat(strings.TrimSpace(str_v), 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid bounding box value '%s', %w", str_v, err)
+		}
+
+		coords[idx] = v
+	}
+
+	if coords[0] > coords[2] || coords[1] > coords[3] {
+		return nil, fmt.Errorf("Bounding box minimum values must be less than or equal to maximum values")
+	}
+
+	bbox := orb.Bound{
+		Min: orb.Point{coords[0], coords[1]},
+		Max: orb.Point{coords[2], coords[3]},
+	}
+
+	return &bbox, nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	_ "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/app/export"
+)
+
+func main() {
+
+	ctx := context.Background()
+	err := export.Run(ctx)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"log"
 
 	_ "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
-	"github.com/whosonfirst/go-whosonfirst-spatial-www/app/server"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/app/http/server"
 )
 
 func main() {
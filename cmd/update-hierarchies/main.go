@@ -4,8 +4,7 @@ import (
 	"context"
 	"log"
 
-	_ "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
-	"github.com/whosonfirst/go-whosonfirst-spatial/app/hierarchy/update"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/app/hierarchy/update"
 )
 
 func main() {
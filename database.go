@@ -8,10 +8,10 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
-	gocache "github.com/patrickmn/go-cache"
 	"github.com/paulmach/orb"
 	database_sql "github.com/sfomuseum/go-database/sql"
 	"github.com/whosonfirst/go-reader/v2"
@@ -19,13 +19,20 @@ import (
 	"github.com/whosonfirst/go-whosonfirst-spatial/database"
 	"github.com/whosonfirst/go-whosonfirst-spr/v2"
 	"github.com/whosonfirst/go-writer/v3"
+	"go.opentelemetry.io/otel"
 )
 
+// The name of the OpenTelemetry tracer used for spans created by `SQLiteSpatialDatabase` instances.
+const TracerName string = "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+
+var tracer = otel.Tracer(TracerName)
+
 func init() {
 	ctx := context.Background()
 	database.RegisterSpatialDatabase(ctx, "sqlite", NewSQLiteSpatialDatabase)
 	reader.RegisterReader(ctx, "sqlite", NewSQLiteSpatialDatabaseReader)
 	writer.RegisterWriter(ctx, "sqlite", NewSQLiteSpatialDatabaseWriter)
+	reader.RegisterReader(ctx, PROPERTIES_READER_SCHEME, NewSQLitePropertiesReader)
 }
 
 // SQLiteSpatialDatabase is a struct that implements the `database.SpatialDatabase` for performing
@@ -34,19 +41,37 @@ func init() {
 type SQLiteSpatialDatabase struct {
 	database.SpatialDatabase
 	mu            *sync.RWMutex
-	db            *sql.DB
+	uri           string
+	conn          *sqliteConn
 	rtree_table   database_sql.Table
 	spr_table     database_sql.Table
 	geojson_table database_sql.Table
-	gocache       *gocache.Cache
-	dsn           string
-	is_tmp        bool
-	tmp_path      string
+	// The table used to append properties to results, by the `PropertiesReader` method.
+	properties_table database_sql.Table
+	metrics          *Metrics
+	// A boolean flag indicating whether alternate geometries are written to the database.
+	index_alt_files bool
+	dsn             string
+	is_tmp          bool
+	tmp_path        string
+	// A function to stop watching for changes to the underlying database file (and signals) for reloading.
+	stop_reload func()
+	// A boolean flag indicating whether the `Disconnect` method has been called. Databases are not reloaded once disconnected.
+	disconnected bool
+	// Point-in-polygon and intersects queries which take longer than this will be logged.
+	slow_query_threshold time.Duration
+	slow_query_log       *slowQueryLog
+	// The index used to find candidate records for spatial queries. One of `RTREE_INDEX_SQLITE` or `RTREE_INDEX_MEMORY`.
+	rtree_index string
+	// A boolean flag indicating whether an in-memory rtree index keeps parsed polygons rather than reading them from the rtree table.
+	rtree_index_polygons bool
 }
 
 // RTreeSpatialIndex is a struct representing an RTree based spatial index
 type RTreeSpatialIndex struct {
-	geometry  string
+	geometry string
+	// The parsed geometry, if already known (for example records from an in-memory rtree index).
+	polygon   orb.Polygon
 	bounds    orb.Bound
 	Id        string
 	FeatureId string
@@ -54,12 +79,24 @@ type RTreeSpatialIndex struct {
 	IsAlt bool
 	// The label for the feature (associated with the index) if it is an alternate geometry.
 	AltLabel string
+	// A boolean flag indicating whether the geometry has already been tested against the query, by a SQL function.
+	matched bool
 }
 
 func (sp RTreeSpatialIndex) Bounds() orb.Bound {
 	return sp.bounds
 }
 
+// parsePolygon returns the polygon for 'sp', parsing its geometry if necessary.
+func (sp RTreeSpatialIndex) parsePolygon() (orb.Polygon, error) {
+
+	if sp.polygon != nil {
+		return sp.polygon, nil
+	}
+
+	return parseRTreeGeometry(sp.geometry)
+}
+
 func (sp RTreeSpatialIndex) Path() string {
 
 	if sp.IsAlt {
@@ -91,7 +128,33 @@ func NewSQLiteSpatialDatabaseWriter(ctx context.Context, uri string) (writer.Wri
 }
 
 // NewSQLiteSpatialDatabase returns a new `whosonfirst/go-whosonfirst-spatial/database.database.SpatialDatabase`
-// instance for performing spatial operations derived from 'uri'.
+// instance for performing spatial operations derived from 'uri'. In addition to the 'dsn' parameter 'uri' may
+// contain the following optional query parameters:
+//   - 'slow-query-threshold' is a duration string (for example "250ms"); point-in-polygon and intersects queries
+//     which take longer will be logged.
+//   - 'slow-query-log' is the path to a line-delimited JSON file where slow queries are written. If empty slow
+//     queries are written to the default logger.
+//   - 'slow-query-log-max-size' is the size, in bytes, after which the slow query log is rotated. Default is 10MB.
+//   - 'slow-query-log-max-backups' is the number of rotated slow query logs to keep. Default is 5.
+//   - 'watch' is a boolean flag; if true the DSN file will be watched for changes and the database reloaded when
+//     it is replaced.
+//   - 'watch-delay' is a duration string (for example "5s") to wait for changes to the DSN file to settle before
+//     reloading the database. Default is 1s.
+//   - 'reload-on-sighup' is a boolean flag; if true the database will be reloaded when the process receives a SIGHUP signal.
+//   - 'memory' is a boolean flag; if true the database will be copied in to an in-memory database, using the SQLite
+//     backup API, when it is opened (or reloaded). This requires that `BackupDatabase` be assigned, which happens
+//     automatically when this package is built with the "mattn" or "modernc" tag.
+//   - 'index-alt-files' is a boolean flag; if true alternate geometries will be written to the rtree, spr and geojson
+//     tables by the `IndexFeature` and `IndexFeatures` methods. Default is false.
+//   - 'rtree-index' is the index used to find candidate records for spatial queries. Valid options are "sqlite" (the
+//     SQLite rtree module) and "memory" (an in-process R-tree loaded from the rtree table when the database is opened).
+//     Default is "sqlite".
+//   - 'rtree-index-polygons' is a boolean flag; if true the "memory" rtree index keeps each record's parsed polygons
+//     rather than reading them from the rtree table for every query. This is faster but uses more memory. Default is false.
+//   - 'upgrade' is a boolean flag; if true databases with an older schema version will be migrated in place when
+//     they are opened.
+//
+// If 'uri' contains more than one 'dsn' parameter then a `SQLiteMultiSpatialDatabase` instance is returned.
 func NewSQLiteSpatialDatabase(ctx context.Context, uri string) (database.SpatialDatabase, error) {
 
 	u, err := url.Parse(uri)
@@ -101,6 +164,11 @@ func NewSQLiteSpatialDatabase(ctx context.Context, uri string) (database.Spatial
 	}
 
 	q := u.Query()
+
+	if len(q["dsn"]) > 1 {
+		return NewSQLiteMultiSpatialDatabase(ctx, uri)
+	}
+
 	dsn := q.Get("dsn")
 
 	is_tmp := false
@@ -124,7 +192,7 @@ func NewSQLiteSpatialDatabase(ctx context.Context, uri string) (database.Spatial
 		uri = u.String()
 	}
 
-	db, err := database_sql.OpenWithURI(ctx, uri)
+	db, pin, err := openDatabase(ctx, uri)
 
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create new database, %w", err)
@@ -133,9 +201,18 @@ func NewSQLiteSpatialDatabase(ctx context.Context, uri string) (database.Spatial
 	spatial_db, err := NewSQLiteSpatialDatabaseWithDatabase(ctx, uri, db)
 
 	if err != nil {
+
+		if pin != nil {
+			pin.Close()
+		}
+
 		return nil, err
 	}
 
+	if pin != nil {
+		spatial_db.(*SQLiteSpatialDatabase).conn.pin = pin
+	}
+
 	if is_tmp {
 		spatial_db.(*SQLiteSpatialDatabase).is_tmp = is_tmp
 		spatial_db.(*SQLiteSpatialDatabase).tmp_path = tmp_path
@@ -149,13 +226,40 @@ func NewSQLiteSpatialDatabase(ctx context.Context, uri string) (database.Spatial
 // instance defined by 'sqlite_db'.
 func NewSQLiteSpatialDatabaseWithDatabase(ctx context.Context, uri string, db *sql.DB) (database.SpatialDatabase, error) {
 
-	rtree_table, err := tables.NewRTreeTableWithDatabase(ctx, db)
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	index_alt_files := false
+
+	if u.Query().Has("index-alt-files") {
+
+		v, err := strconv.ParseBool(u.Query().Get("index-alt-files"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?index-alt-files= parameter, %w", err)
+		}
+
+		index_alt_files = v
+	}
+
+	rtree_opts := &tables.RTreeTableOptions{
+		IndexAltFiles: index_alt_files,
+	}
+
+	rtree_table, err := tables.NewRTreeTableWithDatabaseAndOptions(ctx, db, rtree_opts)
 
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create rtree table, %w", err)
 	}
 
-	spr_table, err := tables.NewSPRTableWithDatabase(ctx, db)
+	spr_opts := &tables.SPRTableOptions{
+		IndexAltFiles: index_alt_files,
+	}
+
+	spr_table, err := tables.NewSPRTableWithDatabaseAndOptions(ctx, db, spr_opts)
 
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create spr table, %w", err)
@@ -164,18 +268,40 @@ func NewSQLiteSpatialDatabaseWithDatabase(ctx context.Context, uri string, db *s
 	// This is so we can satisfy the reader.Reader requirement
 	// in the spatial.SpatialDatabase interface
 
-	geojson_table, err := tables.NewGeoJSONTableWithDatabase(ctx, db)
+	geojson_opts, err := tables.DefaultGeoJSONTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create geojson table options, %w", err)
+	}
+
+	geojson_opts.IndexAltFiles = index_alt_files
+
+	geojson_table, err := tables.NewGeoJSONTableWithDatabaseAndOptions(ctx, db, geojson_opts)
 
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create geojson table, %w", err)
 	}
 
+	// This is so we can append properties to results without reading (and parsing) the
+	// entire GeoJSON body for each record. See database_properties.go
+
+	properties_opts := &tables.PropertiesTableOptions{
+		IndexAltFiles: index_alt_files,
+	}
+
+	properties_table, err := tables.NewPropertiesTableWithDatabaseAndOptions(ctx, db, properties_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create properties table, %w", err)
+	}
+
 	db_opts := database_sql.DefaultConfigureDatabaseOptions()
 
 	db_opts.Tables = []database_sql.Table{
 		rtree_table,
 		spr_table,
 		geojson_table,
+		properties_table,
 	}
 
 	db_opts.CreateTablesIfNecessary = true
@@ -186,20 +312,61 @@ func NewSQLiteSpatialDatabaseWithDatabase(ctx context.Context, uri string, db *s
 		return nil, fmt.Errorf("Failed to configure database, %w", err)
 	}
 
-	expires := 5 * time.Minute
-	cleanup := 30 * time.Minute
-
-	gc := gocache.New(expires, cleanup)
+	m := DefaultMetrics
 
 	mu := new(sync.RWMutex)
 
 	spatial_db := &SQLiteSpatialDatabase{
-		db:            db,
-		rtree_table:   rtree_table,
-		spr_table:     spr_table,
-		geojson_table: geojson_table,
-		gocache:       gc,
-		mu:            mu,
+		uri:              uri,
+		conn:             newSQLiteConn(db, m),
+		rtree_table:      rtree_table,
+		spr_table:        spr_table,
+		geojson_table:    geojson_table,
+		properties_table: properties_table,
+		metrics:          m,
+		mu:               mu,
+		index_alt_files:  index_alt_files,
+		rtree_index:      RTREE_INDEX_SQLITE,
+	}
+
+	spatial_db.conn.sql_functions = hasSQLFunctions(ctx, db)
+
+	err = parseRTreeIndexOptions(spatial_db, u.Query())
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = parseSchemaOptions(ctx, spatial_db, u.Query())
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = spatial_db.loadRTreeIndex(ctx, spatial_db.conn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The slow query log is opened last, before the reload options (which stop any watchers they have started if
+	// they fail), and closed if they fail so that it is not left open by a database which is never returned.
+
+	err = parseSlowQueryOptions(spatial_db, u.Query())
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = parseReloadOptions(ctx, spatial_db, u.Query())
+
+	if err != nil {
+
+		if spatial_db.slow_query_log != nil {
+			spatial_db.slow_query_log.Close()
+		}
+
+		return nil, err
 	}
 
 	return spatial_db, nil
@@ -0,0 +1,258 @@
+package sqlite
+
+// Benchmarks for the indexing and query paths, run against databases of synthetic features. For example:
+// `go test -run XXX -bench . -benchmem`.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/generator"
+)
+
+// benchmarkFeatures returns the GeoJSON-encoded features produced by 'opts'.
+func benchmarkFeatures(b *testing.B, opts *generator.Options) [][]byte {
+
+	ctx := context.Background()
+
+	g, err := generator.NewGenerator(opts)
+
+	if err != nil {
+		b.Fatalf("Failed to create generator, %v", err)
+	}
+
+	bodies := make([][]byte, 0)
+
+	for body, err := range g.Features(ctx) {
+
+		if err != nil {
+			b.Fatalf("Failed to generate feature, %v", err)
+		}
+
+		bodies = append(bodies, body)
+	}
+
+	return bodies
+}
+
+// newBenchmarkDatabase returns a new database, in a temporary directory, containing the features produced by 'opts',
+// the centroids of its (leaf) neighbourhood features and the number of features.
+func newBenchmarkDatabase(b *testing.B, opts *generator.Options) (*SQLiteSpatialDatabase, []orb.Point, int) {
+
+	ctx := context.Background()
+
+	bodies := benchmarkFeatures(b, opts)
+
+	uri := fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, filepath.Join(b.TempDir(), "benchmark.db"))
+
+	db, err := NewSQLiteSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		b.Fatalf("Failed to create database, %v", err)
+	}
+
+	b.Cleanup(func() {
+		db.Disconnect(ctx)
+	})
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	err = sqlite_db.IndexFeatures(ctx, bodies)
+
+	if err != nil {
+		b.Fatalf("Failed to index features, %v", err)
+	}
+
+	points := make([]orb.Point, 0)
+
+	for _, body := range bodies {
+
+		if gjson.GetBytes(body, "properties.wof:placetype").String() != "neighbourhood" {
+			continue
+		}
+
+		pt := orb.Point{
+			gjson.GetBytes(body, "properties.geom:longitude").Float(),
+			gjson.GetBytes(body, "properties.geom:latitude").Float(),
+		}
+
+		points = append(points, pt)
+	}
+
+	return sqlite_db, points, len(bodies)
+}
+
+// regularPolygon returns a polygon with 'count' vertices inscribed in a circle of radius 'r' degrees centered on 'center'.
+func regularPolygon(center orb.Point, r float64, count int) orb.Polygon {
+
+	ring := make(orb.Ring, count+1)
+
+	for i := 0; i < count; i++ {
+		a := float64(i) * 2 * math.Pi / float64(count)
+		ring[i] = orb.Point{center.X() + math.Cos(a)*r, center.Y() + math.Sin(a)*r}
+	}
+
+	ring[count] = ring[0]
+	return orb.Polygon{ring}
+}
+
+func BenchmarkIndexFeature(b *testing.B) {
+
+	ctx := context.Background()
+
+	db, _, _ := newBenchmarkDatabase(b, &generator.Options{Seed: 1, Children: 2})
+
+	bodies := benchmarkFeatures(b, &generator.Options{Seed: 2, StartId: 100000, Children: 4, Vertices: 64})
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		err := db.IndexFeature(ctx, bodies[i%len(bodies)])
+
+		if err != nil {
+			b.Fatalf("Failed to index feature, %v", err)
+		}
+	}
+}
+
+func BenchmarkPointInPolygon(b *testing.B) {
+
+	ctx := context.Background()
+
+	db, points, _ := newBenchmarkDatabase(b, &generator.Options{Seed: 1, Children: 4, InteriorRings: 2})
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		pt := points[i%len(points)]
+
+		_, err := db.PointInPolygon(ctx, &pt)
+
+		if err != nil {
+			b.Fatalf("Failed to perform point in polygon query, %v", err)
+		}
+	}
+}
+
+func BenchmarkIntersects(b *testing.B) {
+
+	ctx := context.Background()
+
+	db, points, _ := newBenchmarkDatabase(b, &generator.Options{Seed: 1, Children: 4})
+
+	tests := []struct {
+		label    string
+		radius   float64
+		vertices int
+	}{
+		{"small", 0.01, 8},
+		{"large", 5.0, 4096},
+	}
+
+	for _, test := range tests {
+
+		b.Run(test.label, func(b *testing.B) {
+
+			for i := 0; i < b.N; i++ {
+
+				poly := regularPolygon(points[i%len(points)], test.radius, test.vertices)
+
+				_, err := db.Intersects(ctx, poly)
+
+				if err != nil {
+					b.Fatalf("Failed to perform intersects query, %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+
+	ctx := context.Background()
+
+	db, _, count := newBenchmarkDatabase(b, &generator.Options{Seed: 1, Children: 4, Vertices: 256})
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		// Feature IDs are assigned sequentially starting at 1
+		id := strconv.Itoa((i % count) + 1)
+
+		r, err := db.Read(ctx, id)
+
+		if err != nil {
+			b.Fatalf("Failed to read %s, %v", id, err)
+		}
+
+		_, err = io.ReadAll(r)
+		r.Close()
+
+		if err != nil {
+			b.Fatalf("Failed to read body for %s, %v", id, err)
+		}
+	}
+}
+
+func BenchmarkRetrieveSPR(b *testing.B) {
+
+	ctx := context.Background()
+
+	db, _, count := newBenchmarkDatabase(b, &generator.Options{Seed: 1, Children: 4})
+
+	conn, release := db.acquire()
+	defer release()
+
+	for _, label := range []string{"warm", "cold"} {
+
+		b.Run(label, func(b *testing.B) {
+
+			conn.gocache.Flush()
+
+			// Fill the cache with every record before timing warm lookups
+
+			if label == "warm" {
+
+				for i := 0; i < count; i++ {
+
+					id := strconv.Itoa(i + 1)
+
+					_, err := db.retrieveSPR(ctx, conn, id)
+
+					if err != nil {
+						b.Fatalf("Failed to retrieve SPR for %s, %v", id, err)
+					}
+				}
+
+				b.ResetTimer()
+			}
+
+			for i := 0; i < b.N; i++ {
+
+				if label == "cold" {
+					b.StopTimer()
+					conn.gocache.Flush()
+					b.StartTimer()
+				}
+
+				id := strconv.Itoa((i % count) + 1)
+
+				_, err := db.retrieveSPR(ctx, conn, id)
+
+				if err != nil {
+					b.Fatalf("Failed to retrieve SPR for %s, %v", id, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-feature/alt"
+	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// IndexFeatures will index zero or more Who's On First GeoJSON Feature records, defined in 'bodies', in the spatial
+// database using a single transaction. Unlike `IndexFeature` any existing rtree rows for each record are removed
+// before it is indexed so records can be indexed again without creating duplicate rows. If any record fails to be
+// indexed the entire batch is rolled back.
+func (r *SQLiteSpatialDatabase) IndexFeatures(ctx context.Context, bodies [][]byte) error {
+
+	if len(bodies) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t1 := time.Now()
+
+	defer r.metrics.Since(metricWriteDuration, t1, "operation", "index")
+	r.metrics.Add(metricWritesTotal, float64(len(bodies)), "operation", "index")
+
+	ctx, span := tracer.Start(ctx, "IndexFeatures", trace.WithAttributes(attribute.Int("wof.count", len(bodies))))
+	defer span.End()
+
+	err := r.indexFeatures(ctx, bodies)
+
+	if err != nil {
+		r.metrics.Add(metricErrorsTotal, 1, "operation", "index")
+		recordSpanError(span, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *SQLiteSpatialDatabase) indexFeatures(ctx context.Context, bodies [][]byte) error {
+
+	db := r.conn.db
+
+	index_tables := r.indexTables()
+
+	has_tombstones, err := r.conn.hasTombstones(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create transaction, %w", err)
+	}
+
+	q := fmt.Sprintf("DELETE FROM %s WHERE wof_id = ? AND COALESCE(alt_label, '') = ?", r.rtree_table.Name())
+
+	stmt, err := tx.PrepareContext(ctx, q)
+
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to prepare statement, %w", err)
+	}
+
+	defer stmt.Close()
+
+	// The records to update in the in-memory rtree index, if present, once the transaction is committed
+
+	indexed := make([][]byte, 0)
+
+	for _, body := range bodies {
+
+		id, err := properties.Id(body)
+
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to derive ID, %w", err)
+		}
+
+		is_alt := alt.IsAlt(body)
+
+		if is_alt && !r.index_alt_files {
+			continue
+		}
+
+		alt_label := ""
+
+		if is_alt {
+
+			label, err := properties.AltLabel(body)
+
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("Failed to derive alt label for %d, %w", id, err)
+			}
+
+			alt_label = label
+		}
+
+		_, err = stmt.ExecContext(ctx, id, alt_label)
+
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to remove rtree rows for %d, %w", id, err)
+		}
+
+		for _, t := range index_tables {
+
+			err := t.IndexRecord(ctx, db, tx, body)
+
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("Failed to index %s table for %d, %w", t.Name(), id, err)
+			}
+		}
+
+		if has_tombstones {
+
+			err := clearTombstones(ctx, tx, id, alt_label)
+
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+
+		indexed = append(indexed, body)
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return fmt.Errorf("Failed to commit transaction, %w", err)
+	}
+
+	if r.conn.rtree != nil {
+
+		for _, body := range indexed {
+
+			err := r.syncMemoryRTree(ctx, r.conn, body)
+
+			if err != nil {
+				return fmt.Errorf("Failed to update in-memory rtree index, %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Analyze runs the SQLite `ANALYZE` command which gathers statistics about the tables and indices in the database
+// for use by the query planner. It is usually worth running after a large number of records have been indexed.
+func (r *SQLiteSpatialDatabase) Analyze(ctx context.Context) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err := r.conn.db.ExecContext(ctx, "ANALYZE")
+
+	if err != nil {
+		return fmt.Errorf("Failed to analyze database, %w", err)
+	}
+
+	return nil
+}
+
+// Vacuum runs the SQLite `VACUUM` command which rebuilds the database file, repacking it in to the minimal amount
+// of disk space.
+func (r *SQLiteSpatialDatabase) Vacuum(ctx context.Context) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err := r.conn.db.ExecContext(ctx, "VACUUM")
+
+	if err != nil {
+		return fmt.Errorf("Failed to vacuum database, %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+func TestIndexFeatures(t *testing.T) {
+
+	ctx := context.Background()
+
+	db_path := filepath.Join(t.TempDir(), "bulk.db")
+
+	db, err := database.NewSpatialDatabase(ctx, fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, db_path))
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	bodies := make([][]byte, 0)
+
+	for _, id := range []int64{101737491, 1360521545} {
+
+		body, err := os.ReadFile(fmt.Sprintf("fixtures/%d.geojson", id))
+
+		if err != nil {
+			t.Fatalf("Failed to read fixture for %d, %v", id, err)
+		}
+
+		bodies = append(bodies, body)
+	}
+
+	counts := make([]int, 2)
+
+	for i := 0; i < 2; i++ {
+
+		err = sqlite_db.IndexFeatures(ctx, bodies)
+
+		if err != nil {
+			t.Fatalf("Failed to index features, %v", err)
+		}
+
+		err = sqlite_db.conn.db.QueryRowContext(ctx, "SELECT COUNT(id) FROM rtree").Scan(&counts[i])
+
+		if err != nil {
+			t.Fatalf("Failed to count rtree rows, %v", err)
+		}
+	}
+
+	if counts[0] == 0 || counts[0] != counts[1] {
+		t.Fatalf("Unexpected rtree row counts after indexing features twice, %v", counts)
+	}
+
+	err = sqlite_db.IndexFeatures(ctx, [][]byte{[]byte(`{"type":"Feature"}`)})
+
+	if err == nil {
+		t.Fatalf("Expected invalid feature to fail")
+	}
+
+	err = sqlite_db.Analyze(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to analyze database, %v", err)
+	}
+}
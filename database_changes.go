@@ -0,0 +1,285 @@
+package sqlite
+
+// A feed of records that have been added, updated or removed since a given time.
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"slices"
+	"time"
+
+	database_sql "github.com/sfomuseum/go-database/sql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The name of the table where records removed by the `RemoveFeature` method are recorded.
+const TOMBSTONES_TABLE_NAME string = "tombstones"
+
+// The schema for the tombstones table. The 'lastmodified' column is the Unix timestamp when a record was removed or, if
+// it is later, the record's own last modified time.
+const tombstones_schema string = `CREATE TABLE IF NOT EXISTS %s (
+	id INTEGER NOT NULL,
+	alt_label TEXT,
+	lastmodified INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS %s_by_lastmod ON %s (lastmodified);`
+
+// Change is a struct describing a record that was added, updated or removed.
+type Change struct {
+	// The unique Who's On First ID of the record.
+	Id int64 `json:"id"`
+	// The alternate geometry label for the record, if it is an alternate geometry.
+	AltLabel string `json:"alt_label,omitempty"`
+	// The Unix timestamp when the record was last modified (or removed).
+	LastModified int64 `json:"lastmodified"`
+	// A boolean flag indicating whether the record was removed.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// ChangesDatabase is an interface for databases that can report the records which have changed since a given time.
+type ChangesDatabase interface {
+	// ChangedSince yields the records added, updated or removed after a Unix timestamp in ascending order of their
+	// last modified time.
+	ChangedSince(context.Context, int64) iter.Seq2[*Change, error]
+}
+
+// ChangedSince yields the records (and alternate geometries) whose 'lastmodified' time is after 'since' as well as
+// any records removed after 'since', in ascending order of their last modified (or removed) time. Records which are
+// removed and then indexed again are only reported as changed, with their own last modified time, since their
+// tombstones are removed when they are indexed.
+func (r *SQLiteSpatialDatabase) ChangedSince(ctx context.Context, since int64) iter.Seq2[*Change, error] {
+
+	return func(yield func(*Change, error) bool) {
+
+		ctx, span := tracer.Start(ctx, "ChangedSince", trace.WithAttributes(attribute.Int64("since", since)))
+		defer span.End()
+
+		conn, release := r.acquire()
+		defer release()
+
+		has_tombstones, err := database_sql.HasTable(ctx, conn.db, TOMBSTONES_TABLE_NAME)
+
+		if err != nil {
+			recordSpanError(span, err)
+			yield(nil, fmt.Errorf("Failed to determine whether tombstones table exists, %w", err))
+			return
+		}
+
+		q := fmt.Sprintf("SELECT id, alt_label, lastmodified, 0 AS deleted FROM %s WHERE lastmodified > ?", r.spr_table.Name())
+		args := []any{since}
+
+		if has_tombstones {
+			// Exclude tombstones for records which still exist, for example ones indexed again by another tool
+			q = fmt.Sprintf("%s UNION ALL SELECT t.id, t.alt_label, t.lastmodified, 1 AS deleted FROM %s t WHERE t.lastmodified > ? AND NOT EXISTS (SELECT 1 FROM %s s WHERE s.id = t.id AND COALESCE(s.alt_label, '') = COALESCE(t.alt_label, ''))", q, TOMBSTONES_TABLE_NAME, r.spr_table.Name())
+			args = append(args, since)
+		}
+
+		q = fmt.Sprintf("%s ORDER BY lastmodified ASC, deleted ASC", q)
+
+		rows, err := conn.db.QueryContext(ctx, q, args...)
+
+		if err != nil {
+			recordSpanError(span, err)
+			yield(nil, fmt.Errorf("Failed to query changes, %w", err))
+			return
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+
+			var id int64
+			var alt_label sql.NullString
+			var lastmod int64
+			var deleted int
+
+			err := rows.Scan(&id, &alt_label, &lastmod, &deleted)
+
+			if err != nil {
+				recordSpanError(span, err)
+				yield(nil, fmt.Errorf("Failed to scan change, %w", err))
+				return
+			}
+
+			c := &Change{
+				Id:           id,
+				AltLabel:     alt_label.String,
+				LastModified: lastmod,
+				Deleted:      deleted == 1,
+			}
+
+			if !yield(c, nil) {
+				return
+			}
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			recordSpanError(span, err)
+			yield(nil, fmt.Errorf("Failed to iterate changes, %w", err))
+			return
+		}
+	}
+}
+
+// ChangedSince yields the records added, updated or removed after 'since' in any of the databases for 'db', in ascending
+// order of their last modified time.
+func (db *SQLiteMultiSpatialDatabase) ChangedSince(ctx context.Context, since int64) iter.Seq2[*Change, error] {
+
+	return func(yield func(*Change, error) bool) {
+
+		changes := make([][]*Change, len(db.databases))
+
+		err := db.forEachDatabase(ctx, db.databases, func(ctx context.Context, m *multiDatabase) error {
+
+			db_changes := make([]*Change, 0)
+
+			for c, err := range m.db.ChangedSince(ctx, since) {
+
+				if err != nil {
+					return fmt.Errorf("Failed to derive changes for %s, %w", m.name, err)
+				}
+
+				db_changes = append(db_changes, c)
+			}
+
+			changes[db.offset(m)] = db_changes
+			return nil
+		})
+
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		all := slices.Concat(changes...)
+
+		slices.SortStableFunc(all, func(a *Change, b *Change) int {
+			return cmp.Compare(a.LastModified, b.LastModified)
+		})
+
+		for _, c := range all {
+
+			if !yield(c, nil) {
+				return
+			}
+		}
+	}
+}
+
+// addTombstones records that the record 'id' (and any alternate geometries) has been removed in the tombstones table,
+// creating the table if necessary.
+func (r *SQLiteSpatialDatabase) addTombstones(ctx context.Context, tx *sql.Tx, id int64) error {
+
+	schema := fmt.Sprintf(tombstones_schema, TOMBSTONES_TABLE_NAME, TOMBSTONES_TABLE_NAME, TOMBSTONES_TABLE_NAME)
+
+	_, err := tx.ExecContext(ctx, schema)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create tombstones table, %w", err)
+	}
+
+	q := fmt.Sprintf("SELECT alt_label, lastmodified FROM %s WHERE id = ?", r.spr_table.Name())
+
+	rows, err := tx.QueryContext(ctx, q, id)
+
+	if err != nil {
+		return fmt.Errorf("Failed to query alternate labels, %w", err)
+	}
+
+	// Removals are stamped with the current time, or the record's own last modified time if that is later, so that
+	// they are never reported before the change they remove.
+
+	now := time.Now().Unix()
+
+	labels := make(map[string]int64)
+
+	for rows.Next() {
+
+		var alt_label sql.NullString
+		var lastmod sql.NullInt64
+
+		err := rows.Scan(&alt_label, &lastmod)
+
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("Failed to scan alternate label, %w", err)
+		}
+
+		labels[alt_label.String] = max(now, lastmod.Int64)
+	}
+
+	rows.Close()
+
+	q = fmt.Sprintf("INSERT INTO %s (id, alt_label, lastmodified) VALUES (?, ?, ?)", TOMBSTONES_TABLE_NAME)
+
+	for alt_label, lastmod := range labels {
+
+		_, err := tx.ExecContext(ctx, q, id, alt_label, lastmod)
+
+		if err != nil {
+			return fmt.Errorf("Failed to add tombstone, %w", err)
+		}
+	}
+
+	return nil
+}
+
+// hasTombstones returns a boolean value indicating whether the database for 'conn' has a tombstones table. The database
+// is only queried the first time this method is called; after that the table is known to exist once `addedTombstones`
+// has been called.
+func (conn *sqliteConn) hasTombstones(ctx context.Context) (bool, error) {
+
+	conn.tombstones_mu.Lock()
+	defer conn.tombstones_mu.Unlock()
+
+	if !conn.tombstones_known {
+
+		has_table, err := database_sql.HasTable(ctx, conn.db, TOMBSTONES_TABLE_NAME)
+
+		if err != nil {
+			return false, fmt.Errorf("Failed to determine whether tombstones table exists, %w", err)
+		}
+
+		conn.tombstones = has_table
+		conn.tombstones_known = true
+	}
+
+	return conn.tombstones, nil
+}
+
+// addedTombstones records that the tombstones table has been created for the database for 'conn'.
+func (conn *sqliteConn) addedTombstones() {
+
+	conn.tombstones_mu.Lock()
+	defer conn.tombstones_mu.Unlock()
+
+	conn.tombstones = true
+	conn.tombstones_known = true
+}
+
+// execer is the interface shared by `sql.DB` and `sql.Tx` instances for executing statements.
+type execer interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}
+
+// clearTombstones removes any tombstones for the record 'id' with the alternate geometry label 'alt_label' because it
+// has been indexed again.
+func clearTombstones(ctx context.Context, ex execer, id int64, alt_label string) error {
+
+	q := fmt.Sprintf("DELETE FROM %s WHERE id = ? AND COALESCE(alt_label, '') = ?", TOMBSTONES_TABLE_NAME)
+
+	_, err := ex.ExecContext(ctx, q, id, alt_label)
+
+	if err != nil {
+		return fmt.Errorf("Failed to remove tombstones for %d, %w", id, err)
+	}
+
+	return nil
+}
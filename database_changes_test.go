@@ -0,0 +1,138 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/tidwall/sjson"
+)
+
+func TestChangedSince(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := NewSQLiteSpatialDatabase(ctx, "sqlite://"+DEFAULT_ENGINE+"?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	body, err := os.ReadFile("fixtures/101737491.geojson")
+
+	if err != nil {
+		t.Fatalf("Failed to read fixture, %v", err)
+	}
+
+	err = db.IndexFeature(ctx, body)
+
+	if err != nil {
+		t.Fatalf("Failed to index fixture, %v", err)
+	}
+
+	changes_db := db.(ChangesDatabase)
+
+	collect := func(since int64) []*Change {
+
+		changes := make([]*Change, 0)
+
+		for c, err := range changes_db.ChangedSince(ctx, since) {
+
+			if err != nil {
+				t.Fatalf("Failed to derive changes, %v", err)
+			}
+
+			changes = append(changes, c)
+		}
+
+		return changes
+	}
+
+	changes := collect(0)
+
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 change but got %d", len(changes))
+	}
+
+	if changes[0].Id != 101737491 || changes[0].Deleted {
+		t.Fatalf("Unexpected change %v", changes[0])
+	}
+
+	lastmod := changes[0].LastModified
+
+	changes = collect(lastmod)
+
+	if len(changes) != 0 {
+		t.Fatalf("Expected no changes after %d but got %d", lastmod, len(changes))
+	}
+
+	err = db.RemoveFeature(ctx, "101737491")
+
+	if err != nil {
+		t.Fatalf("Failed to remove feature, %v", err)
+	}
+
+	changes = collect(lastmod)
+
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 change after removal but got %d", len(changes))
+	}
+
+	if changes[0].Id != 101737491 || !changes[0].Deleted {
+		t.Fatalf("Expected removal of 101737491, got %v", changes[0])
+	}
+
+	if changes[0].LastModified < lastmod {
+		t.Fatalf("Expected removal to be reported after %d, got %d", lastmod, changes[0].LastModified)
+	}
+
+	// Indexing a record again, even with an older last modified time, clears its removal
+
+	older, err := sjson.SetBytes(body, "properties.wof:lastmodified", lastmod-86400)
+
+	if err != nil {
+		t.Fatalf("Failed to update last modified time, %v", err)
+	}
+
+	for _, index := range []func() error{
+		func() error { return db.IndexFeature(ctx, older) },
+		func() error { return db.(*SQLiteSpatialDatabase).IndexFeatures(ctx, [][]byte{older}) },
+	} {
+
+		err = db.RemoveFeature(ctx, "101737491")
+
+		if err != nil {
+			t.Fatalf("Failed to remove feature, %v", err)
+		}
+
+		err = index()
+
+		if err != nil {
+			t.Fatalf("Failed to index feature again, %v", err)
+		}
+
+		changes = collect(0)
+
+		if len(changes) != 1 {
+			t.Fatalf("Expected 1 change after indexing again but got %d", len(changes))
+		}
+
+		if changes[0].Id != 101737491 || changes[0].Deleted {
+			t.Fatalf("Expected 101737491 to be reported as changed, got %v", changes[0])
+		}
+
+		var count int
+
+		err = db.(*SQLiteSpatialDatabase).conn.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+TOMBSTONES_TABLE_NAME).Scan(&count)
+
+		if err != nil {
+			t.Fatalf("Failed to count tombstones, %v", err)
+		}
+
+		if count != 0 {
+			t.Fatalf("Expected tombstones to be removed after indexing again but got %d", count)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !modernc || mattn
+
+package sqlite
+
+// DEFAULT_ENGINE is the name of the database/sql driver used to open SQLite databases when one is not specified.
+const DEFAULT_ENGINE string = "sqlite3"
@@ -0,0 +1,147 @@
+package sqlite
+
+// SQL functions for performing exact geometry tests inside SQLite statements.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkt"
+	"github.com/paulmach/orb/planar"
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+// SQL_FUNCTIONS_ENGINE is the name of the database/sql driver, registered when this package is built with the "mattn"
+// or "modernc" tag, whose connections provide the `wof_contains` and `wof_intersects` SQL functions. For example:
+// "sqlite://sqlite3_wof?dsn=test.db".
+const SQL_FUNCTIONS_ENGINE string = "sqlite3_wof"
+
+// The name of the SQL function which returns 1 if a geometry contains a coordinate.
+const SQL_FUNCTION_CONTAINS string = "wof_contains"
+
+// The name of the SQL function which returns 1 if a geometry intersects a WKT-encoded geometry.
+const SQL_FUNCTION_INTERSECTS string = "wof_intersects"
+
+// sql_function_wkt_cache_size is the maximum number of parsed query geometries kept by `parseQueryWKT`.
+const sql_function_wkt_cache_size int = 64
+
+var sql_function_wkt_cache = make(map[string]geom.Geometry)
+var sql_function_wkt_mu = new(sync.RWMutex)
+
+// WOFContains implements the `wof_contains(geometry, x, y)` SQL function. It returns true if 'geometry', a polygon encoded
+// as WKT, WKB or JSON coordinates (as stored in the rtree table), contains the coordinate 'x' (longitude), 'y' (latitude).
+// Geometries which can not be parsed are an error, as they are when point-in-polygon queries are performed in Go.
+func WOFContains(geometry string, x float64, y float64) (bool, error) {
+
+	poly, err := parseRTreeGeometry(geometry)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to parse geometry, %w", err)
+	}
+
+	return planar.PolygonContains(poly, orb.Point{x, y}), nil
+}
+
+// WOFIntersects implements the `wof_intersects(geometry, wkt)` SQL function. It returns true if 'geometry', a polygon encoded
+// as WKT, WKB or JSON coordinates (as stored in the rtree table), intersects the WKT-encoded geometry 'str_wkt'. The test is
+// the same as the one performed by `whosonfirst/go-whosonfirst-spatial/geo.Intersects`. Geometries, or values of 'str_wkt',
+// which can not be parsed are an error, as they are when intersects queries are performed in Go.
+func WOFIntersects(geometry string, str_wkt string) (bool, error) {
+
+	g2, err := parseQueryWKT(str_wkt)
+
+	if err != nil {
+		return false, err
+	}
+
+	poly, err := parseRTreeGeometry(geometry)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to parse geometry, %w", err)
+	}
+
+	g1, err := geom.UnmarshalWKT(wkt.MarshalString(poly))
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to derive geometry, %w", err)
+	}
+
+	return geom.Intersects(g1, g2), nil
+}
+
+// parseQueryWKT parses the WKT-encoded geometry 'str_wkt'. Since the same query geometry is passed to `wof_intersects`
+// for every candidate row parsed geometries are cached, up to `sql_function_wkt_cache_size` of them at a time.
+func parseQueryWKT(str_wkt string) (geom.Geometry, error) {
+
+	sql_function_wkt_mu.RLock()
+	g, ok := sql_function_wkt_cache[str_wkt]
+	sql_function_wkt_mu.RUnlock()
+
+	if ok {
+		return g, nil
+	}
+
+	g, err := geom.UnmarshalWKT(str_wkt)
+
+	if err != nil {
+		return geom.Geometry{}, fmt.Errorf("Failed to parse WKT, %w", err)
+	}
+
+	sql_function_wkt_mu.Lock()
+	defer sql_function_wkt_mu.Unlock()
+
+	if len(sql_function_wkt_cache) >= sql_function_wkt_cache_size {
+		clear(sql_function_wkt_cache)
+	}
+
+	sql_function_wkt_cache[str_wkt] = g
+	return g, nil
+}
+
+// sqlFunctionFloat converts the SQL function argument 'v' in to a float64 value. SQLite passes numeric literals without
+// a decimal point as integers.
+func sqlFunctionFloat(v any) (float64, error) {
+
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int64:
+		return float64(n), nil
+	default:
+		return 0, fmt.Errorf("Invalid numeric argument, %v", v)
+	}
+}
+
+// sqlFunctionString converts the SQL function argument 'v' in to a string value. Geometries may be stored as text or blobs.
+func sqlFunctionString(v any) (string, error) {
+
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case []byte:
+		return string(s), nil
+	default:
+		return "", fmt.Errorf("Invalid string argument, %v", v)
+	}
+}
+
+// hasSQLFunctions returns a boolean value indicating whether the `wof_contains` and `wof_intersects` SQL functions are
+// available to 'db'.
+func hasSQLFunctions(ctx context.Context, db *sql.DB) bool {
+
+	q := fmt.Sprintf("SELECT %s('POLYGON((0 0, 1 0, 1 1, 0 1, 0 0))', 0.5, 0.5), %s('POLYGON((0 0, 1 0, 1 1, 0 1, 0 0))', 'POINT(0.5 0.5)')", SQL_FUNCTION_CONTAINS, SQL_FUNCTION_INTERSECTS)
+
+	var contains bool
+	var intersects bool
+
+	err := db.QueryRowContext(ctx, q).Scan(&contains, &intersects)
+
+	if err != nil {
+		return false
+	}
+
+	return contains && intersects
+}
@@ -0,0 +1,126 @@
+//go:build mattn || modernc
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+func TestSQLFunctions(t *testing.T) {
+
+	ctx := context.Background()
+
+	uri, err := createFixturesDatabase(ctx, t.TempDir())
+
+	if err != nil {
+		t.Fatalf("Failed to create fixtures database, %v", err)
+	}
+
+	functions_uri := strings.Replace(uri, fmt.Sprintf("sqlite://%s?", DEFAULT_ENGINE), fmt.Sprintf("sqlite://%s?", SQL_FUNCTIONS_ENGINE), 1)
+
+	db, err := database.NewSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create spatial database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	functions_db, err := database.NewSpatialDatabase(ctx, functions_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create spatial database with SQL functions, %v", err)
+	}
+
+	defer functions_db.Disconnect(ctx)
+
+	if db.(*SQLiteSpatialDatabase).conn.sql_functions {
+		t.Fatalf("Did not expect SQL functions for %s", uri)
+	}
+
+	if !functions_db.(*SQLiteSpatialDatabase).conn.sql_functions {
+		t.Fatalf("Expected SQL functions for %s", functions_uri)
+	}
+
+	// Both databases should return the same results for every query test case
+
+	paths, err := filepath.Glob("testdata/queries/*.json")
+
+	if err != nil {
+		t.Fatalf("Failed to list query test cases, %v", err)
+	}
+
+	for _, path := range paths {
+
+		spec, err := readQuerySpec(path)
+
+		if err != nil {
+			t.Fatalf("Failed to read %s, %v", path, err)
+		}
+
+		if spec.Database != "" {
+			continue
+		}
+
+		spec.Repeat = 1
+
+		ids, err := runQuerySpec(ctx, db, spec)
+
+		if err != nil {
+			t.Fatalf("Failed to run query for %s, %v", path, err)
+		}
+
+		functions_ids, err := runQuerySpec(ctx, functions_db, spec)
+
+		if err != nil {
+			t.Fatalf("Failed to run query, with SQL functions, for %s, %v", path, err)
+		}
+
+		if !slices.Equal(ids, functions_ids) {
+			t.Fatalf("%s: expected %v with SQL functions, got %v", spec.Description, ids, functions_ids)
+		}
+	}
+
+	// Functions can be used in ad-hoc queries, with integer coordinates
+
+	conn, release := functions_db.(*SQLiteSpatialDatabase).acquire()
+	defer release()
+
+	q := "SELECT wof_id FROM rtree WHERE wof_contains(geometry, -71.330873, 46.852675) AND NOT wof_contains(geometry, 0, 0) AND wof_intersects(geometry, 'POINT(-71.330873 46.852675)')"
+
+	rows, err := conn.db.QueryContext(ctx, q)
+
+	if err != nil {
+		t.Fatalf("Failed to query rtree, %v", err)
+	}
+
+	defer rows.Close()
+
+	found := false
+
+	for rows.Next() {
+
+		var id int64
+
+		err := rows.Scan(&id)
+
+		if err != nil {
+			t.Fatalf("Failed to scan row, %v", err)
+		}
+
+		if id == 101737491 {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatalf("Expected 101737491 in ad-hoc query results")
+	}
+}
@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"testing"
+)
+
+func TestWOFContains(t *testing.T) {
+
+	tests := map[string]bool{
+		"POLYGON((0 0, 10 0, 10 10, 0 10, 0 0), (4 4, 6 4, 6 6, 4 6, 4 4))": false,
+		"POLYGON((0 0, 10 0, 10 10, 0 10, 0 0))":                            true,
+		"[[[0,0],[10,0],[10,10],[0,10],[0,0]]]":                             true,
+		"POLYGON((20 20, 30 20, 30 30, 20 30, 20 20))":                      false,
+	}
+
+	for geometry, expected := range tests {
+
+		ok, err := WOFContains(geometry, 5.0, 5.0)
+
+		if err != nil {
+			t.Fatalf("Failed to test %s, %v", geometry, err)
+		}
+
+		if ok != expected {
+			t.Fatalf("Expected %t for %s, got %t", expected, geometry, ok)
+		}
+	}
+
+	_, err := WOFContains("POINT(5 5)", 5.0, 5.0)
+
+	if err == nil {
+		t.Fatalf("Expected non-polygon geometry to fail")
+	}
+}
+
+func TestWOFIntersects(t *testing.T) {
+
+	geometry := "POLYGON((0 0, 10 0, 10 10, 0 10, 0 0))"
+
+	tests := map[string]bool{
+		"POINT(5 5)":                                   true,
+		"LINESTRING(-5 5, 15 5)":                       true,
+		"POLYGON((9 9, 20 9, 20 20, 9 20, 9 9))":       true,
+		"POLYGON((20 20, 30 20, 30 30, 20 30, 20 20))": false,
+	}
+
+	for str_wkt, expected := range tests {
+
+		ok, err := WOFIntersects(geometry, str_wkt)
+
+		if err != nil {
+			t.Fatalf("Failed to test %s, %v", str_wkt, err)
+		}
+
+		if ok != expected {
+			t.Fatalf("Expected %t for %s, got %t", expected, str_wkt, ok)
+		}
+	}
+
+	_, err := WOFIntersects("POINT(5 5)", "POINT(5 5)")
+
+	if err == nil {
+		t.Fatalf("Expected non-polygon geometry to fail")
+	}
+
+	_, err = WOFIntersects(geometry, "POINT(")
+
+	if err == nil {
+		t.Fatalf("Expected invalid WKT to fail")
+	}
+}
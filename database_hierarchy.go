@@ -0,0 +1,194 @@
+package sqlite
+
+// Support for resolving hierarchies with a single point-in-polygon query per coordinate.
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/paulmach/orb"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+)
+
+// The maximum number of coordinates whose point-in-polygon results are cached by `PointInPolygonHierarchyDatabase`.
+const hierarchy_cache_size int = 256
+
+// PlacetypeResults is a struct containing the results of a point-in-polygon query for a single placetype.
+type PlacetypeResults struct {
+	// The name of the placetype.
+	Placetype string `json:"placetype"`
+	// The records, matching the placetype, which contain the query coordinate.
+	Results []spr.StandardPlacesResult `json:"results"`
+}
+
+// PointInPolygonWithPlacetypes performs a single point-in-polygon query for 'coord' and returns the records matching
+// any of 'placetypes' grouped by placetype, in the same order as 'placetypes'. Placetypes with no matches are included
+// with an empty list of results. Placetype names may include a placetype definition URI (for example "region#whosonfirst://")
+// which is ignored. Any placetype criteria defined in 'filters' are also applied so 'filters' should usually only contain
+// existential or date criteria.
+func (db *SQLiteSpatialDatabase) PointInPolygonWithPlacetypes(ctx context.Context, coord *orb.Point, placetypes []string, filters ...spatial.Filter) ([]*PlacetypeResults, error) {
+
+	ctx, span := tracer.Start(ctx, "PointInPolygonWithPlacetypes")
+	defer span.End()
+
+	results := make([]*PlacetypeResults, len(placetypes))
+	lookup := make(map[string]*PlacetypeResults)
+
+	for idx, pt := range placetypes {
+
+		pt_results := &PlacetypeResults{
+			Placetype: pt,
+			Results:   make([]spr.StandardPlacesResult, 0),
+		}
+
+		results[idx] = pt_results
+
+		name := strings.SplitN(pt, "#", 2)[0]
+
+		_, exists := lookup[name]
+
+		if !exists {
+			lookup[name] = pt_results
+		}
+	}
+
+	for r, err := range db.PointInPolygonWithIterator(ctx, coord, filters...) {
+
+		if err != nil {
+			recordSpanError(span, err)
+			return nil, err
+		}
+
+		pt_results, ok := lookup[r.Placetype()]
+
+		if !ok {
+			continue
+		}
+
+		pt_results.Results = append(pt_results.Results, r)
+	}
+
+	return results, nil
+}
+
+// PointInPolygonHierarchyDatabase wraps a `SQLiteSpatialDatabase` instance for use with the
+// `whosonfirst/go-whosonfirst-spatial/hierarchy.PointInPolygonHierarchyResolver` package. That resolver performs a
+// point-in-polygon query for each ancestor placetype of a record until one of them matches. This type performs a
+// single query for all placetypes the first time a coordinate is seen and answers subsequent queries for the same
+// coordinate by filtering those results in memory.
+type PointInPolygonHierarchyDatabase struct {
+	*SQLiteSpatialDatabase
+	cache_mu *sync.Mutex
+	cache    map[orb.Point][]spr.StandardPlacesResult
+	// The order in which coordinates were added to cache, used to evict the oldest coordinates.
+	cache_keys []orb.Point
+}
+
+// NewPointInPolygonHierarchyDatabase returns a new `PointInPolygonHierarchyDatabase` instance wrapping 'db'.
+func NewPointInPolygonHierarchyDatabase(db *SQLiteSpatialDatabase) *PointInPolygonHierarchyDatabase {
+
+	h := &PointInPolygonHierarchyDatabase{
+		SQLiteSpatialDatabase: db,
+		cache_mu:              new(sync.Mutex),
+		cache:                 make(map[orb.Point][]spr.StandardPlacesResult),
+		cache_keys:            make([]orb.Point, 0),
+	}
+
+	return h
+}
+
+// PointInPolygon will perform a point in polygon query against the database for records that contain 'coord' and
+// that are inclusive of any filters defined by 'filters'. Only the first query for a given coordinate is performed
+// against the database.
+func (h *PointInPolygonHierarchyDatabase) PointInPolygon(ctx context.Context, coord *orb.Point, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	possible, err := h.candidates(ctx, coord)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]spr.StandardPlacesResult, 0)
+
+	for _, r := range possible {
+
+		if h.matchesFilters(ctx, r, filters...) {
+			results = append(results, r)
+		}
+	}
+
+	spr_results := &SQLiteResults{
+		Places: results,
+	}
+
+	return spr_results, nil
+}
+
+// IndexFeature will index a Who's On First GeoJSON Feature record, defined in 'body', in the spatial database
+// and empty the cache of point-in-polygon results.
+func (h *PointInPolygonHierarchyDatabase) IndexFeature(ctx context.Context, body []byte) error {
+
+	defer h.flush()
+	return h.SQLiteSpatialDatabase.IndexFeature(ctx, body)
+}
+
+// RemoveFeature will remove the database record with ID 'id' from the database and empty the cache of
+// point-in-polygon results.
+func (h *PointInPolygonHierarchyDatabase) RemoveFeature(ctx context.Context, id string) error {
+
+	defer h.flush()
+	return h.SQLiteSpatialDatabase.RemoveFeature(ctx, id)
+}
+
+// candidates returns all the records which contain 'coord', regardless of placetype or any other criteria.
+func (h *PointInPolygonHierarchyDatabase) candidates(ctx context.Context, coord *orb.Point) ([]spr.StandardPlacesResult, error) {
+
+	h.cache_mu.Lock()
+	possible, ok := h.cache[*coord]
+	h.cache_mu.Unlock()
+
+	if ok {
+		return possible, nil
+	}
+
+	possible = make([]spr.StandardPlacesResult, 0)
+
+	for r, err := range h.SQLiteSpatialDatabase.PointInPolygonWithIterator(ctx, coord) {
+
+		if err != nil {
+			return nil, err
+		}
+
+		possible = append(possible, r)
+	}
+
+	h.cache_mu.Lock()
+	defer h.cache_mu.Unlock()
+
+	_, exists := h.cache[*coord]
+
+	if !exists {
+
+		if len(h.cache_keys) >= hierarchy_cache_size {
+			delete(h.cache, h.cache_keys[0])
+			h.cache_keys = h.cache_keys[1:]
+		}
+
+		h.cache[*coord] = possible
+		h.cache_keys = append(h.cache_keys, *coord)
+	}
+
+	return possible, nil
+}
+
+// flush empties the cache of point-in-polygon results.
+func (h *PointInPolygonHierarchyDatabase) flush() {
+
+	h.cache_mu.Lock()
+	defer h.cache_mu.Unlock()
+
+	h.cache = make(map[orb.Point][]spr.StandardPlacesResult)
+	h.cache_keys = make([]orb.Point, 0)
+}
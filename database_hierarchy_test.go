@@ -0,0 +1,140 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+)
+
+func TestPointInPolygonWithPlacetypes(t *testing.T) {
+
+	ctx := context.Background()
+
+	db_path := filepath.Join(t.TempDir(), "hierarchy.db")
+
+	db, err := database.NewSpatialDatabase(ctx, fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, db_path))
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	for _, id := range []int64{101737491, 1360521545} {
+
+		body, err := os.ReadFile(fmt.Sprintf("fixtures/%d.geojson", id))
+
+		if err != nil {
+			t.Fatalf("Failed to read fixture for %d, %v", id, err)
+		}
+
+		err = sqlite_db.IndexFeature(ctx, body)
+
+		if err != nil {
+			t.Fatalf("Failed to index %d, %v", id, err)
+		}
+	}
+
+	coord := orb.Point{-71.330873, 46.852675}
+
+	placetypes := []string{"neighbourhood", "locality#whosonfirst://", "region"}
+
+	results, err := sqlite_db.PointInPolygonWithPlacetypes(ctx, &coord, placetypes)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query, %v", err)
+	}
+
+	if len(results) != len(placetypes) {
+		t.Fatalf("Expected %d placetype results, got %d", len(placetypes), len(results))
+	}
+
+	for idx, pt_results := range results {
+
+		if pt_results.Placetype != placetypes[idx] {
+			t.Fatalf("Unexpected placetype at position %d, %s", idx, pt_results.Placetype)
+		}
+
+		expected := 0
+
+		if pt_results.Placetype == "locality#whosonfirst://" {
+			expected = 1
+		}
+
+		if len(pt_results.Results) != expected {
+			t.Fatalf("Expected %d results for %s, got %d", expected, pt_results.Placetype, len(pt_results.Results))
+		}
+	}
+
+	if results[1].Results[0].Id() != "101737491" {
+		t.Fatalf("Unexpected locality, %s", results[1].Results[0].Id())
+	}
+
+	// Now test the wrapper used by the hierarchy resolver
+
+	h := NewPointInPolygonHierarchyDatabase(sqlite_db)
+
+	for _, pt := range []string{"neighbourhood", "locality"} {
+
+		inputs, err := filter.NewSPRInputs()
+
+		if err != nil {
+			t.Fatalf("Failed to create SPR inputs, %v", err)
+		}
+
+		inputs.Placetypes = []string{pt}
+
+		f, err := filter.NewSPRFilterFromInputs(inputs)
+
+		if err != nil {
+			t.Fatalf("Failed to create SPR filter, %v", err)
+		}
+
+		rsp, err := h.PointInPolygon(ctx, &coord, f)
+
+		if err != nil {
+			t.Fatalf("Failed to perform point in polygon query for %s, %v", pt, err)
+		}
+
+		count := len(rsp.Results())
+
+		switch pt {
+		case "locality":
+			if count != 1 {
+				t.Fatalf("Expected 1 locality, got %d", count)
+			}
+		default:
+			if count != 0 {
+				t.Fatalf("Expected 0 results for %s, got %d", pt, count)
+			}
+		}
+	}
+
+	if len(h.cache) != 1 {
+		t.Fatalf("Expected 1 cached coordinate, got %d", len(h.cache))
+	}
+
+	err = h.RemoveFeature(ctx, "101737491")
+
+	if err != nil {
+		t.Fatalf("Failed to remove feature, %v", err)
+	}
+
+	rsp, err := h.PointInPolygon(ctx, &coord)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query, %v", err)
+	}
+
+	if len(rsp.Results()) != 0 {
+		t.Fatalf("Expected no results after removing feature, got %d", len(rsp.Results()))
+	}
+}
@@ -0,0 +1,312 @@
+package sqlite
+
+// Update the hierarchies of the records in a spatial database, writing the results back in to the database.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spatial/hierarchy"
+	hierarchy_filter "github.com/whosonfirst/go-whosonfirst-spatial/hierarchy/filter"
+)
+
+// UpdateHierarchiesOptions is a struct containing configuration options for the `UpdateHierarchies` method.
+type UpdateHierarchiesOptions struct {
+	// Zero or more placetypes that records must match to be updated. If empty all records are considered.
+	Placetypes []string
+	// If greater than zero only records whose last modified time is after this Unix timestamp are considered.
+	Since int64
+	// The number of updated records to write in each transaction. Default is 1000.
+	BatchSize int
+	// If true the changes that would be made are reported but the database is not modified.
+	DryRun bool
+	// Optional filter criteria applied to point-in-polygon results. Default is no criteria.
+	SPRFilterInputs *filter.SPRInputs
+	// Optional callback used to choose a parent from point-in-polygon results. Default is `FirstButForgivingSPRResultsFunc`.
+	SPRResultsFunc hierarchy_filter.FilterSPRResultsFunc
+	// Optional callback used to derive the properties to assign to a record. Default is `DefaultPointInPolygonHierarchyResolverUpdateCallback`.
+	PIPUpdateFunc hierarchy.PointInPolygonHierarchyResolverUpdateCallback
+}
+
+// HierarchyChange is a struct describing the change to the hierarchy of a single record.
+type HierarchyChange struct {
+	// The unique ID of the record.
+	Id int64 `json:"id"`
+	// The name of the record.
+	Name string `json:"name"`
+	// The placetype of the record.
+	Placetype string `json:"placetype"`
+	// The parent ID of the record before it was updated.
+	PreviousParentId int64 `json:"previous_parent_id"`
+	// The parent ID of the record after it was updated.
+	ParentId int64 `json:"parent_id"`
+	// The hierarchy of the record before it was updated.
+	PreviousHierarchy json.RawMessage `json:"previous_hierarchy"`
+	// The hierarchy of the record after it was updated.
+	Hierarchy json.RawMessage `json:"hierarchy"`
+}
+
+// ParentChanged returns a boolean value indicating whether the record's parent ID has changed.
+func (c *HierarchyChange) ParentChanged() bool {
+	return c.PreviousParentId != c.ParentId
+}
+
+// UpdateHierarchiesSummary is a struct describing the changes made by the `UpdateHierarchies` method.
+type UpdateHierarchiesSummary struct {
+	// The number of records whose hierarchies were resolved.
+	Checked int `json:"checked"`
+	// The number of records whose hierarchies changed (or would change, if DryRun is true).
+	Updated int `json:"updated"`
+	// A boolean flag indicating whether the database was left unmodified.
+	DryRun bool `json:"dry_run"`
+	// The details of each record whose hierarchy changed.
+	Changes []*HierarchyChange `json:"changes"`
+}
+
+// UpdateHierarchies resolves the hierarchy of each (non-alternate) record in the database, matching the criteria in 'opts',
+// by performing point-in-polygon queries against the database itself. Records whose `wof:parent_id` or `wof:hierarchy` properties
+// (or any other properties assigned by the update callback) change have their `wof:lastmodified` property updated and are written
+// back to the database, using `IndexFeatures`, in batches of one transaction each. If 'opts.DryRun' is true the changes are
+// reported but not written.
+func (r *SQLiteSpatialDatabase) UpdateHierarchies(ctx context.Context, opts *UpdateHierarchiesOptions) (*UpdateHierarchiesSummary, error) {
+
+	ctx, span := tracer.Start(ctx, "UpdateHierarchies")
+	defer span.End()
+
+	batch_size := opts.BatchSize
+
+	if batch_size <= 0 {
+		batch_size = 1000
+	}
+
+	inputs := opts.SPRFilterInputs
+
+	if inputs == nil {
+
+		i, err := filter.NewSPRInputs()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create SPR inputs, %w", err)
+		}
+
+		inputs = i
+	}
+
+	results_cb := opts.SPRResultsFunc
+
+	if results_cb == nil {
+		results_cb = hierarchy_filter.FirstButForgivingSPRResultsFunc
+	}
+
+	update_cb := opts.PIPUpdateFunc
+
+	if update_cb == nil {
+		update_cb = hierarchy.DefaultPointInPolygonHierarchyResolverUpdateCallback()
+	}
+
+	// Resolve hierarchies using a single point-in-polygon query for each record rather than one per ancestor placetype
+
+	h := NewPointInPolygonHierarchyDatabase(r)
+
+	resolver_opts := &hierarchy.PointInPolygonHierarchyResolverOptions{
+		Database: h,
+	}
+
+	resolver, err := hierarchy.NewPointInPolygonHierarchyResolver(ctx, resolver_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create hierarchy resolver, %w", err)
+	}
+
+	ids, err := r.hierarchyCandidates(ctx, opts)
+
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	summary := &UpdateHierarchiesSummary{
+		DryRun:  opts.DryRun,
+		Changes: make([]*HierarchyChange, 0),
+	}
+
+	batch := make([][]byte, 0, batch_size)
+
+	flush := func() error {
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := r.IndexFeatures(ctx, batch)
+
+		if err != nil {
+			return err
+		}
+
+		// Cached SPR results will have stale parent IDs
+
+		r.mu.RLock()
+		r.conn.flushCache()
+		r.mu.RUnlock()
+
+		h.flush()
+
+		batch = make([][]byte, 0, batch_size)
+		return nil
+	}
+
+	for _, id := range ids {
+
+		body, err := r.readGeoJSON(ctx, id, "")
+
+		if err != nil {
+			recordSpanError(span, err)
+			return nil, err
+		}
+
+		if body == nil {
+			slog.Warn("Record is missing from geojson table, skipping", "id", id)
+			continue
+		}
+
+		has_changed, new_body, err := resolver.PointInPolygonAndUpdate(ctx, inputs, results_cb, update_cb, body)
+
+		if err != nil {
+			recordSpanError(span, err)
+			return nil, fmt.Errorf("Failed to resolve hierarchy for %d, %w", id, err)
+		}
+
+		summary.Checked += 1
+
+		if !has_changed {
+			continue
+		}
+
+		new_body, err = sjson.SetBytes(new_body, "properties.wof:lastmodified", time.Now().Unix())
+
+		if err != nil {
+			recordSpanError(span, err)
+			return nil, fmt.Errorf("Failed to assign last modified time for %d, %w", id, err)
+		}
+
+		c := &HierarchyChange{
+			Id:                id,
+			Name:              gjson.GetBytes(body, "properties.wof:name").String(),
+			Placetype:         gjson.GetBytes(body, "properties.wof:placetype").String(),
+			PreviousParentId:  gjson.GetBytes(body, "properties.wof:parent_id").Int(),
+			ParentId:          gjson.GetBytes(new_body, "properties.wof:parent_id").Int(),
+			PreviousHierarchy: rawProperty(body, "wof:hierarchy"),
+			Hierarchy:         rawProperty(new_body, "wof:hierarchy"),
+		}
+
+		slog.Debug("Update hierarchy", "id", id, "previous parent", c.PreviousParentId, "parent", c.ParentId, "dry run", opts.DryRun)
+
+		summary.Updated += 1
+		summary.Changes = append(summary.Changes, c)
+
+		if opts.DryRun {
+			continue
+		}
+
+		batch = append(batch, new_body)
+
+		if len(batch) >= batch_size {
+
+			err := flush()
+
+			if err != nil {
+				recordSpanError(span, err)
+				return nil, err
+			}
+		}
+	}
+
+	err = flush()
+
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// hierarchyCandidates returns the IDs of the (non-alternate) records matching the placetype and last modified criteria in 'opts'.
+func (r *SQLiteSpatialDatabase) hierarchyCandidates(ctx context.Context, opts *UpdateHierarchiesOptions) ([]int64, error) {
+
+	conn, release := r.acquire()
+	defer release()
+
+	conditions := []string{
+		"COALESCE(alt_label, '') = ''",
+	}
+
+	args := make([]any, 0)
+
+	if len(opts.Placetypes) > 0 {
+
+		conditions = append(conditions, fmt.Sprintf("placetype IN (%s)", placeholders(len(opts.Placetypes))))
+
+		for _, pt := range opts.Placetypes {
+			args = append(args, pt)
+		}
+	}
+
+	if opts.Since > 0 {
+		conditions = append(conditions, "lastmodified > ?")
+		args = append(args, opts.Since)
+	}
+
+	q := fmt.Sprintf("SELECT CAST(id AS INTEGER) FROM %s WHERE %s ORDER BY CAST(id AS INTEGER)", r.spr_table.Name(), strings.Join(conditions, " AND "))
+
+	rows, err := conn.db.QueryContext(ctx, q, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query %s table, %w", r.spr_table.Name(), err)
+	}
+
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+
+	for rows.Next() {
+
+		var id int64
+
+		err := rows.Scan(&id)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan %s row, %w", r.spr_table.Name(), err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate %s rows, %w", r.spr_table.Name(), err)
+	}
+
+	return ids, nil
+}
+
+// rawProperty returns the raw JSON value of the property 'k' in 'body' or "null" if it is not present.
+func rawProperty(body []byte, k string) json.RawMessage {
+
+	rsp := gjson.GetBytes(body, "properties."+k)
+
+	if !rsp.Exists() {
+		return json.RawMessage("null")
+	}
+
+	return json.RawMessage(rsp.Raw)
+}
@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+// A neighbourhood, inside the locality of Quebec (101737491), with no parent.
+const hierarchy_update_neighbourhood string = `{"type":"Feature","id":1,"properties":{"wof:id":1,"wof:name":"Test","wof:placetype":"neighbourhood","wof:parent_id":-1,"wof:hierarchy":[],"wof:country":"CA","wof:repo":"whosonfirst-data-admin-ca","wof:lastmodified":1,"geom:latitude":46.852675,"geom:longitude":-71.330873,"mz:is_current":1},"bbox":[-71.330873,46.852675,-71.330873,46.852675],"geometry":{"type":"Point","coordinates":[-71.330873,46.852675]}}`
+
+func TestUpdateHierarchies(t *testing.T) {
+
+	ctx := context.Background()
+
+	db_path := filepath.Join(t.TempDir(), "hierarchy.db")
+
+	db, err := database.NewSpatialDatabase(ctx, fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, db_path))
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	body, err := os.ReadFile("fixtures/101737491.geojson")
+
+	if err != nil {
+		t.Fatalf("Failed to read fixture, %v", err)
+	}
+
+	err = sqlite_db.IndexFeatures(ctx, [][]byte{body, []byte(hierarchy_update_neighbourhood)})
+
+	if err != nil {
+		t.Fatalf("Failed to index features, %v", err)
+	}
+
+	parentId := func() int64 {
+
+		var parent_id int64
+
+		err := sqlite_db.conn.db.QueryRowContext(ctx, "SELECT parent_id FROM spr WHERE id = '1'").Scan(&parent_id)
+
+		if err != nil {
+			t.Fatalf("Failed to query parent ID, %v", err)
+		}
+
+		return parent_id
+	}
+
+	opts := &UpdateHierarchiesOptions{
+		Placetypes: []string{"neighbourhood"},
+		DryRun:     true,
+	}
+
+	summary, err := sqlite_db.UpdateHierarchies(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to update hierarchies (dry run), %v", err)
+	}
+
+	if summary.Checked != 1 || summary.Updated != 1 {
+		t.Fatalf("Unexpected dry run summary, %d checked %d updated", summary.Checked, summary.Updated)
+	}
+
+	c := summary.Changes[0]
+
+	if !c.ParentChanged() || c.PreviousParentId != -1 || c.ParentId != 101737491 {
+		t.Fatalf("Unexpected change, %d -> %d", c.PreviousParentId, c.ParentId)
+	}
+
+	if parentId() != -1 {
+		t.Fatalf("Dry run modified the database")
+	}
+
+	opts.DryRun = false
+
+	_, err = sqlite_db.UpdateHierarchies(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to update hierarchies, %v", err)
+	}
+
+	if parentId() != 101737491 {
+		t.Fatalf("Unexpected parent ID after update, %d", parentId())
+	}
+
+	summary, err = sqlite_db.UpdateHierarchies(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to update hierarchies again, %v", err)
+	}
+
+	if summary.Updated != 0 {
+		t.Fatalf("Expected no updates after updating hierarchies, got %d", summary.Updated)
+	}
+}
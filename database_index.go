@@ -4,32 +4,56 @@ package sqlite
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"iter"
 	"log/slog"
 	"os"
 	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkt"
 	"github.com/paulmach/orb/planar"
 	database_sql "github.com/sfomuseum/go-database/sql"
 	"github.com/whosonfirst/go-whosonfirst-spatial"
-	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/wkttoorb"
 	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
 	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
 	"github.com/whosonfirst/go-whosonfirst-spr/v2"
 	sqlite_spr "github.com/whosonfirst/go-whosonfirst-sqlite-spr/v2"
 	"github.com/whosonfirst/go-whosonfirst-uri"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Disconnect will close the underlying database connection.
+// Disconnect will close the underlying database connection. It waits for any queries using the connection to finish
+// first which means it should not be called from inside the loop of a query iterator.
 func (r *SQLiteSpatialDatabase) Disconnect(ctx context.Context) error {
 
+	r.mu.Lock()
+	r.disconnected = true
+	conn := r.conn
+	r.mu.Unlock()
+
+	if r.stop_reload != nil {
+		r.stop_reload()
+	}
+
+	conn.inflight.Wait()
+
+	err := conn.close()
+
+	if r.slow_query_log != nil {
+
+		err := r.slow_query_log.Close()
+
+		if err != nil {
+			slog.Error("Failed to close slow query log", "error", err)
+		}
+	}
+
 	if r.is_tmp {
 
 		err := os.Remove(r.tmp_path)
@@ -39,7 +63,7 @@ func (r *SQLiteSpatialDatabase) Disconnect(ctx context.Context) error {
 		}
 	}
 
-	return r.db.Close()
+	return err
 }
 
 // IndexFeature will index a Who's On First GeoJSON Feature record, defined in 'body', in the spatial database.
@@ -48,25 +72,61 @@ func (r *SQLiteSpatialDatabase) IndexFeature(ctx context.Context, body []byte) e
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	tables := []database_sql.Table{
-		r.rtree_table,
-		r.spr_table,
-	}
+	t1 := time.Now()
 
-	if r.geojson_table != nil {
-		tables = append(tables, r.geojson_table)
+	defer r.metrics.Since(metricWriteDuration, t1, "operation", "index")
+	r.metrics.Add(metricWritesTotal, 1, "operation", "index")
+
+	ctx, span := tracer.Start(ctx, "IndexFeature")
+	defer span.End()
+
+	has_tombstones, err := r.conn.hasTombstones(ctx)
+
+	if err != nil {
+		r.metrics.Add(metricErrorsTotal, 1, "operation", "index")
+		recordSpanError(span, err)
+		return err
 	}
 
-	err := database_sql.IndexRecord(ctx, r.db, body, tables...)
+	err = database_sql.IndexRecord(ctx, r.conn.db, body, r.indexTables()...)
 
 	if err != nil {
+		r.metrics.Add(metricErrorsTotal, 1, "operation", "index")
+		recordSpanError(span, err)
 		return fmt.Errorf("Failed to index record, %w", err)
 	}
 
+	if has_tombstones {
+
+		k, err := deriveSyncKey(body)
+
+		if err == nil {
+			err = clearTombstones(ctx, r.conn.db, k.id, k.alt_label)
+		}
+
+		if err != nil {
+			r.metrics.Add(metricErrorsTotal, 1, "operation", "index")
+			recordSpanError(span, err)
+			return err
+		}
+	}
+
+	if r.conn.rtree != nil {
+
+		err := r.syncMemoryRTree(ctx, r.conn, body)
+
+		if err != nil {
+			r.metrics.Add(metricErrorsTotal, 1, "operation", "index")
+			recordSpanError(span, err)
+			return fmt.Errorf("Failed to update in-memory rtree index, %w", err)
+		}
+	}
+
 	return nil
 }
 
-// RemoveFeature will remove the database record with ID 'id' from the database.
+// RemoveFeature will remove the database record with ID 'id' from the database. Removed records are recorded in the
+// tombstones table so they can be reported by the `ChangedSince` method.
 func (r *SQLiteSpatialDatabase) RemoveFeature(ctx context.Context, str_id string) error {
 
 	id, err := strconv.ParseInt(str_id, 10, 64)
@@ -75,24 +135,37 @@ func (r *SQLiteSpatialDatabase) RemoveFeature(ctx context.Context, str_id string
 		return fmt.Errorf("Failed to parse string ID '%s', %w", str_id, err)
 	}
 
-	tx, err := r.db.Begin()
+	t1 := time.Now()
+
+	defer r.metrics.Since(metricWriteDuration, t1, "operation", "remove")
+	r.metrics.Add(metricWritesTotal, 1, "operation", "remove")
+
+	ctx, span := tracer.Start(ctx, "RemoveFeature", trace.WithAttributes(attribute.Int64("wof.id", id)))
+	defer span.End()
+
+	conn, release := r.acquire()
+	defer release()
+
+	tx, err := conn.db.Begin()
 
 	if err != nil {
+		r.metrics.Add(metricErrorsTotal, 1, "operation", "remove")
+		recordSpanError(span, err)
 		return fmt.Errorf("Failed to create transaction, %w", err)
 	}
 
-	// defer tx.Rollback()
+	// This is a no-op once the transaction has been committed
+	defer tx.Rollback()
 
-	tables := []database_sql.Table{
-		r.rtree_table,
-		r.spr_table,
-	}
+	err = r.addTombstones(ctx, tx, id)
 
-	if r.geojson_table != nil {
-		tables = append(tables, r.geojson_table)
+	if err != nil {
+		r.metrics.Add(metricErrorsTotal, 1, "operation", "remove")
+		recordSpanError(span, err)
+		return err
 	}
 
-	for _, t := range tables {
+	for _, t := range r.indexTables() {
 
 		var q string
 
@@ -106,12 +179,16 @@ func (r *SQLiteSpatialDatabase) RemoveFeature(ctx context.Context, str_id string
 		stmt, err := tx.Prepare(q)
 
 		if err != nil {
+			r.metrics.Add(metricErrorsTotal, 1, "operation", "remove")
+			recordSpanError(span, err)
 			return fmt.Errorf("Failed to create query statement for %s, %w", t.Name(), err)
 		}
 
 		_, err = stmt.ExecContext(ctx, id)
 
 		if err != nil {
+			r.metrics.Add(metricErrorsTotal, 1, "operation", "remove")
+			recordSpanError(span, err)
 			return fmt.Errorf("Failed execute query statement for %s, %w", t.Name(), err)
 		}
 	}
@@ -119,12 +196,39 @@ func (r *SQLiteSpatialDatabase) RemoveFeature(ctx context.Context, str_id string
 	err = tx.Commit()
 
 	if err != nil {
+		r.metrics.Add(metricErrorsTotal, 1, "operation", "remove")
+		recordSpanError(span, err)
 		return fmt.Errorf("Failed to commit transaction, %w", err)
 	}
 
+	conn.addedTombstones()
+
+	if conn.rtree != nil {
+		conn.rtree.removeFeature(id)
+	}
+
 	return nil
 }
 
+// indexTables returns the list of tables that records are written to (and removed from).
+func (r *SQLiteSpatialDatabase) indexTables() []database_sql.Table {
+
+	tables := []database_sql.Table{
+		r.rtree_table,
+		r.spr_table,
+	}
+
+	if r.geojson_table != nil {
+		tables = append(tables, r.geojson_table)
+	}
+
+	if r.properties_table != nil {
+		tables = append(tables, r.properties_table)
+	}
+
+	return tables
+}
+
 // PointInPolygon will perform a point in polygon query against the database for records that contain 'coord' and
 // that are inclusive of any filters defined by 'filters'.
 func (db *SQLiteSpatialDatabase) PointInPolygon(ctx context.Context, coord *orb.Point, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
@@ -159,17 +263,54 @@ func (db *SQLiteSpatialDatabase) PointInPolygonWithIterator(ctx context.Context,
 
 		t1 := time.Now()
 
+		pt := metricsPlacetypes(filters...)
+
+		candidates := 0
+		t_candidates := time.Duration(0)
+		results := new(atomic.Int64)
+
 		defer func() {
+
 			slog.Debug("Time to PIP", "time", time.Since(t1))
+			db.metrics.Since(metricQueryDuration, t1, "query", "pip", "placetype", pt)
+
+			if db.isSlowQuery(t1) {
+				q := newSlowQuery("pip", t1, *coord, filters...)
+				q.Candidates = candidates
+				q.Results = results.Load()
+				q.Timings.Candidates = t_candidates
+				q.Timings.Total = time.Since(t1)
+				db.logSlowQuery(ctx, q)
+			}
 		}()
 
-		rows, err := db.getIntersectsByCoord(ctx, coord, filters...)
+		db.metrics.Add(metricQueriesTotal, 1, "query", "pip", "placetype", pt)
+
+		ctx, span := tracer.Start(ctx, "PointInPolygon", trace.WithAttributes(
+			attribute.Float64("latitude", coord.Y()),
+			attribute.Float64("longitude", coord.X()),
+			attribute.String("placetypes", pt),
+		))
+
+		defer span.End()
+
+		conn, release := db.acquire()
+		defer release()
+
+		rows, err := db.getIntersectsByCoord(ctx, conn, coord, filters...)
 
 		if err != nil {
+			db.metrics.Add(metricErrorsTotal, 1, "operation", "pip")
+			recordSpanError(span, err)
 			yield(nil, err)
 			return
 		}
 
+		candidates = len(rows)
+		t_candidates = time.Since(t1)
+
+		db.metrics.Observe(metricQueryCandidates, DefaultCountBuckets, float64(len(rows)), "query", "pip")
+
 		seen := new(sync.Map)
 		wg := new(sync.WaitGroup)
 
@@ -190,11 +331,13 @@ func (db *SQLiteSpatialDatabase) PointInPolygonWithIterator(ctx context.Context,
 					return
 				}
 
-				r, err := db.inflatePointInPolygonSpatialIndex(ctx, sp, coord, filters...)
+				r, err := db.inflatePointInPolygonSpatialIndex(ctx, conn, sp, coord, filters...)
 
 				if err != nil {
 
 					slog.Error("Failed to inflate index", "error", err)
+					db.metrics.Add(metricErrorsTotal, 1, "operation", "pip")
+					recordSpanError(span, err)
 
 					if working.Load() {
 
@@ -213,6 +356,7 @@ func (db *SQLiteSpatialDatabase) PointInPolygonWithIterator(ctx context.Context,
 				seen.Store(sp.Id, r)
 
 				if working.Load() {
+					results.Add(1)
 					yield(r, nil)
 				}
 			})
@@ -252,15 +396,54 @@ func (db *SQLiteSpatialDatabase) IntersectsWithIterator(ctx context.Context, geo
 
 	return func(yield func(spr.StandardPlacesResult, error) bool) {
 
-		bound := geom.Bound()
+		t1 := time.Now()
+
+		pt := metricsPlacetypes(filters...)
+
+		candidates := 0
+		t_candidates := time.Duration(0)
+		results := new(atomic.Int64)
+
+		defer func() {
+
+			db.metrics.Since(metricQueryDuration, t1, "query", "intersects", "placetype", pt)
+
+			if db.isSlowQuery(t1) {
+				q := newSlowQuery("intersects", t1, geom, filters...)
+				q.Candidates = candidates
+				q.Results = results.Load()
+				q.Timings.Candidates = t_candidates
+				q.Timings.Total = time.Since(t1)
+				db.logSlowQuery(ctx, q)
+			}
+		}()
+
+		db.metrics.Add(metricQueriesTotal, 1, "query", "intersects", "placetype", pt)
+
+		ctx, span := tracer.Start(ctx, "Intersects", trace.WithAttributes(
+			attribute.String("geometry", geom.GeoJSONType()),
+			attribute.String("placetypes", pt),
+		))
+
+		defer span.End()
 
-		rows, err := db.getIntersectsByRect(ctx, &bound, filters...)
+		conn, release := db.acquire()
+		defer release()
+
+		rows, err := db.getIntersectsByGeometry(ctx, conn, geom, filters...)
 
 		if err != nil {
+			db.metrics.Add(metricErrorsTotal, 1, "operation", "intersects")
+			recordSpanError(span, err)
 			yield(nil, err)
 			return
 		}
 
+		candidates = len(rows)
+		t_candidates = time.Since(t1)
+
+		db.metrics.Observe(metricQueryCandidates, DefaultCountBuckets, float64(len(rows)), "query", "intersects")
+
 		seen := new(sync.Map)
 		wg := new(sync.WaitGroup)
 
@@ -281,10 +464,13 @@ func (db *SQLiteSpatialDatabase) IntersectsWithIterator(ctx context.Context, geo
 					return
 				}
 
-				r, err := db.inflateIntersectsSpatialIndex(ctx, sp, geom, filters...)
+				r, err := db.inflateIntersectsSpatialIndex(ctx, conn, sp, geom, filters...)
 
 				if err != nil {
 
+					db.metrics.Add(metricErrorsTotal, 1, "operation", "intersects")
+					recordSpanError(span, err)
+
 					if working.Load() {
 
 						if !yield(nil, err) {
@@ -302,6 +488,7 @@ func (db *SQLiteSpatialDatabase) IntersectsWithIterator(ctx context.Context, geo
 				seen.Store(sp.Id, true)
 
 				if working.Load() {
+					results.Add(1)
 					yield(r, nil)
 				}
 			})
@@ -313,7 +500,7 @@ func (db *SQLiteSpatialDatabase) IntersectsWithIterator(ctx context.Context, geo
 
 // getIntersectsByCoord will return the list of `RTreeSpatialIndex` instances for records that contain 'coord' and are inclusive of any filters
 // defined in 'filters'. This method derives a very small bounding box from 'coord' and then invokes the `getIntersectsByRect` method.
-func (db *SQLiteSpatialDatabase) getIntersectsByCoord(ctx context.Context, coord *orb.Point, filters ...spatial.Filter) ([]*RTreeSpatialIndex, error) {
+func (db *SQLiteSpatialDatabase) getIntersectsByCoord(ctx context.Context, conn *sqliteConn, coord *orb.Point, filters ...spatial.Filter) ([]*RTreeSpatialIndex, error) {
 
 	// how small can this be?
 
@@ -322,30 +509,83 @@ func (db *SQLiteSpatialDatabase) getIntersectsByCoord(ctx context.Context, coord
 	b := coord.Bound()
 	rect := b.Pad(padding)
 
-	return db.getIntersectsByRect(ctx, &rect, filters...)
+	if conn.sql_functions && conn.rtree == nil {
+		predicate := fmt.Sprintf("%s(geometry, ?, ?)", SQL_FUNCTION_CONTAINS)
+		return db.queryRTree(ctx, conn, &rect, predicate, coord.X(), coord.Y())
+	}
+
+	return db.getIntersectsByRect(ctx, conn, &rect, filters...)
+}
+
+// getIntersectsByGeometry will return the list of `RTreeSpatialIndex` instances for records that intersect 'geom' and are inclusive of any filters
+// defined in 'filters'. If the database supports the `wof_intersects` SQL function the exact geometry test is performed by SQLite, otherwise only
+// records whose bounding boxes intersect 'geom' are returned.
+func (db *SQLiteSpatialDatabase) getIntersectsByGeometry(ctx context.Context, conn *sqliteConn, geom orb.Geometry, filters ...spatial.Filter) ([]*RTreeSpatialIndex, error) {
+
+	bound := geom.Bound()
+
+	if conn.sql_functions && conn.rtree == nil {
+		predicate := fmt.Sprintf("%s(geometry, ?)", SQL_FUNCTION_INTERSECTS)
+		return db.queryRTree(ctx, conn, &bound, predicate, wkt.MarshalString(geom))
+	}
+
+	return db.getIntersectsByRect(ctx, conn, &bound, filters...)
+}
+
+// getIntersectsByRect will return the list of `RTreeSpatialIndex` instances for records that intersect 'rect' and are inclusive of any filters
+// defined in 'filters'. If 'conn' has an in-memory rtree index it is used instead of the rtree table.
+func (db *SQLiteSpatialDatabase) getIntersectsByRect(ctx context.Context, conn *sqliteConn, rect *orb.Bound, filters ...spatial.Filter) ([]*RTreeSpatialIndex, error) {
+
+	if conn.rtree == nil {
+		return db.queryRTree(ctx, conn, rect, "")
+	}
+
+	_, span := tracer.Start(ctx, "getIntersectsByRect", trace.WithAttributes(attribute.String("rtree_index", RTREE_INDEX_MEMORY)))
+	defer span.End()
+
+	intersects, err := db.memoryRTreeCandidates(ctx, conn, conn.rtree.intersects(rect))
+
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("candidates", len(intersects)))
+
+	slog.Debug("Intersects by rect candidates", "r", rect, "count", len(intersects), "rtree index", RTREE_INDEX_MEMORY)
+	return intersects, nil
 }
 
-// getIntersectsByCoord will return the list of `RTreeSpatialIndex` instances for records that intersect 'rect' and are inclusive of any filters
-// defined in 'filters'.
-func (db *SQLiteSpatialDatabase) getIntersectsByRect(ctx context.Context, rect *orb.Bound, filters ...spatial.Filter) ([]*RTreeSpatialIndex, error) {
+// queryRTree will return the list of `RTreeSpatialIndex` instances for records that intersect 'rect'. If 'predicate' is not empty it is
+// appended to the query's conditions, with 'args' as its arguments, and the returned instances are marked as already matching the query.
+func (db *SQLiteSpatialDatabase) queryRTree(ctx context.Context, conn *sqliteConn, rect *orb.Bound, predicate string, args ...any) ([]*RTreeSpatialIndex, error) {
 
 	logger := slog.Default()
 	logger = logger.With("query", "intersects by rect")
 	logger = logger.With("center", rect.Center())
 
-	q := fmt.Sprintf("SELECT id, wof_id, is_alt, alt_label, geometry, min_x, min_y, max_x, max_y FROM %s  WHERE min_x <= ? OR max_x >= ?  OR min_y <= ? OR max_y >= ?", db.rtree_table.Name())
+	ctx, span := tracer.Start(ctx, "getIntersectsByRect")
+	defer span.End()
+
+	q := fmt.Sprintf("SELECT id, wof_id, is_alt, alt_label, geometry, min_x, min_y, max_x, max_y FROM %s  WHERE max_x >= ? AND min_x <= ? AND max_y >= ? AND min_y <= ?", db.rtree_table.Name())
 
-	// Left returns the left of the bound.
-	// Right returns the right of the bound.
+	if predicate != "" {
+		q = fmt.Sprintf("SELECT id, wof_id, is_alt, alt_label, geometry, min_x, min_y, max_x, max_y FROM %s  WHERE max_x >= ? AND min_x <= ? AND max_y >= ? AND min_y <= ? AND %s", db.rtree_table.Name(), predicate)
+	}
+
+	// Only records whose bounding boxes overlap 'rect' so that the rtree index narrows the candidates before any predicate is tested
 
 	minx := rect.Left()
 	miny := rect.Bottom()
 	maxx := rect.Right()
 	maxy := rect.Top()
 
-	rows, err := db.db.QueryContext(ctx, q, minx, maxx, miny, maxy)
+	q_args := append([]any{minx, maxx, miny, maxy}, args...)
+
+	rows, err := conn.db.QueryContext(ctx, q, q_args...)
 
 	if err != nil {
+		recordSpanError(span, err)
 		return nil, fmt.Errorf("SQL query failed, %w", err)
 	}
 
@@ -368,6 +608,7 @@ func (db *SQLiteSpatialDatabase) getIntersectsByRect(ctx context.Context, rect *
 		err := rows.Scan(&id, &feature_id, &is_alt, &alt_label, &geometry, &minx, &miny, &maxx, &maxy)
 
 		if err != nil {
+			recordSpanError(span, err)
 			return nil, err
 		}
 
@@ -384,6 +625,7 @@ func (db *SQLiteSpatialDatabase) getIntersectsByRect(ctx context.Context, rect *
 			FeatureId: feature_id,
 			bounds:    rect,
 			geometry:  geometry,
+			matched:   predicate != "",
 		}
 
 		if is_alt == 1 {
@@ -394,19 +636,29 @@ func (db *SQLiteSpatialDatabase) getIntersectsByRect(ctx context.Context, rect *
 		intersects = append(intersects, i)
 	}
 
+	span.SetAttributes(attribute.Int("candidates", len(intersects)))
+
 	logger.Debug("Intersects by rect candidates", "r", rect, "count", len(intersects))
 	return intersects, nil
 }
 
 // retrieveSPR retrieves a `spr.StandardPlacesResult` instance from the local database cache identified by 'uri_str'.
-func (r *SQLiteSpatialDatabase) retrieveSPR(ctx context.Context, uri_str string) (spr.StandardPlacesResult, error) {
+func (r *SQLiteSpatialDatabase) retrieveSPR(ctx context.Context, conn *sqliteConn, uri_str string) (spr.StandardPlacesResult, error) {
+
+	ctx, span := tracer.Start(ctx, "retrieveSPR", trace.WithAttributes(attribute.String("uri", uri_str)))
+	defer span.End()
+
+	c, ok := conn.gocache.Get(uri_str)
 
-	c, ok := r.gocache.Get(uri_str)
+	span.SetAttributes(attribute.Bool("cache_hit", ok))
 
 	if ok {
+		r.metrics.Add(metricCacheHitsTotal, 1)
 		return c.(*sqlite_spr.SQLiteStandardPlacesResult), nil
 	}
 
+	r.metrics.Add(metricCacheMissesTotal, 1)
+
 	id, uri_args, err := uri.ParseURI(uri_str)
 
 	if err != nil {
@@ -426,17 +678,20 @@ func (r *SQLiteSpatialDatabase) retrieveSPR(ctx context.Context, uri_str string)
 		alt_label = source
 	}
 
-	s, err := sqlite_spr.RetrieveSPR(ctx, r.db, r.spr_table, id, alt_label)
+	s, err := sqlite_spr.RetrieveSPR(ctx, conn.db, r.spr_table, id, alt_label)
 
 	if err != nil {
-		return nil, err
+		r.metrics.Add(metricErrorsTotal, 1, "operation", "retrieve")
+		recordSpanError(span, err)
+		// This usually means there is an rtree row with no corresponding spr row. See the Validate method.
+		return nil, fmt.Errorf("Failed to retrieve SPR for %s, %w", uri_str, err)
 	}
 
-	r.gocache.Set(uri_str, s, -1)
+	conn.gocache.Set(uri_str, s, -1)
 	return s, nil
 }
 
-func (db *SQLiteSpatialDatabase) inflateIntersectsSpatialIndex(ctx context.Context, sp *RTreeSpatialIndex, geom orb.Geometry, filters ...spatial.Filter) (spr.StandardPlacesResult, error) {
+func (db *SQLiteSpatialDatabase) inflateIntersectsSpatialIndex(ctx context.Context, conn *sqliteConn, sp *RTreeSpatialIndex, geom orb.Geometry, filters ...spatial.Filter) (spr.StandardPlacesResult, error) {
 
 	// sp_id := fmt.Sprintf("%s:%s", sp.Id, sp.AltLabel)
 	feature_id := fmt.Sprintf("%s:%s", sp.FeatureId, sp.AltLabel)
@@ -447,78 +702,40 @@ func (db *SQLiteSpatialDatabase) inflateIntersectsSpatialIndex(ctx context.Conte
 
 	logger.Debug("Inflate spatial index")
 
-	// START OF maybe move all this code in to whosonfirst/go-whosonfirst-sqlite-features/tables/rtree.go
+	ctx, span := tracer.Start(ctx, "inflateIntersectsSpatialIndex", trace.WithAttributes(attribute.String("feature_id", feature_id)))
+	defer span.End()
 
-	var poly orb.Polygon
-	var err error
+	if !sp.matched {
 
-	// This is to account for version of the whosonfirst/go-whosonfirst-sqlite-features
-	// package < 0.10.0 that stored geometries as JSON-encoded strings. Subsequent versions
-	// use WKT encoding.
-
-	// This is the bottleneck. It appears to be this:
-	// https://github.com/paulmach/orb/issues/132
-	// maybe... https://github.com/Succo/wktToOrb/ ?
-
-	if strings.HasPrefix(sp.geometry, "[[[") {
-		// Investigate https://github.com/paulmach/orb/tree/master/geojson#performance
-		err = json.Unmarshal([]byte(sp.geometry), &poly)
-	} else {
-
-		// poly, err = wkt.UnmarshalPolygon(sp.geometry)
-
-		o, err := wkttoorb.Scan(sp.geometry)
+		poly, err := sp.parsePolygon()
 
 		if err != nil {
+			logger.Error("Failed to derive polygon", "error", err)
+			recordSpanError(span, err)
 			return nil, err
 		}
 
-		poly = o.(orb.Polygon)
-	}
+		intersects, err := geo.Intersects(poly, geom)
 
-	if err != nil {
-		logger.Error("Failed to derive polygon", "error", err)
-		return nil, err
-	}
-
-	// END OF maybe move all this code in to whosonfirst/go-whosonfirst-sqlite-features/tables/rtree.go
-
-	intersects := false
-
-	ok, err := geo.Intersects(poly, geom)
-
-	if err != nil {
-		logger.Error("Failed to determine intersection", "error", err)
-		return nil, nil
-	}
-
-	intersects = ok
+		if err != nil {
+			logger.Error("Failed to determine intersection", "error", err)
+			return nil, nil
+		}
 
-	if !intersects {
-		return nil, nil
+		if !intersects {
+			return nil, nil
+		}
 	}
 
-	s, err := db.retrieveSPR(ctx, sp.Path())
+	s, err := db.retrieveSPR(ctx, conn, sp.Path())
 
 	if err != nil {
 		logger.Error("Failed to retrieve feature cache", "key", sp.Path(), "error", err)
+		recordSpanError(span, err)
 		return nil, err
 	}
 
-	matches := true
-
-	for _, f := range filters {
-
-		err = filter.FilterSPR(f, s)
-
-		if err != nil {
-			slog.Debug("Feature failed SPR filter", "feature_id", feature_id, "error", err)
-			matches = false
-			break
-		}
-	}
-
-	if !matches {
+	if !db.matchesFilters(ctx, s, filters...) {
 		return nil, nil
 	}
 
@@ -526,7 +743,7 @@ func (db *SQLiteSpatialDatabase) inflateIntersectsSpatialIndex(ctx context.Conte
 	return s, nil
 }
 
-func (db *SQLiteSpatialDatabase) inflatePointInPolygonSpatialIndex(ctx context.Context, sp *RTreeSpatialIndex, c *orb.Point, filters ...spatial.Filter) (spr.StandardPlacesResult, error) {
+func (db *SQLiteSpatialDatabase) inflatePointInPolygonSpatialIndex(ctx context.Context, conn *sqliteConn, sp *RTreeSpatialIndex, c *orb.Point, filters ...spatial.Filter) (spr.StandardPlacesResult, error) {
 
 	// sp_id := fmt.Sprintf("%s:%s", sp.Id, sp.AltLabel)
 	feature_id := fmt.Sprintf("%s:%s", sp.FeatureId, sp.AltLabel)
@@ -538,70 +755,63 @@ func (db *SQLiteSpatialDatabase) inflatePointInPolygonSpatialIndex(ctx context.C
 
 	logger.Debug("Inflate spatial index")
 
-	// START OF maybe move all this code in to whosonfirst/go-whosonfirst-sqlite-features/tables/rtree.go
-
-	var poly orb.Polygon
-	var err error
-
-	// This is to account for version of the whosonfirst/go-whosonfirst-sqlite-features
-	// package < 0.10.0 that stored geometries as JSON-encoded strings. Subsequent versions
-	// use WKT encoding.
-
-	// This is the bottleneck. It appears to be this:
-	// https://github.com/paulmach/orb/issues/132
-	// maybe... https://github.com/Succo/wktToOrb/ ?
+	ctx, span := tracer.Start(ctx, "inflatePointInPolygonSpatialIndex", trace.WithAttributes(attribute.String("feature_id", feature_id)))
+	defer span.End()
 
-	if strings.HasPrefix(sp.geometry, "[[[") {
-		// Investigate https://github.com/paulmach/orb/tree/master/geojson#performance
-		err = json.Unmarshal([]byte(sp.geometry), &poly)
-	} else {
+	if !sp.matched {
 
-		// poly, err = wkt.UnmarshalPolygon(sp.geometry)
-
-		o, err := wkttoorb.Scan(sp.geometry)
+		poly, err := sp.parsePolygon()
 
 		if err != nil {
+			logger.Error("Failed to derive polygon", "error", err)
+			recordSpanError(span, err)
 			return nil, err
 		}
 
-		poly = o.(orb.Polygon)
+		if !planar.PolygonContains(poly, *c) {
+			logger.Debug("Coordinate not contained by feature polygon")
+			return nil, nil
+		}
 	}
 
+	s, err := db.retrieveSPR(ctx, conn, sp.Path())
+
 	if err != nil {
-		logger.Error("Failed to derive polygon", "error", err)
+		logger.Error("Failed to retrieve feature cache", "key", sp.Path(), "error", err)
+		recordSpanError(span, err)
 		return nil, err
 	}
 
-	// END OF maybe move all this code in to whosonfirst/go-whosonfirst-sqlite-features/tables/rtree.go
-
-	if !planar.PolygonContains(poly, *c) {
-		logger.Debug("Coordinate not contained by feature polygon")
+	if !db.matchesFilters(ctx, s, filters...) {
 		return nil, nil
 	}
 
-	s, err := db.retrieveSPR(ctx, sp.Path())
+	return s, nil
+}
 
-	if err != nil {
-		logger.Error("Failed to retrieve feature cache", "key", sp.Path(), "error", err)
-		return nil, err
-	}
+// matchesFilters returns a boolean value indicating whether 's' matches all of the criteria defined by 'filters'.
+func (db *SQLiteSpatialDatabase) matchesFilters(ctx context.Context, s spr.StandardPlacesResult, filters ...spatial.Filter) bool {
 
-	matches := true
+	_, span := tracer.Start(ctx, "filterSPR", trace.WithAttributes(attribute.String("id", s.Id())))
+	defer span.End()
 
 	for _, f := range filters {
 
-		err = filter.FilterSPR(f, s)
+		err := filter.FilterSPR(f, s)
 
 		if err != nil {
-			slog.Debug("Feature failed SPR filter", "feature_id", feature_id, "error", err)
-			matches = false
-			break
+			slog.Debug("Feature failed SPR filter", "id", s.Id(), "error", err)
+			span.SetAttributes(attribute.Bool("matches", false))
+			return false
 		}
 	}
 
-	if !matches {
-		return nil, nil
-	}
+	span.SetAttributes(attribute.Bool("matches", true))
+	return true
+}
 
-	return s, nil
+// recordSpanError records 'err' in 'span' and marks the span as failed.
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
 }
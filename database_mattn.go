@@ -3,5 +3,105 @@
 package sqlite
 
 import (
-	_ "github.com/mattn/go-sqlite3"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
 )
+
+func init() {
+
+	BackupDatabase = backupDatabaseMattn
+
+	sql.Register(SQL_FUNCTIONS_ENGINE, &sqlite3.SQLiteDriver{
+		ConnectHook: registerFunctionsMattn,
+	})
+}
+
+// registerFunctionsMattn registers the `wof_contains` and `wof_intersects` SQL functions with 'conn'.
+func registerFunctionsMattn(conn *sqlite3.SQLiteConn) error {
+
+	contains := func(geometry string, x any, y any) (bool, error) {
+
+		fx, err := sqlFunctionFloat(x)
+
+		if err != nil {
+			return false, err
+		}
+
+		fy, err := sqlFunctionFloat(y)
+
+		if err != nil {
+			return false, err
+		}
+
+		return WOFContains(geometry, fx, fy)
+	}
+
+	err := conn.RegisterFunc(SQL_FUNCTION_CONTAINS, contains, true)
+
+	if err != nil {
+		return fmt.Errorf("Failed to register %s function, %w", SQL_FUNCTION_CONTAINS, err)
+	}
+
+	err = conn.RegisterFunc(SQL_FUNCTION_INTERSECTS, WOFIntersects, true)
+
+	if err != nil {
+		return fmt.Errorf("Failed to register %s function, %w", SQL_FUNCTION_INTERSECTS, err)
+	}
+
+	return nil
+}
+
+// backupDatabaseMattn implements the `BackupDatabaseFunc` interface for the mattn/go-sqlite3 driver.
+func backupDatabaseMattn(ctx context.Context, dest *sql.Conn, src *sql.Conn) error {
+
+	return dest.Raw(func(dest_raw any) error {
+
+		dest_conn, ok := dest_raw.(*sqlite3.SQLiteConn)
+
+		if !ok {
+			return fmt.Errorf("Destination is not a mattn/go-sqlite3 connection")
+		}
+
+		return src.Raw(func(src_raw any) error {
+
+			src_conn, ok := src_raw.(*sqlite3.SQLiteConn)
+
+			if !ok {
+				return fmt.Errorf("Source is not a mattn/go-sqlite3 connection")
+			}
+
+			b, err := dest_conn.Backup("main", src_conn, "main")
+
+			if err != nil {
+				return fmt.Errorf("Failed to start backup, %w", err)
+			}
+
+			for {
+
+				select {
+				case <-ctx.Done():
+					b.Close()
+					return ctx.Err()
+				default:
+					// pass
+				}
+
+				done, err := b.Step(-1)
+
+				if err != nil {
+					b.Close()
+					return fmt.Errorf("Failed to copy database, %w", err)
+				}
+
+				if done {
+					break
+				}
+			}
+
+			return b.Finish()
+		})
+	})
+}
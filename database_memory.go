@@ -0,0 +1,192 @@
+package sqlite
+
+// Load on-disk databases in to memory using the SQLite backup API.
+// https://www.sqlite.org/backup.html
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	database_sql "github.com/sfomuseum/go-database/sql"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// BackupDatabaseFunc is a function that copies the contents of the "main" database in 'src' to the "main" database
+// in 'dest' using the SQLite backup API. Because the backup API is specific to individual SQLite drivers an
+// implementation needs to be assigned to `BackupDatabase` before databases can be loaded in to memory.
+type BackupDatabaseFunc func(ctx context.Context, dest *sql.Conn, src *sql.Conn) error
+
+// BackupDatabase is the `BackupDatabaseFunc` used to load databases in to memory. It is assigned automatically
+// when this package is built with the "mattn" or "modernc" tag.
+var BackupDatabase BackupDatabaseFunc
+
+// memory_databases is a counter used to derive unique names for in-memory databases.
+var memory_databases = new(atomic.Int64)
+
+// isMemoryURI returns a boolean value indicating whether the database defined by 'uri' should be loaded in to memory.
+func isMemoryURI(uri string) (bool, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	str_memory := u.Query().Get("memory")
+
+	if str_memory == "" {
+		return false, nil
+	}
+
+	memory, err := strconv.ParseBool(str_memory)
+
+	if err != nil {
+		return false, fmt.Errorf("Invalid ?memory= parameter, %w", err)
+	}
+
+	return memory, nil
+}
+
+// openDatabase opens the database defined by 'uri'. If the 'dsn' parameter in 'uri' is a remote database it is fetched
+// to a local cache first. If 'uri' contains a "memory=true" query parameter then the database is copied in to a new
+// in-memory database and a connection that must remain open for the lifetime of the in-memory database is returned
+// as well.
+func openDatabase(ctx context.Context, uri string) (*sql.DB, *sql.Conn, error) {
+
+	uri, err := fetchDatabase(ctx, uri)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to fetch database, %w", err)
+	}
+
+	memory, err := isMemoryURI(uri)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !memory {
+
+		db, err := database_sql.OpenWithURI(ctx, uri)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return db, nil, nil
+	}
+
+	return loadDatabase(ctx, uri)
+}
+
+// loadDatabase copies the on-disk database defined by 'uri' in to a new (shared cache) in-memory database.
+func loadDatabase(ctx context.Context, uri string) (*sql.DB, *sql.Conn, error) {
+
+	if BackupDatabase == nil {
+		return nil, nil, fmt.Errorf("Loading databases in to memory is not supported by the current SQLite driver")
+	}
+
+	t1 := time.Now()
+
+	ctx, span := tracer.Start(ctx, "loadDatabase")
+	defer span.End()
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+	dsn := q.Get("dsn")
+
+	if dsn == "" || dsn == ":memory:" || dsn == "{tmp}" {
+		return nil, nil, fmt.Errorf("Invalid DSN for loading in to memory, '%s'", dsn)
+	}
+
+	src_db, err := database_sql.OpenWithURI(ctx, uri)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open database, %w", err)
+	}
+
+	defer src_db.Close()
+
+	// Each connection to ":memory:" is a separate database so use a named, shared-cache database
+	// instead in order that every connection in the pool sees the same data.
+
+	memory_dsn := fmt.Sprintf("file:whosonfirst-spatial-sqlite-%d?mode=memory&cache=shared", memory_databases.Add(1))
+
+	q.Set("dsn", memory_dsn)
+	u.RawQuery = q.Encode()
+
+	dest_db, err := database_sql.OpenWithURI(ctx, u.String())
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open in-memory database, %w", err)
+	}
+
+	// An in-memory database is deleted when its last connection is closed so 'dest_conn' is
+	// not closed until the database itself is closed.
+
+	dest_conn, err := dest_db.Conn(ctx)
+
+	if err != nil {
+		dest_db.Close()
+		return nil, nil, fmt.Errorf("Failed to create in-memory database connection, %w", err)
+	}
+
+	src_conn, err := src_db.Conn(ctx)
+
+	if err != nil {
+		dest_conn.Close()
+		dest_db.Close()
+		return nil, nil, fmt.Errorf("Failed to create database connection, %w", err)
+	}
+
+	defer src_conn.Close()
+
+	err = BackupDatabase(ctx, dest_conn, src_conn)
+
+	if err != nil {
+		dest_conn.Close()
+		dest_db.Close()
+		recordSpanError(span, err)
+		return nil, nil, fmt.Errorf("Failed to copy database in to memory, %w", err)
+	}
+
+	var page_count int64
+	var page_size int64
+
+	err = dest_conn.QueryRowContext(ctx, "PRAGMA page_count").Scan(&page_count)
+
+	if err != nil {
+		dest_conn.Close()
+		dest_db.Close()
+		return nil, nil, fmt.Errorf("Failed to derive page count, %w", err)
+	}
+
+	err = dest_conn.QueryRowContext(ctx, "PRAGMA page_size").Scan(&page_size)
+
+	if err != nil {
+		dest_conn.Close()
+		dest_db.Close()
+		return nil, nil, fmt.Errorf("Failed to derive page size, %w", err)
+	}
+
+	size := page_count * page_size
+
+	span.SetAttributes(
+		attribute.String("dsn", dsn),
+		attribute.Int64("size", size),
+	)
+
+	slog.Info("Loaded database in to memory", "dsn", dsn, "size", size, "time", time.Since(t1))
+	return dest_db, dest_conn, nil
+}
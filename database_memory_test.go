@@ -0,0 +1,69 @@
+//go:build mattn || modernc
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+)
+
+func TestMemoryDatabase(t *testing.T) {
+
+	ctx := context.Background()
+
+	db_path := filepath.Join(t.TempDir(), "memory.db")
+
+	createReloadDatabase(t, db_path, 101737491)
+
+	database_uri := fmt.Sprintf("sqlite://%s?dsn=%s&memory=true", DEFAULT_ENGINE, db_path)
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	c, err := geo.NewCoordinate(-71.330873, 46.852675)
+
+	if err != nil {
+		t.Fatalf("Failed to create new coordinate, %v", err)
+	}
+
+	// Records are inflated concurrently so these queries will use multiple connections to the in-memory database.
+
+	for i := 0; i < 10; i++ {
+
+		rsp, err := db.PointInPolygon(ctx, c)
+
+		if err != nil {
+			t.Fatalf("Failed to perform point in polygon query, %v", err)
+		}
+
+		if len(rsp.Results()) != 1 {
+			t.Fatalf("Expected 1 result but got %d", len(rsp.Results()))
+		}
+	}
+
+	err = db.(*SQLiteSpatialDatabase).Reload(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to reload in-memory database, %v", err)
+	}
+
+	exists, err := db.Exists(ctx, "101737491")
+
+	if err != nil {
+		t.Fatalf("Failed to determine whether record exists, %v", err)
+	}
+
+	if !exists {
+		t.Fatalf("Expected 101737491 to exist after reload")
+	}
+}
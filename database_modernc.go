@@ -0,0 +1,170 @@
+//go:build modernc && !mattn
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"modernc.org/sqlite"
+)
+
+// DEFAULT_ENGINE is the name of the database/sql driver used to open SQLite databases when one is not specified.
+const DEFAULT_ENGINE string = "sqlite"
+
+func init() {
+
+	BackupDatabase = backupDatabaseModernc
+
+	// Register the functions on a private driver, rather than the package-level "sqlite" driver, so that
+	// they are opt-in in the same way they are for the mattn/go-sqlite3 driver.
+
+	d := &sqlite.Driver{}
+
+	d.MustRegisterDeterministicScalarFunction(SQL_FUNCTION_CONTAINS, 3, containsModernc)
+	d.MustRegisterDeterministicScalarFunction(SQL_FUNCTION_INTERSECTS, 2, intersectsModernc)
+
+	sql.Register(SQL_FUNCTIONS_ENGINE, d)
+}
+
+// containsModernc implements the `wof_contains` SQL function for the modernc.org/sqlite driver.
+func containsModernc(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+
+	geometry, err := sqlFunctionString(args[0])
+
+	if err != nil {
+		return nil, err
+	}
+
+	x, err := sqlFunctionFloat(args[1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := sqlFunctionFloat(args[2])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return WOFContains(geometry, x, y)
+}
+
+// intersectsModernc implements the `wof_intersects` SQL function for the modernc.org/sqlite driver.
+func intersectsModernc(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+
+	geometry, err := sqlFunctionString(args[0])
+
+	if err != nil {
+		return nil, err
+	}
+
+	str_wkt, err := sqlFunctionString(args[1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return WOFIntersects(geometry, str_wkt)
+}
+
+// restorer is the interface implemented by modernc.org/sqlite connections for restoring a database from another file.
+type restorer interface {
+	NewRestore(string) (*sqlite.Backup, error)
+}
+
+// backupDatabaseModernc implements the `BackupDatabaseFunc` interface for the modernc.org/sqlite driver. Unlike the
+// mattn/go-sqlite3 driver the backup API only copies between a connection and a URI so 'src' must be an on-disk database.
+func backupDatabaseModernc(ctx context.Context, dest *sql.Conn, src *sql.Conn) error {
+
+	src_path, err := databasePath(ctx, src)
+
+	if err != nil {
+		return err
+	}
+
+	return dest.Raw(func(dest_raw any) error {
+
+		dest_conn, ok := dest_raw.(restorer)
+
+		if !ok {
+			return fmt.Errorf("Destination is not a modernc.org/sqlite connection")
+		}
+
+		b, err := dest_conn.NewRestore(src_path)
+
+		if err != nil {
+			return fmt.Errorf("Failed to start backup, %w", err)
+		}
+
+		for {
+
+			select {
+			case <-ctx.Done():
+				b.Finish()
+				return ctx.Err()
+			default:
+				// pass
+			}
+
+			more, err := b.Step(-1)
+
+			if err != nil {
+				b.Finish()
+				return fmt.Errorf("Failed to copy database, %w", err)
+			}
+
+			if !more {
+				break
+			}
+		}
+
+		return b.Finish()
+	})
+}
+
+// databasePath returns the path of the file backing the "main" database for 'conn'.
+func databasePath(ctx context.Context, conn *sql.Conn) (string, error) {
+
+	rows, err := conn.QueryContext(ctx, "PRAGMA database_list")
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to list databases, %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var seq int
+		var name string
+		var path string
+
+		err := rows.Scan(&seq, &name, &path)
+
+		if err != nil {
+			return "", fmt.Errorf("Failed to scan database list, %w", err)
+		}
+
+		if name != "main" {
+			continue
+		}
+
+		if path == "" {
+			return "", fmt.Errorf("Database is not backed by a file")
+		}
+
+		return path, nil
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to iterate database list, %w", err)
+	}
+
+	return "", fmt.Errorf("Failed to find main database")
+}
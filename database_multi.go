@@ -0,0 +1,817 @@
+package sqlite
+
+// Implement a federated whosonfirst/go-whosonfirst-spatial/database.SpatialDatabase that fans spatial queries
+// out across multiple SQLite databases.
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-reader/v2"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"github.com/whosonfirst/go-writer/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MultiRouteFunc is a function that returns the name of the database that the Who's On First GeoJSON Feature
+// record defined in 'body' should be written to.
+type MultiRouteFunc func(ctx context.Context, body []byte) (string, error)
+
+// SQLiteMultiSpatialDatabase is a struct that implements the `database.SpatialDatabase` interface for performing
+// spatial queries across multiple `SQLiteSpatialDatabase` instances in parallel. Results are merged and deduplicated
+// by ID. Databases whose overall extent does not overlap a query are skipped.
+type SQLiteMultiSpatialDatabase struct {
+	database.SpatialDatabase
+	mu            *sync.RWMutex
+	databases     []*multiDatabase
+	route         MultiRouteFunc
+	default_route string
+}
+
+// multiDatabase is a `SQLiteSpatialDatabase` instance that is part of a `SQLiteMultiSpatialDatabase` instance.
+type multiDatabase struct {
+	name string
+	db   *SQLiteSpatialDatabase
+}
+
+func init() {
+	ctx := context.Background()
+	database.RegisterSpatialDatabase(ctx, "sqlite-multi", NewSQLiteMultiSpatialDatabase)
+	reader.RegisterReader(ctx, "sqlite-multi", NewSQLiteMultiSpatialDatabaseReader)
+	writer.RegisterWriter(ctx, "sqlite-multi", NewSQLiteMultiSpatialDatabaseWriter)
+}
+
+func NewSQLiteMultiSpatialDatabaseReader(ctx context.Context, uri string) (reader.Reader, error) {
+	return NewSQLiteMultiSpatialDatabase(ctx, uri)
+}
+
+func NewSQLiteMultiSpatialDatabaseWriter(ctx context.Context, uri string) (writer.Writer, error) {
+	return NewSQLiteMultiSpatialDatabase(ctx, uri)
+}
+
+// NewSQLiteMultiSpatialDatabase returns a new `SQLiteMultiSpatialDatabase` instance derived from 'uri' which is expected
+// to take the form of:
+//
+//	sqlite-multi://{DATABASE_SQL_ENGINE}?dsn={DSN}&dsn={DSN}
+//
+// Each 'dsn' parameter is opened as a separate `SQLiteSpatialDatabase` instance. Any other query parameters (for
+// example 'slow-query-threshold') are applied to every database except the following, which configure how writes are
+// routed:
+//   - 'route' is the path of a property (for example "wof:repo") whose value is the name of the database a record
+//     should be written to. The name of a database is the base name of its DSN minus its extension and any "-latest"
+//     suffix, so "whosonfirst-data-admin-us-latest.db" is named "whosonfirst-data-admin-us".
+//   - 'default-route' is the name of the database that records which can not otherwise be routed are written to.
+//
+// The 'slow-query-log' parameter (and its related parameters) defines a single slow query log which every database writes to.
+func NewSQLiteMultiSpatialDatabase(ctx context.Context, uri string) (database.SpatialDatabase, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	dsn_list := q["dsn"]
+	route_property := q.Get("route")
+	default_route := q.Get("default-route")
+
+	if len(dsn_list) == 0 {
+		return nil, fmt.Errorf("Missing ?dsn= parameter")
+	}
+
+	q.Del("dsn")
+	q.Del("route")
+	q.Del("default-route")
+
+	// The slow query log is opened once, below, and shared by every database rather than each database opening
+	// (and rotating) the same file.
+
+	log_q := url.Values{}
+
+	for _, k := range []string{"slow-query-log", "slow-query-log-max-size", "slow-query-log-max-backups"} {
+
+		if q.Has(k) {
+			log_q.Set(k, q.Get(k))
+			q.Del(k)
+		}
+	}
+
+	databases := make([]*multiDatabase, len(dsn_list))
+	names := make(map[string]bool)
+
+	for idx, dsn := range dsn_list {
+
+		name := multiDatabaseName(dsn)
+
+		_, exists := names[name]
+
+		if exists {
+			closeMultiDatabases(ctx, databases)
+			return nil, fmt.Errorf("Multiple databases named '%s'", name)
+		}
+
+		names[name] = true
+
+		db_q := url.Values{}
+
+		for k, v := range q {
+			db_q[k] = v
+		}
+
+		db_q.Set("dsn", dsn)
+
+		db_u := url.URL{}
+		db_u.Scheme = "sqlite"
+		db_u.Host = u.Host
+		db_u.RawQuery = db_q.Encode()
+
+		spatial_db, err := NewSQLiteSpatialDatabase(ctx, db_u.String())
+
+		if err != nil {
+			closeMultiDatabases(ctx, databases)
+			return nil, fmt.Errorf("Failed to create spatial database for %s, %w", dsn, err)
+		}
+
+		sqlite_db := spatial_db.(*SQLiteSpatialDatabase)
+
+		// Extents are derived (and cached) for each connection so this will be done again if the database is reloaded
+
+		_, err = sqlite_db.extent(ctx)
+
+		if err != nil {
+			sqlite_db.Disconnect(ctx)
+			closeMultiDatabases(ctx, databases)
+			return nil, fmt.Errorf("Failed to derive extent for %s, %w", dsn, err)
+		}
+
+		databases[idx] = &multiDatabase{
+			name: name,
+			db:   sqlite_db,
+		}
+	}
+
+	if default_route != "" {
+
+		_, exists := names[default_route]
+
+		if !exists {
+			closeMultiDatabases(ctx, databases)
+			return nil, fmt.Errorf("Invalid ?default-route= parameter, no database named '%s'", default_route)
+		}
+	}
+
+	if q.Get("slow-query-threshold") != "" {
+
+		slow_query_log, err := parseSlowQueryLog(log_q)
+
+		if err != nil {
+			closeMultiDatabases(ctx, databases)
+			return nil, err
+		}
+
+		for _, m := range databases {
+			m.db.slow_query_log = slow_query_log
+		}
+	}
+
+	multi_db := &SQLiteMultiSpatialDatabase{
+		mu:            new(sync.RWMutex),
+		databases:     databases,
+		default_route: default_route,
+	}
+
+	if route_property != "" {
+		multi_db.route = NewPropertyMultiRouteFunc(route_property)
+	}
+
+	return multi_db, nil
+}
+
+// NewPropertyMultiRouteFunc returns a `MultiRouteFunc` that routes records using the (string) value of the property
+// 'path' (for example "wof:repo").
+func NewPropertyMultiRouteFunc(path string) MultiRouteFunc {
+
+	fn := func(ctx context.Context, body []byte) (string, error) {
+
+		rsp := gjson.GetBytes(body, fmt.Sprintf("properties.%s", path))
+
+		if !rsp.Exists() {
+			return "", fmt.Errorf("Missing %s property", path)
+		}
+
+		return rsp.String(), nil
+	}
+
+	return fn
+}
+
+// SetRouteFunc assigns 'fn' as the function used to determine which database a record should be written to.
+func (db *SQLiteMultiSpatialDatabase) SetRouteFunc(fn MultiRouteFunc) {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.route = fn
+}
+
+// Databases returns the names of the databases that 'db' queries, in the order they were defined.
+func (db *SQLiteMultiSpatialDatabase) Databases() []string {
+
+	names := make([]string, len(db.databases))
+
+	for idx, m := range db.databases {
+		names[idx] = m.name
+	}
+
+	return names
+}
+
+// Disconnect will close the underlying database connections.
+func (db *SQLiteMultiSpatialDatabase) Disconnect(ctx context.Context) error {
+	return closeMultiDatabases(ctx, db.databases)
+}
+
+// IndexFeature will index a Who's On First GeoJSON Feature record, defined in 'body', in the database it is
+// routed to.
+func (db *SQLiteMultiSpatialDatabase) IndexFeature(ctx context.Context, body []byte) error {
+
+	m, err := db.routeFeature(ctx, body)
+
+	if err != nil {
+		return err
+	}
+
+	err = m.db.IndexFeature(ctx, body)
+
+	if err != nil {
+		return fmt.Errorf("Failed to index record in %s, %w", m.name, err)
+	}
+
+	f, err := geojson.UnmarshalFeature(body)
+
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal feature, %w", err)
+	}
+
+	m.db.expandExtent(f.Geometry.Bound())
+	return nil
+}
+
+// RemoveFeature will remove the database record with ID 'id' from every database.
+func (db *SQLiteMultiSpatialDatabase) RemoveFeature(ctx context.Context, id string) error {
+
+	err := db.forEachDatabase(ctx, db.databases, func(ctx context.Context, m *multiDatabase) error {
+
+		err := m.db.RemoveFeature(ctx, id)
+
+		if err != nil {
+			return fmt.Errorf("Failed to remove %s from %s, %w", id, m.name, err)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// PointInPolygon will perform a point in polygon query against every database whose extent contains 'coord' for
+// records that contain 'coord' and that are inclusive of any filters defined by 'filters'.
+func (db *SQLiteMultiSpatialDatabase) PointInPolygon(ctx context.Context, coord *orb.Point, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	results := make([]spr.StandardPlacesResult, 0)
+
+	for r, err := range db.PointInPolygonWithIterator(ctx, coord, filters...) {
+
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, r)
+	}
+
+	spr_results := &SQLiteResults{
+		Places: results,
+	}
+
+	return spr_results, nil
+}
+
+func (db *SQLiteMultiSpatialDatabase) PointInPolygonWithIterator(ctx context.Context, coord *orb.Point, filters ...spatial.Filter) iter.Seq2[spr.StandardPlacesResult, error] {
+
+	b := coord.Bound()
+
+	query := func(ctx context.Context, m *multiDatabase) iter.Seq2[spr.StandardPlacesResult, error] {
+		return m.db.PointInPolygonWithIterator(ctx, coord, filters...)
+	}
+
+	return db.queryWithIterator(ctx, "MultiPointInPolygon", b, query)
+}
+
+// Intersects will perform an intersects query against every database whose extent intersects 'geom' for records
+// that intersect 'geom' and that are inclusive of any filters defined by 'filters'.
+func (db *SQLiteMultiSpatialDatabase) Intersects(ctx context.Context, geom orb.Geometry, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	results := make([]spr.StandardPlacesResult, 0)
+
+	for r, err := range db.IntersectsWithIterator(ctx, geom, filters...) {
+
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, r)
+	}
+
+	spr_results := &SQLiteResults{
+		Places: results,
+	}
+
+	return spr_results, nil
+}
+
+func (db *SQLiteMultiSpatialDatabase) IntersectsWithIterator(ctx context.Context, geom orb.Geometry, filters ...spatial.Filter) iter.Seq2[spr.StandardPlacesResult, error] {
+
+	b := geom.Bound()
+
+	query := func(ctx context.Context, m *multiDatabase) iter.Seq2[spr.StandardPlacesResult, error] {
+		return m.db.IntersectsWithIterator(ctx, geom, filters...)
+	}
+
+	return db.queryWithIterator(ctx, "MultiIntersects", b, query)
+}
+
+// Read implements the whosonfirst/go-reader interface so that the database itself can be used as a
+// reader.Reader instance. Every database is queried in parallel and the record from the first database
+// (in the order they were defined) that contains 'str_uri' is returned.
+func (db *SQLiteMultiSpatialDatabase) Read(ctx context.Context, str_uri string) (io.ReadSeekCloser, error) {
+
+	_, _, err := uri.ParseURI(str_uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	readers := make([]io.ReadSeekCloser, len(db.databases))
+
+	err = db.forEachDatabase(ctx, db.databases, func(ctx context.Context, m *multiDatabase) error {
+
+		r, err := m.db.Read(ctx, str_uri)
+
+		if err != nil {
+
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+
+			return fmt.Errorf("Failed to read %s from %s, %w", str_uri, m.name, err)
+		}
+
+		readers[db.offset(m)] = r
+		return nil
+	})
+
+	var fh io.ReadSeekCloser
+
+	for _, r := range readers {
+
+		if r == nil {
+			continue
+		}
+
+		if fh == nil {
+			fh = r
+		} else {
+			r.Close()
+		}
+	}
+
+	if err != nil {
+
+		if fh != nil {
+			fh.Close()
+		}
+
+		return nil, err
+	}
+
+	if fh == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	return fh, nil
+}
+
+// Exists returns a boolean value indicating whether 'str_uri` exists in any database.
+func (db *SQLiteMultiSpatialDatabase) Exists(ctx context.Context, str_uri string) (bool, error) {
+
+	found := new(atomic.Bool)
+
+	err := db.forEachDatabase(ctx, db.databases, func(ctx context.Context, m *multiDatabase) error {
+
+		exists, err := m.db.Exists(ctx, str_uri)
+
+		if err != nil {
+			return fmt.Errorf("Failed to determine whether %s exists in %s, %w", str_uri, m.name, err)
+		}
+
+		if exists {
+			found.Store(true)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return found.Load(), nil
+}
+
+// ReaderURI implements the whosonfirst/go-reader interface so that the database itself can be used as a
+// reader.Reader instance
+func (db *SQLiteMultiSpatialDatabase) ReaderURI(ctx context.Context, str_uri string) string {
+	return str_uri
+}
+
+// Write implements the whosonfirst/go-writer interface so that the database itself can be used as a
+// writer.Writer instance (by invoking the `IndexFeature` method).
+func (db *SQLiteMultiSpatialDatabase) Write(ctx context.Context, key string, fh io.ReadSeeker) (int64, error) {
+
+	body, err := io.ReadAll(fh)
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = db.IndexFeature(ctx, body)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(body)), nil
+}
+
+// WriterURI implements the whosonfirst/go-writer interface so that the database itself can be used as a
+// writer.Writer instance
+func (db *SQLiteMultiSpatialDatabase) WriterURI(ctx context.Context, str_uri string) string {
+	return str_uri
+}
+
+// Flush implements the whosonfirst/go-writer interface so that the database itself can be used as a
+// writer.Writer instance. This method is a no-op and simply returns `nil`.
+func (db *SQLiteMultiSpatialDatabase) Flush(ctx context.Context) error {
+	return nil
+}
+
+// Close implements the whosonfirst/go-writer interface so that the database itself can be used as a
+// writer.Writer instance. This method invokes the `Disconnect` method.
+func (db *SQLiteMultiSpatialDatabase) Close(ctx context.Context) error {
+	return db.Disconnect(ctx)
+}
+
+// SetLogger implements the whosonfirst/go-writer interface so that the database itself can be used as a
+// writer.Writer instance. This method is a no-op and simply returns `nil`.
+func (db *SQLiteMultiSpatialDatabase) SetLogger(ctx context.Context, logger *log.Logger) error {
+	return nil
+}
+
+// queryWithIterator runs 'query' against every database whose extent intersects 'b' in parallel, yielding
+// results (deduplicated by ID) as they arrive.
+func (db *SQLiteMultiSpatialDatabase) queryWithIterator(ctx context.Context, name string, b orb.Bound, query func(context.Context, *multiDatabase) iter.Seq2[spr.StandardPlacesResult, error]) iter.Seq2[spr.StandardPlacesResult, error] {
+
+	return func(yield func(spr.StandardPlacesResult, error) bool) {
+
+		candidates, err := db.candidates(ctx, b)
+
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		ctx, span := tracer.Start(ctx, name, trace.WithAttributes(
+			attribute.Int("databases", len(db.databases)),
+			attribute.Int("candidates", len(candidates)),
+		))
+
+		defer span.End()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		seen := new(sync.Map)
+		yield_mu := new(sync.Mutex)
+
+		working := new(atomic.Bool)
+		working.Store(true)
+
+		wg := new(sync.WaitGroup)
+
+		for _, m := range candidates {
+
+			wg.Go(func() {
+
+				// Results are drained rather than breaking out of the loop once 'working' is false since
+				// the underlying iterators yield from multiple goroutines.
+
+				for r, err := range query(ctx, m) {
+
+					if !working.Load() {
+						continue
+					}
+
+					if err != nil {
+						recordSpanError(span, err)
+						err = fmt.Errorf("Failed to query %s, %w", m.name, err)
+					} else {
+
+						_, exists := seen.LoadOrStore(r.Id(), true)
+
+						if exists {
+							continue
+						}
+					}
+
+					yield_mu.Lock()
+
+					if working.Load() && !yield(r, err) {
+						working.Store(false)
+						cancel()
+					}
+
+					yield_mu.Unlock()
+				}
+			})
+		}
+
+		wg.Wait()
+	}
+}
+
+// candidates returns the list of databases whose extent intersects 'b'.
+func (db *SQLiteMultiSpatialDatabase) candidates(ctx context.Context, b orb.Bound) ([]*multiDatabase, error) {
+
+	candidates := make([]*multiDatabase, 0)
+
+	for _, m := range db.databases {
+
+		extent, err := m.db.extent(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive extent for %s, %w", m.name, err)
+		}
+
+		if extent == nil || !extent.Intersects(b) {
+			continue
+		}
+
+		candidates = append(candidates, m)
+	}
+
+	return candidates, nil
+}
+
+// routeFeature returns the database that the record defined by 'body' should be written to.
+func (db *SQLiteMultiSpatialDatabase) routeFeature(ctx context.Context, body []byte) (*multiDatabase, error) {
+
+	db.mu.RLock()
+	route := db.route
+	db.mu.RUnlock()
+
+	name := db.default_route
+
+	if route != nil {
+
+		v, err := route(ctx, body)
+
+		if err != nil && db.default_route == "" {
+			return nil, fmt.Errorf("Failed to route record, %w", err)
+		}
+
+		if err == nil {
+			name = v
+		}
+	}
+
+	for _, m := range db.databases {
+
+		if m.name == name {
+			return m, nil
+		}
+	}
+
+	if db.default_route != "" {
+
+		for _, m := range db.databases {
+
+			if m.name == db.default_route {
+				return m, nil
+			}
+		}
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("Unable to route record, no route or default route defined")
+	}
+
+	return nil, fmt.Errorf("Unable to route record, no database named '%s'", name)
+}
+
+// offset returns the position of 'm' in the list of databases for 'db'.
+func (db *SQLiteMultiSpatialDatabase) offset(m *multiDatabase) int {
+
+	for idx, candidate := range db.databases {
+
+		if candidate == m {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// forEachDatabase invokes 'fn' for each database in 'databases' in parallel returning the first error encountered.
+func (db *SQLiteMultiSpatialDatabase) forEachDatabase(ctx context.Context, databases []*multiDatabase, fn func(context.Context, *multiDatabase) error) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	err_ch := make(chan error, len(databases))
+	wg := new(sync.WaitGroup)
+
+	for _, m := range databases {
+
+		wg.Go(func() {
+
+			err := fn(ctx, m)
+
+			if err != nil {
+				err_ch <- err
+				cancel()
+			}
+		})
+	}
+
+	wg.Wait()
+	close(err_ch)
+
+	return <-err_ch
+}
+
+// extent returns the overall extent of the records in the rtree table (or in-memory rtree index) or nil if it is empty.
+// The extent of the rtree table is derived once for each connection and then updated by `expandExtent`.
+func (r *SQLiteSpatialDatabase) extent(ctx context.Context) (*orb.Bound, error) {
+
+	conn, release := r.acquire()
+	defer release()
+
+	if conn.rtree != nil {
+		return conn.rtree.extent(), nil
+	}
+
+	conn.extent_mu.Lock()
+	defer conn.extent_mu.Unlock()
+
+	if !conn.extent_known {
+
+		b, err := r.queryExtent(ctx, conn)
+
+		if err != nil {
+			return nil, err
+		}
+
+		conn.extent = b
+		conn.extent_known = true
+	}
+
+	if conn.extent == nil {
+		return nil, nil
+	}
+
+	b := *conn.extent
+	return &b, nil
+}
+
+// expandExtent updates the extent of the current connection, if it has already been derived, to include 'b'.
+func (r *SQLiteSpatialDatabase) expandExtent(b orb.Bound) {
+
+	conn, release := r.acquire()
+	defer release()
+
+	// The in-memory rtree index is kept up to date when records are indexed
+
+	if conn.rtree != nil {
+		return
+	}
+
+	conn.extent_mu.Lock()
+	defer conn.extent_mu.Unlock()
+
+	if !conn.extent_known {
+		return
+	}
+
+	if conn.extent == nil {
+		conn.extent = &b
+		return
+	}
+
+	extent := conn.extent.Union(b)
+	conn.extent = &extent
+}
+
+// queryExtent returns the overall extent of the records in the rtree table for 'conn' or nil if it is empty.
+func (r *SQLiteSpatialDatabase) queryExtent(ctx context.Context, conn *sqliteConn) (*orb.Bound, error) {
+
+	q := fmt.Sprintf("SELECT MIN(min_x), MIN(min_y), MAX(max_x), MAX(max_y) FROM %s", r.rtree_table.Name())
+
+	row := conn.db.QueryRowContext(ctx, q)
+
+	var minx sql.NullFloat64
+	var miny sql.NullFloat64
+	var maxx sql.NullFloat64
+	var maxy sql.NullFloat64
+
+	err := row.Scan(&minx, &miny, &maxx, &maxy)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !minx.Valid {
+		return nil, nil
+	}
+
+	b := orb.Bound{
+		Min: orb.Point{minx.Float64, miny.Float64},
+		Max: orb.Point{maxx.Float64, maxy.Float64},
+	}
+
+	return &b, nil
+}
+
+// multiDatabaseName derives the name of a database from its DSN.
+func multiDatabaseName(dsn string) string {
+
+	path := dsn
+
+	u, err := url.Parse(dsn)
+
+	if err == nil && u.Path != "" {
+		path = u.Path
+	}
+
+	name := filepath.Base(path)
+
+	// Remote databases may be compressed (for example "ca.db.gz")
+
+	switch filepath.Ext(name) {
+	case ".gz", ".zst", ".zstd":
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	name = strings.TrimSuffix(name, "-latest")
+
+	return name
+}
+
+func closeMultiDatabases(ctx context.Context, databases []*multiDatabase) error {
+
+	var close_err error
+
+	for _, m := range databases {
+
+		if m == nil {
+			continue
+		}
+
+		err := m.db.Disconnect(ctx)
+
+		if err != nil && close_err == nil {
+			close_err = fmt.Errorf("Failed to close %s, %w", m.name, err)
+		}
+	}
+
+	return close_err
+}
@@ -0,0 +1,247 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+)
+
+func TestMultiSpatialDatabase(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	admin_path := filepath.Join(root, "whosonfirst-data-admin-ca-latest.db")
+	arch_path := filepath.Join(root, "sfomuseum-data-architecture.db")
+
+	database_uri := fmt.Sprintf("sqlite-multi://%s?dsn=%s&dsn=%s&route=wof:repo", DEFAULT_ENGINE, admin_path, arch_path)
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	multi_db := db.(*SQLiteMultiSpatialDatabase)
+
+	for _, id := range []int64{101737491, 1360521545} {
+
+		path := fmt.Sprintf("fixtures/%d.geojson", id)
+
+		body, err := os.ReadFile(path)
+
+		if err != nil {
+			t.Fatalf("Failed to read %s, %v", path, err)
+		}
+
+		err = db.IndexFeature(ctx, body)
+
+		if err != nil {
+			t.Fatalf("Failed to index %s, %v", path, err)
+		}
+	}
+
+	for idx, expected := range []string{"101737491", "1360521545"} {
+
+		m := multi_db.databases[idx]
+
+		exists, err := m.db.Exists(ctx, expected)
+
+		if err != nil {
+			t.Fatalf("Failed to determine whether %s exists in %s, %v", expected, m.name, err)
+		}
+
+		if !exists {
+			t.Fatalf("Expected %s to be routed to %s", expected, m.name)
+		}
+	}
+
+	exists, err := db.Exists(ctx, "1360521545")
+
+	if err != nil {
+		t.Fatalf("Failed to determine whether record exists, %v", err)
+	}
+
+	if !exists {
+		t.Fatalf("Expected 1360521545 to exist")
+	}
+
+	r, err := db.Read(ctx, "101737491")
+
+	if err != nil {
+		t.Fatalf("Failed to read 101737491, %v", err)
+	}
+
+	r.Close()
+
+	_, err = db.Read(ctx, "1234")
+
+	if err == nil {
+		t.Fatalf("Expected error reading record that does not exist")
+	}
+
+	c, err := geo.NewCoordinate(-71.330873, 46.852675)
+
+	if err != nil {
+		t.Fatalf("Failed to create new coordinate, %v", err)
+	}
+
+	candidates, err := multi_db.candidates(ctx, c.Bound())
+
+	if err != nil {
+		t.Fatalf("Failed to derive candidate databases, %v", err)
+	}
+
+	if len(candidates) != 1 {
+		t.Fatalf("Expected 1 candidate database but got %d", len(candidates))
+	}
+
+	rsp, err := db.PointInPolygon(ctx, c)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query, %v", err)
+	}
+
+	results := rsp.Results()
+
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result but got %d", len(results))
+	}
+
+	if results[0].Id() != "101737491" {
+		t.Fatalf("Unexpected result %s", results[0].Id())
+	}
+
+	err = db.RemoveFeature(ctx, "101737491")
+
+	if err != nil {
+		t.Fatalf("Failed to remove feature, %v", err)
+	}
+
+	rsp, err = db.PointInPolygon(ctx, c)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query, %v", err)
+	}
+
+	if len(rsp.Results()) != 0 {
+		t.Fatalf("Expected 0 results after removing feature but got %d", len(rsp.Results()))
+	}
+}
+
+func TestMultiSpatialDatabaseRouting(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	a_path := filepath.Join(root, "a.db")
+	b_path := filepath.Join(root, "b.db")
+
+	database_uri := fmt.Sprintf("sqlite://%s?dsn=%s&dsn=%s&route=wof:repo", DEFAULT_ENGINE, a_path, b_path)
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	_, ok := db.(*SQLiteMultiSpatialDatabase)
+
+	if !ok {
+		t.Fatalf("Expected multiple DSNs to return a SQLiteMultiSpatialDatabase instance")
+	}
+
+	body, err := os.ReadFile("fixtures/101737491.geojson")
+
+	if err != nil {
+		t.Fatalf("Failed to read fixture, %v", err)
+	}
+
+	err = db.IndexFeature(ctx, body)
+
+	if err == nil {
+		t.Fatalf("Expected error indexing record with no matching route")
+	}
+}
+
+func TestMultiSpatialDatabaseReload(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	db_path := filepath.Join(root, "current.db")
+	next_path := filepath.Join(root, "next.db")
+
+	createReloadDatabase(t, db_path, 101737491)
+	createReloadDatabase(t, next_path, 1360521545)
+
+	database_uri := fmt.Sprintf("sqlite-multi://%s?dsn=%s", DEFAULT_ENGINE, db_path)
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	multi_db := db.(*SQLiteMultiSpatialDatabase)
+
+	montreal, err := geo.NewCoordinate(-71.330873, 46.852675)
+
+	if err != nil {
+		t.Fatalf("Failed to create new coordinate, %v", err)
+	}
+
+	sfo, err := geo.NewCoordinate(-122.38370979473034, 37.61700839815536)
+
+	if err != nil {
+		t.Fatalf("Failed to create new coordinate, %v", err)
+	}
+
+	count_candidates := func(c *orb.Point) int {
+
+		candidates, err := multi_db.candidates(ctx, c.Bound())
+
+		if err != nil {
+			t.Fatalf("Failed to derive candidate databases, %v", err)
+		}
+
+		return len(candidates)
+	}
+
+	if count_candidates(montreal) != 1 || count_candidates(sfo) != 0 {
+		t.Fatalf("Unexpected candidate databases before reload")
+	}
+
+	// The extent of a database is derived again once it has been reloaded
+
+	err = os.Rename(next_path, db_path)
+
+	if err != nil {
+		t.Fatalf("Failed to replace database, %v", err)
+	}
+
+	err = multi_db.databases[0].db.Reload(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to reload database, %v", err)
+	}
+
+	if count_candidates(montreal) != 0 || count_candidates(sfo) != 1 {
+		t.Fatalf("Unexpected candidate databases after reload")
+	}
+}
@@ -0,0 +1,382 @@
+package sqlite
+
+// Implement a whosonfirst/go-reader/v2.Reader interface for the properties table.
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-ioutil"
+	"github.com/whosonfirst/go-reader/v2"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The scheme used to register `SQLitePropertiesReader` with the whosonfirst/go-reader/v2 package.
+const PROPERTIES_READER_SCHEME string = "sqlite-properties"
+
+// SQLitePropertiesReader implements the `whosonfirst/go-reader/v2.Reader` interface for reading the properties of
+// records from the properties table of a `SQLiteSpatialDatabase`. Rather than the entire GeoJSON body of a record it
+// returns a GeoJSON Feature with no geometry and, if any keys were specified, only those properties. It is meant to
+// be used with the `spatial.PropertiesResponseResultsWithStandardPlacesResults` method.
+type SQLitePropertiesReader struct {
+	reader.Reader
+	database *SQLiteSpatialDatabase
+	// Top-level property names to read.
+	keys []string
+	// Property name prefixes (for example "wof:") to read.
+	prefixes []string
+	// A boolean flag indicating whether 'database' was created by (and should be closed with) the reader.
+	is_owner bool
+}
+
+// propertiesFeature is a struct representing the GeoJSON Feature returned by `SQLitePropertiesReader`.
+type propertiesFeature struct {
+	Type       string                     `json:"type"`
+	Id         int64                      `json:"id"`
+	Properties map[string]json.RawMessage `json:"properties"`
+	Geometry   json.RawMessage            `json:"geometry"`
+}
+
+// NewSQLitePropertiesReader returns a new `SQLitePropertiesReader` instance derived from 'uri' which takes the form of:
+//
+//	sqlite-properties://{DATABASE_SQL_ENGINE}?dsn={DATABASE_SQL_DSN}&key={KEY}
+//
+// Where 'key' is zero or more property names to read. Names ending in "*" or ":" (for example "wof:*") are treated as
+// prefixes. If no keys are specified all the properties for a record are read. Any other parameters are passed to
+// `NewSQLiteSpatialDatabase`.
+func NewSQLitePropertiesReader(ctx context.Context, uri string) (reader.Reader, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	keys := q["key"]
+	q.Del("key")
+
+	u.Scheme = "sqlite"
+	u.RawQuery = q.Encode()
+
+	db, err := NewSQLiteSpatialDatabase(ctx, u.String())
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create spatial database, %w", err)
+	}
+
+	sqlite_db, ok := db.(*SQLiteSpatialDatabase)
+
+	if !ok {
+		db.Disconnect(ctx)
+		return nil, fmt.Errorf("Properties reader URI must be a single database")
+	}
+
+	pr := sqlite_db.PropertiesReader(keys...)
+	pr.is_owner = true
+
+	return pr, nil
+}
+
+// PropertiesReader returns a new `SQLitePropertiesReader` instance for reading the properties table of 'r'. If 'keys'
+// is not empty only those properties will be read. Keys ending in "*" or ":" (for example "wof:*") are treated as
+// prefixes and nested keys (for example "wof:hierarchy.0") read their top-level property.
+func (r *SQLiteSpatialDatabase) PropertiesReader(keys ...string) *SQLitePropertiesReader {
+
+	pr := &SQLitePropertiesReader{
+		database: r,
+		keys:     make([]string, 0),
+		prefixes: make([]string, 0),
+	}
+
+	for _, k := range keys {
+
+		if strings.HasSuffix(k, "*") || strings.HasSuffix(k, ":") {
+			pr.prefixes = append(pr.prefixes, strings.TrimSuffix(k, "*"))
+			continue
+		}
+
+		k = strings.SplitN(k, ".", 2)[0]
+		pr.keys = append(pr.keys, k)
+	}
+
+	return pr
+}
+
+// Read returns a GeoJSON Feature containing the properties of the record defined by 'str_uri'. If the record has not
+// been written to the properties table (for example because the database was created by an older version of this
+// package) its properties are read from the geojson table instead.
+func (pr *SQLitePropertiesReader) Read(ctx context.Context, str_uri string) (io.ReadSeekCloser, error) {
+
+	r := pr.database
+
+	id, uri_args, err := uri.ParseURI(str_uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	alt_label := ""
+
+	if uri_args.IsAlternate {
+
+		label, err := uri_args.AltGeom.String()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive alt label, %w", err)
+		}
+
+		alt_label = label
+	}
+
+	t1 := time.Now()
+
+	defer r.metrics.Since(metricReadDuration, t1)
+	r.metrics.Add(metricReadsTotal, 1)
+
+	ctx, span := tracer.Start(ctx, "ReadProperties", trace.WithAttributes(attribute.Int64("wof.id", id)))
+	defer span.End()
+
+	conn, release := r.acquire()
+	defer release()
+
+	props, err := pr.readProperties(ctx, conn.db, id, alt_label)
+
+	if err == sql.ErrNoRows {
+		props, err = pr.readGeoJSONProperties(ctx, conn.db, id, alt_label)
+	}
+
+	if err != nil {
+
+		if err != sql.ErrNoRows {
+			r.metrics.Add(metricErrorsTotal, 1, "operation", "read")
+			recordSpanError(span, err)
+		}
+
+		return nil, err
+	}
+
+	f := propertiesFeature{
+		Type:       "Feature",
+		Id:         id,
+		Properties: props,
+		Geometry:   json.RawMessage("null"),
+	}
+
+	enc, err := json.Marshal(f)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal properties, %w", err)
+	}
+
+	return ioutil.NewReadSeekCloser(bytes.NewReader(enc))
+}
+
+// Exists returns a boolean value indicating whether 'str_uri' exists in the properties table.
+func (pr *SQLitePropertiesReader) Exists(ctx context.Context, str_uri string) (bool, error) {
+
+	id, _, err := uri.ParseURI(str_uri)
+
+	if err != nil {
+		return false, err
+	}
+
+	r := pr.database
+
+	conn, release := r.acquire()
+	defer release()
+
+	q := fmt.Sprintf("SELECT 1 FROM %s WHERE id = ? LIMIT 1", r.properties_table.Name())
+
+	var i int
+
+	err = conn.db.QueryRowContext(ctx, q, id).Scan(&i)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		return false, err
+	default:
+		return true, nil
+	}
+}
+
+// ReaderURI returns 'str_uri'.
+func (pr *SQLitePropertiesReader) ReaderURI(ctx context.Context, str_uri string) string {
+	return str_uri
+}
+
+// Close closes the underlying database if it was created by the `NewSQLitePropertiesReader` method.
+func (pr *SQLitePropertiesReader) Close(ctx context.Context) error {
+
+	if !pr.is_owner {
+		return nil
+	}
+
+	return pr.database.Disconnect(ctx)
+}
+
+// readProperties reads the properties for 'id' and 'alt_label' from the properties table. If 'pr' has any keys then
+// only those properties are selected (using the SQLite `json_each` function) rather than returning the entire body.
+func (pr *SQLitePropertiesReader) readProperties(ctx context.Context, db *sql.DB, id int64, alt_label string) (map[string]json.RawMessage, error) {
+
+	table := pr.database.properties_table.Name()
+
+	if len(pr.keys) == 0 && len(pr.prefixes) == 0 {
+
+		q := fmt.Sprintf("SELECT body FROM %s WHERE id = ? AND COALESCE(alt_label, '') = ?", table)
+
+		var body string
+
+		err := db.QueryRowContext(ctx, q, id, alt_label).Scan(&body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var props map[string]json.RawMessage
+
+		err = json.Unmarshal([]byte(body), &props)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal properties, %w", err)
+		}
+
+		return props, nil
+	}
+
+	// Make sure the record exists since json_each won't return any rows if it doesn't match any keys
+
+	exists_q := fmt.Sprintf("SELECT 1 FROM %s WHERE id = ? AND COALESCE(alt_label, '') = ?", table)
+
+	var i int
+
+	err := db.QueryRowContext(ctx, exists_q, id, alt_label).Scan(&i)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := make([]string, 0)
+	args := []any{id, alt_label}
+
+	if len(pr.keys) > 0 {
+
+		conditions = append(conditions, fmt.Sprintf("j.key IN (%s)", placeholders(len(pr.keys))))
+
+		for _, k := range pr.keys {
+			args = append(args, k)
+		}
+	}
+
+	for _, prefix := range pr.prefixes {
+		conditions = append(conditions, "substr(j.key, 1, ?) = ?")
+		args = append(args, len(prefix), prefix)
+	}
+
+	// Booleans are reported by json_each as 1 or 0 so they need to be handled explicitly
+
+	q := fmt.Sprintf(`SELECT j.key, CASE j.type
+		WHEN 'object' THEN j.value
+		WHEN 'array' THEN j.value
+		WHEN 'true' THEN 'true'
+		WHEN 'false' THEN 'false'
+		ELSE json_quote(j.value) END
+	FROM %s p, json_each(p.body) j
+	WHERE p.id = ? AND COALESCE(p.alt_label, '') = ? AND (%s)`, table, strings.Join(conditions, " OR "))
+
+	rows, err := db.QueryContext(ctx, q, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query properties, %w", err)
+	}
+
+	defer rows.Close()
+
+	props := make(map[string]json.RawMessage)
+
+	for rows.Next() {
+
+		var k string
+		var v string
+
+		err := rows.Scan(&k, &v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan property, %w", err)
+		}
+
+		props[k] = json.RawMessage(v)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate properties, %w", err)
+	}
+
+	return props, nil
+}
+
+// readGeoJSONProperties reads the properties for 'id' and 'alt_label' from the GeoJSON body in the geojson table.
+func (pr *SQLitePropertiesReader) readGeoJSONProperties(ctx context.Context, db *sql.DB, id int64, alt_label string) (map[string]json.RawMessage, error) {
+
+	q := fmt.Sprintf("SELECT body FROM %s WHERE id = ? AND COALESCE(alt_label, '') = ?", pr.database.geojson_table.Name())
+
+	var body string
+
+	err := db.QueryRowContext(ctx, q, id, alt_label).Scan(&body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	props := make(map[string]json.RawMessage)
+
+	gjson.Get(body, "properties").ForEach(func(k gjson.Result, v gjson.Result) bool {
+
+		if pr.matches(k.String()) {
+			props[k.String()] = json.RawMessage(v.Raw)
+		}
+
+		return true
+	})
+
+	return props, nil
+}
+
+// matches returns a boolean value indicating whether the property 'k' should be read.
+func (pr *SQLitePropertiesReader) matches(k string) bool {
+
+	if len(pr.keys) == 0 && len(pr.prefixes) == 0 {
+		return true
+	}
+
+	for _, key := range pr.keys {
+
+		if k == key {
+			return true
+		}
+	}
+
+	for _, prefix := range pr.prefixes {
+
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,176 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/whosonfirst/go-reader/v2"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+)
+
+func TestPropertiesReader(t *testing.T) {
+
+	ctx := context.Background()
+
+	db_path := filepath.Join(t.TempDir(), "properties.db")
+	createReloadDatabase(t, db_path, 101737491)
+
+	db, err := database.NewSpatialDatabase(ctx, fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, db_path))
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	pr := sqlite_db.PropertiesReader("wof:name", "wof:hierarchy.0", "mz:*")
+
+	readProperties := func(label string) map[string]any {
+
+		fh, err := pr.Read(ctx, "101/737/491/101737491.geojson")
+
+		if err != nil {
+			t.Fatalf("Failed to read properties (%s), %v", label, err)
+		}
+
+		defer fh.Close()
+
+		body, err := io.ReadAll(fh)
+
+		if err != nil {
+			t.Fatalf("Failed to read body (%s), %v", label, err)
+		}
+
+		var f struct {
+			Properties map[string]any `json:"properties"`
+		}
+
+		err = json.Unmarshal(body, &f)
+
+		if err != nil {
+			t.Fatalf("Failed to unmarshal properties (%s), %v", label, err)
+		}
+
+		return f.Properties
+	}
+
+	expected := []string{"mz:hierarchy_label", "mz:is_current", "mz:min_zoom", "wof:hierarchy", "wof:name"}
+
+	assertProperties := func(label string, props map[string]any) {
+
+		keys := make([]string, 0)
+
+		for k := range props {
+			keys = append(keys, k)
+		}
+
+		slices.Sort(keys)
+
+		if !slices.Equal(keys, expected) {
+			t.Fatalf("Unexpected properties (%s), %v", label, keys)
+		}
+
+		if props["wof:name"] != "Quebec" {
+			t.Fatalf("Unexpected wof:name (%s), %v", label, props["wof:name"])
+		}
+
+		_, ok := props["wof:hierarchy"].([]any)
+
+		if !ok {
+			t.Fatalf("Expected wof:hierarchy (%s) to be a list, %v", label, props["wof:hierarchy"])
+		}
+	}
+
+	assertProperties("properties table", readProperties("properties table"))
+
+	// Records missing from the properties table are read from the geojson table
+
+	_, err = sqlite_db.conn.db.ExecContext(ctx, "DELETE FROM properties")
+
+	if err != nil {
+		t.Fatalf("Failed to delete properties, %v", err)
+	}
+
+	assertProperties("geojson table", readProperties("geojson table"))
+
+	c, err := geo.NewCoordinate(-71.330873, 46.852675)
+
+	if err != nil {
+		t.Fatalf("Failed to create new coordinate, %v", err)
+	}
+
+	rsp, err := db.PointInPolygon(ctx, c)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query, %v", err)
+	}
+
+	props_opts := &spatial.PropertiesResponseOptions{
+		Reader:       pr,
+		Keys:         []string{"wof:name", "mz:*"},
+		SourcePrefix: "properties",
+	}
+
+	props_rsp, err := spatial.PropertiesResponseResultsWithStandardPlacesResults(ctx, props_opts, rsp)
+
+	if err != nil {
+		t.Fatalf("Failed to derive properties response, %v", err)
+	}
+
+	if len(props_rsp.Properties) != 1 {
+		t.Fatalf("Expected 1 result but got %d", len(props_rsp.Properties))
+	}
+
+	_, ok := (*props_rsp.Properties[0])["mz:min_zoom"]
+
+	if !ok {
+		t.Fatalf("Expected mz:min_zoom to be appended to result")
+	}
+
+	// Properties readers can also be created from URIs
+
+	uri_r, err := reader.NewReader(ctx, fmt.Sprintf("%s://%s?dsn=%s&key=wof:name", PROPERTIES_READER_SCHEME, DEFAULT_ENGINE, db_path))
+
+	if err != nil {
+		t.Fatalf("Failed to create properties reader, %v", err)
+	}
+
+	defer uri_r.(*SQLitePropertiesReader).Close(ctx)
+
+	fh, err := uri_r.Read(ctx, "101737491")
+
+	if err != nil {
+		t.Fatalf("Failed to read properties, %v", err)
+	}
+
+	defer fh.Close()
+
+	body, err := io.ReadAll(fh)
+
+	if err != nil {
+		t.Fatalf("Failed to read body, %v", err)
+	}
+
+	var f struct {
+		Properties map[string]any `json:"properties"`
+	}
+
+	err = json.Unmarshal(body, &f)
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal properties, %v", err)
+	}
+
+	if len(f.Properties) != 1 || f.Properties["wof:name"] != "Quebec" {
+		t.Fatalf("Unexpected properties, %v", f.Properties)
+	}
+}
@@ -0,0 +1,411 @@
+package sqlite
+
+// Table-driven query tests. Each JSON file in testdata/queries defines a point-in-polygon or intersects query and the
+// IDs it is expected to return. Run `go test -run TestQueries -update` to regenerate the expected IDs after fixtures
+// change and `go test -run TestQueries -query-database-uri {URI}` to run every query against a different database.
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+)
+
+var update_queries = flag.Bool("update", false, "Regenerate the expected IDs for query test cases in testdata/queries.")
+
+var query_database_uri = flag.String("query-database-uri", "", "An optional spatial database URI to run all the query test cases in testdata/queries against.")
+
+// querySpec is a struct defining a query test case.
+type querySpec struct {
+	Description string `json:"description"`
+	// The path to a database, relative to the package root, to query. If empty a database containing the records in
+	// fixtures/*.geojson is used. If the database does not exist the test case is skipped.
+	Database string `json:"database,omitempty"`
+	// The type of query to perform. Valid options are: pip, intersects.
+	Query     string  `json:"query"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	// A GeoJSON geometry for intersects queries.
+	Geometry json.RawMessage `json:"geometry,omitempty"`
+	// The ID of a record, in the database being queried, whose geometry is used for intersects queries.
+	GeometryId int64 `json:"geometry_id,omitempty"`
+	// SPR filter criteria, as defined by `filter.NewSPRFilterFromQuery`.
+	Filters url.Values `json:"filters,omitempty"`
+	// The number of times to perform the query. Default is 1.
+	Repeat int `json:"repeat,omitempty"`
+	// The IDs the query is expected to return, in any order. IDs returned more than once must be listed more than once.
+	Expected []string `json:"expected"`
+	// The number of results the query is expected to return if Expected is null. Running with -update replaces this
+	// with the IDs of the results.
+	ExpectedCount int `json:"expected_count,omitempty"`
+}
+
+func TestQueries(t *testing.T) {
+
+	ctx := context.Background()
+
+	paths, err := filepath.Glob("testdata/queries/*.json")
+
+	if err != nil {
+		t.Fatalf("Failed to list query test cases, %v", err)
+	}
+
+	if len(paths) == 0 {
+		t.Fatalf("No query test cases found")
+	}
+
+	fixtures_uri, err := createFixturesDatabase(ctx, t.TempDir())
+
+	if err != nil {
+		t.Fatalf("Failed to create fixtures database, %v", err)
+	}
+
+	databases := make(map[string]database.SpatialDatabase)
+
+	defer func() {
+
+		for _, db := range databases {
+			db.Disconnect(ctx)
+		}
+	}()
+
+	for _, path := range paths {
+
+		t.Run(filepath.Base(path), func(t *testing.T) {
+
+			spec, err := readQuerySpec(path)
+
+			if err != nil {
+				t.Fatalf("Failed to read %s, %v", path, err)
+			}
+
+			uri, err := querySpecDatabaseURI(spec, fixtures_uri)
+
+			if err != nil {
+				t.Skipf("%s, %v", spec.Description, err)
+			}
+
+			db, exists := databases[uri]
+
+			if !exists {
+
+				db, err = database.NewSpatialDatabase(ctx, uri)
+
+				if err != nil {
+					t.Fatalf("Failed to create spatial database for %s, %v", uri, err)
+				}
+
+				databases[uri] = db
+			}
+
+			ids, err := runQuerySpec(ctx, db, spec)
+
+			if err != nil {
+				t.Fatalf("Failed to run query for %s, %v", path, err)
+			}
+
+			if *update_queries {
+
+				spec.Expected = ids
+				spec.ExpectedCount = 0
+
+				err := writeQuerySpec(path, spec)
+
+				if err != nil {
+					t.Fatalf("Failed to update %s, %v", path, err)
+				}
+
+				return
+			}
+
+			if spec.Expected == nil {
+
+				if len(ids) != spec.ExpectedCount {
+					t.Fatalf("%s: expected %d results, got %d", spec.Description, spec.ExpectedCount, len(ids))
+				}
+
+				return
+			}
+
+			expected := slices.Clone(spec.Expected)
+			slices.Sort(expected)
+
+			if !slices.Equal(ids, expected) {
+				t.Fatalf("%s: expected %v, got %v", spec.Description, expected, ids)
+			}
+		})
+	}
+}
+
+// runQuerySpec performs the query defined by 'spec' against 'db' and returns the sorted IDs of the results. If the
+// query is performed more than once, or 'db' is a `SQLiteSpatialDatabase` (in which case the iterator methods are
+// also used), an error is returned if the results are not the same each time.
+func runQuerySpec(ctx context.Context, db database.SpatialDatabase, spec *querySpec) ([]string, error) {
+
+	f, err := filter.NewSPRFilterFromQuery(spec.Filters)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create SPR filter, %w", err)
+	}
+
+	var geom orb.Geometry
+
+	switch spec.Query {
+	case "pip":
+		geom = orb.Point{spec.Longitude, spec.Latitude}
+	case "intersects":
+
+		g, err := querySpecGeometry(ctx, db, spec)
+
+		if err != nil {
+			return nil, err
+		}
+
+		geom = g
+	default:
+		return nil, fmt.Errorf("Invalid query '%s'", spec.Query)
+	}
+
+	queries := []func() ([]string, error){
+		func() ([]string, error) {
+
+			var rsp spr.StandardPlacesResults
+			var err error
+
+			switch spec.Query {
+			case "pip":
+				pt := geom.(orb.Point)
+				rsp, err = db.PointInPolygon(ctx, &pt, f)
+			default:
+				rsp, err = db.Intersects(ctx, geom, f)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			return sortedResultIds(rsp.Results()), nil
+		},
+	}
+
+	sqlite_db, ok := db.(*SQLiteSpatialDatabase)
+
+	if ok {
+
+		queries = append(queries, func() ([]string, error) {
+
+			results := make([]spr.StandardPlacesResult, 0)
+
+			var it func(func(spr.StandardPlacesResult, error) bool)
+
+			switch spec.Query {
+			case "pip":
+				pt := geom.(orb.Point)
+				it = sqlite_db.PointInPolygonWithIterator(ctx, &pt, f)
+			default:
+				it = sqlite_db.IntersectsWithIterator(ctx, geom, f)
+			}
+
+			for r, err := range it {
+
+				if err != nil {
+					return nil, err
+				}
+
+				results = append(results, r)
+			}
+
+			return sortedResultIds(results), nil
+		})
+	}
+
+	repeat := max(spec.Repeat, 1)
+
+	var ids []string
+
+	for i := 0; i < repeat; i++ {
+
+		for _, q := range queries {
+
+			q_ids, err := q()
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to perform %s query, %w", spec.Query, err)
+			}
+
+			if ids == nil {
+				ids = q_ids
+				continue
+			}
+
+			if !slices.Equal(ids, q_ids) {
+				return nil, fmt.Errorf("Inconsistent results, %v and %v", ids, q_ids)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// querySpecGeometry returns the geometry used for intersects queries defined by 'spec'.
+func querySpecGeometry(ctx context.Context, db database.SpatialDatabase, spec *querySpec) (orb.Geometry, error) {
+
+	if len(spec.Geometry) > 0 {
+
+		g, err := geojson.UnmarshalGeometry(spec.Geometry)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal geometry, %w", err)
+		}
+
+		return g.Geometry(), nil
+	}
+
+	if spec.GeometryId == 0 {
+		return nil, fmt.Errorf("Intersects query is missing geometry or geometry_id")
+	}
+
+	r, err := db.Read(ctx, strconv.FormatInt(spec.GeometryId, 10))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %d, %w", spec.GeometryId, err)
+	}
+
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read body for %d, %w", spec.GeometryId, err)
+	}
+
+	feature, err := geojson.UnmarshalFeature(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal feature for %d, %w", spec.GeometryId, err)
+	}
+
+	return feature.Geometry, nil
+}
+
+// querySpecDatabaseURI returns the URI of the database to query for 'spec'. If 'spec' does not define a database
+// 'fixtures_uri' is returned. An error is returned if the database does not exist.
+func querySpecDatabaseURI(spec *querySpec, fixtures_uri string) (string, error) {
+
+	if *query_database_uri != "" {
+		return *query_database_uri, nil
+	}
+
+	if spec.Database != "" {
+
+		// Check first since opening a database which doesn't exist will create an empty one
+
+		info, err := os.Stat(spec.Database)
+
+		if err != nil || info.Size() == 0 {
+			return "", fmt.Errorf("Database %s does not exist", spec.Database)
+		}
+
+		return fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, spec.Database), nil
+	}
+
+	return fixtures_uri, nil
+}
+
+// createFixturesDatabase creates a database, in 'root', containing the records in fixtures/*.geojson and returns its URI.
+func createFixturesDatabase(ctx context.Context, root string) (string, error) {
+
+	uri := fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, filepath.Join(root, "fixtures.db"))
+
+	db, err := NewSQLiteSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to create fixtures database, %w", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	paths, err := filepath.Glob("fixtures/*.geojson")
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to list fixtures, %w", err)
+	}
+
+	bodies := make([][]byte, len(paths))
+
+	for idx, path := range paths {
+
+		body, err := os.ReadFile(path)
+
+		if err != nil {
+			return "", fmt.Errorf("Failed to read %s, %w", path, err)
+		}
+
+		bodies[idx] = body
+	}
+
+	err = db.(*SQLiteSpatialDatabase).IndexFeatures(ctx, bodies)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to index fixtures, %w", err)
+	}
+
+	return uri, nil
+}
+
+// sortedResultIds returns the sorted IDs of 'results'. Duplicate IDs are kept so that they are compared with (and
+// must be listed in) the expected results.
+func sortedResultIds(results []spr.StandardPlacesResult) []string {
+
+	ids := make([]string, len(results))
+
+	for idx, r := range results {
+		ids[idx] = r.Id()
+	}
+
+	slices.Sort(ids)
+	return ids
+}
+
+func readQuerySpec(path string) (*querySpec, error) {
+
+	body, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var spec querySpec
+
+	err = json.Unmarshal(body, &spec)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &spec, nil
+}
+
+func writeQuerySpec(path string, spec *querySpec) error {
+
+	enc, err := json.MarshalIndent(spec, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(enc, '\n'), 0644)
+}
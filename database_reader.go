@@ -8,9 +8,12 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/whosonfirst/go-ioutil"
 	"github.com/whosonfirst/go-whosonfirst-uri"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Read implements the whosonfirst/go-reader interface so that the database itself can be used as a
@@ -23,17 +26,34 @@ func (r *SQLiteSpatialDatabase) Read(ctx context.Context, str_uri string) (io.Re
 		return nil, err
 	}
 
+	t1 := time.Now()
+
+	defer r.metrics.Since(metricReadDuration, t1)
+	r.metrics.Add(metricReadsTotal, 1)
+
+	ctx, span := tracer.Start(ctx, "Read", trace.WithAttributes(attribute.Int64("wof.id", id)))
+	defer span.End()
+
 	// TO DO : ALT STUFF HERE
 
 	q := fmt.Sprintf("SELECT body FROM %s WHERE id = ?", r.geojson_table.Name())
 
-	row := r.db.QueryRowContext(ctx, q, id)
+	conn, release := r.acquire()
+	defer release()
+
+	row := conn.db.QueryRowContext(ctx, q, id)
 
 	var body string
 
 	err = row.Scan(&body)
 
 	if err != nil {
+
+		if err != sql.ErrNoRows {
+			r.metrics.Add(metricErrorsTotal, 1, "operation", "read")
+			recordSpanError(span, err)
+		}
+
 		return nil, err
 	}
 
@@ -60,7 +80,10 @@ func (r *SQLiteSpatialDatabase) Exists(ctx context.Context, str_uri string) (boo
 
 	q := fmt.Sprintf("SELECT 1 FROM %s WHERE id = ?", r.geojson_table.Name())
 
-	row := r.db.QueryRowContext(ctx, q, id)
+	conn, release := r.acquire()
+	defer release()
+
+	row := conn.db.QueryRowContext(ctx, q, id)
 
 	var one int
 
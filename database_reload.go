@@ -0,0 +1,467 @@
+package sqlite
+
+// Reload the underlying database file without interrupting in-flight queries.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/paulmach/orb"
+)
+
+// The default amount of time to wait for changes to a database file to settle before reloading it.
+const DEFAULT_WATCH_DELAY time.Duration = 1 * time.Second
+
+// sqliteConn is a database connection and the SPR cache derived from it. A new instance is created each time
+// the underlying database is reloaded.
+type sqliteConn struct {
+	db      *sql.DB
+	gocache *gocache.Cache
+	// An optional connection that must remain open for the lifetime of 'db' (used by in-memory databases).
+	pin *sql.Conn
+	// The number of queries currently using 'db'.
+	inflight *sync.WaitGroup
+	// A boolean flag indicating whether the `wof_contains` and `wof_intersects` SQL functions are available to 'db'.
+	sql_functions bool
+	// An optional in-process R-tree index, derived from 'db', used instead of the rtree table to find candidate records.
+	rtree *memoryRTree
+	// The metrics used to record SPR cache evictions.
+	metrics *Metrics
+	// The overall extent of the records in 'db', derived when it is first needed, and a boolean flag indicating
+	// whether it has been derived yet.
+	extent       *orb.Bound
+	extent_known bool
+	extent_mu    *sync.Mutex
+	// A boolean flag indicating whether 'db' has a tombstones table, derived when it is first needed, and a boolean
+	// flag indicating whether it has been derived yet.
+	tombstones       bool
+	tombstones_known bool
+	tombstones_mu    *sync.Mutex
+}
+
+func newSQLiteConn(db *sql.DB, m *Metrics) *sqliteConn {
+
+	expires := 5 * time.Minute
+	cleanup := 30 * time.Minute
+
+	gc := gocache.New(expires, cleanup)
+
+	gc.OnEvicted(func(k string, v interface{}) {
+		m.Add(metricCacheEvictionTotal, 1)
+	})
+
+	c := &sqliteConn{
+		db:            db,
+		gocache:       gc,
+		inflight:      new(sync.WaitGroup),
+		metrics:       m,
+		extent_mu:     new(sync.Mutex),
+		tombstones_mu: new(sync.Mutex),
+	}
+
+	return c
+}
+
+// flushCache removes all the items from the SPR cache for 'c'. Unlike expired items the cache does not report flushed
+// items as evicted so they are counted here.
+func (c *sqliteConn) flushCache() {
+
+	c.metrics.Add(metricCacheEvictionTotal, float64(c.gocache.ItemCount()))
+	c.gocache.Flush()
+}
+
+// close closes the database connection for 'c'.
+func (c *sqliteConn) close() error {
+
+	if c.pin != nil {
+		c.pin.Close()
+	}
+
+	return c.db.Close()
+}
+
+// acquire returns the current database connection for 'r' and a function that must be called once the caller
+// is finished with it. Connections are not closed, after being reloaded, until all their callers have finished.
+func (r *SQLiteSpatialDatabase) acquire() (*sqliteConn, func()) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c := r.conn
+	c.inflight.Add(1)
+
+	return c, c.inflight.Done
+}
+
+// Reload opens a new connection to the database defined by the URI used to create 'r', validates its schema and
+// then replaces the current connection (and SPR cache) with it. The previous connection is closed once all the
+// queries using it have finished which means this method should not be called from inside the loop of a query
+// iterator.
+func (r *SQLiteSpatialDatabase) Reload(ctx context.Context) error {
+
+	t1 := time.Now()
+
+	ctx, span := tracer.Start(ctx, "Reload")
+	defer span.End()
+
+	err := r.reload(ctx)
+
+	if err != nil {
+		r.metrics.Add(metricReloadsTotal, 1, "status", "error")
+		recordSpanError(span, err)
+		return err
+	}
+
+	r.metrics.Add(metricReloadsTotal, 1, "status", "ok")
+
+	slog.Info("Reloaded database", "dsn", r.dsnPath(), "time", time.Since(t1))
+	return nil
+}
+
+func (r *SQLiteSpatialDatabase) reload(ctx context.Context) error {
+
+	if r.is_tmp {
+		return fmt.Errorf("Temporary databases can not be reloaded")
+	}
+
+	if strings.Contains(r.dsnPath(), ":memory:") {
+		return fmt.Errorf("In-memory databases can not be reloaded")
+	}
+
+	r.mu.RLock()
+	disconnected := r.disconnected
+	r.mu.RUnlock()
+
+	if disconnected {
+		return fmt.Errorf("Database has been disconnected")
+	}
+
+	db, pin, err := openDatabase(ctx, r.uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to open database, %w", err)
+	}
+
+	conn := newSQLiteConn(db, r.metrics)
+	conn.pin = pin
+	conn.sql_functions = hasSQLFunctions(ctx, db)
+
+	err = r.validateSchema(ctx, db)
+
+	if err != nil {
+		conn.close()
+		return fmt.Errorf("Failed to validate database, %w", err)
+	}
+
+	err = r.loadRTreeIndex(ctx, conn)
+
+	if err != nil {
+		conn.close()
+		return err
+	}
+
+	r.mu.Lock()
+
+	// The database may have been disconnected while the new connection was being opened
+
+	if r.disconnected {
+		r.mu.Unlock()
+		conn.close()
+		return fmt.Errorf("Database has been disconnected")
+	}
+
+	old := r.conn
+	r.conn = conn
+
+	r.mu.Unlock()
+
+	old.inflight.Wait()
+	old.flushCache()
+
+	err = old.close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to close previous database, %w", err)
+	}
+
+	return nil
+}
+
+// validateSchema ensures that 'db' contains the tables, and columns, that are queried by 'r' and that its schema
+// version is supported.
+func (r *SQLiteSpatialDatabase) validateSchema(ctx context.Context, db *sql.DB) error {
+
+	queries := []string{
+		fmt.Sprintf("SELECT id, placetype, is_current, is_deprecated, is_ceased, is_superseded, is_superseding, lastmodified FROM %s LIMIT 1", r.spr_table.Name()),
+		fmt.Sprintf("SELECT id, body FROM %s LIMIT 1", r.geojson_table.Name()),
+	}
+
+	// The rtree table is validated when an in-memory rtree index is loaded (which may not require the rtree module)
+
+	if r.rtree_index != RTREE_INDEX_MEMORY {
+		q := fmt.Sprintf("SELECT id, wof_id, is_alt, alt_label, geometry, min_x, min_y, max_x, max_y FROM %s LIMIT 1", r.rtree_table.Name())
+		queries = append(queries, q)
+	}
+
+	for _, q := range queries {
+
+		rows, err := db.QueryContext(ctx, q)
+
+		if err != nil {
+			return fmt.Errorf("Invalid schema (%s), %w", q, err)
+		}
+
+		rows.Close()
+	}
+
+	return r.checkSchema(ctx, db, false)
+}
+
+// watch reloads 'r' whenever the DSN file is replaced or modified. Changes are assumed to be complete once no
+// further changes have been seen for 'delay'. The parent directory of the DSN file, rather than the file itself,
+// is watched so that files which are moved in to place are also detected.
+func (r *SQLiteSpatialDatabase) watch(ctx context.Context, delay time.Duration) (func(), error) {
+
+	path, err := filepath.Abs(r.dsnPath())
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive absolute path for DSN, %w", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create watcher, %w", err)
+	}
+
+	err = watcher.Add(filepath.Dir(path))
+
+	if err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("Failed to watch %s, %w", filepath.Dir(path), err)
+	}
+
+	// The pending reload, if any, which is cancelled when watching stops
+
+	var timer *time.Timer
+	stopped := false
+
+	mu := new(sync.Mutex)
+
+	go func() {
+
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+
+				if !ok {
+					return
+				}
+
+				if filepath.Clean(ev.Name) != path {
+					continue
+				}
+
+				if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) && !ev.Has(fsnotify.Rename) {
+					continue
+				}
+
+				slog.Debug("Database file changed", "path", path, "op", ev.Op.String())
+
+				mu.Lock()
+
+				if stopped {
+					mu.Unlock()
+					return
+				}
+
+				if timer != nil {
+					timer.Stop()
+				}
+
+				timer = time.AfterFunc(delay, func() {
+
+					_, err := os.Stat(path)
+
+					if err != nil {
+						slog.Warn("Database file missing, skipping reload", "path", path, "error", err)
+						return
+					}
+
+					err = r.Reload(ctx)
+
+					if err != nil {
+						slog.Error("Failed to reload database", "path", path, "error", err)
+					}
+				})
+
+				mu.Unlock()
+
+			case err, ok := <-watcher.Errors:
+
+				if !ok {
+					return
+				}
+
+				slog.Error("Database watcher error", "path", path, "error", err)
+			}
+		}
+	}()
+
+	stop := func() {
+
+		watcher.Close()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		stopped = true
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+
+	return stop, nil
+}
+
+// reloadOnSignal reloads 'r' whenever the current process receives a SIGHUP signal.
+func (r *SQLiteSpatialDatabase) reloadOnSignal(ctx context.Context) func() {
+
+	ch := make(chan os.Signal, 1)
+	done := make(chan bool)
+
+	signal.Notify(ch, syscall.SIGHUP)
+
+	go func() {
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ch:
+
+				err := r.Reload(ctx)
+
+				if err != nil {
+					slog.Error("Failed to reload database", "path", r.dsnPath(), "error", err)
+				}
+			}
+		}
+	}()
+
+	stop := func() {
+		signal.Stop(ch)
+		close(done)
+	}
+
+	return stop
+}
+
+// dsnPath returns the path of the database file that 'r' was created with.
+func (r *SQLiteSpatialDatabase) dsnPath() string {
+
+	u, err := url.Parse(r.uri)
+
+	if err != nil {
+		return ""
+	}
+
+	dsn := u.Query().Get("dsn")
+
+	dsn = strings.TrimPrefix(dsn, "file:")
+
+	path, _, _ := strings.Cut(dsn, "?")
+	return path
+}
+
+// parseReloadOptions starts watching the DSN file, or signals, for 'db' as defined by the query parameters 'q'.
+func parseReloadOptions(ctx context.Context, db *SQLiteSpatialDatabase, q url.Values) error {
+
+	str_watch := q.Get("watch")
+	str_delay := q.Get("watch-delay")
+	str_sighup := q.Get("reload-on-sighup")
+
+	stop_funcs := make([]func(), 0)
+
+	if str_watch != "" {
+
+		watch, err := strconv.ParseBool(str_watch)
+
+		if err != nil {
+			return fmt.Errorf("Invalid ?watch= parameter, %w", err)
+		}
+
+		if watch && isRemoteDSN(ctx, q.Get("dsn")) {
+			return fmt.Errorf("Watching remote databases is not supported, use ?reload-on-sighup= instead")
+		}
+
+		if watch {
+
+			delay := DEFAULT_WATCH_DELAY
+
+			if str_delay != "" {
+
+				d, err := time.ParseDuration(str_delay)
+
+				if err != nil {
+					return fmt.Errorf("Invalid ?watch-delay= parameter, %w", err)
+				}
+
+				delay = d
+			}
+
+			stop, err := db.watch(context.WithoutCancel(ctx), delay)
+
+			if err != nil {
+				return fmt.Errorf("Failed to watch database, %w", err)
+			}
+
+			stop_funcs = append(stop_funcs, stop)
+		}
+	}
+
+	if str_sighup != "" {
+
+		sighup, err := strconv.ParseBool(str_sighup)
+
+		if err != nil {
+
+			for _, stop := range stop_funcs {
+				stop()
+			}
+
+			return fmt.Errorf("Invalid ?reload-on-sighup= parameter, %w", err)
+		}
+
+		if sighup {
+			stop := db.reloadOnSignal(context.WithoutCancel(ctx))
+			stop_funcs = append(stop_funcs, stop)
+		}
+	}
+
+	if len(stop_funcs) > 0 {
+
+		db.stop_reload = func() {
+
+			for _, stop := range stop_funcs {
+				stop()
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,305 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+)
+
+func TestReload(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	db_path := filepath.Join(root, "current.db")
+	next_path := filepath.Join(root, "next.db")
+	invalid_path := filepath.Join(root, "invalid.db")
+
+	createReloadDatabase(t, db_path, 101737491)
+	createReloadDatabase(t, next_path, 1360521545)
+
+	database_uri := fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, db_path)
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	c, err := geo.NewCoordinate(-71.330873, 46.852675)
+
+	if err != nil {
+		t.Fatalf("Failed to create new coordinate, %v", err)
+	}
+
+	rsp, err := db.PointInPolygon(ctx, c)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query, %v", err)
+	}
+
+	if len(rsp.Results()) != 1 {
+		t.Fatalf("Expected 1 result but got %d", len(rsp.Results()))
+	}
+
+	// An empty database, with no tables, should fail validation and leave the current database in place.
+
+	invalid_db, err := sql.Open(DEFAULT_ENGINE, invalid_path)
+
+	if err != nil {
+		t.Fatalf("Failed to create invalid database, %v", err)
+	}
+
+	_, err = invalid_db.Exec("CREATE TABLE example (id INTEGER)")
+
+	if err != nil {
+		t.Fatalf("Failed to create table in invalid database, %v", err)
+	}
+
+	invalid_db.Close()
+
+	err = os.Rename(invalid_path, db_path)
+
+	if err != nil {
+		t.Fatalf("Failed to replace database, %v", err)
+	}
+
+	err = sqlite_db.Reload(ctx)
+
+	if err == nil {
+		t.Fatalf("Expected reload of invalid database to fail")
+	}
+
+	rsp, err = db.PointInPolygon(ctx, c)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query after failed reload, %v", err)
+	}
+
+	if len(rsp.Results()) != 1 {
+		t.Fatalf("Expected 1 result after failed reload but got %d", len(rsp.Results()))
+	}
+
+	err = os.Rename(next_path, db_path)
+
+	if err != nil {
+		t.Fatalf("Failed to replace database, %v", err)
+	}
+
+	err = sqlite_db.Reload(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to reload database, %v", err)
+	}
+
+	rsp, err = db.PointInPolygon(ctx, c)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query after reload, %v", err)
+	}
+
+	if len(rsp.Results()) != 0 {
+		t.Fatalf("Expected 0 results after reload but got %d", len(rsp.Results()))
+	}
+
+	exists, err := db.Exists(ctx, "1360521545")
+
+	if err != nil {
+		t.Fatalf("Failed to determine whether record exists, %v", err)
+	}
+
+	if !exists {
+		t.Fatalf("Expected 1360521545 to exist after reload")
+	}
+}
+
+func TestReloadWithWatch(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	db_path := filepath.Join(root, "current.db")
+	next_path := filepath.Join(root, "next.db")
+
+	createReloadDatabase(t, db_path, 101737491)
+	createReloadDatabase(t, next_path, 1360521545)
+
+	database_uri := fmt.Sprintf("sqlite://%s?dsn=%s&watch=true&watch-delay=50ms", DEFAULT_ENGINE, db_path)
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	err = os.Rename(next_path, db_path)
+
+	if err != nil {
+		t.Fatalf("Failed to replace database, %v", err)
+	}
+
+	timeout := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(timeout) {
+
+		exists, err := db.Exists(ctx, "1360521545")
+
+		if err != nil {
+			t.Fatalf("Failed to determine whether record exists, %v", err)
+		}
+
+		if exists {
+			return
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatalf("Database was not reloaded after being replaced")
+}
+
+func TestReloadAfterDisconnect(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	db_path := filepath.Join(root, "current.db")
+	next_path := filepath.Join(root, "next.db")
+
+	createReloadDatabase(t, db_path, 101737491)
+	createReloadDatabase(t, next_path, 1360521545)
+
+	database_uri := fmt.Sprintf("sqlite://%s?dsn=%s&watch=true&watch-delay=1s", DEFAULT_ENGINE, db_path)
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+	conn := sqlite_db.conn
+
+	// Replace the database, scheduling a reload, and disconnect before it happens
+
+	err = os.Rename(next_path, db_path)
+
+	if err != nil {
+		t.Fatalf("Failed to replace database, %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	err = db.Disconnect(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to disconnect database, %v", err)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+
+	sqlite_db.mu.RLock()
+	current := sqlite_db.conn
+	sqlite_db.mu.RUnlock()
+
+	if current != conn {
+		t.Fatalf("Database was reloaded after being disconnected")
+	}
+
+	err = sqlite_db.Reload(ctx)
+
+	if err == nil {
+		t.Fatalf("Expected reload after disconnect to fail")
+	}
+}
+
+func TestDisconnectWaitsForQueries(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := NewSQLiteSpatialDatabase(ctx, "sqlite://"+DEFAULT_ENGINE+"?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	// Simulate a query using the current connection
+
+	conn, release := sqlite_db.acquire()
+
+	done := make(chan error)
+
+	go func() {
+		done <- db.Disconnect(ctx)
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("Expected disconnect to wait for query to finish")
+	case <-time.After(100 * time.Millisecond):
+		// pass
+	}
+
+	err = conn.db.PingContext(ctx)
+
+	if err != nil {
+		t.Fatalf("Expected connection to remain open while query is running, %v", err)
+	}
+
+	release()
+
+	err = <-done
+
+	if err != nil {
+		t.Fatalf("Failed to disconnect database, %v", err)
+	}
+
+	err = conn.db.PingContext(ctx)
+
+	if err == nil {
+		t.Fatalf("Expected connection to be closed once query has finished")
+	}
+}
+
+func createReloadDatabase(t *testing.T, path string, id int64) {
+
+	ctx := context.Background()
+
+	db, err := database.NewSpatialDatabase(ctx, fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, path))
+
+	if err != nil {
+		t.Fatalf("Failed to create database %s, %v", path, err)
+	}
+
+	defer db.Close(ctx)
+
+	body, err := os.ReadFile(fmt.Sprintf("fixtures/%d.geojson", id))
+
+	if err != nil {
+		t.Fatalf("Failed to read fixture for %d, %v", id, err)
+	}
+
+	err = db.IndexFeature(ctx, body)
+
+	if err != nil {
+		t.Fatalf("Failed to index %d, %v", id, err)
+	}
+}
@@ -0,0 +1,414 @@
+package sqlite
+
+// Fetch databases stored in gocloud.dev/blob buckets to a local cache before opening them.
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aaronland/gocloud/blob/bucket"
+	"github.com/klauspost/compress/zstd"
+	"go.opentelemetry.io/otel/attribute"
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/fileblob"
+	"gocloud.dev/gcerrors"
+)
+
+// The name of the directory, inside the user's cache directory, where remote databases are cached by default.
+const DEFAULT_CACHE_DIRECTORY string = "whosonfirst-spatial-sqlite"
+
+// The extension of the sidecar file containing the SHA-256 checksum for a remote database.
+const CHECKSUM_EXTENSION string = ".sha256"
+
+// remoteDatabase is a struct containing metadata about a remote database that has been cached locally. It is
+// stored alongside the cached database (as "{PATH}.json").
+type remoteDatabase struct {
+	// The URI of the remote database.
+	URI string `json:"uri"`
+	// The ETag of the remote database when it was fetched.
+	ETag string `json:"etag,omitempty"`
+	// The SHA-256 checksum of the remote database when it was fetched.
+	Checksum string `json:"checksum"`
+	// The time the remote database was fetched.
+	Fetched time.Time `json:"fetched"`
+}
+
+// isRemoteDSN returns a boolean value indicating whether 'dsn' is a gocloud.dev/blob URI (for example
+// "file:///releases/ca.db.gz" or "s3://bucket/ca.db") rather than a SQLite DSN. Note that SQLite URI filenames
+// (for example "file:ca.db?mode=ro") are not considered remote.
+func isRemoteDSN(ctx context.Context, dsn string) bool {
+
+	if !strings.Contains(dsn, "://") {
+		return false
+	}
+
+	u, err := url.Parse(dsn)
+
+	if err != nil {
+		return false
+	}
+
+	return blob.DefaultURLMux().ValidBucketScheme(u.Scheme)
+}
+
+// fetchDatabase downloads the database defined by the 'dsn' parameter in 'uri' to a local cache directory, if it
+// is a remote database, and returns a new URI whose 'dsn' parameter is the path to the cached copy. If 'dsn' is not
+// a remote database then 'uri' is returned unchanged.
+func fetchDatabase(ctx context.Context, uri string) (string, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+	dsn := q.Get("dsn")
+
+	if !isRemoteDSN(ctx, dsn) {
+		return uri, nil
+	}
+
+	cache_dir := q.Get("cache-dir")
+	compression := q.Get("compression")
+	str_required := q.Get("checksum-required")
+
+	checksum_required := false
+
+	if str_required != "" {
+
+		v, err := strconv.ParseBool(str_required)
+
+		if err != nil {
+			return "", fmt.Errorf("Invalid ?checksum-required= parameter, %w", err)
+		}
+
+		checksum_required = v
+	}
+
+	if cache_dir == "" {
+
+		user_cache, err := os.UserCacheDir()
+
+		if err != nil {
+			return "", fmt.Errorf("Failed to derive user cache directory, %w", err)
+		}
+
+		cache_dir = filepath.Join(user_cache, DEFAULT_CACHE_DIRECTORY)
+	}
+
+	if compression == "" {
+		compression = "auto"
+	}
+
+	path, err := fetchRemoteDatabase(ctx, dsn, cache_dir, compression, checksum_required)
+
+	if err != nil {
+		return "", err
+	}
+
+	q.Set("dsn", path)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// fetchRemoteDatabase downloads (and decompresses) the remote database 'dsn' to 'cache_dir' returning the path of
+// the cached copy. If a cached copy exists and the remote database's checksum (or ETag, if there is no checksum)
+// is unchanged then it is reused.
+func fetchRemoteDatabase(ctx context.Context, dsn string, cache_dir string, compression string, checksum_required bool) (string, error) {
+
+	t1 := time.Now()
+
+	ctx, span := tracer.Start(ctx, "fetchRemoteDatabase")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("dsn", dsn))
+
+	bucket_uri, key, err := bucket.ParseURI(dsn)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse remote DSN, %w", err)
+	}
+
+	if compression == "auto" {
+
+		switch filepath.Ext(key) {
+		case ".gz":
+			compression = "gzip"
+		case ".zst", ".zstd":
+			compression = "zstd"
+		default:
+			compression = "none"
+		}
+	}
+
+	switch compression {
+	case "gzip", "zstd", "none":
+		// pass
+	default:
+		return "", fmt.Errorf("Invalid or unsupported compression '%s'", compression)
+	}
+
+	b, err := blob.OpenBucket(ctx, bucket_uri)
+
+	if err != nil {
+		recordSpanError(span, err)
+		return "", fmt.Errorf("Failed to open bucket for %s, %w", dsn, err)
+	}
+
+	defer b.Close()
+
+	attrs, err := b.Attributes(ctx, key)
+
+	if err != nil {
+		recordSpanError(span, err)
+		return "", fmt.Errorf("Failed to derive attributes for %s, %w", dsn, err)
+	}
+
+	checksum, err := readRemoteChecksum(ctx, b, key)
+
+	if err != nil {
+		recordSpanError(span, err)
+		return "", err
+	}
+
+	if checksum == "" && checksum_required {
+		return "", fmt.Errorf("Missing checksum file (%s%s) for %s", key, CHECKSUM_EXTENSION, dsn)
+	}
+
+	// Cached databases are stored in a sub-directory derived from the (hash of the) remote URI so that
+	// databases with the same name in different buckets don't collide.
+
+	dsn_hash := sha256.Sum256([]byte(dsn))
+	root := filepath.Join(cache_dir, hex.EncodeToString(dsn_hash[:])[:16])
+
+	fname := key
+
+	if compression != "none" {
+		fname = strings.TrimSuffix(fname, filepath.Ext(fname))
+	}
+
+	path := filepath.Join(root, fname)
+	meta_path := fmt.Sprintf("%s.json", path)
+
+	meta, err := readRemoteDatabaseMetadata(meta_path)
+
+	if err == nil {
+
+		_, err := os.Stat(path)
+
+		if err == nil && isRemoteDatabaseUnchanged(meta, attrs.ETag, checksum) {
+			span.SetAttributes(attribute.Bool("cache_hit", true))
+			slog.Debug("Reuse cached database", "dsn", dsn, "path", path)
+			return path, nil
+		}
+	}
+
+	span.SetAttributes(attribute.Bool("cache_hit", false))
+
+	err = os.MkdirAll(root, 0755)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to create cache directory, %w", err)
+	}
+
+	r, err := b.NewReader(ctx, key, nil)
+
+	if err != nil {
+		recordSpanError(span, err)
+		return "", fmt.Errorf("Failed to open %s, %w", dsn, err)
+	}
+
+	defer r.Close()
+
+	h := sha256.New()
+	tee := io.TeeReader(r, h)
+
+	tmp_wr, err := os.CreateTemp(root, ".download-*")
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to create temporary file, %w", err)
+	}
+
+	tmp_path := tmp_wr.Name()
+
+	defer os.Remove(tmp_path)
+
+	size, err := copyRemoteDatabase(tmp_wr, tee, compression)
+
+	if err != nil {
+		tmp_wr.Close()
+		recordSpanError(span, err)
+		return "", fmt.Errorf("Failed to fetch %s, %w", dsn, err)
+	}
+
+	err = tmp_wr.Close()
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to close temporary file, %w", err)
+	}
+
+	fetched_checksum := hex.EncodeToString(h.Sum(nil))
+
+	if checksum != "" && fetched_checksum != checksum {
+		err := fmt.Errorf("Checksum mismatch for %s, expected %s but got %s", dsn, checksum, fetched_checksum)
+		recordSpanError(span, err)
+		return "", err
+	}
+
+	err = os.Rename(tmp_path, path)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to move database in to place, %w", err)
+	}
+
+	meta = &remoteDatabase{
+		URI:      dsn,
+		ETag:     attrs.ETag,
+		Checksum: fetched_checksum,
+		Fetched:  time.Now(),
+	}
+
+	err = writeRemoteDatabaseMetadata(meta_path, meta)
+
+	if err != nil {
+		return "", err
+	}
+
+	span.SetAttributes(attribute.Int64("size", size))
+
+	slog.Info("Fetched remote database", "dsn", dsn, "path", path, "size", size, "time", time.Since(t1))
+	return path, nil
+}
+
+// copyRemoteDatabase copies 'r' to 'wr' decompressing it using 'compression'.
+func copyRemoteDatabase(wr io.Writer, r io.Reader, compression string) (int64, error) {
+
+	switch compression {
+	case "gzip":
+
+		gz, err := gzip.NewReader(r)
+
+		if err != nil {
+			return 0, fmt.Errorf("Failed to create gzip reader, %w", err)
+		}
+
+		defer gz.Close()
+
+		r = gz
+
+	case "zstd":
+
+		zr, err := zstd.NewReader(r)
+
+		if err != nil {
+			return 0, fmt.Errorf("Failed to create zstd reader, %w", err)
+		}
+
+		defer zr.Close()
+
+		r = zr
+	}
+
+	n, err := io.Copy(wr, r)
+
+	if err != nil {
+		return n, err
+	}
+
+	// Ensure that any trailing bytes (not consumed by the decompressor) are included in the checksum.
+
+	_, err = io.Copy(io.Discard, r)
+
+	if err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// readRemoteChecksum reads the SHA-256 checksum for 'key' from its sidecar file in 'b'. The sidecar file is expected
+// to be in the format produced by the `sha256sum` tool. If the sidecar file does not exist an empty string is returned.
+func readRemoteChecksum(ctx context.Context, b *blob.Bucket, key string) (string, error) {
+
+	checksum_key := fmt.Sprintf("%s%s", key, CHECKSUM_EXTENSION)
+
+	body, err := b.ReadAll(ctx, checksum_key)
+
+	if err != nil {
+
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("Failed to read checksum file %s, %w", checksum_key, err)
+	}
+
+	fields := strings.Fields(string(body))
+
+	if len(fields) == 0 {
+		return "", fmt.Errorf("Checksum file %s is empty", checksum_key)
+	}
+
+	return strings.ToLower(fields[0]), nil
+}
+
+// isRemoteDatabaseUnchanged returns a boolean value indicating whether a remote database with 'etag' and 'checksum'
+// is the same as the one described by 'meta'. Checksums take precedence over ETags.
+func isRemoteDatabaseUnchanged(meta *remoteDatabase, etag string, checksum string) bool {
+
+	if checksum != "" {
+		return meta.Checksum == checksum
+	}
+
+	return etag != "" && meta.ETag == etag
+}
+
+func readRemoteDatabaseMetadata(path string) (*remoteDatabase, error) {
+
+	body, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var meta *remoteDatabase
+
+	err = json.Unmarshal(body, &meta)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal %s, %w", path, err)
+	}
+
+	return meta, nil
+}
+
+func writeRemoteDatabaseMetadata(path string, meta *remoteDatabase) error {
+
+	body, err := json.Marshal(meta)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal metadata, %w", err)
+	}
+
+	err = os.WriteFile(path, body, 0644)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write %s, %w", path, err)
+	}
+
+	return nil
+}
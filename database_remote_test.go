@@ -0,0 +1,182 @@
+package sqlite
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+func TestRemoteDatabase(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	releases := filepath.Join(root, "releases")
+	cache_dir := filepath.Join(root, "cache")
+
+	err := os.MkdirAll(releases, 0755)
+
+	if err != nil {
+		t.Fatalf("Failed to create releases directory, %v", err)
+	}
+
+	db_path := filepath.Join(root, "ca.db")
+	createReloadDatabase(t, db_path, 101737491)
+
+	tests := map[string]func(io.Writer) (io.WriteCloser, error){
+		"ca.db.gz": func(wr io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(wr), nil
+		},
+		"ca.db.zst": func(wr io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(wr)
+		},
+	}
+
+	for fname, new_writer := range tests {
+
+		release_path := filepath.Join(releases, fname)
+		checksum := writeRemoteDatabase(t, db_path, release_path, new_writer)
+
+		database_uri := fmt.Sprintf("sqlite://%s?dsn=file://%s&cache-dir=%s&checksum-required=true", DEFAULT_ENGINE, release_path, cache_dir)
+
+		db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+		if err != nil {
+			t.Fatalf("Failed to create spatial database for %s, %v", fname, err)
+		}
+
+		exists, err := db.Exists(ctx, "101737491")
+
+		db.Close(ctx)
+
+		if err != nil {
+			t.Fatalf("Failed to determine whether record exists in %s, %v", fname, err)
+		}
+
+		if !exists {
+			t.Fatalf("Expected 101737491 to exist in %s", fname)
+		}
+
+		// Subsequent fetches should reuse the cached copy
+
+		uri, err := fetchDatabase(ctx, database_uri)
+
+		if err != nil {
+			t.Fatalf("Failed to fetch %s, %v", fname, err)
+		}
+
+		u, err := url.Parse(uri)
+
+		if err != nil {
+			t.Fatalf("Failed to parse URI, %v", err)
+		}
+
+		cached_path := u.Query().Get("dsn")
+
+		meta, err := readRemoteDatabaseMetadata(fmt.Sprintf("%s.json", cached_path))
+
+		if err != nil {
+			t.Fatalf("Failed to read metadata for %s, %v", cached_path, err)
+		}
+
+		if meta.Checksum != checksum {
+			t.Fatalf("Unexpected checksum for %s, %s", fname, meta.Checksum)
+		}
+
+		fetched := meta.Fetched
+
+		_, err = fetchDatabase(ctx, database_uri)
+
+		if err != nil {
+			t.Fatalf("Failed to fetch %s, %v", fname, err)
+		}
+
+		meta, err = readRemoteDatabaseMetadata(fmt.Sprintf("%s.json", cached_path))
+
+		if err != nil {
+			t.Fatalf("Failed to read metadata for %s, %v", cached_path, err)
+		}
+
+		if !meta.Fetched.Equal(fetched) {
+			t.Fatalf("Expected cached copy of %s to be reused", fname)
+		}
+
+		// A checksum that doesn't match should cause the fetch to fail
+
+		err = os.WriteFile(release_path+CHECKSUM_EXTENSION, []byte("0000  "+fname+"\n"), 0644)
+
+		if err != nil {
+			t.Fatalf("Failed to write checksum file, %v", err)
+		}
+
+		_, err = fetchDatabase(ctx, database_uri)
+
+		if err == nil {
+			t.Fatalf("Expected checksum mismatch for %s", fname)
+		}
+	}
+}
+
+func writeRemoteDatabase(t *testing.T, db_path string, release_path string, new_writer func(io.Writer) (io.WriteCloser, error)) string {
+
+	r, err := os.Open(db_path)
+
+	if err != nil {
+		t.Fatalf("Failed to open %s, %v", db_path, err)
+	}
+
+	defer r.Close()
+
+	wr, err := os.Create(release_path)
+
+	if err != nil {
+		t.Fatalf("Failed to create %s, %v", release_path, err)
+	}
+
+	h := sha256.New()
+
+	compressed_wr, err := new_writer(io.MultiWriter(wr, h))
+
+	if err != nil {
+		t.Fatalf("Failed to create writer for %s, %v", release_path, err)
+	}
+
+	_, err = io.Copy(compressed_wr, r)
+
+	if err != nil {
+		t.Fatalf("Failed to write %s, %v", release_path, err)
+	}
+
+	err = compressed_wr.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to close writer for %s, %v", release_path, err)
+	}
+
+	err = wr.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to close %s, %v", release_path, err)
+	}
+
+	checksum := hex.EncodeToString(h.Sum(nil))
+
+	err = os.WriteFile(release_path+CHECKSUM_EXTENSION, []byte(fmt.Sprintf("%s  %s\n", checksum, filepath.Base(release_path))), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write checksum for %s, %v", release_path, err)
+	}
+
+	return checksum
+}
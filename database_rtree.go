@@ -0,0 +1,718 @@
+package sqlite
+
+// An optional in-process R-tree index, derived from the rtree (or geojson) table, used to find the candidate records
+// for spatial queries instead of the SQLite rtree module. SQLite remains the source of SPR and GeoJSON records and, unless
+// polygons are cached, of the geometries used to test candidate records.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhconnelly/rtreego"
+	"github.com/paulmach/orb"
+	"github.com/whosonfirst/go-whosonfirst-feature/alt"
+	"github.com/whosonfirst/go-whosonfirst-feature/geometry"
+	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// The name of the (default) rtree index which uses the SQLite rtree module to find candidate records.
+const RTREE_INDEX_SQLITE string = "sqlite"
+
+// The name of the rtree index which uses an in-process (rtreego) R-tree to find candidate records.
+const RTREE_INDEX_MEMORY string = "memory"
+
+// The minimum and maximum number of entries in each node of an in-process R-tree.
+const memory_rtree_min_children int = 25
+const memory_rtree_max_children int = 50
+
+// The maximum number of rtree rows whose geometries are read in a single query.
+const memory_rtree_geometry_batch_size int = 500
+
+// memoryRTree is an in-process R-tree index of the bounding boxes of the polygons in a database.
+type memoryRTree struct {
+	mu    *sync.RWMutex
+	rtree *rtreego.Rtree
+	// The entries in the index keyed by their Who's On First ID, used to update and remove entries.
+	entries map[int64][]*memoryRTreeEntry
+	// A boolean flag indicating whether parsed polygons are kept in the index, rather than read from the rtree table.
+	polygons bool
+	// The overall extent of the entries in the index, or nil if it is empty, and a boolean flag indicating whether it
+	// needs to be derived again because entries have been removed.
+	bounds       *orb.Bound
+	bounds_stale bool
+}
+
+// memoryRTreeEntry is a single polygon in a `memoryRTree` index.
+type memoryRTreeEntry struct {
+	// The rtree table row ID for the entry.
+	id         int64
+	feature_id int64
+	alt_label  string
+	rect       rtreego.Rect
+	// The parsed polygon for the entry, if polygons are cached or there is no rtree table to read them from.
+	polygon orb.Polygon
+}
+
+// Bounds implements the `rtreego.Spatial` interface.
+func (e *memoryRTreeEntry) Bounds() rtreego.Rect {
+	return e.rect
+}
+
+// bound returns the bounding box of 'e' as an `orb.Bound` instance.
+func (e *memoryRTreeEntry) bound() orb.Bound {
+
+	min := orb.Point{e.rect.PointCoord(0), e.rect.PointCoord(1)}
+	max := orb.Point{min.X() + e.rect.LengthsCoord(0), min.Y() + e.rect.LengthsCoord(1)}
+
+	return orb.Bound{Min: min, Max: max}
+}
+
+// spatialIndex returns a new `RTreeSpatialIndex` instance for 'e'.
+func (e *memoryRTreeEntry) spatialIndex() *RTreeSpatialIndex {
+
+	b := e.bound()
+
+	sp := &RTreeSpatialIndex{
+		Id:        fmt.Sprintf("%d#%d", e.feature_id, e.id),
+		FeatureId: fmt.Sprintf("%d", e.feature_id),
+		bounds:    b,
+		polygon:   e.polygon,
+	}
+
+	if e.alt_label != "" {
+		sp.IsAlt = true
+		sp.AltLabel = e.alt_label
+	}
+
+	return sp
+}
+
+// parseRTreeIndexOptions assigns the rtree index defined by the '?rtree-index=' and '?rtree-index-polygons=' parameters
+// in 'q' to 'db'. The in-process R-tree index itself is created by `loadRTreeIndex`, once the database's schema has been
+// checked.
+func parseRTreeIndexOptions(db *SQLiteSpatialDatabase, q url.Values) error {
+
+	rtree_index := RTREE_INDEX_SQLITE
+
+	if q.Has("rtree-index") {
+		rtree_index = q.Get("rtree-index")
+	}
+
+	switch rtree_index {
+	case RTREE_INDEX_SQLITE, RTREE_INDEX_MEMORY:
+		// pass
+	default:
+		return fmt.Errorf("Invalid or unsupported ?rtree-index= parameter, '%s'", rtree_index)
+	}
+
+	if q.Has("rtree-index-polygons") {
+
+		v, err := strconv.ParseBool(q.Get("rtree-index-polygons"))
+
+		if err != nil {
+			return fmt.Errorf("Invalid ?rtree-index-polygons= parameter, %w", err)
+		}
+
+		db.rtree_index_polygons = v
+	}
+
+	db.rtree_index = rtree_index
+	return nil
+}
+
+// loadRTreeIndex assigns a newly loaded in-process R-tree index to 'conn' if 'r' uses the "memory" rtree index.
+func (r *SQLiteSpatialDatabase) loadRTreeIndex(ctx context.Context, conn *sqliteConn) error {
+
+	if r.rtree_index != RTREE_INDEX_MEMORY {
+		return nil
+	}
+
+	idx := newMemoryRTree(r.rtree_index_polygons)
+
+	err := r.loadMemoryRTree(ctx, conn.db, idx)
+
+	if err != nil {
+		return err
+	}
+
+	conn.rtree = idx
+	return nil
+}
+
+// newMemoryRTree returns a new, empty, `memoryRTree` instance. If 'polygons' is true parsed polygons are kept in the index.
+func newMemoryRTree(polygons bool) *memoryRTree {
+
+	idx := &memoryRTree{
+		mu:       new(sync.RWMutex),
+		rtree:    rtreego.NewTree(2, memory_rtree_min_children, memory_rtree_max_children),
+		entries:  make(map[int64][]*memoryRTreeEntry),
+		polygons: polygons,
+	}
+
+	return idx
+}
+
+// loadMemoryRTree replaces the contents of 'idx' with the rows in the rtree table of 'db'. If the rtree table can not
+// be read because the SQLite rtree module is not available the index is derived from the geojson table instead. Since
+// there is no rtree table to read geometries from in that case parsed polygons are always kept in the index.
+func (r *SQLiteSpatialDatabase) loadMemoryRTree(ctx context.Context, db *sql.DB, idx *memoryRTree) error {
+
+	t1 := time.Now()
+
+	ctx, span := tracer.Start(ctx, "loadMemoryRTree")
+	defer span.End()
+
+	entries, err := r.readRTreeEntries(ctx, db, idx.polygons, "")
+
+	if err != nil && isMissingModuleError(err) {
+		slog.Warn("SQLite rtree module is not available, deriving in-memory rtree index from geojson table", "error", err)
+		entries, err = r.readGeoJSONEntries(ctx, db)
+	}
+
+	if err != nil {
+		recordSpanError(span, err)
+		return fmt.Errorf("Failed to load in-memory rtree index, %w", err)
+	}
+
+	idx.load(entries)
+
+	span.SetAttributes(attribute.Int("count", len(entries)))
+
+	slog.Debug("Loaded in-memory rtree index", "count", len(entries), "time", time.Since(t1))
+	return nil
+}
+
+// readRTreeEntries returns a `memoryRTreeEntry` instance for each row in the rtree table of 'db'. If 'where' is not empty
+// it is used as the query's conditions with 'args' as its arguments. If 'polygons' is true each row's geometry is parsed.
+func (r *SQLiteSpatialDatabase) readRTreeEntries(ctx context.Context, db *sql.DB, polygons bool, where string, args ...any) ([]*memoryRTreeEntry, error) {
+
+	cols := "id, wof_id, is_alt, COALESCE(alt_label, ''), min_x, min_y, max_x, max_y"
+
+	if polygons {
+		cols = cols + ", geometry"
+	}
+
+	q := fmt.Sprintf("SELECT %s FROM %s", cols, r.rtree_table.Name())
+
+	if where != "" {
+		q = fmt.Sprintf("%s WHERE %s", q, where)
+	}
+
+	rows, err := db.QueryContext(ctx, q, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := make([]*memoryRTreeEntry, 0)
+
+	for rows.Next() {
+
+		var id int64
+		var feature_id int64
+		var is_alt int32
+		var alt_label string
+		var minx float64
+		var miny float64
+		var maxx float64
+		var maxy float64
+		var geometry string
+
+		dest := []any{&id, &feature_id, &is_alt, &alt_label, &minx, &miny, &maxx, &maxy}
+
+		if polygons {
+			dest = append(dest, &geometry)
+		}
+
+		err := rows.Scan(dest...)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan rtree row, %w", err)
+		}
+
+		if is_alt != 1 {
+			alt_label = ""
+		}
+
+		b := orb.Bound{
+			Min: orb.Point{minx, miny},
+			Max: orb.Point{maxx, maxy},
+		}
+
+		var poly orb.Polygon
+
+		if polygons {
+
+			poly, err = parseRTreeGeometry(geometry)
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse geometry for rtree row %d, %w", id, err)
+			}
+		}
+
+		entries = append(entries, newMemoryRTreeEntry(id, feature_id, alt_label, b, poly))
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate rtree rows, %w", err)
+	}
+
+	return entries, nil
+}
+
+// readGeoJSONEntries returns the `memoryRTreeEntry` instances for each record in the geojson table of 'db'. Entry IDs
+// are assigned sequentially.
+func (r *SQLiteSpatialDatabase) readGeoJSONEntries(ctx context.Context, db *sql.DB) ([]*memoryRTreeEntry, error) {
+
+	q := fmt.Sprintf("SELECT body FROM %s", r.geojson_table.Name())
+
+	rows, err := db.QueryContext(ctx, q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := make([]*memoryRTreeEntry, 0)
+
+	for rows.Next() {
+
+		var body []byte
+
+		err := rows.Scan(&body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan geojson row, %w", err)
+		}
+
+		feature_id, alt_label, polys, err := featurePolygons(body, r.index_alt_files)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, poly := range polys {
+			id := int64(len(entries) + 1)
+			entries = append(entries, newMemoryRTreeEntry(id, feature_id, alt_label, poly.Bound(), poly))
+		}
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate geojson rows, %w", err)
+	}
+
+	return entries, nil
+}
+
+// newMemoryRTreeEntry returns a new `memoryRTreeEntry` instance for the polygon bounded by 'b'. 'poly' may be nil.
+func newMemoryRTreeEntry(id int64, feature_id int64, alt_label string, b orb.Bound, poly orb.Polygon) *memoryRTreeEntry {
+
+	// NewRectFromPoints (unlike NewRect) allows rectangles with no width or height
+	rect, _ := rtreego.NewRectFromPoints(rtreego.Point{b.Min.X(), b.Min.Y()}, rtreego.Point{b.Max.X(), b.Max.Y()})
+
+	e := &memoryRTreeEntry{
+		id:         id,
+		feature_id: feature_id,
+		alt_label:  alt_label,
+		rect:       rect,
+		polygon:    poly,
+	}
+
+	return e
+}
+
+// featurePolygons returns the Who's On First ID, alternate geometry label and the polygons in 'body' using the same
+// rules as the rtree table. If 'body' is not a polygon, or is an alternate geometry and 'index_alt_files' is false,
+// no polygons are returned.
+func featurePolygons(body []byte, index_alt_files bool) (int64, string, []orb.Polygon, error) {
+
+	feature_id, err := properties.Id(body)
+
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("Failed to derive ID, %w", err)
+	}
+
+	alt_label := ""
+
+	if alt.IsAlt(body) {
+
+		if !index_alt_files {
+			return feature_id, "", nil, nil
+		}
+
+		label, err := properties.AltLabel(body)
+
+		if err != nil {
+			return 0, "", nil, fmt.Errorf("Failed to derive alt label for %d, %w", feature_id, err)
+		}
+
+		alt_label = label
+	}
+
+	geojson_geom, err := geometry.Geometry(body)
+
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("Failed to derive geometry for %d, %w", feature_id, err)
+	}
+
+	switch g := geojson_geom.Geometry().(type) {
+	case orb.Polygon:
+		return feature_id, alt_label, []orb.Polygon{g}, nil
+	case orb.MultiPolygon:
+		return feature_id, alt_label, []orb.Polygon(g), nil
+	default:
+		return feature_id, alt_label, nil, nil
+	}
+}
+
+// isMissingModuleError returns a boolean value indicating whether 'err' was caused by a virtual table module (for
+// example the rtree module) which is not available to the SQLite driver.
+func isMissingModuleError(err error) bool {
+	return strings.Contains(err.Error(), "no such module")
+}
+
+// syncMemoryRTree replaces the entries in the in-process R-tree index for 'conn' for the record defined by 'body' with
+// the rows for that record in the rtree table. It is called after the record has been written to the rtree table so that
+// the index mirrors the table's row IDs and bounding boxes exactly.
+func (r *SQLiteSpatialDatabase) syncMemoryRTree(ctx context.Context, conn *sqliteConn, body []byte) error {
+
+	feature_id, alt_label, polys, err := featurePolygons(body, r.index_alt_files)
+
+	if err != nil {
+		return err
+	}
+
+	// The rows for the record are found using the rtree index so query the extent of both its current entries
+	// (which may have been kept, since rows are appended when a record is indexed) and its new polygons.
+
+	b, ok := conn.rtree.bound(feature_id, alt_label)
+
+	for _, poly := range polys {
+
+		if !ok {
+			b = poly.Bound()
+			ok = true
+			continue
+		}
+
+		b = b.Union(poly.Bound())
+	}
+
+	if !ok {
+		return nil
+	}
+
+	where := "max_x >= ? AND min_x <= ? AND max_y >= ? AND min_y <= ? AND wof_id = ? AND COALESCE(alt_label, '') = ?"
+
+	entries, err := r.readRTreeEntries(ctx, conn.db, conn.rtree.polygons, where, b.Min.X(), b.Max.X(), b.Min.Y(), b.Max.Y(), feature_id, alt_label)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read rtree rows for %d, %w", feature_id, err)
+	}
+
+	conn.rtree.replace(feature_id, alt_label, entries)
+	return nil
+}
+
+// memoryRTreeCandidates returns the list of `RTreeSpatialIndex` instances for 'entries'. The geometries for entries
+// without a parsed polygon are read from the rtree table in batches. Entries whose rows no longer exist are skipped.
+func (r *SQLiteSpatialDatabase) memoryRTreeCandidates(ctx context.Context, conn *sqliteConn, entries []*memoryRTreeEntry) ([]*RTreeSpatialIndex, error) {
+
+	candidates := make([]*RTreeSpatialIndex, len(entries))
+	missing := make(map[int64]*RTreeSpatialIndex)
+
+	for i, e := range entries {
+
+		sp := e.spatialIndex()
+		candidates[i] = sp
+
+		if sp.polygon == nil {
+			missing[e.id] = sp
+		}
+	}
+
+	if len(missing) == 0 {
+		return candidates, nil
+	}
+
+	ids := make([]any, 0, len(missing))
+
+	for id := range missing {
+		ids = append(ids, id)
+	}
+
+	for start := 0; start < len(ids); start += memory_rtree_geometry_batch_size {
+
+		end := min(start+memory_rtree_geometry_batch_size, len(ids))
+		batch := ids[start:end]
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		q := fmt.Sprintf("SELECT id, geometry FROM %s WHERE id IN (%s)", r.rtree_table.Name(), placeholders)
+
+		rows, err := conn.db.QueryContext(ctx, q, batch...)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read rtree geometries, %w", err)
+		}
+
+		for rows.Next() {
+
+			var id int64
+			var geometry string
+
+			err := rows.Scan(&id, &geometry)
+
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("Failed to scan rtree geometry, %w", err)
+			}
+
+			missing[id].geometry = geometry
+			delete(missing, id)
+		}
+
+		err = rows.Err()
+		rows.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to iterate rtree geometries, %w", err)
+		}
+	}
+
+	if len(missing) == 0 {
+		return candidates, nil
+	}
+
+	slog.Debug("Skipping in-memory rtree index entries with no rtree row", "count", len(missing))
+
+	found := make([]*RTreeSpatialIndex, 0, len(candidates)-len(missing))
+
+	for _, sp := range candidates {
+
+		if sp.polygon == nil && sp.geometry == "" {
+			continue
+		}
+
+		found = append(found, sp)
+	}
+
+	return found, nil
+}
+
+// load replaces the contents of 'idx' with 'entries'.
+func (idx *memoryRTree) load(entries []*memoryRTreeEntry) {
+
+	objs := make([]rtreego.Spatial, len(entries))
+	by_feature := make(map[int64][]*memoryRTreeEntry)
+
+	for i, e := range entries {
+		objs[i] = e
+		by_feature[e.feature_id] = append(by_feature[e.feature_id], e)
+	}
+
+	rtree := rtreego.NewTree(2, memory_rtree_min_children, memory_rtree_max_children, objs...)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.rtree = rtree
+	idx.entries = by_feature
+
+	idx.deriveBoundsLocked()
+}
+
+// bound returns the combined bounding box of the entries for the record 'feature_id' with the alternate geometry label
+// 'alt_label' in 'idx' and a boolean value indicating whether there are any entries.
+func (idx *memoryRTree) bound(feature_id int64, alt_label string) (orb.Bound, bool) {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var b orb.Bound
+	ok := false
+
+	for _, e := range idx.entries[feature_id] {
+
+		if e.alt_label != alt_label {
+			continue
+		}
+
+		if !ok {
+			b = e.bound()
+			ok = true
+			continue
+		}
+
+		b = b.Union(e.bound())
+	}
+
+	return b, ok
+}
+
+// replace replaces the entries for the record 'feature_id' with the alternate geometry label 'alt_label' in 'idx' with 'entries'.
+func (idx *memoryRTree) replace(feature_id int64, alt_label string, entries []*memoryRTreeEntry) {
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(feature_id, alt_label)
+
+	for _, e := range entries {
+		idx.rtree.Insert(e)
+		idx.entries[feature_id] = append(idx.entries[feature_id], e)
+		idx.expandBoundsLocked(e.bound())
+	}
+}
+
+// remove removes the entries for the record 'feature_id' with the alternate geometry label 'alt_label' from 'idx'.
+func (idx *memoryRTree) remove(feature_id int64, alt_label string) {
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(feature_id, alt_label)
+}
+
+// removeLocked removes the entries for the record 'feature_id' with the alternate geometry label 'alt_label' from 'idx'.
+// The caller must hold the write lock for 'idx'.
+func (idx *memoryRTree) removeLocked(feature_id int64, alt_label string) {
+
+	keep := make([]*memoryRTreeEntry, 0)
+
+	for _, e := range idx.entries[feature_id] {
+
+		if e.alt_label != alt_label {
+			keep = append(keep, e)
+			continue
+		}
+
+		idx.rtree.Delete(e)
+		idx.bounds_stale = true
+	}
+
+	if len(keep) == 0 {
+		delete(idx.entries, feature_id)
+		return
+	}
+
+	idx.entries[feature_id] = keep
+}
+
+// removeFeature removes all the entries, including alternate geometries, for the record 'feature_id' from 'idx'.
+func (idx *memoryRTree) removeFeature(feature_id int64) {
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, e := range idx.entries[feature_id] {
+		idx.rtree.Delete(e)
+		idx.bounds_stale = true
+	}
+
+	delete(idx.entries, feature_id)
+}
+
+// intersects returns the list of entries in 'idx' whose bounding boxes intersect 'rect'.
+func (idx *memoryRTree) intersects(rect *orb.Bound) []*memoryRTreeEntry {
+
+	bb, _ := rtreego.NewRectFromPoints(rtreego.Point{rect.Min.X(), rect.Min.Y()}, rtreego.Point{rect.Max.X(), rect.Max.Y()})
+
+	idx.mu.RLock()
+	results := idx.rtree.SearchIntersect(bb)
+	idx.mu.RUnlock()
+
+	entries := make([]*memoryRTreeEntry, len(results))
+
+	for i, obj := range results {
+		entries[i] = obj.(*memoryRTreeEntry)
+	}
+
+	return entries
+}
+
+// extent returns the overall extent of the entries in 'idx' or nil if it is empty. The extent is kept up to date as
+// entries are added and only derived again, from every entry, after entries have been removed.
+func (idx *memoryRTree) extent() *orb.Bound {
+
+	idx.mu.RLock()
+
+	if !idx.bounds_stale {
+		b := idx.copyBoundsLocked()
+		idx.mu.RUnlock()
+		return b
+	}
+
+	idx.mu.RUnlock()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.bounds_stale {
+		idx.deriveBoundsLocked()
+	}
+
+	return idx.copyBoundsLocked()
+}
+
+// copyBoundsLocked returns a copy of the overall extent of the entries in 'idx'. The caller must hold a lock for 'idx'.
+func (idx *memoryRTree) copyBoundsLocked() *orb.Bound {
+
+	if idx.bounds == nil {
+		return nil
+	}
+
+	b := *idx.bounds
+	return &b
+}
+
+// expandBoundsLocked updates the overall extent of the entries in 'idx' to include 'b'. The caller must hold the
+// write lock for 'idx'.
+func (idx *memoryRTree) expandBoundsLocked(b orb.Bound) {
+
+	if idx.bounds == nil {
+		idx.bounds = &b
+		return
+	}
+
+	u := idx.bounds.Union(b)
+	idx.bounds = &u
+}
+
+// deriveBoundsLocked derives the overall extent of the entries in 'idx' from every entry. The caller must hold the
+// write lock for 'idx'.
+func (idx *memoryRTree) deriveBoundsLocked() {
+
+	idx.bounds = nil
+	idx.bounds_stale = false
+
+	for _, entries := range idx.entries {
+
+		for _, e := range entries {
+			idx.expandBoundsLocked(e.bound())
+		}
+	}
+}
+
+// size returns the number of entries in 'idx'.
+func (idx *memoryRTree) size() int {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.rtree.Size()
+}
@@ -0,0 +1,389 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/generator"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+func TestMemoryRTreeIndex(t *testing.T) {
+
+	ctx := context.Background()
+
+	uri, err := createFixturesDatabase(ctx, t.TempDir())
+
+	if err != nil {
+		t.Fatalf("Failed to create fixtures database, %v", err)
+	}
+
+	db, err := database.NewSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create spatial database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	paths, err := filepath.Glob("testdata/queries/*.json")
+
+	if err != nil {
+		t.Fatalf("Failed to list query test cases, %v", err)
+	}
+
+	for _, polygons := range []bool{false, true} {
+
+		memory_db, err := database.NewSpatialDatabase(ctx, fmt.Sprintf("%s&rtree-index=%s&rtree-index-polygons=%t", uri, RTREE_INDEX_MEMORY, polygons))
+
+		if err != nil {
+			t.Fatalf("Failed to create spatial database with in-memory rtree index, %v", err)
+		}
+
+		defer memory_db.Disconnect(ctx)
+
+		idx := memory_db.(*SQLiteSpatialDatabase).conn.rtree
+
+		if idx == nil || idx.size() == 0 {
+			t.Fatalf("Expected in-memory rtree index to be loaded")
+		}
+
+		// Both databases should return the same results for every query test case
+
+		for _, path := range paths {
+
+			spec, err := readQuerySpec(path)
+
+			if err != nil {
+				t.Fatalf("Failed to read %s, %v", path, err)
+			}
+
+			if spec.Database != "" {
+				continue
+			}
+
+			spec.Repeat = 1
+
+			ids, err := runQuerySpec(ctx, db, spec)
+
+			if err != nil {
+				t.Fatalf("Failed to run query for %s, %v", path, err)
+			}
+
+			memory_ids, err := runQuerySpec(ctx, memory_db, spec)
+
+			if err != nil {
+				t.Fatalf("Failed to run query, with in-memory rtree index (polygons %t), for %s, %v", polygons, path, err)
+			}
+
+			if !slices.Equal(ids, memory_ids) {
+				t.Fatalf("%s: expected %v with in-memory rtree index (polygons %t), got %v", spec.Description, ids, polygons, memory_ids)
+			}
+		}
+	}
+
+	_, err = database.NewSpatialDatabase(ctx, fmt.Sprintf("%s&rtree-index=invalid", uri))
+
+	if err == nil {
+		t.Fatalf("Expected invalid ?rtree-index= parameter to fail")
+	}
+}
+
+func TestMemoryRTreeIndexUpdates(t *testing.T) {
+
+	ctx := context.Background()
+
+	g, err := generator.NewGenerator(&generator.Options{Seed: 1, Children: 2, InteriorRings: 1, Antimeridian: 1})
+
+	if err != nil {
+		t.Fatalf("Failed to create generator, %v", err)
+	}
+
+	bodies := make([][]byte, 0)
+
+	for body, err := range g.Features(ctx) {
+
+		if err != nil {
+			t.Fatalf("Failed to generate feature, %v", err)
+		}
+
+		bodies = append(bodies, body)
+	}
+
+	uri := fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, filepath.Join(t.TempDir(), "rtree.db"))
+
+	db, err := NewSQLiteSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	// Index the first half of the features before the in-memory index is loaded and the rest afterwards
+
+	err = db.(*SQLiteSpatialDatabase).IndexFeatures(ctx, bodies[:len(bodies)/2])
+
+	if err != nil {
+		t.Fatalf("Failed to index features, %v", err)
+	}
+
+	memory_db, err := NewSQLiteSpatialDatabase(ctx, fmt.Sprintf("%s&rtree-index=%s", uri, RTREE_INDEX_MEMORY))
+
+	if err != nil {
+		t.Fatalf("Failed to create database with in-memory rtree index, %v", err)
+	}
+
+	defer memory_db.Disconnect(ctx)
+
+	for _, body := range bodies[len(bodies)/2:] {
+
+		err := memory_db.IndexFeature(ctx, body)
+
+		if err != nil {
+			t.Fatalf("Failed to index feature, %v", err)
+		}
+	}
+
+	sqlite_db := memory_db.(*SQLiteSpatialDatabase)
+
+	// Indexing records again with IndexFeatures replaces, rather than duplicates, their entries
+
+	err = sqlite_db.IndexFeatures(ctx, bodies)
+
+	if err != nil {
+		t.Fatalf("Failed to index features again, %v", err)
+	}
+
+	conn, release := sqlite_db.acquire()
+	rtree_entries, err := sqlite_db.readRTreeEntries(ctx, conn.db, false, "")
+	geojson_entries, geojson_err := sqlite_db.readGeoJSONEntries(ctx, conn.db)
+	release()
+
+	if err != nil {
+		t.Fatalf("Failed to read rtree entries, %v", err)
+	}
+
+	if geojson_err != nil {
+		t.Fatalf("Failed to read geojson entries, %v", geojson_err)
+	}
+
+	if conn.rtree.size() != len(rtree_entries) {
+		t.Fatalf("Expected %d entries in in-memory rtree index, got %d", len(rtree_entries), conn.rtree.size())
+	}
+
+	if len(geojson_entries) != len(rtree_entries) {
+		t.Fatalf("Expected %d entries derived from geojson table, got %d", len(rtree_entries), len(geojson_entries))
+	}
+
+	pip := func(db database.SpatialDatabase, pt orb.Point) []string {
+
+		rsp, err := db.PointInPolygon(ctx, &pt)
+
+		if err != nil {
+			t.Fatalf("Failed to perform point in polygon query for %v, %v", pt, err)
+		}
+
+		return sortedResultIds(rsp.Results())
+	}
+
+	// Both databases should return the same results for the centroid of every feature and either side of the antimeridian
+
+	points := []orb.Point{{179.9, 0}, {-179.9, 0}}
+
+	for _, body := range bodies {
+
+		pt := orb.Point{
+			gjson.GetBytes(body, "properties.geom:longitude").Float(),
+			gjson.GetBytes(body, "properties.geom:latitude").Float(),
+		}
+
+		points = append(points, pt)
+	}
+
+	for _, pt := range points {
+
+		ids := pip(db, pt)
+		memory_ids := pip(memory_db, pt)
+
+		if !slices.Equal(ids, memory_ids) {
+			t.Fatalf("Expected %v for %v with in-memory rtree index, got %v", ids, pt, memory_ids)
+		}
+	}
+
+	// Removed records are no longer returned
+
+	leaf := bodies[len(bodies)-1]
+
+	leaf_id := gjson.GetBytes(leaf, "properties.wof:id").String()
+
+	leaf_pt := orb.Point{
+		gjson.GetBytes(leaf, "properties.geom:longitude").Float(),
+		gjson.GetBytes(leaf, "properties.geom:latitude").Float(),
+	}
+
+	if !slices.Contains(pip(memory_db, leaf_pt), leaf_id) {
+		t.Fatalf("Expected %s for %v", leaf_id, leaf_pt)
+	}
+
+	err = memory_db.RemoveFeature(ctx, leaf_id)
+
+	if err != nil {
+		t.Fatalf("Failed to remove %s, %v", leaf_id, err)
+	}
+
+	if slices.Contains(pip(memory_db, leaf_pt), leaf_id) {
+		t.Fatalf("Did not expect %s for %v after it was removed", leaf_id, leaf_pt)
+	}
+
+	// The extent of the in-memory rtree index is kept up to date as records are added and removed
+
+	conn, release = sqlite_db.acquire()
+	expected_extent, err := sqlite_db.queryExtent(ctx, conn)
+	release()
+
+	if err != nil {
+		t.Fatalf("Failed to query extent, %v", err)
+	}
+
+	extent := conn.rtree.extent()
+
+	if extent == nil || expected_extent == nil || !extent.Equal(*expected_extent) {
+		t.Fatalf("Expected extent %v for in-memory rtree index, got %v", expected_extent, extent)
+	}
+}
+
+func TestMemoryRTreeIndexMissingModule(t *testing.T) {
+
+	ctx := context.Background()
+
+	uri, err := createFixturesDatabase(ctx, t.TempDir())
+
+	if err != nil {
+		t.Fatalf("Failed to create fixtures database, %v", err)
+	}
+
+	db, err := database.NewSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create spatial database, %v", err)
+	}
+
+	paths, err := filepath.Glob("testdata/queries/*.json")
+
+	if err != nil {
+		t.Fatalf("Failed to list query test cases, %v", err)
+	}
+
+	specs := make([]*querySpec, 0)
+	expected := make([][]string, 0)
+
+	for _, path := range paths {
+
+		spec, err := readQuerySpec(path)
+
+		if err != nil {
+			t.Fatalf("Failed to read %s, %v", path, err)
+		}
+
+		if spec.Database != "" {
+			continue
+		}
+
+		spec.Repeat = 1
+
+		ids, err := runQuerySpec(ctx, db, spec)
+
+		if err != nil {
+			t.Fatalf("Failed to run query for %s, %v", path, err)
+		}
+
+		specs = append(specs, spec)
+		expected = append(expected, ids)
+	}
+
+	err = db.Disconnect(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to disconnect database, %v", err)
+	}
+
+	// Simulate a SQLite build without the rtree module by pointing the rtree table at a module which does not exist,
+	// and remove the schema metadata as databases created by other tools do not have it.
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		t.Fatalf("Failed to parse URI, %v", err)
+	}
+
+	conn, err := sql.Open(DEFAULT_ENGINE, u.Query().Get("dsn"))
+
+	if err != nil {
+		t.Fatalf("Failed to open database, %v", err)
+	}
+
+	statements := []string{
+		fmt.Sprintf("DROP TABLE %s", METADATA_TABLE_NAME),
+		"PRAGMA writable_schema = ON",
+		"UPDATE sqlite_master SET sql = replace(sql, 'USING rtree', 'USING rtree_missing') WHERE name = 'rtree'",
+		"PRAGMA writable_schema = OFF",
+	}
+
+	for _, q := range statements {
+
+		_, err := conn.ExecContext(ctx, q)
+
+		if err != nil {
+			t.Fatalf("Failed to execute '%s', %v", q, err)
+		}
+	}
+
+	conn.Close()
+
+	_, err = database.NewSpatialDatabase(ctx, uri)
+
+	if err == nil {
+		t.Fatalf("Expected database without rtree module to fail")
+	}
+
+	memory_db, err := database.NewSpatialDatabase(ctx, fmt.Sprintf("%s&rtree-index=%s", uri, RTREE_INDEX_MEMORY))
+
+	if err != nil {
+		t.Fatalf("Failed to create spatial database with in-memory rtree index, %v", err)
+	}
+
+	defer memory_db.Disconnect(ctx)
+
+	// The extent used by multiple databases is derived from the in-memory rtree index
+
+	extent, err := memory_db.(*SQLiteSpatialDatabase).extent(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to derive extent, %v", err)
+	}
+
+	if extent == nil {
+		t.Fatalf("Expected extent for database without rtree module")
+	}
+
+	for i, spec := range specs {
+
+		ids, err := runQuerySpec(ctx, memory_db, spec)
+
+		if err != nil {
+			t.Fatalf("Failed to run query, without rtree module, for %s, %v", spec.Description, err)
+		}
+
+		if !slices.Equal(ids, expected[i]) {
+			t.Fatalf("%s: expected %v without rtree module, got %v", spec.Description, expected[i], ids)
+		}
+	}
+}
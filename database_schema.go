@@ -0,0 +1,669 @@
+package sqlite
+
+// Record (and check) the schema version and geometry encoding of spatial databases and migrate older databases.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+	"github.com/paulmach/orb/encoding/wkt"
+	database_sql "github.com/sfomuseum/go-database/sql"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/wkttoorb"
+)
+
+// The name of the table where schema metadata is stored.
+const METADATA_TABLE_NAME string = "spatial_metadata"
+
+// The current schema version. Databases without a metadata table are considered to be version 0.
+const SCHEMA_VERSION int = 1
+
+// Geometries in the rtree table are stored as WKT strings. This is what `IndexFeature` writes.
+const GEOMETRY_ENCODING_WKT string = "wkt"
+
+// Geometries in the rtree table are stored as WKB blobs.
+const GEOMETRY_ENCODING_WKB string = "wkb"
+
+// Geometries in the rtree table are stored as JSON-encoded coordinates. This is what versions of
+// whosonfirst/go-whosonfirst-sqlite-features < 0.10.0 wrote.
+const GEOMETRY_ENCODING_JSON string = "json"
+
+// The module path used to derive the indexer version.
+const module_path string = "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+
+const metadata_schema string = `CREATE TABLE IF NOT EXISTS %s (
+	key TEXT PRIMARY KEY,
+	value TEXT
+);`
+
+// Matches the CREATE INDEX statements in table schemas so they can be made idempotent.
+var re_create_index = regexp.MustCompile(`(?i)CREATE\s+(UNIQUE\s+)?INDEX\s+(IF\s+NOT\s+EXISTS\s+)?`)
+
+// SchemaMetadata is a struct describing the schema of a spatial database.
+type SchemaMetadata struct {
+	// The schema version of the database. Databases without a metadata table are version 0.
+	SchemaVersion int `json:"schema_version"`
+	// The encoding of geometries in the rtree table. One of the GEOMETRY_ENCODING_ constants.
+	GeometryEncoding string `json:"geometry_encoding"`
+	// The version of the code which created (or last migrated) the database.
+	IndexerVersion string `json:"indexer_version,omitempty"`
+	// The time the database was created (or first migrated).
+	BuildTime time.Time `json:"build_time,omitzero"`
+}
+
+// MigrateOptions is a struct containing configuration options for the `Migrate` method.
+type MigrateOptions struct {
+	// The encoding to convert geometries in the rtree table to. Valid options are GEOMETRY_ENCODING_WKT and
+	// GEOMETRY_ENCODING_WKB. Default is GEOMETRY_ENCODING_WKT.
+	GeometryEncoding string
+	// The number of rtree rows to convert in each transaction. Default is 1000.
+	BatchSize int
+}
+
+// SchemaMetadata returns the schema metadata for 'r'.
+func (r *SQLiteSpatialDatabase) SchemaMetadata(ctx context.Context) (*SchemaMetadata, error) {
+
+	conn, release := r.acquire()
+	defer release()
+
+	return r.readSchemaMetadata(ctx, conn.db)
+}
+
+// parseSchemaOptions checks the schema of the database for 'r'. If the URI query parameters in 'q' contain an
+// "upgrade=true" parameter then databases with an older schema are migrated in place.
+func parseSchemaOptions(ctx context.Context, r *SQLiteSpatialDatabase, q url.Values) error {
+
+	upgrade := false
+
+	if q.Has("upgrade") {
+
+		v, err := strconv.ParseBool(q.Get("upgrade"))
+
+		if err != nil {
+			return fmt.Errorf("Invalid ?upgrade= parameter, %w", err)
+		}
+
+		upgrade = v
+	}
+
+	return r.checkSchema(ctx, r.conn.db, upgrade)
+}
+
+// checkSchema ensures that the schema of 'db' is compatible with 'r'. Databases with a newer schema version are
+// refused. New (empty) databases have their schema metadata recorded. Older databases are migrated if 'upgrade'
+// is true; otherwise they are used as-is and a warning is logged if they contain legacy JSON-encoded geometries.
+func (r *SQLiteSpatialDatabase) checkSchema(ctx context.Context, db *sql.DB, upgrade bool) error {
+
+	m, err := r.readSchemaMetadata(ctx, db)
+
+	if err != nil {
+		return err
+	}
+
+	if m.SchemaVersion > SCHEMA_VERSION {
+		return fmt.Errorf("Database schema version (%d) is newer than the supported schema version (%d)", m.SchemaVersion, SCHEMA_VERSION)
+	}
+
+	if m.SchemaVersion == SCHEMA_VERSION {
+		return nil
+	}
+
+	is_empty, err := r.isEmpty(ctx, db)
+
+	if err != nil {
+		return err
+	}
+
+	if is_empty {
+
+		err := r.writeSchemaMetadata(ctx, db, GEOMETRY_ENCODING_WKT, time.Now())
+
+		// Empty databases may have been opened read-only so this is not considered fatal.
+
+		if err != nil {
+			slog.Warn("Failed to record schema metadata for new database", "error", err)
+		}
+
+		return nil
+	}
+
+	if upgrade {
+
+		opts := &MigrateOptions{
+			GeometryEncoding: GEOMETRY_ENCODING_WKT,
+		}
+
+		return r.migrate(ctx, db, opts)
+	}
+
+	if m.GeometryEncoding == GEOMETRY_ENCODING_JSON {
+		slog.Warn("Database contains legacy JSON-encoded geometries which are slower to query. Use the migrate tool, or the ?upgrade=true parameter, to convert them.", "version", m.SchemaVersion)
+	} else {
+		slog.Debug("Database does not have schema metadata", "version", m.SchemaVersion, "encoding", m.GeometryEncoding)
+	}
+
+	return nil
+}
+
+// readSchemaMetadata reads the schema metadata for 'db'. If 'db' does not have a metadata table then the
+// schema version is 0 and the geometry encoding is derived from the first row in the rtree table.
+func (r *SQLiteSpatialDatabase) readSchemaMetadata(ctx context.Context, db *sql.DB) (*SchemaMetadata, error) {
+
+	has_table, err := database_sql.HasTable(ctx, db, METADATA_TABLE_NAME)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to determine whether metadata table exists, %w", err)
+	}
+
+	if !has_table {
+
+		m := &SchemaMetadata{
+			SchemaVersion:    0,
+			GeometryEncoding: GEOMETRY_ENCODING_WKT,
+		}
+
+		q := fmt.Sprintf("SELECT geometry FROM %s LIMIT 1", r.rtree_table.Name())
+
+		var geometry string
+
+		err := db.QueryRowContext(ctx, q).Scan(&geometry)
+
+		switch {
+		case err == sql.ErrNoRows:
+			// pass
+		case r.isOptionalRTreeError(err):
+			slog.Debug("Unable to derive geometry encoding, rtree module is not available", "error", err)
+		case err != nil:
+			return nil, fmt.Errorf("Failed to query rtree table, %w", err)
+		default:
+			m.GeometryEncoding = geometryEncoding(geometry)
+		}
+
+		return m, nil
+	}
+
+	q := fmt.Sprintf("SELECT key, value FROM %s", METADATA_TABLE_NAME)
+
+	rows, err := db.QueryContext(ctx, q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query metadata table, %w", err)
+	}
+
+	defer rows.Close()
+
+	m := new(SchemaMetadata)
+
+	for rows.Next() {
+
+		var k string
+		var v string
+
+		err := rows.Scan(&k, &v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan metadata, %w", err)
+		}
+
+		switch k {
+		case "schema_version":
+
+			version, err := strconv.Atoi(v)
+
+			if err != nil {
+				return nil, fmt.Errorf("Invalid schema version '%s', %w", v, err)
+			}
+
+			m.SchemaVersion = version
+
+		case "geometry_encoding":
+			m.GeometryEncoding = v
+		case "indexer_version":
+			m.IndexerVersion = v
+		case "build_time":
+
+			t, err := time.Parse(time.RFC3339, v)
+
+			if err != nil {
+				return nil, fmt.Errorf("Invalid build time '%s', %w", v, err)
+			}
+
+			m.BuildTime = t
+
+		default:
+			// Ignore unknown keys so that future additions don't break older versions
+		}
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate metadata, %w", err)
+	}
+
+	return m, nil
+}
+
+// writeSchemaMetadata records the current schema version, 'encoding' and the current indexer version in 'db'. The
+// build time is only recorded (as 'build_time') if it has not already been set.
+func (r *SQLiteSpatialDatabase) writeSchemaMetadata(ctx context.Context, db *sql.DB, encoding string, build_time time.Time) error {
+
+	_, err := db.ExecContext(ctx, fmt.Sprintf(metadata_schema, METADATA_TABLE_NAME))
+
+	if err != nil {
+		return fmt.Errorf("Failed to create metadata table, %w", err)
+	}
+
+	values := [][2]string{
+		{"schema_version", strconv.Itoa(SCHEMA_VERSION)},
+		{"geometry_encoding", encoding},
+		{"indexer_version", indexerVersion()},
+	}
+
+	q := fmt.Sprintf("INSERT OR REPLACE INTO %s (key, value) VALUES (?, ?)", METADATA_TABLE_NAME)
+
+	for _, kv := range values {
+
+		_, err := db.ExecContext(ctx, q, kv[0], kv[1])
+
+		if err != nil {
+			return fmt.Errorf("Failed to write %s metadata, %w", kv[0], err)
+		}
+	}
+
+	q = fmt.Sprintf("INSERT OR IGNORE INTO %s (key, value) VALUES ('build_time', ?)", METADATA_TABLE_NAME)
+
+	_, err = db.ExecContext(ctx, q, build_time.UTC().Format(time.RFC3339))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write build_time metadata, %w", err)
+	}
+
+	return nil
+}
+
+// isEmpty returns a boolean value indicating whether the rtree and spr tables in 'db' are empty.
+func (r *SQLiteSpatialDatabase) isEmpty(ctx context.Context, db *sql.DB) (bool, error) {
+
+	for _, t := range []string{r.spr_table.Name(), r.rtree_table.Name()} {
+
+		q := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s)", t)
+
+		var has_rows bool
+
+		err := db.QueryRowContext(ctx, q).Scan(&has_rows)
+
+		if err != nil {
+
+			if t == r.rtree_table.Name() && r.isOptionalRTreeError(err) {
+				continue
+			}
+
+			return false, fmt.Errorf("Failed to determine whether database is empty, %w", err)
+		}
+
+		if has_rows {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// isOptionalRTreeError returns a boolean value indicating whether 'err' was caused by the SQLite rtree module not being
+// available and can be ignored because 'r' uses an in-memory rtree index (which can be derived from the geojson table).
+func (r *SQLiteSpatialDatabase) isOptionalRTreeError(err error) bool {
+	return err != nil && r.rtree_index == RTREE_INDEX_MEMORY && isMissingModuleError(err)
+}
+
+// Migrate upgrades the database for 'r' in place to the current schema version. Geometries in the rtree table are
+// converted to the encoding defined in 'opts', any indexes missing from the spr and geojson tables are created and
+// the schema metadata is recorded. Note that records indexed after a database has been migrated to WKB will still
+// have their geometries stored as WKT; both encodings can be queried.
+func (r *SQLiteSpatialDatabase) Migrate(ctx context.Context, opts *MigrateOptions) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.migrate(ctx, r.conn.db, opts)
+
+	if err != nil {
+		return err
+	}
+
+	r.conn.flushCache()
+	return nil
+}
+
+func (r *SQLiteSpatialDatabase) migrate(ctx context.Context, db *sql.DB, opts *MigrateOptions) error {
+
+	t1 := time.Now()
+
+	ctx, span := tracer.Start(ctx, "Migrate")
+	defer span.End()
+
+	encoding := opts.GeometryEncoding
+
+	if encoding == "" {
+		encoding = GEOMETRY_ENCODING_WKT
+	}
+
+	switch encoding {
+	case GEOMETRY_ENCODING_WKT, GEOMETRY_ENCODING_WKB:
+		// pass
+	default:
+		return fmt.Errorf("Invalid or unsupported geometry encoding '%s'", encoding)
+	}
+
+	m, err := r.readSchemaMetadata(ctx, db)
+
+	if err != nil {
+		recordSpanError(span, err)
+		return err
+	}
+
+	if m.SchemaVersion > SCHEMA_VERSION {
+		return fmt.Errorf("Database schema version (%d) is newer than the supported schema version (%d)", m.SchemaVersion, SCHEMA_VERSION)
+	}
+
+	converted, err := r.convertGeometries(ctx, db, encoding, opts.BatchSize)
+
+	if err != nil {
+		recordSpanError(span, err)
+		return err
+	}
+
+	for _, t := range []database_sql.Table{r.spr_table, r.geojson_table, r.properties_table} {
+
+		if t == nil {
+			continue
+		}
+
+		err := ensureIndexes(ctx, db, t)
+
+		if err != nil {
+			recordSpanError(span, err)
+			return err
+		}
+	}
+
+	build_time := m.BuildTime
+
+	if build_time.IsZero() {
+		build_time = time.Now()
+	}
+
+	err = r.writeSchemaMetadata(ctx, db, encoding, build_time)
+
+	if err != nil {
+		recordSpanError(span, err)
+		return err
+	}
+
+	slog.Info("Migrated database", "from version", m.SchemaVersion, "to version", SCHEMA_VERSION, "encoding", encoding, "converted", converted, "time", time.Since(t1))
+	return nil
+}
+
+// convertGeometries converts the geometries in the rtree table of 'db' to 'encoding', 'batch_size' rows at a time,
+// returning the number of rows which were converted.
+func (r *SQLiteSpatialDatabase) convertGeometries(ctx context.Context, db *sql.DB, encoding string, batch_size int) (int, error) {
+
+	if batch_size <= 0 {
+		batch_size = 1000
+	}
+
+	select_q := fmt.Sprintf("SELECT id, geometry FROM %s WHERE id > ? ORDER BY id ASC LIMIT ?", r.rtree_table.Name())
+	update_q := fmt.Sprintf("UPDATE %s SET geometry = ? WHERE id = ?", r.rtree_table.Name())
+
+	type conversion struct {
+		id       int64
+		geometry any
+	}
+
+	last_id := int64(-1)
+	converted := 0
+
+	for {
+
+		rows, err := db.QueryContext(ctx, select_q, last_id, batch_size)
+
+		if err != nil {
+			return converted, fmt.Errorf("Failed to query rtree table, %w", err)
+		}
+
+		count := 0
+		conversions := make([]*conversion, 0)
+
+		for rows.Next() {
+
+			var id int64
+			var geometry string
+
+			err := rows.Scan(&id, &geometry)
+
+			if err != nil {
+				rows.Close()
+				return converted, fmt.Errorf("Failed to scan rtree row, %w", err)
+			}
+
+			count += 1
+			last_id = id
+
+			if geometryEncoding(geometry) == encoding {
+				continue
+			}
+
+			poly, err := parseRTreeGeometry(geometry)
+
+			if err != nil {
+				rows.Close()
+				return converted, fmt.Errorf("Failed to parse geometry for rtree row %d, %w", id, err)
+			}
+
+			enc_geom, err := encodeRTreeGeometry(poly, encoding)
+
+			if err != nil {
+				rows.Close()
+				return converted, err
+			}
+
+			conversions = append(conversions, &conversion{id, enc_geom})
+		}
+
+		rows.Close()
+
+		err = rows.Err()
+
+		if err != nil {
+			return converted, fmt.Errorf("Failed to iterate rtree rows, %w", err)
+		}
+
+		if len(conversions) > 0 {
+
+			tx, err := db.BeginTx(ctx, nil)
+
+			if err != nil {
+				return converted, fmt.Errorf("Failed to create transaction, %w", err)
+			}
+
+			for _, c := range conversions {
+
+				_, err := tx.ExecContext(ctx, update_q, c.geometry, c.id)
+
+				if err != nil {
+					tx.Rollback()
+					return converted, fmt.Errorf("Failed to update geometry for rtree row %d, %w", c.id, err)
+				}
+			}
+
+			err = tx.Commit()
+
+			if err != nil {
+				return converted, fmt.Errorf("Failed to commit transaction, %w", err)
+			}
+
+			converted += len(conversions)
+		}
+
+		if count < batch_size {
+			break
+		}
+	}
+
+	return converted, nil
+}
+
+// ensureIndexes creates any of the indexes defined in the schema for 't' which are missing from 'db'.
+func ensureIndexes(ctx context.Context, db *sql.DB, t database_sql.Table) error {
+
+	has_table, err := database_sql.HasTable(ctx, db, t.Name())
+
+	if err != nil {
+		return fmt.Errorf("Failed to determine whether %s table exists, %w", t.Name(), err)
+	}
+
+	if !has_table {
+		return nil
+	}
+
+	schema, err := t.Schema(db)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive schema for %s, %w", t.Name(), err)
+	}
+
+	for _, stmt := range strings.Split(schema, ";") {
+
+		stmt = strings.TrimSpace(stmt)
+
+		if !re_create_index.MatchString(stmt) {
+			continue
+		}
+
+		stmt = re_create_index.ReplaceAllString(stmt, "CREATE ${1}INDEX IF NOT EXISTS ")
+
+		_, err := db.ExecContext(ctx, stmt)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create index for %s (%s), %w", t.Name(), stmt, err)
+		}
+	}
+
+	return nil
+}
+
+// geometryEncoding returns the encoding (one of the GEOMETRY_ENCODING_ constants) of 'geometry'.
+func geometryEncoding(geometry string) string {
+
+	switch {
+	case len(geometry) > 0 && (geometry[0] == 0x00 || geometry[0] == 0x01):
+		// The first byte of a WKB geometry is its byte order
+		return GEOMETRY_ENCODING_WKB
+	case strings.HasPrefix(geometry, "["):
+		return GEOMETRY_ENCODING_JSON
+	default:
+		return GEOMETRY_ENCODING_WKT
+	}
+}
+
+// parseRTreeGeometry parses the polygon stored in the geometry column of the rtree table. Geometries may be stored
+// as WKT, WKB or as JSON-encoded coordinates (by versions of whosonfirst/go-whosonfirst-sqlite-features < 0.10.0).
+func parseRTreeGeometry(geometry string) (orb.Polygon, error) {
+
+	var o orb.Geometry
+	var err error
+
+	switch geometryEncoding(geometry) {
+	case GEOMETRY_ENCODING_WKB:
+		o, err = wkb.Unmarshal([]byte(geometry))
+	case GEOMETRY_ENCODING_JSON:
+
+		// Investigate https://github.com/paulmach/orb/tree/master/geojson#performance
+
+		var poly orb.Polygon
+		err = json.Unmarshal([]byte(geometry), &poly)
+		o = poly
+
+	default:
+
+		// This is the bottleneck. It appears to be this:
+		// https://github.com/paulmach/orb/issues/132
+		// maybe... https://github.com/Succo/wktToOrb/ ?
+
+		o, err = wkttoorb.Scan(geometry)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse geometry, %w", err)
+	}
+
+	poly, ok := o.(orb.Polygon)
+
+	if !ok {
+		return nil, fmt.Errorf("Geometry is not a polygon")
+	}
+
+	if len(poly) == 0 || len(poly[0]) == 0 {
+		return nil, fmt.Errorf("Geometry is empty")
+	}
+
+	return poly, nil
+}
+
+// encodeRTreeGeometry encodes 'poly' using 'encoding' for storing in the geometry column of the rtree table.
+func encodeRTreeGeometry(poly orb.Polygon, encoding string) (any, error) {
+
+	switch encoding {
+	case GEOMETRY_ENCODING_WKT:
+		return wkt.MarshalString(poly), nil
+	case GEOMETRY_ENCODING_WKB:
+
+		body, err := wkb.Marshal(poly)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to marshal geometry as WKB, %w", err)
+		}
+
+		return body, nil
+
+	default:
+		return nil, fmt.Errorf("Invalid or unsupported geometry encoding '%s'", encoding)
+	}
+}
+
+// indexerVersion returns the module path and version of this package, as recorded in the build information for
+// the current binary.
+func indexerVersion() string {
+
+	version := "unknown"
+
+	info, ok := debug.ReadBuildInfo()
+
+	if ok {
+
+		if info.Main.Path == module_path {
+			version = info.Main.Version
+		} else {
+
+			for _, dep := range info.Deps {
+
+				if dep.Path == module_path {
+					version = dep.Version
+					break
+				}
+			}
+		}
+	}
+
+	return fmt.Sprintf("%s@%s", module_path, version)
+}
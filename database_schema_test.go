@@ -0,0 +1,187 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+)
+
+func TestSchemaMigrate(t *testing.T) {
+
+	ctx := context.Background()
+
+	db_path := filepath.Join(t.TempDir(), "legacy.db")
+	createReloadDatabase(t, db_path, 101737491)
+
+	database_uri := fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, db_path)
+
+	// Convert the database in to a "legacy" database with JSON-encoded geometries and no metadata table
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	m, err := sqlite_db.SchemaMetadata(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to derive schema metadata, %v", err)
+	}
+
+	if m.SchemaVersion != SCHEMA_VERSION || m.GeometryEncoding != GEOMETRY_ENCODING_WKT {
+		t.Fatalf("Unexpected schema metadata for new database, %v", m)
+	}
+
+	rows, err := sqlite_db.conn.db.QueryContext(ctx, "SELECT id, geometry FROM rtree")
+
+	if err != nil {
+		t.Fatalf("Failed to query rtree, %v", err)
+	}
+
+	legacy := make(map[int64]string)
+
+	for rows.Next() {
+
+		var id int64
+		var geometry string
+
+		err := rows.Scan(&id, &geometry)
+
+		if err != nil {
+			t.Fatalf("Failed to scan rtree row, %v", err)
+		}
+
+		poly, err := parseRTreeGeometry(geometry)
+
+		if err != nil {
+			t.Fatalf("Failed to parse geometry, %v", err)
+		}
+
+		enc, err := json.Marshal(poly)
+
+		if err != nil {
+			t.Fatalf("Failed to marshal geometry, %v", err)
+		}
+
+		legacy[id] = string(enc)
+	}
+
+	rows.Close()
+
+	for id, geometry := range legacy {
+
+		_, err := sqlite_db.conn.db.ExecContext(ctx, "UPDATE rtree SET geometry = ? WHERE id = ?", geometry, id)
+
+		if err != nil {
+			t.Fatalf("Failed to update geometry, %v", err)
+		}
+	}
+
+	_, err = sqlite_db.conn.db.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", METADATA_TABLE_NAME))
+
+	if err != nil {
+		t.Fatalf("Failed to drop metadata table, %v", err)
+	}
+
+	db.Close(ctx)
+
+	// Legacy databases can still be queried
+
+	db, err = database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to open legacy database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	sqlite_db = db.(*SQLiteSpatialDatabase)
+
+	m, err = sqlite_db.SchemaMetadata(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to derive schema metadata, %v", err)
+	}
+
+	if m.SchemaVersion != 0 || m.GeometryEncoding != GEOMETRY_ENCODING_JSON {
+		t.Fatalf("Unexpected schema metadata for legacy database, %v", m)
+	}
+
+	c, err := geo.NewCoordinate(-71.330873, 46.852675)
+
+	if err != nil {
+		t.Fatalf("Failed to create new coordinate, %v", err)
+	}
+
+	assertResults := func(label string) {
+
+		rsp, err := db.PointInPolygon(ctx, c)
+
+		if err != nil {
+			t.Fatalf("Failed to perform point in polygon query (%s), %v", label, err)
+		}
+
+		if len(rsp.Results()) != 1 {
+			t.Fatalf("Expected 1 result (%s) but got %d", label, len(rsp.Results()))
+		}
+	}
+
+	assertResults("legacy")
+
+	opts := &MigrateOptions{
+		GeometryEncoding: GEOMETRY_ENCODING_WKB,
+		BatchSize:        2,
+	}
+
+	err = sqlite_db.Migrate(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to migrate database, %v", err)
+	}
+
+	m, err = sqlite_db.SchemaMetadata(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to derive schema metadata, %v", err)
+	}
+
+	if m.SchemaVersion != SCHEMA_VERSION || m.GeometryEncoding != GEOMETRY_ENCODING_WKB || m.BuildTime.IsZero() {
+		t.Fatalf("Unexpected schema metadata for migrated database, %v", m)
+	}
+
+	var count int
+
+	err = sqlite_db.conn.db.QueryRowContext(ctx, "SELECT COUNT(id) FROM rtree WHERE geometry LIKE '[%'").Scan(&count)
+
+	if err != nil {
+		t.Fatalf("Failed to count legacy geometries, %v", err)
+	}
+
+	if count != 0 {
+		t.Fatalf("Expected all geometries to be converted but %d remain", count)
+	}
+
+	assertResults("migrated")
+
+	// Databases with a newer schema version are refused
+
+	_, err = sqlite_db.conn.db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET value = '99' WHERE key = 'schema_version'", METADATA_TABLE_NAME))
+
+	if err != nil {
+		t.Fatalf("Failed to update schema version, %v", err)
+	}
+
+	_, err = database.NewSpatialDatabase(ctx, database_uri)
+
+	if err == nil {
+		t.Fatalf("Expected database with newer schema version to be refused")
+	}
+}
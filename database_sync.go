@@ -0,0 +1,378 @@
+package sqlite
+
+// Incrementally synchronize a spatial database with a source of Who's On First records.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-feature/alt"
+	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v3"
+)
+
+// SyncOptions is a struct containing configuration options for the `Sync` method.
+type SyncOptions struct {
+	// A whosonfirst/go-whosonfirst-iterate/v3 Iterator instance used to crawl Sources.
+	Iterator iterate.Iterator
+	// One or more URIs to crawl using Iterator.
+	Sources []string
+	// The number of added or updated records to index in each transaction. Default is 1000.
+	BatchSize int
+}
+
+// SyncSummary is a struct describing the changes made by the `Sync` method.
+type SyncSummary struct {
+	// The number of records in the source which were not present in the database.
+	Added int `json:"added"`
+	// The number of records in the source whose last modified time differs from the database.
+	Updated int `json:"updated"`
+	// The number of records in the database which are no longer present in the source.
+	Removed int `json:"removed"`
+	// The number of records in the source whose last modified time matches the database.
+	Unchanged int `json:"unchanged"`
+}
+
+// syncKey is a struct identifying a record (or alternate geometry) in the database.
+type syncKey struct {
+	id        int64
+	alt_label string
+}
+
+// Sync compares the 'wof:lastmodified' property of the records in the sources defined by 'opts' with the 'lastmodified'
+// columns in the spr and geojson tables. Records which are missing or have changed are indexed (using `IndexFeatures`)
+// and records which are no longer present in the sources are removed (using `RemoveFeature`). Alternate geometries are
+// only considered if the database was created with the "index-alt-files" parameter. Since only records which differ
+// from the sources are modified it is safe to run `Sync` repeatedly.
+func (r *SQLiteSpatialDatabase) Sync(ctx context.Context, opts *SyncOptions) (*SyncSummary, error) {
+
+	ctx, span := tracer.Start(ctx, "Sync")
+	defer span.End()
+
+	if opts.Iterator == nil {
+		return nil, fmt.Errorf("Missing iterator")
+	}
+
+	batch_size := opts.BatchSize
+
+	if batch_size <= 0 {
+		batch_size = 1000
+	}
+
+	indexed, err := r.lastModifiedDates(ctx)
+
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	summary := &SyncSummary{}
+
+	seen := make(map[syncKey]bool)
+	seen_ids := make(map[int64]bool)
+
+	batch := make([][]byte, 0, batch_size)
+
+	flush := func() error {
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := r.IndexFeatures(ctx, batch)
+
+		if err != nil {
+			return err
+		}
+
+		batch = make([][]byte, 0, batch_size)
+		return nil
+	}
+
+	for rec, err := range opts.Iterator.Iterate(ctx, opts.Sources...) {
+
+		if err != nil {
+			recordSpanError(span, err)
+			return nil, fmt.Errorf("Failed to iterate records, %w", err)
+		}
+
+		body, err := io.ReadAll(rec.Body)
+		rec.Body.Close()
+
+		if err != nil {
+			recordSpanError(span, err)
+			return nil, fmt.Errorf("Failed to read %s, %w", rec.Path, err)
+		}
+
+		k, err := deriveSyncKey(body)
+
+		if err != nil {
+			recordSpanError(span, err)
+			return nil, fmt.Errorf("Failed to derive key for %s, %w", rec.Path, err)
+		}
+
+		if k.alt_label != "" && !r.index_alt_files {
+			continue
+		}
+
+		seen[*k] = true
+		seen_ids[k.id] = true
+
+		lastmod, exists := indexed[*k]
+
+		switch {
+		case !exists:
+			summary.Added += 1
+			slog.Debug("Add record", "id", k.id, "alt label", k.alt_label)
+		case lastmod != properties.LastModified(body):
+			summary.Updated += 1
+			slog.Debug("Update record", "id", k.id, "alt label", k.alt_label)
+		default:
+			summary.Unchanged += 1
+			continue
+		}
+
+		batch = append(batch, body)
+
+		if len(batch) >= batch_size {
+
+			err := flush()
+
+			if err != nil {
+				recordSpanError(span, err)
+				return nil, err
+			}
+		}
+	}
+
+	err = flush()
+
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	removed_ids := make(map[int64]bool)
+
+	for k := range indexed {
+
+		if seen[k] {
+			continue
+		}
+
+		slog.Debug("Remove record", "id", k.id, "alt label", k.alt_label)
+		summary.Removed += 1
+
+		// If there are no records with this ID left in the sources remove the record (and all its
+		// alternate geometries) otherwise only remove the specific row.
+
+		if !seen_ids[k.id] {
+
+			if removed_ids[k.id] {
+				continue
+			}
+
+			err := r.RemoveFeature(ctx, strconv.FormatInt(k.id, 10))
+
+			if err != nil {
+				recordSpanError(span, err)
+				return nil, fmt.Errorf("Failed to remove %d, %w", k.id, err)
+			}
+
+			removed_ids[k.id] = true
+			continue
+		}
+
+		err := r.removeSyncKey(ctx, k)
+
+		if err != nil {
+			recordSpanError(span, err)
+			return nil, fmt.Errorf("Failed to remove %d (%s), %w", k.id, k.alt_label, err)
+		}
+	}
+
+	return summary, nil
+}
+
+// lastModifiedDates returns the last modified times of every record in the database. If a record's last modified time
+// in the spr and geojson tables differs, or it is missing from either table, its time is reported as -1 so that it will
+// always be indexed again.
+func (r *SQLiteSpatialDatabase) lastModifiedDates(ctx context.Context) (map[syncKey]int64, error) {
+
+	conn, release := r.acquire()
+	defer release()
+
+	spr_dates, err := r.queryLastModifiedDates(ctx, conn.db, r.spr_table.Name())
+
+	if err != nil {
+		return nil, err
+	}
+
+	geojson_dates, err := r.queryLastModifiedDates(ctx, conn.db, r.geojson_table.Name())
+
+	if err != nil {
+		return nil, err
+	}
+
+	for k, lastmod := range geojson_dates {
+
+		v, exists := spr_dates[k]
+
+		if !exists || v != lastmod {
+			spr_dates[k] = -1
+		}
+	}
+
+	for k := range spr_dates {
+
+		_, exists := geojson_dates[k]
+
+		if !exists {
+			spr_dates[k] = -1
+		}
+	}
+
+	return spr_dates, nil
+}
+
+func (r *SQLiteSpatialDatabase) queryLastModifiedDates(ctx context.Context, db *sql.DB, table string) (map[syncKey]int64, error) {
+
+	q := fmt.Sprintf("SELECT CAST(id AS INTEGER), COALESCE(alt_label, ''), lastmodified FROM %s", table)
+
+	if !r.index_alt_files {
+		q = fmt.Sprintf("%s WHERE COALESCE(alt_label, '') = ''", q)
+	}
+
+	rows, err := db.QueryContext(ctx, q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query %s table, %w", table, err)
+	}
+
+	defer rows.Close()
+
+	dates := make(map[syncKey]int64)
+
+	for rows.Next() {
+
+		var k syncKey
+		var lastmod sql.NullInt64
+
+		err := rows.Scan(&k.id, &k.alt_label, &lastmod)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan %s row, %w", table, err)
+		}
+
+		dates[k] = lastmod.Int64
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate %s rows, %w", table, err)
+	}
+
+	return dates, nil
+}
+
+// removeSyncKey removes the rows for a single record (or alternate geometry) defined by 'k', recording its removal
+// in the tombstones table. Unlike `RemoveFeature` any other rows with the same ID are left in place.
+func (r *SQLiteSpatialDatabase) removeSyncKey(ctx context.Context, k syncKey) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx, err := r.conn.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create transaction, %w", err)
+	}
+
+	schema := fmt.Sprintf(tombstones_schema, TOMBSTONES_TABLE_NAME, TOMBSTONES_TABLE_NAME, TOMBSTONES_TABLE_NAME)
+
+	_, err = tx.ExecContext(ctx, schema)
+
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to create tombstones table, %w", err)
+	}
+
+	q := fmt.Sprintf("INSERT INTO %s (id, alt_label, lastmodified) VALUES (?, ?, ?)", TOMBSTONES_TABLE_NAME)
+
+	_, err = tx.ExecContext(ctx, q, k.id, k.alt_label, time.Now().Unix())
+
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to add tombstone, %w", err)
+	}
+
+	deletes := map[string]string{
+		r.rtree_table.Name():   "wof_id",
+		r.spr_table.Name():     "id",
+		r.geojson_table.Name(): "id",
+	}
+
+	if r.properties_table != nil {
+		deletes[r.properties_table.Name()] = "id"
+	}
+
+	for table, col := range deletes {
+
+		q := fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND COALESCE(alt_label, '') = ?", table, col)
+
+		_, err := tx.ExecContext(ctx, q, k.id, k.alt_label)
+
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to remove rows from %s, %w", table, err)
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return fmt.Errorf("Failed to commit transaction, %w", err)
+	}
+
+	r.conn.addedTombstones()
+
+	if r.conn.rtree != nil {
+		r.conn.rtree.remove(k.id, k.alt_label)
+	}
+
+	r.conn.flushCache()
+	return nil
+}
+
+// deriveSyncKey returns the ID and alternate geometry label for 'body'.
+func deriveSyncKey(body []byte) (*syncKey, error) {
+
+	id, err := properties.Id(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive ID, %w", err)
+	}
+
+	k := &syncKey{
+		id: id,
+	}
+
+	if alt.IsAlt(body) {
+
+		label, err := properties.AltLabel(body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive alt label, %w", err)
+		}
+
+		k.alt_label = label
+	}
+
+	return k, nil
+}
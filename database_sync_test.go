@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/sjson"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v3"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+func TestSync(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	db_path := filepath.Join(root, "sync.db")
+	data_root := filepath.Join(root, "data")
+
+	err := os.Mkdir(data_root, 0755)
+
+	if err != nil {
+		t.Fatalf("Failed to create data directory, %v", err)
+	}
+
+	ids := []int64{101737491, 1360521545}
+
+	for _, id := range ids {
+
+		body, err := os.ReadFile(fmt.Sprintf("fixtures/%d.geojson", id))
+
+		if err != nil {
+			t.Fatalf("Failed to read fixture for %d, %v", id, err)
+		}
+
+		err = os.WriteFile(filepath.Join(data_root, fmt.Sprintf("%d.geojson", id)), body, 0644)
+
+		if err != nil {
+			t.Fatalf("Failed to write fixture for %d, %v", id, err)
+		}
+	}
+
+	db, err := database.NewSpatialDatabase(ctx, fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, db_path))
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	it, err := iterate.NewIterator(ctx, "directory://?_with_stats=false")
+
+	if err != nil {
+		t.Fatalf("Failed to create iterator, %v", err)
+	}
+
+	defer it.Close()
+
+	opts := &SyncOptions{
+		Iterator: it,
+		Sources:  []string{data_root},
+	}
+
+	assertSummary := func(label string, expected *SyncSummary) {
+
+		summary, err := sqlite_db.Sync(ctx, opts)
+
+		if err != nil {
+			t.Fatalf("Failed to sync database (%s), %v", label, err)
+		}
+
+		if *summary != *expected {
+			t.Fatalf("Unexpected summary (%s), expected %v but got %v", label, expected, summary)
+		}
+	}
+
+	assertSummary("initial", &SyncSummary{Added: 2})
+	assertSummary("rerun", &SyncSummary{Unchanged: 2})
+
+	// Update the last modified time of one record
+
+	path := filepath.Join(data_root, fmt.Sprintf("%d.geojson", ids[0]))
+
+	body, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("Failed to read %s, %v", path, err)
+	}
+
+	body, err = sjson.SetBytes(body, "properties.wof:lastmodified", 1893456000)
+
+	if err != nil {
+		t.Fatalf("Failed to update last modified time, %v", err)
+	}
+
+	err = os.WriteFile(path, body, 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write %s, %v", path, err)
+	}
+
+	assertSummary("updated", &SyncSummary{Updated: 1, Unchanged: 1})
+
+	// Remove the other record
+
+	err = os.Remove(filepath.Join(data_root, fmt.Sprintf("%d.geojson", ids[1])))
+
+	if err != nil {
+		t.Fatalf("Failed to remove record, %v", err)
+	}
+
+	assertSummary("removed", &SyncSummary{Removed: 1, Unchanged: 1})
+	assertSummary("final", &SyncSummary{Unchanged: 1})
+
+	var count int
+
+	err = sqlite_db.conn.db.QueryRowContext(ctx, "SELECT COUNT(id) FROM rtree WHERE wof_id = ?", ids[1]).Scan(&count)
+
+	if err != nil {
+		t.Fatalf("Failed to count rtree rows, %v", err)
+	}
+
+	if count != 0 {
+		t.Fatalf("Expected rtree rows for %d to be removed", ids[1])
+	}
+}
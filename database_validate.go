@@ -0,0 +1,565 @@
+package sqlite
+
+// Find (and optionally repair) inconsistencies between the rtree, spr and geojson tables.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"github.com/paulmach/orb"
+	database_sql "github.com/sfomuseum/go-database/sql"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// An rtree (or geojson) row with no corresponding spr row.
+const PROBLEM_MISSING_SPR string = "missing-spr"
+
+// An spr row, with a non-point bounding box, with no corresponding rtree rows.
+const PROBLEM_MISSING_RTREE string = "missing-rtree"
+
+// A row whose is_alt flag disagrees with its alt_label.
+const PROBLEM_ALT_LABEL_MISMATCH string = "alt-label-mismatch"
+
+// An rtree row whose geometry can not be parsed as a polygon.
+const PROBLEM_INVALID_GEOMETRY string = "invalid-geometry"
+
+// An rtree row whose bounding box disagrees with its geometry.
+const PROBLEM_BBOX_MISMATCH string = "bbox-mismatch"
+
+// The tolerance (in decimal degrees) used when comparing bounding boxes. The rtree table stores 32-bit
+// floating point coordinates, rounded outwards, so bounding boxes are not expected to match exactly.
+const bbox_tolerance float64 = 0.0001
+
+// ValidationProblem is a struct describing an inconsistency found by the `Validate` method.
+type ValidationProblem struct {
+	// The kind of problem. One of the PROBLEM_ constants.
+	Problem string `json:"problem"`
+	// The name of the table where the problem was found.
+	Table string `json:"table"`
+	// The Who's On First ID of the record.
+	Id int64 `json:"id"`
+	// The alternate geometry label of the record.
+	AltLabel string `json:"alt_label,omitempty"`
+	// The internal row ID, for problems found in the rtree table.
+	RowId int64 `json:"rowid,omitempty"`
+	// A description of the problem.
+	Message string `json:"message"`
+}
+
+// String returns a human-readable description of 'p'.
+func (p *ValidationProblem) String() string {
+
+	label := fmt.Sprintf("%d", p.Id)
+
+	if p.AltLabel != "" {
+		label = fmt.Sprintf("%s (%s)", label, p.AltLabel)
+	}
+
+	return fmt.Sprintf("%s %s %s: %s", p.Problem, p.Table, label, p.Message)
+}
+
+// Validate checks the rtree, spr and geojson (if present) tables for rtree rows with no spr row (and vice versa),
+// geojson rows with no spr row, rows whose is_alt flag disagrees with their alt label, rtree geometries that can not
+// be parsed and rtree bounding boxes that disagree with their geometry. It returns the list of problems found.
+func (r *SQLiteSpatialDatabase) Validate(ctx context.Context) ([]*ValidationProblem, error) {
+
+	ctx, span := tracer.Start(ctx, "Validate")
+	defer span.End()
+
+	conn, release := r.acquire()
+	defer release()
+
+	problems := make([]*ValidationProblem, 0)
+
+	checks := []func(context.Context, *sql.DB) ([]*ValidationProblem, error){
+		r.validateRTree,
+		r.validateMissingRTree,
+		r.validateSPRAltLabels,
+		r.validateGeoJSON,
+	}
+
+	for _, check := range checks {
+
+		p, err := check(ctx, conn.db)
+
+		if err != nil {
+			recordSpanError(span, err)
+			return nil, err
+		}
+
+		problems = append(problems, p...)
+	}
+
+	span.SetAttributes(attribute.Int("problems", len(problems)))
+	return problems, nil
+}
+
+// validateRTree checks each row in the rtree table for a corresponding spr row, a consistent alt label, a valid
+// geometry and a bounding box that agrees with that geometry.
+func (r *SQLiteSpatialDatabase) validateRTree(ctx context.Context, db *sql.DB) ([]*ValidationProblem, error) {
+
+	rtree_name := r.rtree_table.Name()
+
+	q := fmt.Sprintf(`SELECT r.id, r.wof_id, r.is_alt, COALESCE(r.alt_label, ''), r.geometry, r.min_x, r.min_y, r.max_x, r.max_y,
+		EXISTS (SELECT 1 FROM %s s WHERE s.id = CAST(r.wof_id AS TEXT) AND COALESCE(s.alt_label, '') = COALESCE(r.alt_label, ''))
+		FROM %s r`, r.spr_table.Name(), rtree_name)
+
+	rows, err := db.QueryContext(ctx, q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query rtree table, %w", err)
+	}
+
+	defer rows.Close()
+
+	problems := make([]*ValidationProblem, 0)
+
+	for rows.Next() {
+
+		var rowid int64
+		var id int64
+		var is_alt bool
+		var alt_label string
+		var geometry string
+		var minx, miny, maxx, maxy float64
+		var has_spr bool
+
+		err := rows.Scan(&rowid, &id, &is_alt, &alt_label, &geometry, &minx, &miny, &maxx, &maxy, &has_spr)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan rtree row, %w", err)
+		}
+
+		newProblem := func(problem string, msg string) *ValidationProblem {
+			return &ValidationProblem{
+				Problem:  problem,
+				Table:    rtree_name,
+				Id:       id,
+				AltLabel: alt_label,
+				RowId:    rowid,
+				Message:  msg,
+			}
+		}
+
+		if !has_spr {
+			problems = append(problems, newProblem(PROBLEM_MISSING_SPR, "rtree row has no corresponding spr row"))
+		}
+
+		if is_alt != (alt_label != "") {
+			problems = append(problems, newProblem(PROBLEM_ALT_LABEL_MISMATCH, fmt.Sprintf("is_alt is %t but alt_label is '%s'", is_alt, alt_label)))
+		}
+
+		poly, err := parseRTreeGeometry(geometry)
+
+		if err != nil {
+			problems = append(problems, newProblem(PROBLEM_INVALID_GEOMETRY, err.Error()))
+			continue
+		}
+
+		b := poly.Bound()
+
+		stored := orb.Bound{
+			Min: orb.Point{minx, miny},
+			Max: orb.Point{maxx, maxy},
+		}
+
+		if !boundsEqual(b, stored, bbox_tolerance) {
+			problems = append(problems, newProblem(PROBLEM_BBOX_MISMATCH, fmt.Sprintf("stored bounding box %v does not match geometry bounding box %v", stored, b)))
+		}
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate rtree rows, %w", err)
+	}
+
+	return problems, nil
+}
+
+// validateMissingRTree checks for spr rows with no corresponding rtree rows. Because only records with polygon
+// geometries are stored in the rtree table spr rows whose bounding box is a point are ignored.
+func (r *SQLiteSpatialDatabase) validateMissingRTree(ctx context.Context, db *sql.DB) ([]*ValidationProblem, error) {
+
+	spr_name := r.spr_table.Name()
+
+	q := fmt.Sprintf(`SELECT CAST(s.id AS INTEGER), COALESCE(s.alt_label, '') FROM %s s
+		WHERE (s.min_latitude < s.max_latitude OR s.min_longitude < s.max_longitude)
+		AND NOT EXISTS (SELECT 1 FROM %s r WHERE r.wof_id = CAST(s.id AS INTEGER) AND COALESCE(r.alt_label, '') = COALESCE(s.alt_label, ''))`,
+		spr_name, r.rtree_table.Name())
+
+	rows, err := db.QueryContext(ctx, q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query spr table, %w", err)
+	}
+
+	defer rows.Close()
+
+	problems := make([]*ValidationProblem, 0)
+
+	for rows.Next() {
+
+		var id int64
+		var alt_label string
+
+		err := rows.Scan(&id, &alt_label)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan spr row, %w", err)
+		}
+
+		p := &ValidationProblem{
+			Problem:  PROBLEM_MISSING_RTREE,
+			Table:    spr_name,
+			Id:       id,
+			AltLabel: alt_label,
+			Message:  "spr row has no corresponding rtree rows",
+		}
+
+		problems = append(problems, p)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate spr rows, %w", err)
+	}
+
+	return problems, nil
+}
+
+// validateSPRAltLabels checks for spr rows whose is_alt flag disagrees with their alt label.
+func (r *SQLiteSpatialDatabase) validateSPRAltLabels(ctx context.Context, db *sql.DB) ([]*ValidationProblem, error) {
+
+	spr_name := r.spr_table.Name()
+
+	q := fmt.Sprintf(`SELECT CAST(id AS INTEGER), COALESCE(alt_label, ''), is_alt FROM %s
+		WHERE (is_alt = 0 AND COALESCE(alt_label, '') != '') OR (is_alt != 0 AND COALESCE(alt_label, '') = '')`, spr_name)
+
+	rows, err := db.QueryContext(ctx, q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query spr table, %w", err)
+	}
+
+	defer rows.Close()
+
+	problems := make([]*ValidationProblem, 0)
+
+	for rows.Next() {
+
+		var id int64
+		var alt_label string
+		var is_alt bool
+
+		err := rows.Scan(&id, &alt_label, &is_alt)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan spr row, %w", err)
+		}
+
+		p := &ValidationProblem{
+			Problem:  PROBLEM_ALT_LABEL_MISMATCH,
+			Table:    spr_name,
+			Id:       id,
+			AltLabel: alt_label,
+			Message:  fmt.Sprintf("is_alt is %t but alt_label is '%s'", is_alt, alt_label),
+		}
+
+		problems = append(problems, p)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate spr rows, %w", err)
+	}
+
+	return problems, nil
+}
+
+// validateGeoJSON checks for geojson rows with no corresponding spr row. Because the spr table does not index
+// alternate geometries by default only principal records are checked.
+func (r *SQLiteSpatialDatabase) validateGeoJSON(ctx context.Context, db *sql.DB) ([]*ValidationProblem, error) {
+
+	problems := make([]*ValidationProblem, 0)
+
+	if r.geojson_table == nil {
+		return problems, nil
+	}
+
+	geojson_name := r.geojson_table.Name()
+
+	has_table, err := database_sql.HasTable(ctx, db, geojson_name)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to determine whether %s table exists, %w", geojson_name, err)
+	}
+
+	if !has_table {
+		return problems, nil
+	}
+
+	q := fmt.Sprintf(`SELECT g.id FROM %s g WHERE COALESCE(g.alt_label, '') = ''
+		AND NOT EXISTS (SELECT 1 FROM %s s WHERE s.id = CAST(g.id AS TEXT) AND COALESCE(s.alt_label, '') = '')`,
+		geojson_name, r.spr_table.Name())
+
+	rows, err := db.QueryContext(ctx, q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query %s table, %w", geojson_name, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var id int64
+
+		err := rows.Scan(&id)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan %s row, %w", geojson_name, err)
+		}
+
+		p := &ValidationProblem{
+			Problem: PROBLEM_MISSING_SPR,
+			Table:   geojson_name,
+			Id:      id,
+			Message: "geojson row has no corresponding spr row",
+		}
+
+		problems = append(problems, p)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate %s rows, %w", geojson_name, err)
+	}
+
+	return problems, nil
+}
+
+// Repair attempts to fix the problems reported by the `Validate` method. Records whose GeoJSON body is available
+// in the geojson table are removed from the rtree table and indexed again. Otherwise rtree rows with no spr row or
+// an invalid geometry are deleted and rtree bounding boxes are updated to match their geometry. It returns the
+// list of problems which could not be repaired.
+func (r *SQLiteSpatialDatabase) Repair(ctx context.Context, problems []*ValidationProblem) ([]*ValidationProblem, error) {
+
+	ctx, span := tracer.Start(ctx, "Repair")
+	defer span.End()
+
+	unrepaired := make([]*ValidationProblem, 0)
+
+	// Records may have multiple problems (or rtree rows) so only index each record once
+
+	reindexed := make(map[string]bool)
+
+	for _, p := range problems {
+
+		key := fmt.Sprintf("%d#%s", p.Id, p.AltLabel)
+
+		if reindexed[key] {
+			continue
+		}
+
+		body, err := r.readGeoJSON(ctx, p.Id, p.AltLabel)
+
+		if err != nil {
+			recordSpanError(span, err)
+			return nil, err
+		}
+
+		if body != nil {
+
+			err := r.reindexFeature(ctx, p.Id, p.AltLabel, body)
+
+			if err != nil {
+				recordSpanError(span, err)
+				return nil, fmt.Errorf("Failed to repair %s, %w", p, err)
+			}
+
+			slog.Debug("Repaired record by indexing it again", "id", p.Id, "alt label", p.AltLabel, "problem", p.Problem)
+			reindexed[key] = true
+			continue
+		}
+
+		ok, err := r.repairRTreeRow(ctx, p)
+
+		if err != nil {
+			recordSpanError(span, err)
+			return nil, fmt.Errorf("Failed to repair %s, %w", p, err)
+		}
+
+		if !ok {
+			unrepaired = append(unrepaired, p)
+		}
+	}
+
+	// Repairs may have replaced the rows that were cached
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	r.conn.flushCache()
+
+	// Rows repaired without a GeoJSON body are updated in place so reload the in-memory rtree index, if present
+
+	if r.conn.rtree != nil {
+
+		err := r.loadMemoryRTree(ctx, r.conn.db, r.conn.rtree)
+
+		if err != nil {
+			recordSpanError(span, err)
+			return nil, err
+		}
+	}
+
+	span.SetAttributes(attribute.Int("unrepaired", len(unrepaired)))
+	return unrepaired, nil
+}
+
+// readGeoJSON returns the body of the record 'id' (and 'alt_label') from the geojson table or nil if it is not present.
+func (r *SQLiteSpatialDatabase) readGeoJSON(ctx context.Context, id int64, alt_label string) ([]byte, error) {
+
+	if r.geojson_table == nil {
+		return nil, nil
+	}
+
+	conn, release := r.acquire()
+	defer release()
+
+	has_table, err := database_sql.HasTable(ctx, conn.db, r.geojson_table.Name())
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to determine whether %s table exists, %w", r.geojson_table.Name(), err)
+	}
+
+	if !has_table {
+		return nil, nil
+	}
+
+	q := fmt.Sprintf("SELECT body FROM %s WHERE id = ? AND COALESCE(alt_label, '') = ?", r.geojson_table.Name())
+
+	var body string
+
+	err = conn.db.QueryRowContext(ctx, q, id, alt_label).Scan(&body)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read GeoJSON for %d, %w", id, err)
+	}
+
+	return []byte(body), nil
+}
+
+// reindexFeature removes the rtree rows for 'id' (and 'alt_label') and then indexes 'body' again. The rtree rows
+// are removed first because rtree rows are always appended (rather than replaced) when a record is indexed.
+func (r *SQLiteSpatialDatabase) reindexFeature(ctx context.Context, id int64, alt_label string, body []byte) error {
+
+	conn, release := r.acquire()
+
+	q := fmt.Sprintf("DELETE FROM %s WHERE wof_id = ? AND COALESCE(alt_label, '') = ?", r.rtree_table.Name())
+
+	_, err := conn.db.ExecContext(ctx, q, id, alt_label)
+
+	if err == nil && conn.rtree != nil {
+		conn.rtree.remove(id, alt_label)
+	}
+
+	release()
+
+	if err != nil {
+		return fmt.Errorf("Failed to remove rtree rows, %w", err)
+	}
+
+	return r.IndexFeature(ctx, body)
+}
+
+// repairRTreeRow repairs the rtree row for 'p' without the record's GeoJSON body. Rows with no spr row, or an invalid
+// geometry, are deleted and bounding boxes are updated to match their geometry. It returns false if 'p' can not be
+// repaired this way.
+func (r *SQLiteSpatialDatabase) repairRTreeRow(ctx context.Context, p *ValidationProblem) (bool, error) {
+
+	if p.Table != r.rtree_table.Name() {
+		return false, nil
+	}
+
+	conn, release := r.acquire()
+	defer release()
+
+	switch p.Problem {
+	case PROBLEM_MISSING_SPR, PROBLEM_INVALID_GEOMETRY:
+
+		q := fmt.Sprintf("DELETE FROM %s WHERE id = ?", r.rtree_table.Name())
+
+		_, err := conn.db.ExecContext(ctx, q, p.RowId)
+
+		if err != nil {
+			return false, fmt.Errorf("Failed to delete rtree row, %w", err)
+		}
+
+		return true, nil
+
+	case PROBLEM_BBOX_MISMATCH:
+
+		var geometry string
+
+		q := fmt.Sprintf("SELECT geometry FROM %s WHERE id = ?", r.rtree_table.Name())
+
+		err := conn.db.QueryRowContext(ctx, q, p.RowId).Scan(&geometry)
+
+		if err != nil {
+			return false, fmt.Errorf("Failed to read rtree geometry, %w", err)
+		}
+
+		poly, err := parseRTreeGeometry(geometry)
+
+		if err != nil {
+			return false, err
+		}
+
+		b := poly.Bound()
+
+		q = fmt.Sprintf("UPDATE %s SET min_x = ?, max_x = ?, min_y = ?, max_y = ? WHERE id = ?", r.rtree_table.Name())
+
+		_, err = conn.db.ExecContext(ctx, q, b.Min.X(), b.Max.X(), b.Min.Y(), b.Max.Y(), p.RowId)
+
+		if err != nil {
+			return false, fmt.Errorf("Failed to update rtree bounding box, %w", err)
+		}
+
+		return true, nil
+
+	default:
+		return false, nil
+	}
+}
+
+// boundsEqual returns a boolean value indicating whether 'a' and 'b' are equal within 'tolerance'.
+func boundsEqual(a orb.Bound, b orb.Bound, tolerance float64) bool {
+
+	values := [][2]float64{
+		{a.Min.X(), b.Min.X()},
+		{a.Min.Y(), b.Min.Y()},
+		{a.Max.X(), b.Max.X()},
+		{a.Max.Y(), b.Max.Y()},
+	}
+
+	for _, v := range values {
+
+		if math.Abs(v[0]-v[1]) > tolerance {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := NewSQLiteSpatialDatabase(ctx, "sqlite://"+DEFAULT_ENGINE+"?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	for _, path := range []string{"fixtures/101737491.geojson", "fixtures/1360521545.geojson"} {
+
+		body, err := os.ReadFile(path)
+
+		if err != nil {
+			t.Fatalf("Failed to read %s, %v", path, err)
+		}
+
+		err = db.IndexFeature(ctx, body)
+
+		if err != nil {
+			t.Fatalf("Failed to index %s, %v", path, err)
+		}
+	}
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	problems, err := sqlite_db.Validate(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to validate database, %v", err)
+	}
+
+	if len(problems) != 0 {
+		t.Fatalf("Expected no problems but got %v", problems)
+	}
+
+	// Introduce an orphaned rtree row, an invalid geometry, a bounding box that disagrees with its
+	// geometry and a record with no spr row.
+
+	statements := []string{
+		"INSERT INTO rtree (id, min_x, max_x, min_y, max_y, wof_id, is_alt, alt_label, geometry) VALUES (NULL, 0, 1, 0, 1, 999, 0, '', 'POLYGON((0 0')",
+		"UPDATE rtree SET min_x = min_x - 1 WHERE wof_id = 101737491",
+		"DELETE FROM spr WHERE id = '1360521545'",
+	}
+
+	for _, q := range statements {
+
+		_, err := sqlite_db.conn.db.ExecContext(ctx, q)
+
+		if err != nil {
+			t.Fatalf("Failed to execute '%s', %v", q, err)
+		}
+	}
+
+	problems, err = sqlite_db.Validate(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to validate database, %v", err)
+	}
+
+	found := make(map[string]bool)
+
+	for _, p := range problems {
+		found[p.Problem] = true
+	}
+
+	for _, expected := range []string{PROBLEM_MISSING_SPR, PROBLEM_INVALID_GEOMETRY, PROBLEM_BBOX_MISMATCH} {
+
+		if !found[expected] {
+			t.Fatalf("Expected %s problem, got %v", expected, problems)
+		}
+	}
+
+	unrepaired, err := sqlite_db.Repair(ctx, problems)
+
+	if err != nil {
+		t.Fatalf("Failed to repair database, %v", err)
+	}
+
+	if len(unrepaired) != 0 {
+		t.Fatalf("Expected all problems to be repaired, got %v", unrepaired)
+	}
+
+	problems, err = sqlite_db.Validate(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to validate database, %v", err)
+	}
+
+	if len(problems) != 0 {
+		t.Fatalf("Expected no problems after repair but got %v", problems)
+	}
+}
@@ -40,9 +40,9 @@ func (r *SQLiteSpatialDatabase) Flush(ctx context.Context) error {
 }
 
 // Close implements the whosonfirst/go-writer interface so that the database itself can be used as a
-// writer.Writer instance. This method is a no-op and simply returns `nil`.
+// writer.Writer instance. This method invokes the `Disconnect` method.
 func (r *SQLiteSpatialDatabase) Close(ctx context.Context) error {
-	return r.db.Close()
+	return r.Disconnect(ctx)
 }
 
 // SetLogger implements the whosonfirst/go-writer interface so that the database itself can be used as a
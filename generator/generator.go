@@ -0,0 +1,567 @@
+// package generator provides methods for fabricating synthetic Who's On First GeoJSON features for tests and benchmarks.
+package generator
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+)
+
+// The default value assigned to the `wof:lastmodified` property of generated features (2024-01-01T00:00:00Z).
+// A fixed value is used so that the same options always produce the same features.
+const DEFAULT_LASTMODIFIED int64 = 1704067200
+
+// The default value assigned to the `wof:repo` property of generated features.
+const DEFAULT_REPO string = "whosonfirst-data-synthetic"
+
+// The default value assigned to the `wof:country` property of generated features.
+const DEFAULT_COUNTRY string = "XY"
+
+// The maximum number of interior rings (holes) that can be assigned to a polygon.
+const MAX_INTERIOR_RINGS int = 4
+
+// The date assigned to the `edtf:cessation` and `edtf:deprecated` properties of ceased and deprecated features.
+const existential_date string = "2020-01-01"
+
+// DefaultPlacetypes returns the default placetype hierarchy, from the top down, for generated features.
+func DefaultPlacetypes() []string {
+	return []string{"country", "region", "locality", "neighbourhood"}
+}
+
+// Options is a struct containing configuration options for generating synthetic features.
+type Options struct {
+	// The seed for the random number generator. The same options (and seed) always produce the same features.
+	Seed int64
+	// The ID assigned to the first feature. Subsequent features are assigned sequential IDs. Default is 1.
+	StartId int64
+	// The area that top-level features are distributed across. Default is -180,-80,180,80.
+	Bounds orb.Bound
+	// The placetype hierarchy, from the top down. Each feature is contained by its parent. Default is `DefaultPlacetypes`.
+	Placetypes []string
+	// The number of features to create for the top-level placetype and for each parent feature. Default is 4.
+	Children int
+	// The number of vertices in the exterior ring of each polygon. Default is 16. Minimum is 4.
+	Vertices int
+	// The number of interior rings (holes) in each polygon, up to `MAX_INTERIOR_RINGS`. Children are never placed inside holes.
+	// Interior rings require at least 8 vertices.
+	InteriorRings int
+	// Zero or more labels for which an alternate geometry feature is created for each feature.
+	AltLabels []string
+	// The number of additional top-level features, whose geometries are split in to a MultiPolygon, crossing the antimeridian.
+	Antimeridian int
+	// The probability (0.0 - 1.0) that a feature is ceased.
+	CeasedRatio float64
+	// The probability (0.0 - 1.0) that a feature is deprecated.
+	DeprecatedRatio float64
+	// The probability (0.0 - 1.0) that a feature is superseded. Superseded features reference an ID which is not generated.
+	SupersededRatio float64
+	// The value of the `wof:country` property. Default is `DEFAULT_COUNTRY`.
+	Country string
+	// The value of the `wof:repo` property. Default is `DEFAULT_REPO`.
+	Repo string
+	// The value of the `wof:lastmodified` property. Default is `DEFAULT_LASTMODIFIED`.
+	LastModified int64
+}
+
+// Generator is a struct for fabricating synthetic Who's On First GeoJSON features.
+type Generator struct {
+	options *Options
+}
+
+// NewGenerator returns a new `Generator` instance for 'opts'. Any zero values in 'opts' are replaced by their defaults.
+func NewGenerator(opts *Options) (*Generator, error) {
+
+	o := *opts
+
+	if o.StartId == 0 {
+		o.StartId = 1
+	}
+
+	if o.StartId < 0 {
+		return nil, fmt.Errorf("Start ID must be greater than zero")
+	}
+
+	if o.Bounds.IsZero() {
+		o.Bounds = orb.Bound{Min: orb.Point{-180.0, -80.0}, Max: orb.Point{180.0, 80.0}}
+	}
+
+	if o.Bounds.Min.X() < -180.0 || o.Bounds.Max.X() > 180.0 || o.Bounds.Min.Y() < -90.0 || o.Bounds.Max.Y() > 90.0 {
+		return nil, fmt.Errorf("Bounds must be valid WGS84 coordinates")
+	}
+
+	if o.Bounds.Min.X() >= o.Bounds.Max.X() || o.Bounds.Min.Y() >= o.Bounds.Max.Y() {
+		return nil, fmt.Errorf("Bounds must have a non-zero area")
+	}
+
+	if len(o.Placetypes) == 0 {
+		o.Placetypes = DefaultPlacetypes()
+	}
+
+	if o.Children == 0 {
+		o.Children = 4
+	}
+
+	if o.Children < 0 {
+		return nil, fmt.Errorf("Children must be greater than zero")
+	}
+
+	if o.Vertices == 0 {
+		o.Vertices = 16
+	}
+
+	if o.Vertices < 4 {
+		return nil, fmt.Errorf("Vertices must be at least 4")
+	}
+
+	if o.InteriorRings < 0 || o.InteriorRings > MAX_INTERIOR_RINGS {
+		return nil, fmt.Errorf("Interior rings must be between 0 and %d", MAX_INTERIOR_RINGS)
+	}
+
+	// The exterior ring may come as close as 0.9 * cos(π / vertices) of the radius to the center of the polygon,
+	// which is only outside the interior rings (80% of the radius) for 8 or more vertices.
+
+	if o.InteriorRings > 0 && o.Vertices < 8 {
+		return nil, fmt.Errorf("Vertices must be at least 8 when interior rings are enabled")
+	}
+
+	if o.Antimeridian < 0 {
+		return nil, fmt.Errorf("Antimeridian must not be negative")
+	}
+
+	for label, v := range map[string]float64{"ceased": o.CeasedRatio, "deprecated": o.DeprecatedRatio, "superseded": o.SupersededRatio} {
+
+		if v < 0.0 || v > 1.0 {
+			return nil, fmt.Errorf("Invalid %s ratio, must be between 0.0 and 1.0", label)
+		}
+	}
+
+	if o.Country == "" {
+		o.Country = DEFAULT_COUNTRY
+	}
+
+	if o.Repo == "" {
+		o.Repo = DEFAULT_REPO
+	}
+
+	if o.LastModified == 0 {
+		o.LastModified = DEFAULT_LASTMODIFIED
+	}
+
+	o.Placetypes = slices.Clone(o.Placetypes)
+	o.AltLabels = slices.Clone(o.AltLabels)
+
+	g := &Generator{
+		options: &o,
+	}
+
+	return g, nil
+}
+
+// Count returns the number of (non-alternate) features that will be generated.
+func (g *Generator) Count() int {
+
+	count := g.options.Antimeridian
+	level := 1
+
+	for range g.options.Placetypes {
+		level = level * g.options.Children
+		count += level
+	}
+
+	return count
+}
+
+// Features returns an iterator of the GeoJSON-encoded features defined by the generator's options. Parent features are
+// always yielded before their children and alternate geometries immediately follow the feature they belong to.
+func (g *Generator) Features(ctx context.Context) iter.Seq2[[]byte, error] {
+
+	return func(yield func([]byte, error) bool) {
+
+		s := &state{
+			options: g.options,
+			rnd:     rand.New(rand.NewPCG(uint64(g.options.Seed), 0)),
+			next_id: g.options.StartId,
+		}
+
+		for _, cell := range grid(g.options.Bounds, g.options.Children) {
+
+			if !s.generate(ctx, yield, 0, cell, nil) {
+				return
+			}
+		}
+
+		for i := 0; i < g.options.Antimeridian; i++ {
+
+			if !s.antimeridian(ctx, yield) {
+				return
+			}
+		}
+	}
+}
+
+// IndexDatabase writes each feature produced by 'g' to 'db' using its `IndexFeature` method and returns the number of
+// features (including alternate geometries) indexed.
+func IndexDatabase(ctx context.Context, db database.SpatialDatabase, g *Generator) (int, error) {
+
+	count := 0
+
+	for body, err := range g.Features(ctx) {
+
+		if err != nil {
+			return count, err
+		}
+
+		err = db.IndexFeature(ctx, body)
+
+		if err != nil {
+			return count, fmt.Errorf("Failed to index feature, %w", err)
+		}
+
+		count += 1
+	}
+
+	return count, nil
+}
+
+// ancestor is a struct describing a feature's ancestor.
+type ancestor struct {
+	id        int64
+	placetype string
+}
+
+// state is a struct containing the state of a single pass over the features defined by a generator's options.
+type state struct {
+	options *Options
+	rnd     *rand.Rand
+	next_id int64
+}
+
+// generate yields the feature, for placetype 'depth', filling 'cell' and then (recursively) its children. It returns
+// false if iteration should stop.
+func (s *state) generate(ctx context.Context, yield func([]byte, error) bool, depth int, cell orb.Bound, ancestors []*ancestor) bool {
+
+	if ctx.Err() != nil {
+		yield(nil, ctx.Err())
+		return false
+	}
+
+	id := s.nextId()
+	pt := s.options.Placetypes[depth]
+
+	poly, inner := s.polygon(cell)
+
+	if !s.emit(yield, id, pt, poly, ancestors) {
+		return false
+	}
+
+	if depth+1 == len(s.options.Placetypes) {
+		return true
+	}
+
+	ancestors = append(slices.Clone(ancestors), &ancestor{id: id, placetype: pt})
+
+	for _, child := range grid(inner, s.options.Children) {
+
+		if !s.generate(ctx, yield, depth+1, child, ancestors) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// antimeridian yields a top-level feature whose geometry crosses the antimeridian. It returns false if iteration should stop.
+func (s *state) antimeridian(ctx context.Context, yield func([]byte, error) bool) bool {
+
+	if ctx.Err() != nil {
+		yield(nil, ctx.Err())
+		return false
+	}
+
+	b := s.options.Bounds
+	height := math.Min(5.0, (b.Max.Y()-b.Min.Y())/2)
+	width := 1.0 + s.rnd.Float64()*4.0
+
+	miny := b.Min.Y() + s.rnd.Float64()*(b.Max.Y()-b.Min.Y()-height)
+	maxy := miny + height
+
+	east := orb.Bound{Min: orb.Point{180.0 - width, miny}, Max: orb.Point{180.0, maxy}}
+	west := orb.Bound{Min: orb.Point{-180.0, miny}, Max: orb.Point{-180.0 + width, maxy}}
+
+	geom := orb.MultiPolygon{east.ToPolygon(), west.ToPolygon()}
+
+	return s.emit(yield, s.nextId(), s.options.Placetypes[0], geom, nil)
+}
+
+// emit yields the feature (and any alternate geometries) for 'id'. It returns false if iteration should stop.
+func (s *state) emit(yield func([]byte, error) bool, id int64, pt string, geom orb.Geometry, ancestors []*ancestor) bool {
+
+	props := s.properties(id, pt, geom, ancestors)
+
+	body, err := marshalFeature(geom, props)
+
+	if err != nil {
+		yield(nil, fmt.Errorf("Failed to marshal feature %d, %w", id, err))
+		return false
+	}
+
+	if !yield(body, nil) {
+		return false
+	}
+
+	for _, label := range s.options.AltLabels {
+
+		alt_geom := scale(geom, 0.98)
+
+		alt_props := map[string]any{
+			"wof:id":           id,
+			"wof:name":         props["wof:name"],
+			"wof:placetype":    pt,
+			"wof:parent_id":    props["wof:parent_id"],
+			"wof:hierarchy":    props["wof:hierarchy"],
+			"wof:country":      s.options.Country,
+			"wof:repo":         s.options.Repo,
+			"wof:lastmodified": s.options.LastModified,
+			"src:alt_label":    label,
+			"src:geom":         label,
+			"mz:is_current":    props["mz:is_current"],
+		}
+
+		alt_body, err := marshalFeature(alt_geom, alt_props)
+
+		if err != nil {
+			yield(nil, fmt.Errorf("Failed to marshal %s alternate geometry for %d, %w", label, id, err))
+			return false
+		}
+
+		if !yield(alt_body, nil) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// properties returns the Who's On First properties for the feature 'id'.
+func (s *state) properties(id int64, pt string, geom orb.Geometry, ancestors []*ancestor) map[string]any {
+
+	name := fmt.Sprintf("%s%s %d", strings.ToUpper(pt[:1]), pt[1:], id)
+
+	parent_id := int64(-1)
+	belongsto := make([]int64, len(ancestors))
+
+	hierarchy := map[string]int64{
+		fmt.Sprintf("%s_id", pt): id,
+	}
+
+	for idx, a := range ancestors {
+		belongsto[idx] = a.id
+		hierarchy[fmt.Sprintf("%s_id", a.placetype)] = a.id
+	}
+
+	if len(ancestors) > 0 {
+		parent_id = ancestors[len(ancestors)-1].id
+	}
+
+	bbox := geom.Bound()
+	centroid := bbox.Center()
+
+	// The bounding box of a geometry split across the antimeridian spans the whole world so use its first polygon instead
+
+	mp, ok := geom.(orb.MultiPolygon)
+
+	if ok {
+		centroid = mp[0].Bound().Center()
+	}
+
+	props := map[string]any{
+		"wof:id":               id,
+		"wof:name":             name,
+		"name:eng_x_preferred": []string{name},
+		"wof:placetype":        pt,
+		"wof:parent_id":        parent_id,
+		"wof:belongsto":        belongsto,
+		"wof:hierarchy":        []map[string]int64{hierarchy},
+		"wof:country":          s.options.Country,
+		"wof:repo":             s.options.Repo,
+		"wof:lastmodified":     s.options.LastModified,
+		"wof:supersedes":       []int64{},
+		"wof:superseded_by":    []int64{},
+		"src:geom":             "synthetic",
+		"geom:latitude":        centroid.Y(),
+		"geom:longitude":       centroid.X(),
+		"geom:bbox":            fmt.Sprintf("%f,%f,%f,%f", bbox.Min.X(), bbox.Min.Y(), bbox.Max.X(), bbox.Max.Y()),
+		"edtf:inception":       "",
+		"edtf:cessation":       "..",
+		"mz:is_current":        1,
+	}
+
+	// Always draw all three values so that changing one ratio doesn't change which features are assigned the others
+
+	ceased := s.rnd.Float64() < s.options.CeasedRatio
+	deprecated := s.rnd.Float64() < s.options.DeprecatedRatio
+	superseded := s.rnd.Float64() < s.options.SupersededRatio
+
+	if ceased {
+		props["edtf:cessation"] = existential_date
+		props["mz:is_current"] = 0
+	}
+
+	if deprecated {
+		props["edtf:deprecated"] = existential_date
+		props["mz:is_current"] = 0
+	}
+
+	if superseded {
+		props["wof:superseded_by"] = []int64{s.nextId()}
+		props["mz:is_current"] = 0
+	}
+
+	return props
+}
+
+// polygon returns a polygon filling 'cell', with the interior rings defined by the generator's options, and the bounding
+// box inside that polygon (and outside any interior rings) in which children are placed.
+func (s *state) polygon(cell orb.Bound) (orb.Polygon, orb.Bound) {
+
+	center := cell.Center()
+
+	// Leave a margin so that neighbouring polygons don't touch
+
+	rx := (cell.Max.X() - cell.Min.X()) / 2 * 0.95
+	ry := (cell.Max.Y() - cell.Min.Y()) / 2 * 0.95
+
+	count := s.options.Vertices
+	offset := s.rnd.Float64() * 2 * math.Pi / float64(count)
+
+	exterior := make(orb.Ring, count+1)
+
+	for i := 0; i < count; i++ {
+
+		// Vertices are jittered between 90% and 100% of the radius. Since the smallest polygon (4 vertices) is a
+		// diamond this guarantees that every polygon contains the points within 45% of the radius in either axis.
+
+		r := 0.9 + s.rnd.Float64()*0.1
+		a := offset + float64(i)*2*math.Pi/float64(count)
+
+		exterior[i] = orb.Point{center.X() + math.Cos(a)*rx*r, center.Y() + math.Sin(a)*ry*r}
+	}
+
+	exterior[count] = exterior[0]
+
+	poly := orb.Polygon{exterior}
+
+	// Interior rings are placed along the axes, between 60% and 80% of the radius, so that they are always inside the
+	// exterior ring (see the minimum number of vertices in NewGenerator) and never overlap the area reserved for
+	// children (40% of the radius).
+
+	for i := 0; i < s.options.InteriorRings; i++ {
+
+		a := float64(i) * math.Pi / 2
+		hx := center.X() + math.Cos(a)*rx*0.7
+		hy := center.Y() + math.Sin(a)*ry*0.7
+
+		hole := make(orb.Ring, 9)
+
+		for j := 0; j < 8; j++ {
+
+			// Interior rings are wound clockwise
+			ha := -float64(j) * 2 * math.Pi / 8
+			hole[j] = orb.Point{hx + math.Cos(ha)*rx*0.1, hy + math.Sin(ha)*ry*0.1}
+		}
+
+		hole[8] = hole[0]
+		poly = append(poly, hole)
+	}
+
+	inner := orb.Bound{
+		Min: orb.Point{center.X() - rx*0.4, center.Y() - ry*0.4},
+		Max: orb.Point{center.X() + rx*0.4, center.Y() + ry*0.4},
+	}
+
+	return poly, inner
+}
+
+// nextId returns the next unused feature ID.
+func (s *state) nextId() int64 {
+
+	id := s.next_id
+	s.next_id += 1
+	return id
+}
+
+// grid divides 'b' in to (at least) 'count' equally sized cells and returns the first 'count' of them.
+func grid(b orb.Bound, count int) []orb.Bound {
+
+	cols := int(math.Ceil(math.Sqrt(float64(count))))
+	rows := int(math.Ceil(float64(count) / float64(cols)))
+
+	w := (b.Max.X() - b.Min.X()) / float64(cols)
+	h := (b.Max.Y() - b.Min.Y()) / float64(rows)
+
+	cells := make([]orb.Bound, 0, count)
+
+	for i := 0; i < count; i++ {
+
+		x := b.Min.X() + float64(i%cols)*w
+		y := b.Min.Y() + float64(i/cols)*h
+
+		cells = append(cells, orb.Bound{Min: orb.Point{x, y}, Max: orb.Point{x + w, y + h}})
+	}
+
+	return cells
+}
+
+// scale returns a copy of 'geom' with each polygon scaled by 'factor' around the center of its bounding box.
+func scale(geom orb.Geometry, factor float64) orb.Geometry {
+
+	scalePolygon := func(poly orb.Polygon) orb.Polygon {
+
+		center := poly.Bound().Center()
+		scaled := make(orb.Polygon, len(poly))
+
+		for idx, ring := range poly {
+
+			scaled[idx] = make(orb.Ring, len(ring))
+
+			for j, pt := range ring {
+				scaled[idx][j] = orb.Point{center.X() + (pt.X()-center.X())*factor, center.Y() + (pt.Y()-center.Y())*factor}
+			}
+		}
+
+		return scaled
+	}
+
+	switch g := geom.(type) {
+	case orb.Polygon:
+		return scalePolygon(g)
+	case orb.MultiPolygon:
+
+		scaled := make(orb.MultiPolygon, len(g))
+
+		for idx, poly := range g {
+			scaled[idx] = scalePolygon(poly)
+		}
+
+		return scaled
+	default:
+		return geom
+	}
+}
+
+// marshalFeature returns the GeoJSON encoding of a feature with geometry 'geom' and properties 'props'.
+func marshalFeature(geom orb.Geometry, props map[string]any) ([]byte, error) {
+
+	f := geojson.NewFeature(geom)
+	f.Properties = props
+
+	return f.MarshalJSON()
+}
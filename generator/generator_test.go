@@ -0,0 +1,272 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-feature/alt"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-validate"
+)
+
+func TestFeatures(t *testing.T) {
+
+	ctx := context.Background()
+
+	opts := &Options{
+		Seed:            1234,
+		Children:        3,
+		Vertices:        32,
+		InteriorRings:   2,
+		AltLabels:       []string{"quattroshapes"},
+		Antimeridian:    2,
+		CeasedRatio:     0.2,
+		DeprecatedRatio: 0.1,
+		SupersededRatio: 0.1,
+	}
+
+	g, err := NewGenerator(opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create generator, %v", err)
+	}
+
+	// 3 + 9 + 27 + 81 + 2 antimeridian features
+
+	if g.Count() != 122 {
+		t.Fatalf("Unexpected count: %d", g.Count())
+	}
+
+	bodies := make([][]byte, 0)
+
+	for body, err := range g.Features(ctx) {
+
+		if err != nil {
+			t.Fatalf("Failed to generate feature, %v", err)
+		}
+
+		if alt.IsAlt(body) {
+			err = validate.ValidateAlt(body)
+		} else {
+			err = validate.Validate(body)
+		}
+
+		if err != nil {
+			t.Fatalf("Generated feature is invalid, %v\n%s", err, body)
+		}
+
+		bodies = append(bodies, body)
+	}
+
+	if len(bodies) != g.Count()*2 {
+		t.Fatalf("Expected %d features (including alternate geometries), got %d", g.Count()*2, len(bodies))
+	}
+
+	idx := 0
+
+	for body, err := range g.Features(ctx) {
+
+		if err != nil {
+			t.Fatalf("Failed to generate feature, %v", err)
+		}
+
+		if !bytes.Equal(body, bodies[idx]) {
+			t.Fatalf("Feature %d differs between runs", idx)
+		}
+
+		idx += 1
+	}
+
+	_, err = NewGenerator(&Options{InteriorRings: MAX_INTERIOR_RINGS + 1})
+
+	if err == nil {
+		t.Fatalf("Expected invalid interior rings to fail")
+	}
+}
+
+func TestPolygonInteriorRings(t *testing.T) {
+
+	for vertices := 4; vertices <= 32; vertices++ {
+
+		g, err := NewGenerator(&Options{Vertices: vertices, InteriorRings: MAX_INTERIOR_RINGS})
+
+		if vertices < 8 {
+
+			if err == nil {
+				t.Fatalf("Expected interior rings with %d vertices to fail", vertices)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to create generator with %d vertices, %v", vertices, err)
+		}
+
+		for seed := uint64(0); seed < 100; seed++ {
+
+			s := &state{
+				options: g.options,
+				rnd:     rand.New(rand.NewPCG(seed, 0)),
+			}
+
+			cell := orb.Bound{Min: orb.Point{-10, -5}, Max: orb.Point{10, 5}}
+			poly, inner := s.polygon(cell)
+
+			exterior := poly[0]
+
+			for i, hole := range poly[1:] {
+
+				if hole.Bound().Intersects(inner) {
+					t.Fatalf("Interior ring %d overlaps children with %d vertices (seed %d)", i, vertices, seed)
+				}
+
+				for _, pt := range hole {
+
+					if !planar.RingContains(exterior, pt) {
+						t.Fatalf("Interior ring %d is outside exterior ring with %d vertices (seed %d)", i, vertices, seed)
+					}
+				}
+
+				for _, pt := range exterior {
+
+					if planar.RingContains(hole, pt) {
+						t.Fatalf("Exterior ring crosses interior ring %d with %d vertices (seed %d)", i, vertices, seed)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestIndexDatabase(t *testing.T) {
+
+	ctx := context.Background()
+
+	opts := &Options{
+		Seed:          1,
+		Children:      2,
+		InteriorRings: 1,
+		Antimeridian:  1,
+	}
+
+	g, err := NewGenerator(opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create generator, %v", err)
+	}
+
+	uri := fmt.Sprintf("sqlite://%s?dsn=%s", sqlite.DEFAULT_ENGINE, filepath.Join(t.TempDir(), "synthetic.db"))
+
+	db, err := sqlite.NewSQLiteSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	count, err := IndexDatabase(ctx, db, g)
+
+	if err != nil {
+		t.Fatalf("Failed to index features, %v", err)
+	}
+
+	if count != g.Count() {
+		t.Fatalf("Expected %d features to be indexed, got %d", g.Count(), count)
+	}
+
+	var leaf []byte
+	var antimeridian []byte
+
+	for body, _ := range g.Features(ctx) {
+
+		switch gjson.GetBytes(body, "geometry.type").String() {
+		case "MultiPolygon":
+			antimeridian = body
+		default:
+			if leaf == nil && gjson.GetBytes(body, "properties.wof:placetype").String() == "neighbourhood" {
+				leaf = body
+			}
+		}
+	}
+
+	pip := func(pt orb.Point) map[string]bool {
+
+		rsp, err := db.PointInPolygon(ctx, &pt)
+
+		if err != nil {
+			t.Fatalf("Failed to perform point in polygon query for %v, %v", pt, err)
+		}
+
+		ids := make(map[string]bool)
+
+		for _, r := range rsp.Results() {
+			ids[r.Id()] = true
+		}
+
+		return ids
+	}
+
+	// The centroid of the first neighbourhood is contained by it and all of its ancestors
+
+	leaf_pt := orb.Point{
+		gjson.GetBytes(leaf, "properties.geom:longitude").Float(),
+		gjson.GetBytes(leaf, "properties.geom:latitude").Float(),
+	}
+
+	ids := pip(leaf_pt)
+
+	expected := []string{
+		gjson.GetBytes(leaf, "properties.wof:id").String(),
+	}
+
+	for _, a := range gjson.GetBytes(leaf, "properties.wof:belongsto").Array() {
+		expected = append(expected, a.String())
+	}
+
+	if len(ids) != len(expected) {
+		t.Fatalf("Expected %v for %v, got %v", expected, leaf_pt, ids)
+	}
+
+	for _, id := range expected {
+
+		if !ids[id] {
+			t.Fatalf("Expected %v for %v, got %v", expected, leaf_pt, ids)
+		}
+	}
+
+	// The center of the interior ring of the first country is not contained by anything
+
+	cell := grid(g.options.Bounds, g.options.Children)[0]
+	rx := (cell.Max.X() - cell.Min.X()) / 2 * 0.95
+
+	hole_pt := orb.Point{cell.Center().X() + rx*0.7, cell.Center().Y()}
+
+	ids = pip(hole_pt)
+
+	if len(ids) != 0 {
+		t.Fatalf("Expected no results for %v (inside interior ring), got %v", hole_pt, ids)
+	}
+
+	// Both sides of the antimeridian feature contain points
+
+	am_id := gjson.GetBytes(antimeridian, "properties.wof:id").String()
+	am_lat := gjson.GetBytes(antimeridian, "properties.geom:latitude").Float()
+
+	for _, pt := range []orb.Point{{179.9, am_lat}, {-179.9, am_lat}} {
+
+		ids = pip(pt)
+
+		if !ids[am_id] {
+			t.Fatalf("Expected %s for %v, got %v", am_id, pt, ids)
+		}
+	}
+}
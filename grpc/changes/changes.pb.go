@@ -0,0 +1,200 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        v3.21.12
+// source: grpc/changes/changes.proto
+
+package changes
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ChangedSinceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Since         int64                  `protobuf:"varint,1,opt,name=since,proto3" json:"since,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChangedSinceRequest) Reset() {
+	*x = ChangedSinceRequest{}
+	mi := &file_grpc_changes_changes_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangedSinceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangedSinceRequest) ProtoMessage() {}
+
+func (x *ChangedSinceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_changes_changes_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangedSinceRequest.ProtoReflect.Descriptor instead.
+func (*ChangedSinceRequest) Descriptor() ([]byte, []int) {
+	return file_grpc_changes_changes_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ChangedSinceRequest) GetSince() int64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+type Change struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	AltLabel      string                 `protobuf:"bytes,2,opt,name=alt_label,json=altLabel,proto3" json:"alt_label,omitempty"`
+	Lastmodified  int64                  `protobuf:"varint,3,opt,name=lastmodified,proto3" json:"lastmodified,omitempty"`
+	Deleted       bool                   `protobuf:"varint,4,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Change) Reset() {
+	*x = Change{}
+	mi := &file_grpc_changes_changes_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Change) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Change) ProtoMessage() {}
+
+func (x *Change) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_changes_changes_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Change.ProtoReflect.Descriptor instead.
+func (*Change) Descriptor() ([]byte, []int) {
+	return file_grpc_changes_changes_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Change) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Change) GetAltLabel() string {
+	if x != nil {
+		return x.AltLabel
+	}
+	return ""
+}
+
+func (x *Change) GetLastmodified() int64 {
+	if x != nil {
+		return x.Lastmodified
+	}
+	return 0
+}
+
+func (x *Change) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+var File_grpc_changes_changes_proto protoreflect.FileDescriptor
+
+const file_grpc_changes_changes_proto_rawDesc = "" +
+	"\n" +
+	"\x1agrpc/changes/changes.proto\"+\n" +
+	"\x13ChangedSinceRequest\x12\x14\n" +
+	"\x05since\x18\x01 \x01(\x03R\x05since\"s\n" +
+	"\x06Change\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1b\n" +
+	"\talt_label\x18\x02 \x01(\tR\baltLabel\x12\"\n" +
+	"\flastmodified\x18\x03 \x01(\x03R\flastmodified\x12\x18\n" +
+	"\adeleted\x18\x04 \x01(\bR\adeleted2<\n" +
+	"\aChanges\x121\n" +
+	"\fChangedSince\x12\x14.ChangedSinceRequest\x1a\a.Change\"\x000\x01BCZAgithub.com/whosonfirst/go-whosonfirst-spatial-sqlite/grpc/changesb\x06proto3"
+
+var (
+	file_grpc_changes_changes_proto_rawDescOnce sync.Once
+	file_grpc_changes_changes_proto_rawDescData []byte
+)
+
+func file_grpc_changes_changes_proto_rawDescGZIP() []byte {
+	file_grpc_changes_changes_proto_rawDescOnce.Do(func() {
+		file_grpc_changes_changes_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_grpc_changes_changes_proto_rawDesc), len(file_grpc_changes_changes_proto_rawDesc)))
+	})
+	return file_grpc_changes_changes_proto_rawDescData
+}
+
+var file_grpc_changes_changes_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_grpc_changes_changes_proto_goTypes = []any{
+	(*ChangedSinceRequest)(nil), // 0: ChangedSinceRequest
+	(*Change)(nil),              // 1: Change
+}
+var file_grpc_changes_changes_proto_depIdxs = []int32{
+	0, // 0: Changes.ChangedSince:input_type -> ChangedSinceRequest
+	1, // 1: Changes.ChangedSince:output_type -> Change
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_grpc_changes_changes_proto_init() }
+func file_grpc_changes_changes_proto_init() {
+	if File_grpc_changes_changes_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_grpc_changes_changes_proto_rawDesc), len(file_grpc_changes_changes_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_grpc_changes_changes_proto_goTypes,
+		DependencyIndexes: file_grpc_changes_changes_proto_depIdxs,
+		MessageInfos:      file_grpc_changes_changes_proto_msgTypes,
+	}.Build()
+	File_grpc_changes_changes_proto = out.File
+	file_grpc_changes_changes_proto_goTypes = nil
+	file_grpc_changes_changes_proto_depIdxs = nil
+}
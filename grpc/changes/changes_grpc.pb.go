@@ -0,0 +1,124 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v3.21.12
+// source: grpc/changes/changes.proto
+
+package changes
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Changes_ChangedSince_FullMethodName = "/Changes/ChangedSince"
+)
+
+// ChangesClient is the client API for Changes service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ChangesClient interface {
+	ChangedSince(ctx context.Context, in *ChangedSinceRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Change], error)
+}
+
+type changesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChangesClient(cc grpc.ClientConnInterface) ChangesClient {
+	return &changesClient{cc}
+}
+
+func (c *changesClient) ChangedSince(ctx context.Context, in *ChangedSinceRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Change], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Changes_ServiceDesc.Streams[0], Changes_ChangedSince_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ChangedSinceRequest, Change]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Changes_ChangedSinceClient = grpc.ServerStreamingClient[Change]
+
+// ChangesServer is the server API for Changes service.
+// All implementations must embed UnimplementedChangesServer
+// for forward compatibility.
+type ChangesServer interface {
+	ChangedSince(*ChangedSinceRequest, grpc.ServerStreamingServer[Change]) error
+	mustEmbedUnimplementedChangesServer()
+}
+
+// UnimplementedChangesServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedChangesServer struct{}
+
+func (UnimplementedChangesServer) ChangedSince(*ChangedSinceRequest, grpc.ServerStreamingServer[Change]) error {
+	return status.Errorf(codes.Unimplemented, "method ChangedSince not implemented")
+}
+func (UnimplementedChangesServer) mustEmbedUnimplementedChangesServer() {}
+func (UnimplementedChangesServer) testEmbeddedByValue()                 {}
+
+// UnsafeChangesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChangesServer will
+// result in compilation errors.
+type UnsafeChangesServer interface {
+	mustEmbedUnimplementedChangesServer()
+}
+
+func RegisterChangesServer(s grpc.ServiceRegistrar, srv ChangesServer) {
+	// If the following call pancis, it indicates UnimplementedChangesServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Changes_ServiceDesc, srv)
+}
+
+func _Changes_ChangedSince_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ChangedSinceRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChangesServer).ChangedSince(m, &grpc.GenericServerStream[ChangedSinceRequest, Change]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Changes_ChangedSinceServer = grpc.ServerStreamingServer[Change]
+
+// Changes_ServiceDesc is the grpc.ServiceDesc for Changes service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Changes_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "Changes",
+	HandlerType: (*ChangesServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ChangedSince",
+			Handler:       _Changes_ChangedSince_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "grpc/changes/changes.proto",
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite/grpc/changes"
+	"google.golang.org/grpc"
+)
+
+// ChangesServer implements the `changes.ChangesServer` interface for a `sqlite.ChangesDatabase` instance.
+type ChangesServer struct {
+	changes.UnimplementedChangesServer
+	db sqlite.ChangesDatabase
+}
+
+// NewChangesServer returns a new `ChangesServer` instance for 'db'.
+func NewChangesServer(db sqlite.ChangesDatabase) (*ChangesServer, error) {
+
+	s := &ChangesServer{
+		db: db,
+	}
+
+	return s, nil
+}
+
+// ChangedSince streams the records added, updated or removed since the Unix timestamp defined by 'req'.
+func (s *ChangesServer) ChangedSince(req *changes.ChangedSinceRequest, stream grpc.ServerStreamingServer[changes.Change]) error {
+
+	ctx := stream.Context()
+
+	for c, err := range s.db.ChangedSince(ctx, req.Since) {
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive changes, %w", err)
+		}
+
+		rsp := &changes.Change{
+			Id:           c.Id,
+			AltLabel:     c.AltLabel,
+			Lastmodified: c.LastModified,
+			Deleted:      c.Deleted,
+		}
+
+		err = stream.Send(rsp)
+
+		if err != nil {
+			return fmt.Errorf("Failed to send change, %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+)
+
+// ChangesHandler returns a `http.Handler` instance that writes the records added, updated or removed since the Unix
+// timestamp defined by the "since" query parameter, as line-delimited JSON, in ascending order of their last modified time.
+func ChangesHandler(db sqlite.ChangesDatabase) (http.Handler, error) {
+
+	fn := func(rsp http.ResponseWriter, req *http.Request) {
+
+		ctx := req.Context()
+
+		logger := slog.Default()
+		logger = logger.With("path", req.URL.Path)
+
+		if req.Method != http.MethodGet {
+			http.Error(rsp, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		str_since := req.URL.Query().Get("since")
+
+		if str_since == "" {
+			http.Error(rsp, "Missing ?since= parameter", http.StatusBadRequest)
+			return
+		}
+
+		since, err := strconv.ParseInt(str_since, 10, 64)
+
+		if err != nil {
+			http.Error(rsp, "Invalid ?since= parameter", http.StatusBadRequest)
+			return
+		}
+
+		rsp.Header().Set("Content-Type", "application/x-ndjson")
+
+		enc := json.NewEncoder(rsp)
+		flusher, can_flush := rsp.(http.Flusher)
+
+		count := 0
+
+		for c, err := range db.ChangedSince(ctx, since) {
+
+			if err != nil {
+
+				logger.Error("Failed to derive changes", "since", since, "error", err)
+
+				// Headers have not been sent yet so it is still possible to return an error status
+
+				if count == 0 {
+					http.Error(rsp, "Failed to derive changes", http.StatusInternalServerError)
+				}
+
+				return
+			}
+
+			err = enc.Encode(c)
+
+			if err != nil {
+				logger.Error("Failed to encode change", "id", c.Id, "error", err)
+				return
+			}
+
+			count += 1
+
+			if can_flush && count%1000 == 0 {
+				flusher.Flush()
+			}
+		}
+	}
+
+	return http.HandlerFunc(fn), nil
+}
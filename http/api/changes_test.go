@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+)
+
+func TestChangesHandler(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := sqlite.NewSQLiteSpatialDatabase(ctx, "sqlite://"+sqlite.DEFAULT_ENGINE+"?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	for _, path := range []string{"../../fixtures/101737491.geojson", "../../fixtures/1360521545.geojson"} {
+
+		body, err := os.ReadFile(path)
+
+		if err != nil {
+			t.Fatalf("Failed to read %s, %v", path, err)
+		}
+
+		err = db.IndexFeature(ctx, body)
+
+		if err != nil {
+			t.Fatalf("Failed to index %s, %v", path, err)
+		}
+	}
+
+	err = db.RemoveFeature(ctx, "101737491")
+
+	if err != nil {
+		t.Fatalf("Failed to remove feature, %v", err)
+	}
+
+	handler, err := ChangesHandler(db.(sqlite.ChangesDatabase))
+
+	if err != nil {
+		t.Fatalf("Failed to create changes handler, %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/changes?since=0", nil)
+	rsp := httptest.NewRecorder()
+
+	handler.ServeHTTP(rsp, req)
+
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", rsp.Code)
+	}
+
+	changes := make([]*sqlite.Change, 0)
+
+	scanner := bufio.NewScanner(rsp.Body)
+
+	for scanner.Scan() {
+
+		var c *sqlite.Change
+
+		err := json.Unmarshal(scanner.Bytes(), &c)
+
+		if err != nil {
+			t.Fatalf("Failed to unmarshal change, %v", err)
+		}
+
+		changes = append(changes, c)
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes but got %d", len(changes))
+	}
+
+	last := changes[len(changes)-1]
+
+	if last.Id != 101737491 || !last.Deleted {
+		t.Fatalf("Expected last change to be the removal of 101737491, got %v", last)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/changes", nil)
+	rsp = httptest.NewRecorder()
+
+	handler.ServeHTTP(rsp, req)
+
+	if rsp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected bad request for missing since parameter, got %d", rsp.Code)
+	}
+}
@@ -0,0 +1,32 @@
+// Package testdatabase provides helper methods for creating SQLite spatial databases in tests.
+package testdatabase
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
+)
+
+// Create creates a new SQLite spatial database at 'db_path' containing 'bodies'.
+func Create(t testing.TB, db_path string, bodies ...[]byte) {
+
+	t.Helper()
+
+	ctx := context.Background()
+
+	db, err := sqlite.NewSQLiteSpatialDatabase(ctx, fmt.Sprintf("sqlite://%s?dsn=%s", sqlite.DEFAULT_ENGINE, db_path))
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	err = db.(*sqlite.SQLiteSpatialDatabase).IndexFeatures(ctx, bodies)
+
+	if err != nil {
+		t.Fatalf("Failed to index features, %v", err)
+	}
+}
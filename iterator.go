@@ -0,0 +1,422 @@
+package sqlite
+
+// Implement the whosonfirst/go-whosonfirst-iterate/v3.Iterator interface for records in a spatial database.
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/paulmach/orb"
+	"github.com/whosonfirst/go-ioutil"
+	"github.com/whosonfirst/go-whosonfirst-database/sql/tables"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v3"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v3/filters"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// The scheme used to register the `SpatialDatabaseIterator` implementation.
+const ITERATOR_SCHEME string = "sqlitespatial"
+
+// The existential flag columns in the SPR table which may be used to filter records.
+var iterator_existential_flags = []string{
+	"is_current",
+	"is_deprecated",
+	"is_ceased",
+	"is_superseded",
+	"is_superseding",
+}
+
+func init() {
+
+	ctx := context.Background()
+
+	err := iterate.RegisterIterator(ctx, ITERATOR_SCHEME, NewSpatialDatabaseIterator)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// SpatialDatabaseIterator implements the `whosonfirst/go-whosonfirst-iterate/v3.Iterator` interface for crawling
+// the records in the `geojson` table of one or more SQLite spatial databases.
+type SpatialDatabaseIterator struct {
+	iterate.Iterator
+	// The SQLite database engine used to open sources which are not database URIs.
+	engine string
+	// A boolean flag indicating whether alternate geometries should be included.
+	include_alt_files bool
+	// If greater than zero only records whose last modified time is after this Unix timestamp are included.
+	since int64
+	// If greater than zero only records whose last modified time is before or equal to this Unix timestamp are included.
+	until int64
+	// An optional bounding box that records must intersect.
+	bbox *orb.Bound
+	// Zero or more placetypes that records must match.
+	placetypes []string
+	// Zero or more existential flag values, keyed by SPR column name, that records must match.
+	existential map[string][]int64
+	// filters is a `filters.Filters` instance used to include or exclude specific records from being crawled.
+	filters filters.Filters
+	// seen is the count of documents that have been processed.
+	seen int64
+	// iterating is a boolean value indicating whether records are still being iterated.
+	iterating *atomic.Bool
+}
+
+// NewSpatialDatabaseIterator returns a new `SpatialDatabaseIterator` instance configured by 'uri' in the form of:
+//
+//	sqlitespatial://?{PARAMETERS}
+//
+// Where {PARAMETERS} may be:
+// * `?engine=` The SQLite database engine used to open sources which are not database URIs. Default is `DEFAULT_ENGINE`.
+// * `?include-alt-files=` A boolean value indicating whether alternate geometries should be included. Default is false.
+// * `?since=` Only include records whose last modified time is after this Unix timestamp.
+// * `?until=` Only include records whose last modified time is before or equal to this Unix timestamp.
+// * `?bbox=` A comma-separated bounding box (minx,miny,maxx,maxy) that records must intersect.
+// * `?placetype=` Zero or more placetypes that records must match.
+// * `?is_current=`, `?is_deprecated=`, `?is_ceased=`, `?is_superseded=`, `?is_superseding=` Zero or more existential flag values (-1, 0, 1) that records must match.
+// * `?include=` Zero or more `aaronland/go-json-query` query strings containing rules that must match for a document to be considered for further processing.
+// * `?exclude=` Zero or more `aaronland/go-json-query` query strings containing rules that if matched will prevent a document from being considered for further processing.
+// * `?include_mode=` A valid `aaronland/go-json-query` query mode string for testing inclusion rules.
+// * `?exclude_mode=` A valid `aaronland/go-json-query` query mode string for testing exclusion rules.
+//
+// The bounding box, placetype, existential flag and last modified filters are applied by the database (using the `spr`
+// table) rather than by inspecting each record. Alternate geometries are filtered using the properties of their principal
+// record.
+func NewSpatialDatabaseIterator(ctx context.Context, uri string) (iterate.Iterator, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	f, err := filters.NewQueryFiltersFromQuery(ctx, q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create filters from query, %w", err)
+	}
+
+	it := &SpatialDatabaseIterator{
+		engine:      DEFAULT_ENGINE,
+		placetypes:  q["placetype"],
+		existential: make(map[string][]int64),
+		filters:     f,
+		seen:        int64(0),
+		iterating:   new(atomic.Bool),
+	}
+
+	if q.Has("engine") {
+		it.engine = q.Get("engine")
+	}
+
+	if q.Has("include-alt-files") {
+
+		v, err := strconv.ParseBool(q.Get("include-alt-files"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?include-alt-files= parameter, %w", err)
+		}
+
+		it.include_alt_files = v
+	}
+
+	if q.Has("since") {
+
+		v, err := strconv.ParseInt(q.Get("since"), 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?since= parameter, %w", err)
+		}
+
+		it.since = v
+	}
+
+	if q.Has("until") {
+
+		v, err := strconv.ParseInt(q.Get("until"), 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?until= parameter, %w", err)
+		}
+
+		it.until = v
+	}
+
+	if q.Has("bbox") {
+
+		bbox, err := ParseBoundingBox(q.Get("bbox"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?bbox= parameter, %w", err)
+		}
+
+		it.bbox = bbox
+	}
+
+	for _, col := range iterator_existential_flags {
+
+		for _, str_v := range q[col] {
+
+			v, err := strconv.ParseInt(str_v, 10, 64)
+
+			if err != nil || v < -1 || v > 1 {
+				return nil, fmt.Errorf("Invalid ?%s= parameter, '%s'", col, str_v)
+			}
+
+			it.existential[col] = append(it.existential[col], v)
+		}
+	}
+
+	return it, nil
+}
+
+// Iterate will return an `iter.Seq2[*iterate.Record, error]` for each record in the spatial databases defined by
+// 'uris'. Each URI may be a spatial database URI (for example "sqlite://sqlite3?dsn=ca.db") or a database DSN.
+func (it *SpatialDatabaseIterator) Iterate(ctx context.Context, uris ...string) iter.Seq2[*iterate.Record, error] {
+
+	return func(yield func(*iterate.Record, error) bool) {
+
+		it.iterating.Swap(true)
+		defer it.iterating.Swap(false)
+
+		for _, db_uri := range uris {
+
+			if !it.iterateDatabase(ctx, db_uri, yield) {
+				return
+			}
+		}
+	}
+}
+
+// iterateDatabase yields each record in the spatial database defined by 'db_uri'. It returns false if the
+// iteration should be stopped.
+func (it *SpatialDatabaseIterator) iterateDatabase(ctx context.Context, db_uri string, yield func(*iterate.Record, error) bool) bool {
+
+	ctx, span := tracer.Start(ctx, "iterateDatabase")
+	defer span.End()
+
+	if !strings.HasPrefix(db_uri, "sqlite://") {
+
+		q := url.Values{}
+		q.Set("dsn", db_uri)
+
+		db_uri = fmt.Sprintf("sqlite://%s?%s", it.engine, q.Encode())
+	}
+
+	db, pin, err := openDatabase(ctx, db_uri)
+
+	if err != nil {
+		recordSpanError(span, err)
+		return yield(nil, fmt.Errorf("Failed to open %s, %w", db_uri, err))
+	}
+
+	defer db.Close()
+
+	if pin != nil {
+		defer pin.Close()
+	}
+
+	q, args := it.query()
+
+	rows, err := db.QueryContext(ctx, q, args...)
+
+	if err != nil {
+		recordSpanError(span, err)
+		return yield(nil, fmt.Errorf("Failed to query records, %w", err))
+	}
+
+	defer rows.Close()
+
+	count := 0
+
+	for rows.Next() {
+
+		var id int64
+		var alt_label string
+		var body string
+
+		err := rows.Scan(&id, &alt_label, &body)
+
+		if err != nil {
+			recordSpanError(span, err)
+			return yield(nil, fmt.Errorf("Failed to scan record, %w", err))
+		}
+
+		atomic.AddInt64(&it.seen, 1)
+
+		uri_args := uri.NewDefaultURIArgs()
+
+		if alt_label != "" {
+
+			alt_args, err := uri.NewAlternateURIArgsFromAltLabel(alt_label)
+
+			if err != nil {
+
+				if !yield(nil, fmt.Errorf("Failed to derive URI args for %d (%s), %w", id, alt_label, err)) {
+					return false
+				}
+
+				continue
+			}
+
+			uri_args = alt_args
+		}
+
+		path, err := uri.Id2RelPath(id, uri_args)
+
+		if err != nil {
+
+			if !yield(nil, fmt.Errorf("Failed to derive path for %d, %w", id, err)) {
+				return false
+			}
+
+			continue
+		}
+
+		rsc, err := ioutil.NewReadSeekCloser(strings.NewReader(body))
+
+		if err != nil {
+
+			if !yield(nil, fmt.Errorf("Failed to create new ReadSeekCloser for '%s', %w", path, err)) {
+				return false
+			}
+
+			continue
+		}
+
+		if it.filters != nil {
+
+			ok, err := iterate.ApplyFilters(ctx, rsc, it.filters)
+
+			if err != nil {
+
+				rsc.Close()
+
+				if !yield(nil, fmt.Errorf("Failed to apply filters for '%s', %w", path, err)) {
+					return false
+				}
+
+				continue
+			}
+
+			if !ok {
+				rsc.Close()
+				continue
+			}
+		}
+
+		count += 1
+
+		if !yield(iterate.NewRecord(path, rsc), nil) {
+			return false
+		}
+	}
+
+	span.SetAttributes(attribute.Int("count", count))
+
+	err = rows.Err()
+
+	if err != nil {
+		recordSpanError(span, err)
+		return yield(nil, fmt.Errorf("Failed to iterate records, %w", err))
+	}
+
+	return true
+}
+
+// query returns the SQL query (and its arguments) for selecting the records matching the filters defined by 'it'.
+func (it *SpatialDatabaseIterator) query() (string, []any) {
+
+	conditions := make([]string, 0)
+	args := make([]any, 0)
+
+	if !it.include_alt_files {
+		conditions = append(conditions, "(g.alt_label = '' OR g.alt_label IS NULL)")
+	}
+
+	if it.since > 0 {
+		conditions = append(conditions, "g.lastmodified > ?")
+		args = append(args, it.since)
+	}
+
+	if it.until > 0 {
+		conditions = append(conditions, "g.lastmodified <= ?")
+		args = append(args, it.until)
+	}
+
+	use_spr := len(it.placetypes) > 0 || it.bbox != nil
+
+	if it.bbox != nil {
+		conditions = append(conditions, "s.max_longitude >= ? AND s.min_longitude <= ? AND s.max_latitude >= ? AND s.min_latitude <= ?")
+		args = append(args, it.bbox.Min.X(), it.bbox.Max.X(), it.bbox.Min.Y(), it.bbox.Max.Y())
+	}
+
+	if len(it.placetypes) > 0 {
+		conditions = append(conditions, fmt.Sprintf("s.placetype IN (%s)", placeholders(len(it.placetypes))))
+
+		for _, pt := range it.placetypes {
+			args = append(args, pt)
+		}
+	}
+
+	for _, col := range iterator_existential_flags {
+
+		values, ok := it.existential[col]
+
+		if !ok {
+			continue
+		}
+
+		use_spr = true
+
+		conditions = append(conditions, fmt.Sprintf("s.%s IN (%s)", col, placeholders(len(values))))
+
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+
+	q := fmt.Sprintf("SELECT g.id, COALESCE(g.alt_label, ''), g.body FROM %s g", tables.GEOJSON_TABLE_NAME)
+
+	if use_spr {
+		// The 'id' column in the spr table is a string
+		q = fmt.Sprintf("%s JOIN %s s ON s.id = CAST(g.id AS TEXT) AND s.is_alt = 0", q, tables.SPR_TABLE_NAME)
+	}
+
+	if len(conditions) > 0 {
+		q = fmt.Sprintf("%s WHERE %s", q, strings.Join(conditions, " AND "))
+	}
+
+	q = fmt.Sprintf("%s ORDER BY g.id ASC, g.alt_label ASC", q)
+
+	return q, args
+}
+
+// Seen returns the total number of records processed so far.
+func (it *SpatialDatabaseIterator) Seen() int64 {
+	return atomic.LoadInt64(&it.seen)
+}
+
+// IsIterating returns a boolean value indicating whether 'it' is still processing documents.
+func (it *SpatialDatabaseIterator) IsIterating() bool {
+	return it.iterating.Load()
+}
+
+// Close performs any implementation specific tasks before terminating the iterator.
+func (it *SpatialDatabaseIterator) Close() error {
+	return nil
+}
+
+// placeholders returns a comma-separated list of 'count' SQL placeholders.
+func placeholders(count int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", count), ",")
+}
@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-iterate/v3"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+func TestSpatialDatabaseIterator(t *testing.T) {
+
+	ctx := context.Background()
+
+	db_path := filepath.Join(t.TempDir(), "iterate.db")
+
+	db, err := NewSQLiteSpatialDatabase(ctx, fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, db_path))
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	for _, path := range []string{"fixtures/101737491.geojson", "fixtures/1360521545.geojson"} {
+
+		body, err := os.ReadFile(path)
+
+		if err != nil {
+			t.Fatalf("Failed to read %s, %v", path, err)
+		}
+
+		err = db.IndexFeature(ctx, body)
+
+		if err != nil {
+			t.Fatalf("Failed to index %s, %v", path, err)
+		}
+	}
+
+	err = db.Close(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to close database, %v", err)
+	}
+
+	tests := map[string][]int64{
+		"sqlitespatial://?_with_stats=false":                                 {101737491, 1360521545},
+		"sqlitespatial://?_with_stats=false&placetype=wing":                  {1360521545},
+		"sqlitespatial://?_with_stats=false&is_current=1":                    {101737491},
+		"sqlitespatial://?_with_stats=false&placetype=locality&is_current=0": {},
+		"sqlitespatial://?_with_stats=false&bbox=-122.4,37.6,-122.3,37.7":    {1360521545},
+		"sqlitespatial://?_with_stats=false&since=1700000000":                {1360521545},
+		"sqlitespatial://?_with_stats=false&until=1700000000":                {101737491},
+	}
+
+	for iterator_uri, expected := range tests {
+
+		it, err := iterate.NewIterator(ctx, iterator_uri)
+
+		if err != nil {
+			t.Fatalf("Failed to create iterator for %s, %v", iterator_uri, err)
+		}
+
+		ids := make([]int64, 0)
+
+		for rec, err := range it.Iterate(ctx, db_path) {
+
+			if err != nil {
+				t.Fatalf("Failed to iterate %s, %v", iterator_uri, err)
+			}
+
+			id, _, err := uri.ParseURI(rec.Path)
+
+			if err != nil {
+				t.Fatalf("Failed to parse path %s, %v", rec.Path, err)
+			}
+
+			_, err = io.ReadAll(rec.Body)
+
+			if err != nil {
+				t.Fatalf("Failed to read body for %s, %v", rec.Path, err)
+			}
+
+			rec.Body.Close()
+			ids = append(ids, id)
+		}
+
+		slices.Sort(ids)
+
+		if !slices.Equal(ids, expected) {
+			t.Fatalf("Unexpected results for %s, expected %v but got %v", iterator_uri, expected, ids)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package sqlite
+
+// Operational metrics for SQLiteSpatialDatabase instances, rendered in the Prometheus text exposition format.
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+)
+
+const (
+	metricQueriesTotal       string = "whosonfirst_spatial_sqlite_queries_total"
+	metricQueryDuration      string = "whosonfirst_spatial_sqlite_query_duration_seconds"
+	metricQueryCandidates    string = "whosonfirst_spatial_sqlite_query_candidates"
+	metricReadsTotal         string = "whosonfirst_spatial_sqlite_reads_total"
+	metricReadDuration       string = "whosonfirst_spatial_sqlite_read_duration_seconds"
+	metricWritesTotal        string = "whosonfirst_spatial_sqlite_writes_total"
+	metricWriteDuration      string = "whosonfirst_spatial_sqlite_write_duration_seconds"
+	metricCacheHitsTotal     string = "whosonfirst_spatial_sqlite_cache_hits_total"
+	metricCacheMissesTotal   string = "whosonfirst_spatial_sqlite_cache_misses_total"
+	metricCacheEvictionTotal string = "whosonfirst_spatial_sqlite_cache_evictions_total"
+	metricErrorsTotal        string = "whosonfirst_spatial_sqlite_errors_total"
+	metricReloadsTotal       string = "whosonfirst_spatial_sqlite_reloads_total"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, used for latency histograms.
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultCountBuckets are the upper bounds used for histograms that record the number of things (like rtree candidates).
+var DefaultCountBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500}
+
+var metricsHelp = map[string]string{
+	metricQueriesTotal:       "The total number of spatial queries performed.",
+	metricQueryDuration:      "The time to perform a spatial query, in seconds.",
+	metricQueryCandidates:    "The number of rtree candidates considered for a spatial query.",
+	metricReadsTotal:         "The total number of records read from the geojson table.",
+	metricReadDuration:       "The time to read a record from the geojson table, in seconds.",
+	metricWritesTotal:        "The total number of records indexed or removed.",
+	metricWriteDuration:      "The time to index or remove a record, in seconds.",
+	metricCacheHitsTotal:     "The total number of SPR cache hits.",
+	metricCacheMissesTotal:   "The total number of SPR cache misses.",
+	metricCacheEvictionTotal: "The total number of SPR cache evictions.",
+	metricErrorsTotal:        "The total number of errors returned by the underlying SQLite database.",
+	metricReloadsTotal:       "The total number of times the underlying SQLite database has been reloaded.",
+}
+
+// DefaultMetrics is the `Metrics` instance shared by all `SQLiteSpatialDatabase` instances in an application. It is
+// what `MetricsHandler` renders.
+var DefaultMetrics = NewMetrics()
+
+// Metrics is a struct for recording counters and histograms for the operations performed by one or more
+// `SQLiteSpatialDatabase` instances.
+type Metrics struct {
+	mu         *sync.Mutex
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*metricsHistogram
+}
+
+type metricsHistogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *metricsHistogram) observe(v float64) {
+
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i] += 1
+		}
+	}
+
+	h.sum += v
+	h.count += 1
+}
+
+// NewMetrics returns a new (and empty) `Metrics` instance.
+func NewMetrics() *Metrics {
+
+	m := &Metrics{
+		mu:         new(sync.Mutex),
+		counters:   make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*metricsHistogram),
+	}
+
+	return m
+}
+
+// Add increments the counter 'name' (with labels 'labels') by 'v'. Labels are expected to be key, value pairs.
+func (m *Metrics) Add(name string, v float64, labels ...string) {
+
+	k := metricsLabels(labels...)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.counters[name]
+
+	if !ok {
+		series = make(map[string]float64)
+		m.counters[name] = series
+	}
+
+	series[k] += v
+}
+
+// Observe records 'v' in the histogram 'name' (with labels 'labels') using 'buckets'. Labels are expected to be
+// key, value pairs.
+func (m *Metrics) Observe(name string, buckets []float64, v float64, labels ...string) {
+
+	k := metricsLabels(labels...)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.histograms[name]
+
+	if !ok {
+		series = make(map[string]*metricsHistogram)
+		m.histograms[name] = series
+	}
+
+	h, ok := series[k]
+
+	if !ok {
+
+		h = &metricsHistogram{
+			buckets: buckets,
+			counts:  make([]uint64, len(buckets)),
+		}
+
+		series[k] = h
+	}
+
+	h.observe(v)
+}
+
+// Since records the time elapsed since 't1', in seconds, in the latency histogram 'name'.
+func (m *Metrics) Since(name string, t1 time.Time, labels ...string) {
+	m.Observe(name, DefaultLatencyBuckets, time.Since(t1).Seconds(), labels...)
+}
+
+// WritePrometheus writes all the counters and histograms in 'm' to 'wr' using the Prometheus text exposition format.
+func (m *Metrics) WritePrometheus(wr io.Writer) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter_names := make([]string, 0, len(m.counters))
+
+	for name, _ := range m.counters {
+		counter_names = append(counter_names, name)
+	}
+
+	sort.Strings(counter_names)
+
+	for _, name := range counter_names {
+
+		err := writeMetricsHeader(wr, name, "counter")
+
+		if err != nil {
+			return err
+		}
+
+		series := m.counters[name]
+
+		for _, k := range sortedKeys(series) {
+
+			_, err := fmt.Fprintf(wr, "%s%s %s\n", name, k, formatMetricsValue(series[k]))
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	histogram_names := make([]string, 0, len(m.histograms))
+
+	for name, _ := range m.histograms {
+		histogram_names = append(histogram_names, name)
+	}
+
+	sort.Strings(histogram_names)
+
+	for _, name := range histogram_names {
+
+		err := writeMetricsHeader(wr, name, "histogram")
+
+		if err != nil {
+			return err
+		}
+
+		series := m.histograms[name]
+
+		for _, k := range sortedKeys(series) {
+
+			h := series[k]
+
+			for i, le := range h.buckets {
+
+				_, err := fmt.Fprintf(wr, "%s_bucket%s %d\n", name, appendMetricsLabel(k, "le", formatMetricsValue(le)), h.counts[i])
+
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err := fmt.Fprintf(wr, "%s_bucket%s %d\n", name, appendMetricsLabel(k, "le", "+Inf"), h.count)
+
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintf(wr, "%s_sum%s %s\n", name, k, formatMetricsValue(h.sum))
+
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintf(wr, "%s_count%s %d\n", name, k, h.count)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Metrics returns the `Metrics` instance that 'r' records operations to.
+func (r *SQLiteSpatialDatabase) Metrics() *Metrics {
+	return r.metrics
+}
+
+// MetricsHandler returns a `http.Handler` instance that renders 'DefaultMetrics' in the Prometheus text exposition format.
+func MetricsHandler() http.Handler {
+	return MetricsHandlerWithMetrics(DefaultMetrics)
+}
+
+// MetricsHandlerWithMetrics returns a `http.Handler` instance that renders 'm' in the Prometheus text exposition format.
+func MetricsHandlerWithMetrics(m *Metrics) http.Handler {
+
+	fn := func(rsp http.ResponseWriter, req *http.Request) {
+
+		rsp.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		err := m.WritePrometheus(rsp)
+
+		if err != nil {
+			http.Error(rsp, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// metricsPlacetypes returns a comma-separated list of the placetypes defined by 'filters' suitable for use as a
+// metrics label. If 'filters' do not define any placetypes then "*" is returned.
+func metricsPlacetypes(filters ...spatial.Filter) string {
+
+	pt := make([]string, 0)
+
+	for _, f := range filters {
+
+		spr_f, ok := f.(*filter.SPRFilter)
+
+		if !ok {
+			continue
+		}
+
+		for _, p := range spr_f.Placetypes {
+			pt = append(pt, p.Placetype())
+		}
+	}
+
+	if len(pt) == 0 {
+		return "*"
+	}
+
+	sort.Strings(pt)
+	return strings.Join(pt, ",")
+}
+
+func writeMetricsHeader(wr io.Writer, name string, metric_type string) error {
+
+	help, ok := metricsHelp[name]
+
+	if ok {
+
+		_, err := fmt.Fprintf(wr, "# HELP %s %s\n", name, help)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(wr, "# TYPE %s %s\n", name, metric_type)
+	return err
+}
+
+func metricsLabels(labels ...string) string {
+
+	if len(labels) < 2 {
+		return ""
+	}
+
+	pairs := make([]string, 0)
+
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], escapeMetricsLabel(labels[i+1])))
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ","))
+}
+
+func appendMetricsLabel(k string, name string, value string) string {
+
+	l := fmt.Sprintf("%s=\"%s\"", name, escapeMetricsLabel(value))
+
+	if k == "" {
+		return fmt.Sprintf("{%s}", l)
+	}
+
+	return fmt.Sprintf("%s,%s}", strings.TrimSuffix(k, "}"), l)
+}
+
+func escapeMetricsLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return v
+}
+
+func formatMetricsValue(v float64) string {
+
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+
+	keys := make([]string, 0, len(m))
+
+	for k, _ := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,167 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+)
+
+func TestMetrics(t *testing.T) {
+
+	m := NewMetrics()
+
+	m.Add(metricQueriesTotal, 1, "query", "pip", "placetype", "wing")
+	m.Add(metricQueriesTotal, 2, "query", "pip", "placetype", "wing")
+	m.Observe(metricQueryDuration, DefaultLatencyBuckets, 0.02, "query", "pip", "placetype", "wing")
+
+	var buf bytes.Buffer
+
+	err := m.WritePrometheus(&buf)
+
+	if err != nil {
+		t.Fatalf("Failed to write metrics, %v", err)
+	}
+
+	str_metrics := buf.String()
+
+	expected := []string{
+		"# TYPE whosonfirst_spatial_sqlite_queries_total counter",
+		`whosonfirst_spatial_sqlite_queries_total{query="pip",placetype="wing"} 3`,
+		"# TYPE whosonfirst_spatial_sqlite_query_duration_seconds histogram",
+		`whosonfirst_spatial_sqlite_query_duration_seconds_bucket{query="pip",placetype="wing",le="0.01"} 0`,
+		`whosonfirst_spatial_sqlite_query_duration_seconds_bucket{query="pip",placetype="wing",le="0.025"} 1`,
+		`whosonfirst_spatial_sqlite_query_duration_seconds_bucket{query="pip",placetype="wing",le="+Inf"} 1`,
+		`whosonfirst_spatial_sqlite_query_duration_seconds_count{query="pip",placetype="wing"} 1`,
+	}
+
+	for _, str := range expected {
+
+		if !strings.Contains(str_metrics, str) {
+			t.Fatalf("Metrics missing '%s'\n%s", str, str_metrics)
+		}
+	}
+}
+
+func TestDatabaseMetrics(t *testing.T) {
+
+	ctx := context.Background()
+
+	database_uri := "sqlite://" + DEFAULT_ENGINE + "?dsn=:memory:"
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	body, err := os.ReadFile("fixtures/101737491.geojson")
+
+	if err != nil {
+		t.Fatalf("Failed to read fixture, %v", err)
+	}
+
+	err = db.IndexFeature(ctx, body)
+
+	if err != nil {
+		t.Fatalf("Failed to index fixture, %v", err)
+	}
+
+	c, err := geo.NewCoordinate(-71.330873, 46.852675)
+
+	if err != nil {
+		t.Fatalf("Failed to create new coordinate, %v", err)
+	}
+
+	_, err = db.PointInPolygon(ctx, c)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query, %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	err = db.(*SQLiteSpatialDatabase).Metrics().WritePrometheus(&buf)
+
+	if err != nil {
+		t.Fatalf("Failed to write metrics, %v", err)
+	}
+
+	str_metrics := buf.String()
+
+	for _, str := range []string{
+		`whosonfirst_spatial_sqlite_queries_total{query="pip",placetype="*"}`,
+		`whosonfirst_spatial_sqlite_writes_total{operation="index"}`,
+		`whosonfirst_spatial_sqlite_cache_misses_total`,
+	} {
+
+		if !strings.Contains(str_metrics, str) {
+			t.Fatalf("Metrics missing '%s'\n%s", str, str_metrics)
+		}
+	}
+}
+
+func TestCacheEvictionMetrics(t *testing.T) {
+
+	ctx := context.Background()
+
+	db_path := filepath.Join(t.TempDir(), "evictions.db")
+
+	createReloadDatabase(t, db_path, 101737491)
+
+	db, err := database.NewSpatialDatabase(ctx, fmt.Sprintf("sqlite://%s?dsn=%s", DEFAULT_ENGINE, db_path))
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	c, err := geo.NewCoordinate(-71.330873, 46.852675)
+
+	if err != nil {
+		t.Fatalf("Failed to create new coordinate, %v", err)
+	}
+
+	_, err = db.PointInPolygon(ctx, c)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query, %v", err)
+	}
+
+	evictions := func() float64 {
+
+		m := sqlite_db.Metrics()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		return m.counters[metricCacheEvictionTotal][""]
+	}
+
+	before := evictions()
+
+	// Reloading the database flushes the SPR cache for the previous connection
+
+	err = sqlite_db.Reload(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to reload database, %v", err)
+	}
+
+	after := evictions()
+
+	if after <= before {
+		t.Fatalf("Expected cache evictions to increase after reload, got %f (was %f)", after, before)
+	}
+}
@@ -0,0 +1,432 @@
+package sqlite
+
+// Slow query logging for point-in-polygon and intersects queries. Slow queries are written as line-delimited
+// JSON records which can be re-run against a database using the `cmd/replay` tool.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/whosonfirst/go-whosonfirst-flags"
+	"github.com/whosonfirst/go-whosonfirst-flags/date"
+	"github.com/whosonfirst/go-whosonfirst-flags/existential"
+	"github.com/whosonfirst/go-whosonfirst-flags/geometry"
+	"github.com/whosonfirst/go-whosonfirst-flags/placetypes"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+)
+
+// The default maximum size, in bytes, of a slow query log file before it is rotated.
+const DEFAULT_SLOW_QUERY_LOG_MAX_SIZE int64 = 10 * 1024 * 1024
+
+// The default number of rotated slow query log files to keep.
+const DEFAULT_SLOW_QUERY_LOG_MAX_BACKUPS int = 5
+
+// SlowQuery is a struct describing a point-in-polygon or intersects query whose duration exceeded the slow
+// query threshold for a `SQLiteSpatialDatabase` instance.
+type SlowQuery struct {
+	// The time the query was started.
+	Time time.Time `json:"time"`
+	// The type of query. Valid options are: pip, intersects.
+	Query string `json:"query"`
+	// The coordinate (encoded as a Point) or geometry being queried.
+	Geometry *geojson.Geometry `json:"geometry"`
+	// The filters applied to the query.
+	Filters []*filter.SPRInputs `json:"filters,omitempty"`
+	// The number of rtree candidates considered for the query.
+	Candidates int `json:"candidates"`
+	// The number of results returned by the query.
+	Results int64 `json:"results"`
+	// Timings for the query.
+	Timings *SlowQueryTimings `json:"timings"`
+}
+
+// SlowQueryTimings is a struct containing timings (in nanoseconds) for the stages of a slow query.
+type SlowQueryTimings struct {
+	// The time to query the rtree table for candidates.
+	Candidates time.Duration `json:"candidates"`
+	// The total time to perform the query.
+	Total time.Duration `json:"total"`
+}
+
+// SPRFilters returns the list of `spatial.Filter` instances derived from the filters recorded for 'q'.
+func (q *SlowQuery) SPRFilters() ([]spatial.Filter, error) {
+
+	filters := make([]spatial.Filter, len(q.Filters))
+
+	for idx, inputs := range q.Filters {
+
+		f, err := filter.NewSPRFilterFromInputs(inputs)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create filter at offset %d, %w", idx, err)
+		}
+
+		filters[idx] = f
+	}
+
+	return filters, nil
+}
+
+// slowQueryLog is a struct for writing `SlowQuery` records to a line-delimited JSON file that is rotated once it
+// exceeds a maximum size.
+type slowQueryLog struct {
+	mu          *sync.Mutex
+	path        string
+	max_size    int64
+	max_backups int
+	fh          *os.File
+	size        int64
+	// A boolean flag indicating whether the log has been closed. A log may be shared by multiple databases
+	// (for example the databases in a `SQLiteMultiSpatialDatabase` instance) each of which will close it.
+	closed bool
+}
+
+func newSlowQueryLog(path string, max_size int64, max_backups int) (*slowQueryLog, error) {
+
+	l := &slowQueryLog{
+		mu:          new(sync.Mutex),
+		path:        path,
+		max_size:    max_size,
+		max_backups: max_backups,
+	}
+
+	err := l.open()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *slowQueryLog) open() error {
+
+	fh, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+
+	if err != nil {
+		return fmt.Errorf("Failed to open %s, %w", l.path, err)
+	}
+
+	info, err := fh.Stat()
+
+	if err != nil {
+		fh.Close()
+		return fmt.Errorf("Failed to stat %s, %w", l.path, err)
+	}
+
+	l.fh = fh
+	l.size = info.Size()
+
+	return nil
+}
+
+func (l *slowQueryLog) Write(q *SlowQuery) error {
+
+	enc, err := json.Marshal(q)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal slow query, %w", err)
+	}
+
+	enc = append(enc, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return fmt.Errorf("Slow query log has been closed")
+	}
+
+	if l.max_size > 0 && l.size+int64(len(enc)) > l.max_size && l.size > 0 {
+
+		err := l.rotate()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := l.fh.Write(enc)
+
+	l.size += int64(n)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write slow query, %w", err)
+	}
+
+	return nil
+}
+
+// rotate closes the current log file and renames it (and any previous backups) such that "{path}.1" is the most
+// recent backup. Backups beyond 'max_backups' are removed.
+func (l *slowQueryLog) rotate() error {
+
+	err := l.fh.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to close %s, %w", l.path, err)
+	}
+
+	for i := l.max_backups; i > 0; i-- {
+
+		src := l.path
+
+		if i > 1 {
+			src = fmt.Sprintf("%s.%d", l.path, i-1)
+		}
+
+		dest := fmt.Sprintf("%s.%d", l.path, i)
+
+		_, err := os.Stat(src)
+
+		if err != nil {
+			continue
+		}
+
+		err = os.Rename(src, dest)
+
+		if err != nil {
+			return fmt.Errorf("Failed to rename %s, %w", src, err)
+		}
+	}
+
+	if l.max_backups <= 0 {
+
+		err := os.Remove(l.path)
+
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to remove %s, %w", l.path, err)
+		}
+	}
+
+	return l.open()
+}
+
+func (l *slowQueryLog) Close() error {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil
+	}
+
+	l.closed = true
+	return l.fh.Close()
+}
+
+// isSlowQuery returns a boolean value indicating whether the time elapsed since 't1' exceeds the slow query
+// threshold for 'db'.
+func (db *SQLiteSpatialDatabase) isSlowQuery(t1 time.Time) bool {
+	return db.slow_query_threshold > 0 && time.Since(t1) >= db.slow_query_threshold
+}
+
+// logSlowQuery writes 'q' to the slow query log for 'db' if its total duration exceeds the slow query threshold.
+func (db *SQLiteSpatialDatabase) logSlowQuery(ctx context.Context, q *SlowQuery) {
+
+	if db.slow_query_threshold <= 0 || q.Timings.Total < db.slow_query_threshold {
+		return
+	}
+
+	if db.slow_query_log == nil {
+		slog.Warn("Slow query", "query", q.Query, "candidates", q.Candidates, "results", q.Results, "time", q.Timings.Total)
+		return
+	}
+
+	err := db.slow_query_log.Write(q)
+
+	if err != nil {
+		slog.Error("Failed to write slow query", "error", err)
+	}
+}
+
+// newSlowQuery returns a new `SlowQuery` instance for 'geom' and 'filters'.
+func newSlowQuery(query string, t1 time.Time, geom orb.Geometry, filters ...spatial.Filter) *SlowQuery {
+
+	q := &SlowQuery{
+		Time:     t1,
+		Query:    query,
+		Geometry: geojson.NewGeometry(geom),
+		Filters:  slowQueryFilters(filters...),
+		Timings:  &SlowQueryTimings{},
+	}
+
+	return q
+}
+
+// slowQueryFilters derives `filter.SPRInputs` instances for 'filters' so they can be serialized. Filters that are
+// not `filter.SPRFilter` instances are skipped.
+func slowQueryFilters(filters ...spatial.Filter) []*filter.SPRInputs {
+
+	inputs := make([]*filter.SPRInputs, 0)
+
+	for _, f := range filters {
+
+		spr_f, ok := f.(*filter.SPRFilter)
+
+		if !ok {
+			continue
+		}
+
+		i, _ := filter.NewSPRInputs()
+
+		for _, fl := range spr_f.Placetypes {
+
+			_, is_null := fl.(*placetypes.NullFlag)
+
+			if !is_null {
+				i.Placetypes = append(i.Placetypes, fl.Placetype())
+			}
+		}
+
+		i.IsCurrent = slowQueryExistentialFlags(spr_f.Current)
+		i.IsDeprecated = slowQueryExistentialFlags(spr_f.Deprecated)
+		i.IsCeased = slowQueryExistentialFlags(spr_f.Ceased)
+		i.IsSuperseded = slowQueryExistentialFlags(spr_f.Superseded)
+		i.IsSuperseding = slowQueryExistentialFlags(spr_f.Superseding)
+
+		if spr_f.AlternateGeometry != nil {
+
+			_, is_null := spr_f.AlternateGeometry.(*geometry.NullAlternateGeometryFlag)
+
+			if !is_null {
+
+				if spr_f.AlternateGeometry.IsAlternateGeometry() {
+					i.Geometries = []string{"alt"}
+				} else {
+					i.Geometries = []string{"default"}
+				}
+			}
+		}
+
+		for _, fl := range spr_f.AlternateGeometries {
+
+			_, is_null := fl.(*geometry.NullAlternateGeometryFlag)
+
+			if !is_null {
+				i.AlternateGeometries = append(i.AlternateGeometries, fl.Label())
+			}
+		}
+
+		if spr_f.InceptionDate != nil {
+
+			_, is_null := spr_f.InceptionDate.(*date.NullDateFlag)
+
+			if !is_null {
+				i.InceptionDate = spr_f.InceptionDate.String()
+			}
+		}
+
+		if spr_f.CessationDate != nil {
+
+			_, is_null := spr_f.CessationDate.(*date.NullDateFlag)
+
+			if !is_null {
+				i.CessationDate = spr_f.CessationDate.String()
+			}
+		}
+
+		inputs = append(inputs, i)
+	}
+
+	return inputs
+}
+
+func slowQueryExistentialFlags(fl []flags.ExistentialFlag) []int64 {
+
+	values := make([]int64, 0)
+
+	for _, e := range fl {
+
+		_, is_null := e.(*existential.NullFlag)
+
+		if !is_null {
+			values = append(values, e.Flag())
+		}
+	}
+
+	return values
+}
+
+// parseSlowQueryOptions assigns slow query settings derived from the query parameters 'q' to 'db'.
+func parseSlowQueryOptions(db *SQLiteSpatialDatabase, q url.Values) error {
+
+	str_threshold := q.Get("slow-query-threshold")
+
+	if str_threshold == "" {
+		return nil
+	}
+
+	threshold, err := time.ParseDuration(str_threshold)
+
+	if err != nil {
+		return fmt.Errorf("Invalid ?slow-query-threshold= parameter, %w", err)
+	}
+
+	db.slow_query_threshold = threshold
+
+	l, err := parseSlowQueryLog(q)
+
+	if err != nil {
+		return err
+	}
+
+	db.slow_query_log = l
+	return nil
+}
+
+// parseSlowQueryLog returns a new `slowQueryLog` instance derived from the query parameters 'q' or nil if no
+// slow query log is defined.
+func parseSlowQueryLog(q url.Values) (*slowQueryLog, error) {
+
+	log_path := q.Get("slow-query-log")
+	str_max_size := q.Get("slow-query-log-max-size")
+	str_max_backups := q.Get("slow-query-log-max-backups")
+
+	if log_path == "" {
+		return nil, nil
+	}
+
+	max_size := DEFAULT_SLOW_QUERY_LOG_MAX_SIZE
+	max_backups := DEFAULT_SLOW_QUERY_LOG_MAX_BACKUPS
+
+	if str_max_size != "" {
+
+		v, err := strconv.ParseInt(str_max_size, 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?slow-query-log-max-size= parameter, %w", err)
+		}
+
+		max_size = v
+	}
+
+	if str_max_backups != "" {
+
+		v, err := strconv.Atoi(str_max_backups)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?slow-query-log-max-backups= parameter, %w", err)
+		}
+
+		max_backups = v
+	}
+
+	l, err := newSlowQueryLog(log_path, max_size, max_backups)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create slow query log, %w", err)
+	}
+
+	return l, nil
+}
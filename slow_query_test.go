@@ -0,0 +1,279 @@
+package sqlite
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+)
+
+func TestSlowQueryLog(t *testing.T) {
+
+	ctx := context.Background()
+
+	log_path := filepath.Join(t.TempDir(), "slow.jsonl")
+
+	database_uri := fmt.Sprintf("sqlite://%s?dsn=:memory:&slow-query-threshold=1ns&slow-query-log=%s", DEFAULT_ENGINE, log_path)
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	defer db.Close(ctx)
+
+	body, err := os.ReadFile("fixtures/101737491.geojson")
+
+	if err != nil {
+		t.Fatalf("Failed to read fixture, %v", err)
+	}
+
+	err = db.IndexFeature(ctx, body)
+
+	if err != nil {
+		t.Fatalf("Failed to index fixture, %v", err)
+	}
+
+	c, err := geo.NewCoordinate(-71.330873, 46.852675)
+
+	if err != nil {
+		t.Fatalf("Failed to create new coordinate, %v", err)
+	}
+
+	i, err := filter.NewSPRInputs()
+
+	if err != nil {
+		t.Fatalf("Failed to create SPR inputs, %v", err)
+	}
+
+	i.IsCurrent = []int64{1}
+	i.Placetypes = []string{"locality"}
+
+	f, err := filter.NewSPRFilterFromInputs(i)
+
+	if err != nil {
+		t.Fatalf("Failed to create SPR filter from inputs, %v", err)
+	}
+
+	_, err = db.PointInPolygon(ctx, c, f)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query, %v", err)
+	}
+
+	fh, err := os.Open(log_path)
+
+	if err != nil {
+		t.Fatalf("Failed to open slow query log, %v", err)
+	}
+
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+
+	if !scanner.Scan() {
+		t.Fatalf("Slow query log is empty")
+	}
+
+	var q *SlowQuery
+
+	err = json.Unmarshal(scanner.Bytes(), &q)
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal slow query, %v", err)
+	}
+
+	if q.Query != "pip" {
+		t.Fatalf("Unexpected query type '%s'", q.Query)
+	}
+
+	if q.Candidates != 1 {
+		t.Fatalf("Expected 1 candidate, got %d", q.Candidates)
+	}
+
+	if len(q.Filters) != 1 || len(q.Filters[0].Placetypes) != 1 || q.Filters[0].Placetypes[0] != "locality" {
+		t.Fatalf("Unexpected filters, %v", q.Filters)
+	}
+
+	if len(q.Filters[0].IsCurrent) != 1 || q.Filters[0].IsCurrent[0] != 1 {
+		t.Fatalf("Unexpected is current filter, %v", q.Filters[0].IsCurrent)
+	}
+
+	_, err = q.SPRFilters()
+
+	if err != nil {
+		t.Fatalf("Failed to derive filters from slow query, %v", err)
+	}
+}
+
+func TestSlowQueryLogRotation(t *testing.T) {
+
+	log_path := filepath.Join(t.TempDir(), "slow.jsonl")
+
+	l, err := newSlowQueryLog(log_path, 10, 2)
+
+	if err != nil {
+		t.Fatalf("Failed to create slow query log, %v", err)
+	}
+
+	defer l.Close()
+
+	for i := 0; i < 4; i++ {
+
+		err := l.Write(&SlowQuery{Query: "pip", Timings: &SlowQueryTimings{}})
+
+		if err != nil {
+			t.Fatalf("Failed to write slow query, %v", err)
+		}
+	}
+
+	for _, path := range []string{log_path, log_path + ".1", log_path + ".2"} {
+
+		_, err := os.Stat(path)
+
+		if err != nil {
+			t.Fatalf("Expected %s to exist, %v", path, err)
+		}
+	}
+
+	_, err = os.Stat(log_path + ".3")
+
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected %s.3 to not exist", log_path)
+	}
+}
+
+func TestSlowQueryLogInvalidOptions(t *testing.T) {
+
+	ctx := context.Background()
+
+	log_path := filepath.Join(t.TempDir(), "slow.jsonl")
+
+	newDatabase := func(param string) {
+
+		database_uri := fmt.Sprintf("sqlite://%s?dsn=:memory:&slow-query-threshold=1ns&slow-query-log=%s&%s", DEFAULT_ENGINE, log_path, param)
+
+		_, err := NewSQLiteSpatialDatabase(ctx, database_uri)
+
+		if err == nil {
+			t.Fatalf("Expected %s to fail", param)
+		}
+	}
+
+	// The slow query log is not opened if other options are invalid
+
+	newDatabase("rtree-index=bogus")
+
+	_, err := os.Stat(log_path)
+
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected slow query log not to be created")
+	}
+
+	// The slow query log is closed if the reload options are invalid
+
+	newDatabase("watch=true&watch-delay=bogus")
+	newDatabase("reload-on-sighup=bogus")
+
+	fds, err := os.ReadDir("/proc/self/fd")
+
+	if err != nil {
+		t.Skipf("Unable to list open files, %v", err)
+	}
+
+	for _, fd := range fds {
+
+		path, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name()))
+
+		if err == nil && path == log_path {
+			t.Fatalf("Expected slow query log to be closed")
+		}
+	}
+}
+
+func TestSlowQueryLogMulti(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	log_path := filepath.Join(root, "slow.jsonl")
+
+	a_path := filepath.Join(root, "a.db")
+	b_path := filepath.Join(root, "b.db")
+
+	createReloadDatabase(t, a_path, 101737491)
+	createReloadDatabase(t, b_path, 101737491)
+
+	database_uri := fmt.Sprintf("sqlite-multi://%s?dsn=%s&dsn=%s&slow-query-threshold=1ns&slow-query-log=%s", DEFAULT_ENGINE, a_path, b_path, log_path)
+
+	db, err := database.NewSpatialDatabase(ctx, database_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new spatial database, %v", err)
+	}
+
+	multi_db := db.(*SQLiteMultiSpatialDatabase)
+
+	// Every database writes to the same slow query log
+
+	l := multi_db.databases[0].db.slow_query_log
+
+	if l == nil || multi_db.databases[1].db.slow_query_log != l {
+		t.Fatalf("Expected databases to share a slow query log")
+	}
+
+	c, err := geo.NewCoordinate(-71.330873, 46.852675)
+
+	if err != nil {
+		t.Fatalf("Failed to create new coordinate, %v", err)
+	}
+
+	_, err = db.PointInPolygon(ctx, c)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point in polygon query, %v", err)
+	}
+
+	err = db.Close(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to close database, %v", err)
+	}
+
+	fh, err := os.Open(log_path)
+
+	if err != nil {
+		t.Fatalf("Failed to open slow query log, %v", err)
+	}
+
+	defer fh.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(fh)
+
+	for scanner.Scan() {
+
+		var q SlowQuery
+
+		err := json.Unmarshal(scanner.Bytes(), &q)
+
+		if err != nil {
+			t.Fatalf("Failed to unmarshal slow query, %v", err)
+		}
+
+		count += 1
+	}
+
+	if count != 2 {
+		t.Fatalf("Expected 2 slow queries (one for each database), got %d", count)
+	}
+}
@@ -0,0 +1,115 @@
+// package stats provides methods for summarizing query latencies.
+package stats
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latencies is a struct for collecting query durations and deriving summary statistics from them. It is safe
+// for concurrent use.
+type Latencies struct {
+	mu     *sync.Mutex
+	values []time.Duration
+}
+
+// NewLatencies returns a new (and empty) `Latencies` instance.
+func NewLatencies() *Latencies {
+
+	l := &Latencies{
+		mu:     new(sync.Mutex),
+		values: make([]time.Duration, 0),
+	}
+
+	return l
+}
+
+// Add appends 'd' to the list of durations in 'l'.
+func (l *Latencies) Add(d time.Duration) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.values = append(l.values, d)
+}
+
+// Count returns the number of durations in 'l'.
+func (l *Latencies) Count() int {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.values)
+}
+
+// Summary returns a new `Summary` instance derived from the durations in 'l'.
+func (l *Latencies) Summary() *Summary {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := &Summary{
+		Count: len(l.values),
+	}
+
+	if s.Count == 0 {
+		return s
+	}
+
+	sorted := make([]time.Duration, len(l.values))
+	copy(sorted, l.values)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	total := time.Duration(0)
+
+	for _, d := range sorted {
+		total += d
+	}
+
+	s.Min = sorted[0]
+	s.Max = sorted[len(sorted)-1]
+	s.Mean = total / time.Duration(len(sorted))
+	s.P50 = percentile(sorted, 50)
+	s.P90 = percentile(sorted, 90)
+	s.P95 = percentile(sorted, 95)
+	s.P99 = percentile(sorted, 99)
+
+	return s
+}
+
+// Summary is a struct containing summary statistics for a set of durations.
+type Summary struct {
+	Count int           `json:"count"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+}
+
+// Write writes a single line, prefixed by 'label', describing 's' to 'wr'.
+func (s *Summary) Write(wr io.Writer, label string) error {
+	_, err := fmt.Fprintf(wr, "%s\tcount=%d\tmin=%v\tmean=%v\tp50=%v\tp90=%v\tp95=%v\tp99=%v\tmax=%v\n", label, s.Count, s.Min, s.Mean, s.P50, s.P90, s.P95, s.P99, s.Max)
+	return err
+}
+
+// percentile returns the 'p'th percentile, using the nearest-rank method, of 'sorted'.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+
+	rank := int(math.Ceil((p / 100.0) * float64(len(sorted))))
+
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
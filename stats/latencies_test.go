@@ -0,0 +1,33 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencies(t *testing.T) {
+
+	l := NewLatencies()
+
+	for i := 1; i <= 100; i++ {
+		l.Add(time.Duration(i) * time.Millisecond)
+	}
+
+	s := l.Summary()
+
+	tests := map[string][2]time.Duration{
+		"min":  {s.Min, 1 * time.Millisecond},
+		"max":  {s.Max, 100 * time.Millisecond},
+		"p50":  {s.P50, 50 * time.Millisecond},
+		"p95":  {s.P95, 95 * time.Millisecond},
+		"p99":  {s.P99, 99 * time.Millisecond},
+		"mean": {s.Mean, 50500 * time.Microsecond},
+	}
+
+	for label, v := range tests {
+
+		if v[0] != v[1] {
+			t.Fatalf("Unexpected value for %s: %v, expected %v", label, v[0], v[1])
+		}
+	}
+}
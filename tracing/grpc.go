@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// metadataCarrier implements the `propagation.TextMapCarrier` interface for gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+
+	values := metadata.MD(c).Get(key)
+
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+
+	keys := make([]string, 0, len(c))
+
+	for k, _ := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// UnaryServerInterceptor returns a `grpc.UnaryServerInterceptor` that extracts trace context from incoming request
+// metadata and starts a new server span for each request.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+
+		ctx, span := startServerSpan(ctx, info.FullMethod)
+		defer span.End()
+
+		rsp, err := handler(ctx, req)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		return rsp, err
+	}
+}
+
+// StreamServerInterceptor returns a `grpc.StreamServerInterceptor` that extracts trace context from incoming stream
+// metadata and starts a new server span for each stream.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+		ctx, span := startServerSpan(ss.Context(), info.FullMethod)
+		defer span.End()
+
+		wrapped_ss := &serverStream{
+			ServerStream: ss,
+			ctx:          ctx,
+		}
+
+		err := handler(srv, wrapped_ss)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		return err
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+func startServerSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+
+	md, ok := metadata.FromIncomingContext(ctx)
+
+	if ok {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	}
+
+	return otel.Tracer(TracerName).Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("rpc.method", method)),
+	)
+}
@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (wr *statusResponseWriter) WriteHeader(status int) {
+	wr.status = status
+	wr.ResponseWriter.WriteHeader(status)
+}
+
+func (wr *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return wr.ResponseWriter
+}
+
+// HTTPHandler returns a `http.Handler` instance that extracts trace context from incoming request headers and
+// starts a new server span, whose context is assigned to the request, before invoking 'next'.
+func HTTPHandler(next http.Handler) http.Handler {
+
+	fn := func(rsp http.ResponseWriter, req *http.Request) {
+
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+		span_name := fmt.Sprintf("%s %s", req.Method, req.URL.Path)
+
+		ctx, span := otel.Tracer(TracerName).Start(ctx, span_name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", req.Method),
+				attribute.String("url.path", req.URL.Path),
+			),
+		)
+
+		defer span.End()
+
+		status_wr := &statusResponseWriter{
+			ResponseWriter: rsp,
+			status:         http.StatusOK,
+		}
+
+		next.ServeHTTP(status_wr, req.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", status_wr.status))
+
+		if status_wr.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status_wr.status))
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHTTPHandler(t *testing.T) {
+
+	tp := sdktrace.NewTracerProvider()
+	defer tp.Shutdown(t.Context())
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(Propagator())
+
+	trace_id := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	var span_ctx trace.SpanContext
+
+	next := http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		span_ctx = trace.SpanFromContext(req.Context()).SpanContext()
+	})
+
+	req := httptest.NewRequest("GET", "/api/point-in-polygon", nil)
+	req.Header.Set("traceparent", "00-"+trace_id+"-00f067aa0ba902b7-01")
+
+	rsp := httptest.NewRecorder()
+
+	HTTPHandler(next).ServeHTTP(rsp, req)
+
+	if !span_ctx.IsValid() {
+		t.Fatalf("Expected valid span context")
+	}
+
+	if span_ctx.TraceID().String() != trace_id {
+		t.Fatalf("Expected trace ID %s, got %s", trace_id, span_ctx.TraceID().String())
+	}
+}
@@ -0,0 +1,130 @@
+// package tracing provides methods for configuring OpenTelemetry trace exporters and for propagating trace
+// context through the HTTP and gRPC servers that query SQLite spatial databases.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+// The name of the OpenTelemetry tracer used for spans created by this package.
+const TracerName string = "github.com/whosonfirst/go-whosonfirst-spatial-sqlite/tracing"
+
+// NewTracerProvider returns a new `sdktrace.TracerProvider` instance whose spans are written by the exporter
+// defined by 'uri' and assigns it (and a W3C trace context propagator) as the global OpenTelemetry defaults. It
+// also returns a function which shuts down the provider, flushing any pending spans, and releases the exporter's
+// resources (like open files); it should be called instead of the provider's own `Shutdown` method.
+// Valid URIs are:
+//   - stdout:// to write spans to STDOUT
+//   - stderr:// to write spans to STDERR
+//   - file:///path/to/file to append spans to a file on disk
+//
+// All URIs may take an optional '?pretty=true' query parameter to pretty-print exported spans.
+func NewTracerProvider(ctx context.Context, uri string, service_name string) (*sdktrace.TracerProvider, func(context.Context) error, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	exporter_opts := make([]stdouttrace.Option, 0)
+
+	q := u.Query()
+
+	if q.Has("pretty") {
+
+		pretty, err := strconv.ParseBool(q.Get("pretty"))
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid ?pretty= parameter, %w", err)
+		}
+
+		if pretty {
+			exporter_opts = append(exporter_opts, stdouttrace.WithPrettyPrint())
+		}
+	}
+
+	var wr io.Writer
+	var closer io.Closer
+
+	switch u.Scheme {
+	case "stdout":
+		wr = os.Stdout
+	case "stderr":
+		wr = os.Stderr
+	case "file":
+
+		fh, err := os.OpenFile(u.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to open %s for writing, %w", u.Path, err)
+		}
+
+		wr = fh
+		closer = fh
+	default:
+		return nil, nil, fmt.Errorf("Unsupported scheme '%s'", u.Scheme)
+	}
+
+	exporter_opts = append(exporter_opts, stdouttrace.WithWriter(wr))
+
+	exporter, err := stdouttrace.New(exporter_opts...)
+
+	if err != nil {
+
+		if closer != nil {
+			closer.Close()
+		}
+
+		return nil, nil, fmt.Errorf("Failed to create trace exporter, %w", err)
+	}
+
+	r := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service_name))
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(r),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(Propagator())
+
+	shutdown := func(ctx context.Context) error {
+
+		err := tp.Shutdown(ctx)
+
+		if err != nil {
+			return fmt.Errorf("Failed to shutdown tracer provider, %w", err)
+		}
+
+		if closer != nil {
+
+			err := closer.Close()
+
+			if err != nil {
+				return fmt.Errorf("Failed to close trace exporter, %w", err)
+			}
+		}
+
+		return nil
+	}
+
+	return tp, shutdown, nil
+}
+
+// Propagator returns the `propagation.TextMapPropagator` used to read and write trace context.
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestNewTracerProviderFile(t *testing.T) {
+
+	ctx := t.Context()
+
+	path := filepath.Join(t.TempDir(), "traces.json")
+
+	_, shutdown, err := NewTracerProvider(ctx, "file://"+path, "test")
+
+	if err != nil {
+		t.Fatalf("Failed to create tracer provider, %v", err)
+	}
+
+	_, span := otel.Tracer(TracerName).Start(ctx, "test-span")
+	span.End()
+
+	err = shutdown(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to shutdown tracer provider, %v", err)
+	}
+
+	body, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("Failed to read %s, %v", path, err)
+	}
+
+	if !strings.Contains(string(body), "test-span") {
+		t.Fatalf("Expected exported span in %s, got '%s'", path, body)
+	}
+
+	// The file has already been closed so shutting down again fails
+
+	err = shutdown(ctx)
+
+	if err == nil {
+		t.Fatalf("Expected second shutdown to fail")
+	}
+
+	_, _, err = NewTracerProvider(ctx, "file://"+path+"?pretty=invalid", "test")
+
+	if err == nil {
+		t.Fatalf("Expected invalid ?pretty= parameter to fail")
+	}
+}